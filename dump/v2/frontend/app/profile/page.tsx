@@ -3,6 +3,7 @@
 import { useAuth } from "@/components/auth-provider";
 import { useState, useEffect } from "react";
 import { redirect } from "next/navigation";
+import { apiFetch } from "@/lib/api/csrf";
 
 // components
 import { toast } from "sonner";
@@ -105,7 +106,7 @@ export default function Profile() {
     const handleDeleteAccount = async () => {
         setIsDeleting(true);
         try {
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/user`,
                 {
                     method: "DELETE",
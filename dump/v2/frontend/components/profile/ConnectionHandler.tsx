@@ -1,6 +1,7 @@
 "use client";
 
 import { useState, useEffect } from "react";
+import { apiFetch } from "@/lib/api/csrf";
 import * as Dialog from "@/components/ui/dialog";
 import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
@@ -27,7 +28,7 @@ export function ConnectionManager() {
 
     const fetchConnection = async () => {
         try {
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/connection`,
                 {
                     credentials: "include",
@@ -52,7 +53,7 @@ export function ConnectionManager() {
 
     const fetchPendingInvitations = async () => {
         try {
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/connection/pending`,
                 {
                     credentials: "include",
@@ -85,7 +86,7 @@ export function ConnectionManager() {
 
         setIsLoading(true);
         try {
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/connection/invite`,
                 {
                     method: "POST",
@@ -119,7 +120,7 @@ export function ConnectionManager() {
     const handleAcceptInvitation = async (invitationId: string) => {
         setIsLoading(true);
         try {
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/connection/${invitationId}/accept`,
                 {
                     method: "POST",
@@ -149,7 +150,7 @@ export function ConnectionManager() {
     const handleCancelInvitation = async (invitationId: string) => {
         setIsLoading(true);
         try {
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/connection/${invitationId}/reject`,
                 {
                     method: "POST",
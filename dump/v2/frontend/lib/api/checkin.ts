@@ -37,15 +37,19 @@ export interface PartnerCheckin {
 }
 
 import { BACKEND_URL } from "@/lib/utils";
+import { apiFetch } from "@/lib/api/csrf";
 
 // Get today's checkin
 export const getTodayCheckin = async (
     date?: string
 ): Promise<CheckinData | null> => {
     const checkinDate = date || new Date().toLocaleDateString("en-CA"); // YYYY-MM-DD
-    const response = await fetch(`${BACKEND_URL}/api/checkin/${checkinDate}`, {
-        credentials: "include",
-    });
+    const response = await apiFetch(
+        `${BACKEND_URL}/api/checkin/${checkinDate}`,
+        {
+            credentials: "include",
+        }
+    );
 
     if (response.status === 404) {
         return null; // no checkin today
@@ -63,7 +67,7 @@ export const getTodayCheckin = async (
 export const createCheckin = async (
     checkinData: Omit<CheckinData, "id" | "userId" | "createdAt">
 ): Promise<CheckinData> => {
-    const response = await fetch(`${BACKEND_URL}/api/checkin`, {
+    const response = await apiFetch(`${BACKEND_URL}/api/checkin`, {
         method: "POST",
         headers: {
             "Content-Type": "application/json",
@@ -82,7 +86,7 @@ export const createCheckin = async (
 
 // delete checkin for a specific date
 export const deleteCheckin = async (date: string): Promise<void> => {
-    const response = await fetch(`${BACKEND_URL}/api/checkin/${date}`, {
+    const response = await apiFetch(`${BACKEND_URL}/api/checkin/${date}`, {
         method: "DELETE",
         credentials: "include",
     });
@@ -100,7 +104,7 @@ export const getPartnerCheckin = async (
     date?: string
 ): Promise<PartnerCheckin | null> => {
     const checkinDate = date || new Date().toLocaleDateString("en-CA"); // YYYY-MM-DD
-    const response = await fetch(
+    const response = await apiFetch(
         `${BACKEND_URL}/api/checkin/partner/${checkinDate}`,
         {
             credentials: "include",
@@ -130,7 +134,7 @@ export const getPartnerCheckin = async (
 
 // just debugging lol
 export const debugConnection = async () => {
-    const response = await fetch(`${BACKEND_URL}/api/debug/connection`, {
+    const response = await apiFetch(`${BACKEND_URL}/api/debug/connection`, {
         credentials: "include",
     });
 
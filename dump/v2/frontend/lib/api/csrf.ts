@@ -0,0 +1,54 @@
+import { BACKEND_URL } from "@/lib/utils";
+
+// the go server turns away unsafe cookie requests without the session's csrf token
+const CSRF_HEADER = "X-CSRF-Token";
+
+const SAFE_METHODS = ["GET", "HEAD", "OPTIONS"];
+
+let csrfToken: Promise<string> | null = null;
+
+// fetches the token once per page load, it stays the same for the whole session
+function getCSRFToken(refresh = false): Promise<string> {
+    if (!csrfToken || refresh) {
+        csrfToken = fetch(`${BACKEND_URL}/api/auth/csrf`, {
+            credentials: "include",
+        })
+            .then((res) => {
+                if (!res.ok) {
+                    throw new Error(`Failed to fetch csrf token: ${res.status}`);
+                }
+                return res.json();
+            })
+            .then((data) => data.csrfToken as string)
+            .catch((error) => {
+                csrfToken = null;
+                throw error;
+            });
+    }
+    return csrfToken;
+}
+
+// apiFetch calls the go server with the session cookie
+// unsafe requests carry the csrf token, a rejected token is fetched again once
+// since the session behind it can change, for example on sign in
+export async function apiFetch(
+    input: string,
+    init: RequestInit = {}
+): Promise<Response> {
+    const method = (init.method ?? "GET").toUpperCase();
+    if (SAFE_METHODS.includes(method)) {
+        return fetch(input, { credentials: "include", ...init });
+    }
+
+    const send = async (refresh: boolean) => {
+        const headers = new Headers(init.headers);
+        headers.set(CSRF_HEADER, await getCSRFToken(refresh));
+        return fetch(input, { ...init, credentials: "include", headers });
+    };
+
+    const response = await send(false);
+    if (response.status !== 403) {
+        return response;
+    }
+    return send(true);
+}
@@ -1,4 +1,5 @@
 import { BACKEND_URL } from "@/lib/utils";
+import { apiFetch } from "@/lib/api/csrf";
 
 export interface Feedback {
     id: string;
@@ -13,7 +14,7 @@ export const submitFeedback = async (
     category: string
 ): Promise<any> => {
     try {
-        const response = await fetch(`${BACKEND_URL}/api/feedback`, {
+        const response = await apiFetch(`${BACKEND_URL}/api/feedback`, {
             method: "POST",
             headers: {
                 "Content-Type": "application/json",
@@ -46,7 +47,7 @@ export const submitFeedback = async (
 };
 
 export const getUserFeedback = async (): Promise<Feedback[]> => {
-    const response = await fetch(`${BACKEND_URL}/api/feedback`, {
+    const response = await apiFetch(`${BACKEND_URL}/api/feedback`, {
         credentials: "include",
     });
     if (!response.ok) {
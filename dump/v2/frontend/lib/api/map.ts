@@ -1,8 +1,9 @@
 import { DatePin } from "@/lib/types/map";
 import { BACKEND_URL } from "@/lib/utils";
+import { apiFetch } from "@/lib/api/csrf";
 
 export async function fetchPins(): Promise<DatePin[]> {
-    const res = await fetch(`${BACKEND_URL}/api/pins`, {
+    const res = await apiFetch(`${BACKEND_URL}/api/pins`, {
         credentials: "include",
     });
 
@@ -28,7 +29,7 @@ export async function savePin(payload: any, selectedPin?: DatePin) {
         ? JSON.stringify({ ...payload, id: selectedPin.id })
         : JSON.stringify(payload);
 
-    await fetch(url, {
+    await apiFetch(url, {
         method: "POST",
         credentials: "include",
         headers: { "Content-Type": "application/json" },
@@ -37,7 +38,7 @@ export async function savePin(payload: any, selectedPin?: DatePin) {
 }
 
 export async function editPin(id: string, payload: any): Promise<DatePin> {
-    const res = await fetch(
+    const res = await apiFetch(
         `${BACKEND_URL}/api/pins/${encodeURIComponent(id)}`,
         {
             method: "PUT",
@@ -69,7 +70,7 @@ export async function editPin(id: string, payload: any): Promise<DatePin> {
 }
 
 export async function deletePin(id: string) {
-    await fetch(`${BACKEND_URL}/api/pins/${id}`, {
+    await apiFetch(`${BACKEND_URL}/api/pins/${id}`, {
         method: "DELETE",
         credentials: "include",
     });
@@ -1,4 +1,5 @@
 import { BACKEND_URL } from "@/lib/utils";
+import { apiFetch } from "@/lib/api/csrf";
 import {
     PeriodDay,
     CycleSettings,
@@ -21,7 +22,7 @@ async function handleResponse<T>(response: Response): Promise<T> {
 
 // period days
 export async function getPeriodDays(): Promise<{ periodDays: PeriodDay[] }> {
-    const response = await fetch(`${API_BASE}/days`, {
+    const response = await apiFetch(`${API_BASE}/days`, {
         method: "GET",
         credentials: "include",
     });
@@ -32,7 +33,7 @@ export async function getPartnerPeriodDays(): Promise<{
     periodDays: PeriodDay[];
     partnerSex: string;
 }> {
-    const response = await fetch(`${API_BASE}/partner/days`, {
+    const response = await apiFetch(`${API_BASE}/partner/days`, {
         method: "GET",
         credentials: "include",
     });
@@ -44,7 +45,7 @@ export async function getPartnerPeriodDays(): Promise<{
 export async function createPeriodDay(
     data: CreatePeriodDayRequest
 ): Promise<PeriodDay> {
-    const response = await fetch(`${API_BASE}/days`, {
+    const response = await apiFetch(`${API_BASE}/days`, {
         method: "POST",
         headers: {
             "Content-Type": "application/json",
@@ -58,7 +59,7 @@ export async function createPeriodDay(
 export async function deletePeriodDay(
     date: string
 ): Promise<{ message: string }> {
-    const response = await fetch(`${API_BASE}/days/${date}`, {
+    const response = await apiFetch(`${API_BASE}/days/${date}`, {
         method: "DELETE",
         credentials: "include",
     });
@@ -69,7 +70,7 @@ export async function deletePeriodDay(
 export async function getCycleSettings(): Promise<{
     cycleSettings: CycleSettings;
 }> {
-    const response = await fetch(`${API_BASE}/settings`, {
+    const response = await apiFetch(`${API_BASE}/settings`, {
         method: "GET",
         credentials: "include",
     });
@@ -79,7 +80,7 @@ export async function getCycleSettings(): Promise<{
 export async function updateCycleSettings(
     data: UpdateCycleSettingsRequest
 ): Promise<{ cycleSettings: CycleSettings }> {
-    const response = await fetch(`${API_BASE}/settings`, {
+    const response = await apiFetch(`${API_BASE}/settings`, {
         method: "PUT",
         headers: {
             "Content-Type": "application/json",
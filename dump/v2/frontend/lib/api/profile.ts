@@ -1,3 +1,5 @@
+import { apiFetch } from "@/lib/api/csrf";
+
 export interface UserMetadata {
     id: string;
     userId: string;
@@ -12,7 +14,7 @@ const BACKEND_URL = process.env.NEXT_PUBLIC_BACKEND_URL;
 // get user metadata (sex)
 export const getUserMetadata = async (): Promise<UserMetadata | null> => {
     try {
-        const response = await fetch(`${BACKEND_URL}/api/user/metadata`, {
+        const response = await apiFetch(`${BACKEND_URL}/api/user/metadata`, {
             credentials: "include",
         });
 
@@ -48,7 +50,7 @@ export const getUserMetadata = async (): Promise<UserMetadata | null> => {
 export const updateUserMetadata = async (
     data: Partial<{ sex: "male" | "female"; startedDating: string }>
 ): Promise<UserMetadata> => {
-    const response = await fetch(`${BACKEND_URL}/api/user/metadata`, {
+    const response = await apiFetch(`${BACKEND_URL}/api/user/metadata`, {
         method: "PUT",
         headers: {
             "Content-Type": "application/json",
@@ -67,9 +69,12 @@ export const updateUserMetadata = async (
 
 // get partner metadata
 export const getPartnerMetadata = async (): Promise<UserMetadata | null> => {
-    const response = await fetch(`${BACKEND_URL}/api/user/partner/metadata`, {
-        credentials: "include",
-    });
+    const response = await apiFetch(
+        `${BACKEND_URL}/api/user/partner/metadata`,
+        {
+            credentials: "include",
+        }
+    );
 
     if (response.status === 404) {
         return null; // No partner or metadata found
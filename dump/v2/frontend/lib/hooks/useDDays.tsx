@@ -2,6 +2,7 @@ import { useEffect, useState } from "react";
 import { EventPosition, type DDay } from "@/lib/types/calendar";
 import { toast } from "sonner";
 import { calculateDDay } from "@/lib/utils";
+import { apiFetch } from "@/lib/api/csrf";
 
 // main hook for managing calendar events
 export function useDDays(currentDate: Date = new Date()) {
@@ -114,7 +115,7 @@ export function useDDays(currentDate: Date = new Date()) {
 
             const base =
                 process.env.NEXT_PUBLIC_BACKEND_URL || "http://localhost:5000";
-            const response = await fetch(`${base}/api/ddays?view=${view}`, {
+            const response = await apiFetch(`${base}/api/ddays?view=${view}`, {
                 credentials: "include",
             });
 
@@ -230,7 +231,7 @@ export function useDDays(currentDate: Date = new Date()) {
                 endDate: formatDateForAPI(dday.endDate),
             };
 
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/ddays`,
                 {
                     method: "POST",
@@ -271,7 +272,7 @@ export function useDDays(currentDate: Date = new Date()) {
                 payload.imageUrl = updates.imageUrl;
             }
 
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/ddays/${id}`,
                 {
                     method: "PUT",
@@ -298,7 +299,7 @@ export function useDDays(currentDate: Date = new Date()) {
         try {
             // get presigned URL from go
             // send the file size so go can enforce size limits (5MB max)
-            const presignedUrlResponse = await fetch(
+            const presignedUrlResponse = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/ddays/upload-url`,
                 {
                     method: "POST",
@@ -346,7 +347,7 @@ export function useDDays(currentDate: Date = new Date()) {
     // called by EditDdayDialog and DDayIndicator
     const deleteDDay = async (id: string): Promise<boolean> => {
         try {
-            const response = await fetch(
+            const response = await apiFetch(
                 `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/ddays/${id}`,
                 {
                     method: "DELETE",
@@ -1,4 +1,5 @@
 import { useState, useEffect, useCallback } from "react";
+import { apiFetch } from "@/lib/api/csrf";
 
 import { Idea } from "@/lib/types/ideas";
 
@@ -16,7 +17,7 @@ export function usePosts() {
     const fetchAllPosts = useCallback(async () => {
         setLoading(true);
         try {
-            const response = await fetch(`${backendUrl}/api/ideas/all`);
+            const response = await apiFetch(`${backendUrl}/api/ideas/all`);
             if (!response.ok) {
                 throw new Error(`Failed to fetch posts: ${response.status}`);
             }
@@ -42,7 +43,7 @@ export function usePosts() {
     const fetchPosts = useCallback(async () => {
         setLoading(true);
         try {
-            const response = await fetch(`${backendUrl}/api/ideas`, {
+            const response = await apiFetch(`${backendUrl}/api/ideas`, {
                 credentials: "include",
             });
             if (!response.ok) {
@@ -70,7 +71,7 @@ export function usePosts() {
     const addPost = async (newPostData: NewIdeaData): Promise<Idea | null> => {
         setLoading(true);
         try {
-            const response = await fetch(`${backendUrl}/api/ideas`, {
+            const response = await apiFetch(`${backendUrl}/api/ideas`, {
                 method: "POST",
                 headers: {
                     "Content-Type": "application/json",
@@ -107,13 +108,16 @@ export function usePosts() {
     ): Promise<Idea | null> => {
         setLoading(true);
         try {
-            const response = await fetch(`${backendUrl}/api/ideas/${postId}`, {
-                method: "PUT",
-                headers: {
-                    "Content-Type": "application/json",
-                },
-                body: JSON.stringify(updatedPostData),
-            });
+            const response = await apiFetch(
+                `${backendUrl}/api/ideas/${postId}`,
+                {
+                    method: "PUT",
+                    headers: {
+                        "Content-Type": "application/json",
+                    },
+                    body: JSON.stringify(updatedPostData),
+                }
+            );
             if (!response.ok) {
                 const errorData = await response.json();
                 throw new Error(
@@ -151,9 +155,12 @@ export function usePosts() {
     const deletePost = async (postId: string): Promise<boolean> => {
         setLoading(true);
         try {
-            const response = await fetch(`${backendUrl}/api/ideas/${postId}`, {
-                method: "DELETE",
-            });
+            const response = await apiFetch(
+                `${backendUrl}/api/ideas/${postId}`,
+                {
+                    method: "DELETE",
+                }
+            );
             if (!response.ok) {
                 const errorData = await response.json();
                 throw new Error(
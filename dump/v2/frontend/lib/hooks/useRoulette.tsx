@@ -1,4 +1,5 @@
 import { useState, useEffect, useCallback } from "react";
+import { apiFetch } from "@/lib/api/csrf";
 
 const backendUrl =
     process.env.NEXT_PUBLIC_BACKEND_URL || "http://localhost:5000";
@@ -8,7 +9,7 @@ export function useRoulette() {
 
     const fetchRoulette = useCallback(async () => {
         try {
-            const response = await fetch(`${backendUrl}/api/roulette`);
+            const response = await apiFetch(`${backendUrl}/api/roulette`);
             if (!response.ok) {
                 throw new Error(
                     `Failed to fetch rouletteItems: ${response.status}`
@@ -27,7 +28,7 @@ export function useRoulette() {
 
     const addRouletteItem = useCallback(async (item: string) => {
         try {
-            const response = await fetch(`${backendUrl}/api/roulette`, {
+            const response = await apiFetch(`${backendUrl}/api/roulette`, {
                 method: "POST",
                 headers: {
                     "Content-Type": "application/json",
@@ -0,0 +1,258 @@
+// Package accounts deletes accounts with everything that belongs to them
+// a deleted account is kept for a grace period in which it can be restored
+// after that the purge removes its data from every collection
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"calple/store"
+)
+
+// GracePeriod is how long a deleted account can be restored
+const GracePeriod = 30 * 24 * time.Hour
+
+// ErrNotDeleted is returned when restoring an account that is not deleted
+var ErrNotDeleted = errors.New("accounts: account is not deleted")
+
+// Images deletes the images a user uploaded by their public url, r2.Config implements it
+// images the user did not upload are left alone
+type Images interface {
+	DeleteImage(ctx context.Context, uid, url string) error
+}
+
+// PurgeAt is when the grace period of a deleted account ends
+func PurgeAt(u *store.User) time.Time {
+	return u.DeletedAt.Add(GracePeriod)
+}
+
+// Delete starts the grace period, the account is marked deleted and signed out everywhere
+// nothing else is touched so a restore brings everything back
+func Delete(ctx context.Context, st store.Store, uid string, now time.Time) (*store.User, error) {
+	user, err := st.Users().Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt.IsZero() {
+		user.DeletedAt = now
+		if err := st.Users().Save(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	if err := st.Sessions().DeleteByUser(ctx, uid, ""); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Restore ends the grace period of a deleted account
+func Restore(ctx context.Context, st store.Store, uid string) (*store.User, error) {
+	user, err := st.Users().Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt.IsZero() {
+		return nil, ErrNotDeleted
+	}
+	user.DeletedAt = time.Time{}
+	if err := st.Users().Save(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Purger removes the accounts whose grace period is over and the expired sessions
+type Purger struct {
+	Store store.Store
+	// deletes the dday images, nil leaves them in the bucket
+	Images Images
+}
+
+// Run purges the due accounts and the expired sessions every interval until ctx is done
+// every visit starts a session for the csrf token, signed in or not, so they pile up otherwise
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := p.PurgeDue(ctx, time.Now()); err != nil {
+			fmt.Printf("ERROR: Failed to purge deleted accounts: %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("DEBUG: Purged %d deleted accounts\n", n)
+		}
+		if n, err := p.Store.Sessions().DeleteExpired(ctx, time.Now()); err != nil {
+			fmt.Printf("ERROR: Failed to delete expired sessions: %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("DEBUG: Deleted %d expired sessions\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDue purges every account deleted more than GracePeriod before now
+// an account that fails is left for the next run and the others go on
+// returns how many accounts were purged and the first error
+func (p *Purger) PurgeDue(ctx context.Context, now time.Time) (int, error) {
+	due, err := p.Store.Users().ListDeleted(ctx, now.Add(-GracePeriod))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var firstErr error
+	for _, user := range due {
+		if err := p.Purge(ctx, user.ID); err != nil {
+			fmt.Printf("ERROR: Failed to purge account %s: %v\n", user.ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		purged++
+	}
+	return purged, firstErr
+}
+
+// Purge deletes the account and everything that belongs to it right away
+// every step can run again, so an interrupted purge is finished by the next one
+// the user document goes last so the account keeps showing up as due until then
+func (p *Purger) Purge(ctx context.Context, uid string) error {
+	st := p.Store
+	user, err := st.Users().Get(ctx, uid)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	steps := []struct {
+		name string
+		run  func(ctx context.Context, user *store.User) error
+	}{
+		{"sessions", p.purgeSessions},
+		{"api tokens", p.purgeTokens},
+		{"calendar feed", p.purgeFeed},
+		{"identities", p.purgeIdentities},
+		{"connections", p.purgeConnections},
+		{"ddays", p.purgeDDays},
+		{"ideas", p.purgeIdeas},
+	}
+	for _, step := range steps {
+		if err := step.run(ctx, user); err != nil {
+			return fmt.Errorf("purge %s: %w", step.name, err)
+		}
+	}
+
+	// periods, checkins, pins, bookmarks, feedback and the user document
+	if err := st.Users().Purge(ctx, uid); err != nil {
+		return fmt.Errorf("purge user: %w", err)
+	}
+	return nil
+}
+
+func (p *Purger) purgeSessions(ctx context.Context, user *store.User) error {
+	return p.Store.Sessions().DeleteByUser(ctx, user.ID, "")
+}
+
+func (p *Purger) purgeTokens(ctx context.Context, user *store.User) error {
+	tokens, err := p.Store.Tokens().ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := p.Store.Tokens().Delete(ctx, user.ID, token.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Purger) purgeFeed(ctx context.Context, user *store.User) error {
+	return p.Store.Feeds().Delete(ctx, user.ID)
+}
+
+// without its identities nobody can sign in to the account again
+func (p *Purger) purgeIdentities(ctx context.Context, user *store.User) error {
+	identities, err := p.Store.Identities().ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		err := p.Store.Identities().Unlink(ctx, user.ID, identity.Provider, identity.Subject)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removes the partner's side too, pending invitations included
+func (p *Purger) purgeConnections(ctx context.Context, user *store.User) error {
+	connections, err := p.Store.Connections().List(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, conn := range connections {
+		if err := p.Store.Connections().Remove(ctx, user.ID, conn.PartnerUID, conn.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the user's own events go with their images
+// events other people shared with the user stay but no longer list the user
+func (p *Purger) purgeDDays(ctx context.Context, user *store.User) error {
+	own, err := p.Store.DDays().ListByCreator(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, dday := range own {
+		// the image first, the url is only known from the event
+		if dday.ImageURL != "" && p.Images != nil {
+			if err := p.Images.DeleteImage(ctx, user.ID, dday.ImageURL); err != nil {
+				return fmt.Errorf("image of dday %s: %w", dday.ID, err)
+			}
+		}
+		if err := p.Store.DDays().Delete(ctx, dday.ID); err != nil {
+			return err
+		}
+	}
+
+	shared, err := p.Store.DDays().ListVisible(ctx, user.ID, "99991231")
+	if err != nil {
+		return err
+	}
+	for _, dday := range shared {
+		if dday.CreatorID == user.ID || !Unshare(&dday, user.ID) {
+			continue
+		}
+		dday.UpdatedAt = time.Now()
+		if err := p.Store.DDays().Update(ctx, &dday); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// posts go with their comments, and the user's comments on other posts go too
+func (p *Purger) purgeIdeas(ctx context.Context, user *store.User) error {
+	posts, err := p.Store.Ideas().ListByAuthor(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if err := p.Store.Ideas().Delete(ctx, user.ID, post.ID); err != nil {
+			return err
+		}
+	}
+	return p.Store.Ideas().DeleteCommentsByUser(ctx, user.ID)
+}
@@ -0,0 +1,221 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"calple/store"
+	"calple/store/memstore"
+	"calple/store/sqlstore"
+)
+
+const (
+	aliceID    = "alice-uid"
+	aliceEmail = "alice@example.com"
+	bobID      = "bob-uid"
+	bobEmail   = "bob@example.com"
+)
+
+// images records the deleted urls and fails while err is set
+type images struct {
+	deleted []string
+	err     error
+}
+
+func (im *images) DeleteImage(ctx context.Context, uid, url string) error {
+	if im.err != nil {
+		return im.err
+	}
+	im.deleted = append(im.deleted, uid+" "+url)
+	return nil
+}
+
+// the purge only uses the store interfaces, so it runs against every local backend
+func backends(t *testing.T) map[string]store.Store {
+	t.Helper()
+	sqlite, err := sqlstore.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "calple.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]store.Store{"memory": memstore.New(), "sqlite": sqlite}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// a connected couple where alice has something in every collection
+// returns the ID of bob's event shared with alice and of bob's post alice commented on
+func seed(t *testing.T, st store.Store) (sharedDDay, bobPost string) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, u := range []store.User{
+		{ID: aliceID, Email: aliceEmail, Name: "Alice", CreatedAt: now},
+		{ID: bobID, Email: bobEmail, Name: "Bob", CreatedAt: now},
+	} {
+		must(t, st.Users().Save(ctx, &u))
+	}
+	connID, err := st.Connections().Invite(ctx, aliceID, aliceEmail, bobID, bobEmail)
+	must(t, err)
+	must(t, st.Connections().Accept(ctx, bobID, aliceID, connID))
+
+	own := store.DDay{Title: "Trip", Date: "20250101", ImageURL: "https://pub-x.r2.dev/ddays/trip", CreatorID: aliceID, CreatedBy: aliceEmail,
+		ConnectedUsers: []string{bobEmail}, SharedWith: []string{bobID}, CreatedAt: now, UpdatedAt: now}
+	must(t, st.DDays().Create(ctx, &own))
+	shared := store.DDay{Title: "Concert", Date: "20250202", CreatorID: bobID, CreatedBy: bobEmail,
+		ConnectedUsers: []string{aliceEmail}, SharedWith: []string{aliceID}, CreatedAt: now, UpdatedAt: now}
+	must(t, st.DDays().Create(ctx, &shared))
+
+	must(t, st.Periods().SaveDay(ctx, aliceID, &store.PeriodDay{Date: "2025-01-01", IsPeriod: true, CreatedAt: now, UpdatedAt: now}))
+	must(t, st.Periods().SaveSettings(ctx, aliceID, &store.CycleSettings{CycleLength: 28, PeriodLength: 5, CreatedAt: now, UpdatedAt: now}))
+	must(t, st.Checkins().Save(ctx, aliceID, &store.Checkin{UserID: aliceID, Date: "2025-01-01", Mood: "happy", CreatedAt: now, UpdatedAt: now}))
+	must(t, st.Pins().Create(ctx, aliceID, &store.Pin{Title: "Cafe", CreatedAt: now, UpdatedAt: now}))
+	must(t, st.Feedback().Create(ctx, aliceID, &store.Feedback{FeedbackText: "hi", Category: "bug", SubmittedAt: now}))
+
+	alicePost := store.Idea{Title: "Picnic", Author: "Alice"}
+	must(t, st.Ideas().Create(ctx, aliceID, &alicePost))
+	must(t, st.Ideas().AddComment(ctx, bobID, alicePost.ID, &store.Comment{Author: "Bob", Content: "yes"}))
+	post := store.Idea{Title: "Museum", Author: "Bob"}
+	must(t, st.Ideas().Create(ctx, bobID, &post))
+	must(t, st.Ideas().AddComment(ctx, aliceID, post.ID, &store.Comment{Author: "Alice", Content: "fun"}))
+	must(t, st.Ideas().Bookmark(ctx, aliceID, post.ID))
+
+	must(t, st.Tokens().Create(ctx, &store.APIToken{UserID: aliceID, Name: "script", Hash: "hash", CreatedAt: now}))
+	must(t, st.Feeds().Save(ctx, &store.Feed{UserID: aliceID, Hash: "feed-hash", CreatedAt: now}))
+	must(t, st.Identities().Link(ctx, &store.Identity{Provider: "google", Subject: "sub", UserID: aliceID, CreatedAt: now, LastLoginAt: now}))
+	must(t, st.Sessions().Save(ctx, &store.Session{ID: "session", UserID: aliceID, Values: map[string]string{"user_id": aliceID},
+		CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}))
+	return shared.ID, post.ID
+}
+
+func TestDeleteAndRestore(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seed(t, st)
+			deletedAt := time.Now().UTC().Truncate(time.Second)
+
+			user, err := Delete(ctx, st, aliceID, deletedAt)
+			must(t, err)
+			if !PurgeAt(user).Equal(deletedAt.Add(GracePeriod)) {
+				t.Errorf("purge at %v", PurgeAt(user))
+			}
+			if sessions, _ := st.Sessions().ListByUser(ctx, aliceID); len(sessions) != 0 {
+				t.Errorf("sessions after delete: %+v", sessions)
+			}
+
+			// not due until the grace period is over
+			purger := &Purger{Store: st}
+			if n, err := purger.PurgeDue(ctx, deletedAt.Add(GracePeriod-time.Minute)); n != 0 || err != nil {
+				t.Fatalf("purged %d early: %v", n, err)
+			}
+
+			user, err = Restore(ctx, st, aliceID)
+			must(t, err)
+			if !user.DeletedAt.IsZero() {
+				t.Errorf("restored user still deleted: %v", user.DeletedAt)
+			}
+			if _, err := Restore(ctx, st, aliceID); !errors.Is(err, ErrNotDeleted) {
+				t.Errorf("second restore: %v", err)
+			}
+			if n, _ := purger.PurgeDue(ctx, deletedAt.Add(2*GracePeriod)); n != 0 {
+				t.Errorf("restored account was purged")
+			}
+			if pins, _ := st.Pins().List(ctx, aliceID); len(pins) != 1 {
+				t.Errorf("pins after restore: %+v", pins)
+			}
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			sharedDDay, bobPost := seed(t, st)
+			deletedAt := time.Now()
+			_, err := Delete(ctx, st, aliceID, deletedAt)
+			must(t, err)
+
+			// a failing image delete stops the purge before the event is lost
+			im := &images{err: errors.New("bucket down")}
+			purger := &Purger{Store: st, Images: im}
+			if n, err := purger.PurgeDue(ctx, deletedAt.Add(GracePeriod)); n != 0 || err == nil {
+				t.Fatalf("purge with failing images: %d, %v", n, err)
+			}
+			if own, _ := st.DDays().ListByCreator(ctx, aliceID); len(own) != 1 {
+				t.Fatalf("event deleted before its image: %+v", own)
+			}
+
+			// the next run picks it up again
+			im.err = nil
+			if n, err := purger.PurgeDue(ctx, deletedAt.Add(GracePeriod)); n != 1 || err != nil {
+				t.Fatalf("purged %d: %v", n, err)
+			}
+			if len(im.deleted) != 1 || im.deleted[0] != aliceID+" https://pub-x.r2.dev/ddays/trip" {
+				t.Errorf("deleted images %v", im.deleted)
+			}
+
+			if _, err := st.Users().Get(ctx, aliceID); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("user after purge: %v", err)
+			}
+			if conns, _ := st.Connections().List(ctx, bobID); len(conns) != 0 {
+				t.Errorf("partner connections: %+v", conns)
+			}
+			if own, _ := st.DDays().ListByCreator(ctx, aliceID); len(own) != 0 {
+				t.Errorf("own ddays: %+v", own)
+			}
+			shared, err := st.DDays().Get(ctx, sharedDDay)
+			must(t, err)
+			if len(shared.ConnectedUsers) != 0 || len(shared.SharedWith) != 0 {
+				t.Errorf("shared dday still has alice: %v %v", shared.ConnectedUsers, shared.SharedWith)
+			}
+
+			if days, _ := st.Periods().ListDays(ctx, aliceID); len(days) != 0 {
+				t.Errorf("period days: %+v", days)
+			}
+			if _, err := st.Periods().GetSettings(ctx, aliceID); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("cycle settings: %v", err)
+			}
+			if _, err := st.Checkins().GetByDate(ctx, aliceID, "2025-01-01"); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("checkin: %v", err)
+			}
+			if pins, _ := st.Pins().List(ctx, aliceID); len(pins) != 0 {
+				t.Errorf("pins: %+v", pins)
+			}
+			if feedback, _ := st.Feedback().ListByUser(ctx, aliceID); len(feedback) != 0 {
+				t.Errorf("feedback: %+v", feedback)
+			}
+			if bookmarks, _ := st.Ideas().ListBookmarks(ctx, aliceID); len(bookmarks) != 0 {
+				t.Errorf("bookmarks: %v", bookmarks)
+			}
+			if posts, _ := st.Ideas().List(ctx); len(posts) != 1 || posts[0].ID != bobPost {
+				t.Errorf("posts: %+v", posts)
+			}
+			if comments, _ := st.Ideas().ListComments(ctx, bobPost); len(comments) != 0 {
+				t.Errorf("alice's comment on bob's post: %+v", comments)
+			}
+			if tokens, _ := st.Tokens().ListByUser(ctx, aliceID); len(tokens) != 0 {
+				t.Errorf("tokens: %+v", tokens)
+			}
+			if _, err := st.Feeds().Get(ctx, aliceID); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("feed: %v", err)
+			}
+			if _, err := st.Identities().Get(ctx, "google", "sub"); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("identity: %v", err)
+			}
+
+			// purging again is a no-op
+			must(t, purger.Purge(ctx, aliceID))
+		})
+	}
+}
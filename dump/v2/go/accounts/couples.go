@@ -0,0 +1,71 @@
+package accounts
+
+import (
+	"context"
+	"slices"
+
+	"calple/store"
+)
+
+// ShareEvents shares every event created by owner with target, whose email is shown in connectedUsers
+func ShareEvents(ctx context.Context, st store.Store, owner, target, targetEmail string) error {
+	ddays, err := st.DDays().ListByCreator(ctx, owner)
+	if err != nil {
+		return err
+	}
+	for _, dday := range ddays {
+		if slices.Contains(dday.SharedWith, target) {
+			continue
+		}
+		dday.SharedWith = append(dday.SharedWith, target)
+		dday.ConnectedUsers = append(dday.ConnectedUsers, targetEmail)
+		if err := st.DDays().Update(ctx, &dday); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnshareEvents stops sharing every event created by owner with target
+func UnshareEvents(ctx context.Context, st store.Store, owner, target string) error {
+	ddays, err := st.DDays().ListByCreator(ctx, owner)
+	if err != nil {
+		return err
+	}
+	for _, dday := range ddays {
+		if !Unshare(&dday, target) {
+			continue
+		}
+		if err := st.DDays().Update(ctx, &dday); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unshare removes uid and their email from the event, false if it was not shared with them
+func Unshare(dday *store.DDay, uid string) bool {
+	i := slices.Index(dday.SharedWith, uid)
+	if i < 0 {
+		return false
+	}
+	dday.SharedWith = slices.Delete(dday.SharedWith, i, i+1)
+	if i < len(dday.ConnectedUsers) {
+		dday.ConnectedUsers = slices.Delete(dday.ConnectedUsers, i, i+1)
+	}
+	return true
+}
+
+// Disconnect removes the connection from both users and stops sharing their events with each other
+// a connection without a partner ID is only removed from the user
+func Disconnect(ctx context.Context, st store.Store, uid string, conn *store.Connection) error {
+	if conn.PartnerUID != "" {
+		if err := UnshareEvents(ctx, st, uid, conn.PartnerUID); err != nil {
+			return err
+		}
+		if err := UnshareEvents(ctx, st, conn.PartnerUID, uid); err != nil {
+			return err
+		}
+	}
+	return st.Connections().Remove(ctx, uid, conn.PartnerUID, conn.ID)
+}
@@ -0,0 +1,104 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+
+	"calple/store"
+)
+
+// ErrEmailTaken is returned when the new email belongs to another account
+var ErrEmailTaken = errors.New("accounts: email belongs to another account")
+
+// the email and password identity uses the email as its subject
+const emailProvider = "email"
+
+// ChangeEmail moves the account to a new email, the caller has proven the user owns it
+// partners and shared events reference the user by ID, only the emails shown next to them are updated
+// every step can run again, so a change that failed halfway is finished by retrying it
+func ChangeEmail(ctx context.Context, st store.Store, uid, email string) (*store.User, error) {
+	user, err := st.Users().Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	other, err := st.Users().GetByEmail(ctx, email)
+	if err == nil && other.ID != uid {
+		return nil, ErrEmailTaken
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	// the identity moves first, a retry finds it under the old email as long as the user has it
+	if err := moveEmailIdentity(ctx, st, uid, user.Email, email); err != nil {
+		return nil, err
+	}
+	user.Email = email
+	if err := st.Users().Save(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := relabelDDays(ctx, st, uid, email); err != nil {
+		return nil, err
+	}
+	if err := st.Connections().SetPartnerEmail(ctx, uid, email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// the password stays with the account, it is linked under the new email
+func moveEmailIdentity(ctx context.Context, st store.Store, uid, prev, email string) error {
+	if prev == email {
+		return nil
+	}
+	ident, err := st.Identities().Get(ctx, emailProvider, prev)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ident.UserID != uid {
+		return nil
+	}
+
+	moved := *ident
+	moved.Subject = email
+	moved.Email = email
+	if err := st.Identities().Link(ctx, &moved); err != nil {
+		return err
+	}
+	err = st.Identities().Unlink(ctx, uid, emailProvider, prev)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// the emails on events are display data, changing them does not count as an edit
+func relabelDDays(ctx context.Context, st store.Store, uid, email string) error {
+	ddays, err := st.DDays().ListVisible(ctx, uid, "99991231")
+	if err != nil {
+		return err
+	}
+	for _, dday := range ddays {
+		changed := false
+		if dday.CreatorID == uid && dday.CreatedBy != email {
+			dday.CreatedBy = email
+			changed = true
+		}
+		for i, id := range dday.SharedWith {
+			if id == uid && i < len(dday.ConnectedUsers) && dday.ConnectedUsers[i] != email {
+				dday.ConnectedUsers[i] = email
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := st.DDays().Update(ctx, &dday); err != nil {
+			return err
+		}
+	}
+	return nil
+}
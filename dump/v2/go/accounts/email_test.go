@@ -0,0 +1,119 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"calple/store"
+)
+
+func TestChangeEmail(t *testing.T) {
+	const newEmail = "alice@new.example.com"
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			sharedDDay, _ := seed(t, st)
+			now := time.Now().UTC().Truncate(time.Second)
+			must(t, st.Identities().Link(ctx, &store.Identity{Provider: "email", Subject: aliceEmail, UserID: aliceID,
+				Email: aliceEmail, PasswordHash: "hash", CreatedAt: now, LastLoginAt: now}))
+
+			if _, err := ChangeEmail(ctx, st, aliceID, bobEmail); !errors.Is(err, ErrEmailTaken) {
+				t.Fatalf("change to bob's email: %v", err)
+			}
+
+			user, err := ChangeEmail(ctx, st, aliceID, newEmail)
+			must(t, err)
+			if user.Email != newEmail {
+				t.Errorf("user email = %s", user.Email)
+			}
+			// running it again changes nothing
+			_, err = ChangeEmail(ctx, st, aliceID, newEmail)
+			must(t, err)
+
+			if _, err := st.Identities().Get(ctx, "email", aliceEmail); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("old email identity: %v", err)
+			}
+			ident, err := st.Identities().Get(ctx, "email", newEmail)
+			must(t, err)
+			if ident.UserID != aliceID || ident.PasswordHash != "hash" {
+				t.Errorf("moved identity = %+v", ident)
+			}
+
+			own, _ := st.DDays().ListByCreator(ctx, aliceID)
+			if len(own) != 1 || own[0].CreatedBy != newEmail || !own[0].UpdatedAt.Equal(now) {
+				t.Errorf("own ddays = %+v", own)
+			}
+			shared, err := st.DDays().Get(ctx, sharedDDay)
+			must(t, err)
+			if len(shared.SharedWith) != 1 || shared.SharedWith[0] != aliceID || shared.ConnectedUsers[0] != newEmail {
+				t.Errorf("shared dday = %v %v", shared.SharedWith, shared.ConnectedUsers)
+			}
+			if visible, _ := st.DDays().ListVisible(ctx, bobID, "99991231"); len(visible) != 2 {
+				t.Errorf("bob sees %d ddays", len(visible))
+			}
+
+			conns, _ := st.Connections().List(ctx, bobID)
+			if len(conns) != 1 || conns[0].PartnerEmail != newEmail || conns[0].PartnerUID != aliceID {
+				t.Errorf("bob's connection = %+v", conns)
+			}
+		})
+	}
+}
+
+// a store whose identity links fail while fail is set
+type failingLinks struct {
+	store.Store
+	fail bool
+}
+
+func (s *failingLinks) Identities() store.IdentityRepo {
+	return failingLinkRepo{s.Store.Identities(), s}
+}
+
+type failingLinkRepo struct {
+	store.IdentityRepo
+	s *failingLinks
+}
+
+func (r failingLinkRepo) Link(ctx context.Context, ident *store.Identity) error {
+	if r.s.fail {
+		return errors.New("link failed")
+	}
+	return r.IdentityRepo.Link(ctx, ident)
+}
+
+// a change that failed to move the identity keeps the old email, so running it again moves it
+func TestChangeEmailRetry(t *testing.T) {
+	const newEmail = "alice@new.example.com"
+	for name, backend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seed(t, backend)
+			st := &failingLinks{Store: backend, fail: true}
+			now := time.Now().UTC().Truncate(time.Second)
+			must(t, backend.Identities().Link(ctx, &store.Identity{Provider: "email", Subject: aliceEmail, UserID: aliceID,
+				Email: aliceEmail, PasswordHash: "hash", CreatedAt: now, LastLoginAt: now}))
+
+			if _, err := ChangeEmail(ctx, st, aliceID, newEmail); err == nil {
+				t.Fatal("change with a failing link succeeded")
+			}
+			if user, _ := st.Users().Get(ctx, aliceID); user.Email != aliceEmail {
+				t.Fatalf("email after the failed change = %s", user.Email)
+			}
+
+			st.fail = false
+			_, err := ChangeEmail(ctx, st, aliceID, newEmail)
+			must(t, err)
+			ident, err := st.Identities().Get(ctx, "email", newEmail)
+			must(t, err)
+			if ident.UserID != aliceID || ident.PasswordHash != "hash" {
+				t.Errorf("moved identity = %+v", ident)
+			}
+			if _, err := st.Identities().Get(ctx, "email", aliceEmail); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("old email identity: %v", err)
+			}
+		})
+	}
+}
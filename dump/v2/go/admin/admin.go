@@ -0,0 +1,173 @@
+// Package admin holds the operator tasks behind calplectl
+// looking up users and couples, fixing connections, answering feedback, moderating ideas
+// and checking the data for documents that lost their other half
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"calple/accounts"
+	"calple/mailer"
+	"calple/store"
+)
+
+var (
+	// ErrNotConnected is returned when disconnecting a user without an active connection
+	ErrNotConnected = errors.New("admin: user has no active connection")
+	// ErrNotPending is returned when resending or cancelling a connection that was already accepted
+	ErrNotPending = errors.New("admin: connection is not a pending invitation")
+)
+
+// UserInfo is a user with what is linked to their account
+type UserInfo struct {
+	User       *store.User
+	Identities []store.Identity
+	Sessions   []store.Session
+	Tokens     []store.APIToken
+}
+
+// LookupUser finds the user by email, the email is matched lowercased like sign in does
+func LookupUser(ctx context.Context, st store.Store, email string) (*UserInfo, error) {
+	user, err := st.Users().GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, err
+	}
+	info := &UserInfo{User: user}
+	if info.Identities, err = st.Identities().ListByUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if info.Sessions, err = st.Sessions().ListByUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if info.Tokens, err = st.Tokens().ListByUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ConnectionInfo is one of the user's connection documents next to the partner's side of it
+type ConnectionInfo struct {
+	Connection store.Connection
+	// nil when the partner's user document is gone
+	Partner *store.User
+	// the partner's copy of the connection, nil when it is missing
+	Mirror *store.Connection
+}
+
+// Connections returns every connection of the user, active and pending, with both sides
+func Connections(ctx context.Context, st store.Store, uid string) ([]ConnectionInfo, error) {
+	conns, err := st.Connections().List(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ConnectionInfo, 0, len(conns))
+	for _, conn := range conns {
+		info := ConnectionInfo{Connection: conn}
+		if conn.PartnerUID != "" {
+			if info.Partner, err = optional(st.Users().Get(ctx, conn.PartnerUID)); err != nil {
+				return nil, err
+			}
+			if info.Mirror, err = optional(st.Connections().Get(ctx, conn.PartnerUID, conn.ID)); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// ForceDisconnect ends the user's active connection for both partners like RejectInvitation does
+func ForceDisconnect(ctx context.Context, st store.Store, uid string) (*store.Connection, error) {
+	conn, err := st.Connections().Active(ctx, uid)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotConnected
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := accounts.Disconnect(ctx, st, uid, conn); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ResendInvitation mails the invited user of a pending connection, uid may be either side of it
+// frontendURL is where the invitation can be accepted
+func ResendInvitation(ctx context.Context, st store.Store, m mailer.Mailer, frontendURL, uid, id string) error {
+	conn, err := pending(ctx, st, uid, id)
+	if err != nil {
+		return err
+	}
+	inviterID, inviteeID := uid, conn.PartnerUID
+	if conn.Role == store.RoleReceiver {
+		inviterID, inviteeID = conn.PartnerUID, uid
+	}
+	inviter, err := st.Users().Get(ctx, inviterID)
+	if err != nil {
+		return fmt.Errorf("inviting user: %w", err)
+	}
+	invitee, err := st.Users().Get(ctx, inviteeID)
+	if err != nil {
+		return fmt.Errorf("invited user: %w", err)
+	}
+
+	from := inviter.Email
+	if inviter.Name != "" {
+		from = inviter.Name + " (" + inviter.Email + ")"
+	}
+	return m.Send(ctx, mailer.Message{
+		To:      invitee.Email,
+		Subject: "You are invited to connect on Calple",
+		Body: from + " invited you to connect on Calple and share your calendars.\n\n" +
+			"Sign in to accept or decline the invitation: " + frontendURL,
+	})
+}
+
+// CancelInvitation removes a pending connection from both users, uid may be either side of it
+func CancelInvitation(ctx context.Context, st store.Store, uid, id string) error {
+	conn, err := pending(ctx, st, uid, id)
+	if err != nil {
+		return err
+	}
+	return st.Connections().Remove(ctx, uid, conn.PartnerUID, conn.ID)
+}
+
+func pending(ctx context.Context, st store.Store, uid, id string) (*store.Connection, error) {
+	conn, err := st.Connections().Get(ctx, uid, id)
+	if err != nil {
+		return nil, err
+	}
+	if conn.Status != store.StatusPending {
+		return nil, ErrNotPending
+	}
+	return conn, nil
+}
+
+// DeletePost removes a post with its comments and the author's copy of it
+func DeletePost(ctx context.Context, st store.Store, postID string) error {
+	uid, err := st.Ideas().Author(ctx, postID)
+	if err != nil {
+		return err
+	}
+	return st.Ideas().Delete(ctx, uid, postID)
+}
+
+// DeleteComment removes a comment from the post and from its author's comments
+func DeleteComment(ctx context.Context, st store.Store, postID, commentID string) error {
+	uid, err := st.Ideas().CommentAuthor(ctx, postID, commentID)
+	if err != nil {
+		return err
+	}
+	return st.Ideas().DeleteComment(ctx, uid, postID, commentID)
+}
+
+// optional turns ErrNotFound into a nil result
+func optional[T any](v *T, err error) (*T, error) {
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return v, err
+}
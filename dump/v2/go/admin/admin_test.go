@@ -0,0 +1,246 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"calple/mailer"
+	"calple/store"
+	"calple/store/memstore"
+	"calple/store/sqlstore"
+)
+
+const (
+	aliceID    = "alice-uid"
+	aliceEmail = "alice@example.com"
+	bobID      = "bob-uid"
+	bobEmail   = "bob@example.com"
+	carolID    = "carol-uid"
+	carolEmail = "carol@example.com"
+)
+
+// outbox records the sent messages
+type outbox struct {
+	sent []mailer.Message
+}
+
+func (o *outbox) Send(ctx context.Context, msg mailer.Message) error {
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+// the tasks only use the store interfaces, so they run against every local backend
+func backends(t *testing.T) map[string]store.Store {
+	t.Helper()
+	sqlite, err := sqlstore.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "calple.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]store.Store{"memory": memstore.New(), "sqlite": sqlite}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// alice and bob are connected and share an event, carol has invited alice
+// returns the active and the pending connection IDs
+func seed(t *testing.T, st store.Store) (active, invite string) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, u := range []store.User{
+		{ID: aliceID, Email: aliceEmail, Name: "Alice", CreatedAt: now},
+		{ID: bobID, Email: bobEmail, Name: "Bob", CreatedAt: now},
+		{ID: carolID, Email: carolEmail, Name: "Carol", CreatedAt: now},
+	} {
+		must(t, st.Users().Save(ctx, &u))
+	}
+	active, err := st.Connections().Invite(ctx, aliceID, aliceEmail, bobID, bobEmail)
+	must(t, err)
+	must(t, st.Connections().Accept(ctx, bobID, aliceID, active))
+	invite, err = st.Connections().Invite(ctx, carolID, carolEmail, aliceID, aliceEmail)
+	must(t, err)
+
+	must(t, st.DDays().Create(ctx, &store.DDay{Title: "Trip", Date: "20250101", CreatorID: aliceID, CreatedBy: aliceEmail,
+		ConnectedUsers: []string{bobEmail}, SharedWith: []string{bobID}, CreatedAt: now, UpdatedAt: now}))
+	return active, invite
+}
+
+func TestCouples(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			active, invite := seed(t, st)
+
+			info, err := LookupUser(ctx, st, " Alice@Example.com ")
+			must(t, err)
+			if info.User.ID != aliceID {
+				t.Fatalf("lookup found %s, want %s", info.User.ID, aliceID)
+			}
+
+			conns, err := Connections(ctx, st, aliceID)
+			must(t, err)
+			if len(conns) != 2 {
+				t.Fatalf("alice has %d connections, want 2", len(conns))
+			}
+			for _, info := range conns {
+				if info.Partner == nil || info.Mirror == nil || info.Mirror.Status != info.Connection.Status {
+					t.Errorf("connection %s: partner %v, mirror %v", info.Connection.ID, info.Partner, info.Mirror)
+				}
+			}
+
+			// the invitation goes to alice whichever side asks for it
+			out := &outbox{}
+			must(t, ResendInvitation(ctx, st, out, "https://calple.test", carolID, invite))
+			must(t, ResendInvitation(ctx, st, out, "https://calple.test", aliceID, invite))
+			for _, msg := range out.sent {
+				if msg.To != aliceEmail || !strings.Contains(msg.Body, carolEmail) {
+					t.Errorf("invitation mail to %s: %q", msg.To, msg.Body)
+				}
+			}
+			if err := ResendInvitation(ctx, st, out, "", aliceID, active); !errors.Is(err, ErrNotPending) {
+				t.Errorf("resending an active connection: %v, want ErrNotPending", err)
+			}
+			if err := CancelInvitation(ctx, st, aliceID, active); !errors.Is(err, ErrNotPending) {
+				t.Errorf("cancelling an active connection: %v, want ErrNotPending", err)
+			}
+			must(t, CancelInvitation(ctx, st, aliceID, invite))
+			if _, err := st.Connections().Get(ctx, carolID, invite); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("carol's side of the cancelled invitation: %v", err)
+			}
+
+			conn, err := ForceDisconnect(ctx, st, bobID)
+			must(t, err)
+			if conn.ID != active {
+				t.Errorf("disconnected %s, want %s", conn.ID, active)
+			}
+			if _, err := st.Connections().Get(ctx, aliceID, active); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("alice's side after the disconnect: %v", err)
+			}
+			ddays, err := st.DDays().ListByCreator(ctx, aliceID)
+			must(t, err)
+			if len(ddays) != 1 || len(ddays[0].SharedWith) != 0 {
+				t.Errorf("alice's event is still shared: %+v", ddays)
+			}
+			if _, err := ForceDisconnect(ctx, st, bobID); !errors.Is(err, ErrNotConnected) {
+				t.Errorf("second disconnect: %v, want ErrNotConnected", err)
+			}
+		})
+	}
+}
+
+func TestFeedbackAndModeration(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seed(t, st)
+			now := time.Now().UTC().Truncate(time.Second)
+
+			must(t, st.Feedback().Create(ctx, bobID, &store.Feedback{FeedbackText: "later", Category: "bug", SubmittedAt: now}))
+			first := store.Feedback{FeedbackText: "first", Category: "idea", SubmittedAt: now.Add(-time.Hour)}
+			must(t, st.Feedback().Create(ctx, aliceID, &first))
+			must(t, st.Feedback().SetAdminComment(ctx, aliceID, first.ID, "thanks"))
+			if err := st.Feedback().SetAdminComment(ctx, bobID, first.ID, "wrong user"); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("reply to another user's feedback: %v, want ErrNotFound", err)
+			}
+
+			all, err := st.Feedback().List(ctx)
+			must(t, err)
+			if len(all) != 2 || all[0].ID != first.ID || all[0].UserID != aliceID || all[0].AdminComment != "thanks" || all[1].UserID != bobID {
+				t.Errorf("feedback list: %+v", all)
+			}
+
+			post := store.Idea{Title: "Picnic", Author: "Bob"}
+			must(t, st.Ideas().Create(ctx, bobID, &post))
+			keep := store.Comment{Author: "Bob", Content: "bring snacks"}
+			must(t, st.Ideas().AddComment(ctx, bobID, post.ID, &keep))
+			spam := store.Comment{Author: "Alice", Content: "spam"}
+			must(t, st.Ideas().AddComment(ctx, aliceID, post.ID, &spam))
+
+			must(t, DeleteComment(ctx, st, post.ID, spam.ID))
+			mine, err := st.Ideas().ListCommentsByUser(ctx, aliceID)
+			must(t, err)
+			comments, err := st.Ideas().ListComments(ctx, post.ID)
+			must(t, err)
+			if len(mine) != 0 || len(comments) != 1 || comments[0].ID != keep.ID {
+				t.Errorf("after deleting the comment: alice has %d, post has %+v", len(mine), comments)
+			}
+			if err := DeleteComment(ctx, st, post.ID, spam.ID); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("deleting the comment again: %v, want ErrNotFound", err)
+			}
+
+			must(t, DeletePost(ctx, st, post.ID))
+			ideas, err := st.Ideas().List(ctx)
+			must(t, err)
+			posts, err := st.Ideas().ListByAuthor(ctx, bobID)
+			must(t, err)
+			if len(ideas) != 0 || len(posts) != 0 {
+				t.Errorf("after deleting the post: %d ideas, %d in bob's posts", len(ideas), len(posts))
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			active, invite := seed(t, st)
+			now := time.Now().UTC()
+
+			// a clean tree has nothing to report
+			problems, err := Check(ctx, st)
+			must(t, err)
+			if len(problems) != 0 {
+				t.Fatalf("problems in the seed: %+v", problems)
+			}
+
+			// bob lost his side of the couple, carol's account went without her connections and events
+			must(t, st.Connections().Remove(ctx, bobID, "", active))
+			must(t, st.DDays().Create(ctx, &store.DDay{Title: "Gone", CreatorID: carolID, CreatedAt: now, UpdatedAt: now}))
+			must(t, st.Users().Delete(ctx, carolID))
+
+			problems, err = Check(ctx, st)
+			must(t, err)
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.Kind+" "+p.UserID)
+			}
+			slices.Sort(got)
+			want := []string{
+				OneSidedConnection + " " + aliceID,
+				OrphanedConnection + " " + aliceID, // carol's invitation
+				OrphanedConnection + " " + carolID,
+				OrphanedDDay + " " + carolID,
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("problems\n got %v\nwant %v", got, want)
+			}
+
+			fixed, err := Fix(ctx, st, problems)
+			must(t, err)
+			if fixed != 3 {
+				t.Errorf("fixed %d documents, want 3", fixed)
+			}
+			if _, err := st.Connections().Get(ctx, aliceID, invite); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("alice's side of carol's invitation: %v", err)
+			}
+			problems, err = Check(ctx, st)
+			must(t, err)
+			if len(problems) != 1 || problems[0].Kind != OrphanedDDay {
+				t.Errorf("after the fix: %+v", problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package admin
+
+import (
+	"context"
+	"errors"
+
+	"calple/store"
+)
+
+// kinds of problems Check finds
+const (
+	// a connection document whose owner or partner user no longer exists
+	OrphanedConnection = "orphaned-connection"
+	// a connection document the partner has no copy of
+	OneSidedConnection = "one-sided-connection"
+	// an event whose creator no longer exists
+	OrphanedDDay = "orphaned-dday"
+)
+
+// events are read in pages of this size
+const checkPageSize = 500
+
+// Problem is a document Check found inconsistent
+type Problem struct {
+	Kind string
+	// the user whose connection it is, the creator for events
+	UserID string
+	// the connection or event ID
+	ID     string
+	Detail string
+}
+
+// Check looks for connection documents and events that lost their other half
+// usually left behind by a purge or a disconnect that failed halfway
+func Check(ctx context.Context, st store.Store) ([]Problem, error) {
+	problems, err := checkConnections(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	ddays, err := checkDDays(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	return append(problems, ddays...), nil
+}
+
+func checkConnections(ctx context.Context, st store.Store) ([]Problem, error) {
+	owners, err := st.Connections().Owners(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists := userCache(ctx, st)
+
+	problems := []Problem{}
+	for _, uid := range owners {
+		conns, err := st.Connections().List(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := exists(uid)
+		if err != nil {
+			return nil, err
+		}
+		for _, conn := range conns {
+			if !ok {
+				problems = append(problems, Problem{OrphanedConnection, uid, conn.ID, "user no longer exists"})
+				continue
+			}
+			if conn.PartnerUID == "" {
+				problems = append(problems, Problem{OrphanedConnection, uid, conn.ID, "no partner ID, partner email " + conn.PartnerEmail})
+				continue
+			}
+			partnerOK, err := exists(conn.PartnerUID)
+			if err != nil {
+				return nil, err
+			}
+			if !partnerOK {
+				problems = append(problems, Problem{OrphanedConnection, uid, conn.ID, "partner " + conn.PartnerUID + " no longer exists"})
+				continue
+			}
+			_, err = st.Connections().Get(ctx, conn.PartnerUID, conn.ID)
+			if errors.Is(err, store.ErrNotFound) {
+				problems = append(problems, Problem{OneSidedConnection, uid, conn.ID, "partner " + conn.PartnerUID + " has no copy"})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return problems, nil
+}
+
+func checkDDays(ctx context.Context, st store.Store) ([]Problem, error) {
+	exists := userCache(ctx, st)
+
+	problems := []Problem{}
+	after := ""
+	for {
+		page, err := st.DDays().List(ctx, after, checkPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, dday := range page {
+			ok, err := exists(dday.CreatorID)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case dday.CreatorID == "":
+				problems = append(problems, Problem{OrphanedDDay, "", dday.ID, "no creator ID, created by " + dday.CreatedBy})
+			case !ok:
+				problems = append(problems, Problem{OrphanedDDay, dday.CreatorID, dday.ID, "creator no longer exists, title " + dday.Title})
+			}
+		}
+		if len(page) < checkPageSize {
+			return problems, nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// Fix removes the connection documents Check reported, only the reported side of each
+// events are left alone, they may hold shares and images worth a look before deleting them
+// returns how many documents were removed
+func Fix(ctx context.Context, st store.Store, problems []Problem) (int, error) {
+	fixed := 0
+	for _, p := range problems {
+		if p.Kind != OrphanedConnection && p.Kind != OneSidedConnection {
+			continue
+		}
+		if err := st.Connections().Remove(ctx, p.UserID, "", p.ID); err != nil {
+			return fixed, err
+		}
+		fixed++
+	}
+	return fixed, nil
+}
+
+// userCache reads every user at most once
+func userCache(ctx context.Context, st store.Store) func(uid string) (bool, error) {
+	seen := map[string]bool{}
+	return func(uid string) (bool, error) {
+		if uid == "" {
+			return false, nil
+		}
+		if ok, found := seen[uid]; found {
+			return ok, nil
+		}
+		_, err := st.Users().Get(ctx, uid)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return false, err
+		}
+		seen[uid] = err == nil
+		return err == nil, nil
+	}
+}
@@ -0,0 +1,249 @@
+// Package caldav reads the WebDAV and CalDAV (RFC 4918, RFC 4791) request bodies calendar apps send
+// and writes the multistatus responses they expect
+// only what syncing one calendar needs is here: PROPFIND, calendar-query and calendar-multiget
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// the namespaces of the properties, CalendarServer has the ctag most apps poll
+const (
+	NSDAV            = "DAV:"
+	NSCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	NSCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// the properties and elements the server knows
+var (
+	ResourceType         = xml.Name{Space: NSDAV, Local: "resourcetype"}
+	DisplayName          = xml.Name{Space: NSDAV, Local: "displayname"}
+	GetETag              = xml.Name{Space: NSDAV, Local: "getetag"}
+	GetContentType       = xml.Name{Space: NSDAV, Local: "getcontenttype"}
+	GetLastModified      = xml.Name{Space: NSDAV, Local: "getlastmodified"}
+	CurrentUserPrincipal = xml.Name{Space: NSDAV, Local: "current-user-principal"}
+	PrincipalURL         = xml.Name{Space: NSDAV, Local: "principal-URL"}
+	PrivilegeSet         = xml.Name{Space: NSDAV, Local: "current-user-privilege-set"}
+	SupportedReportSet   = xml.Name{Space: NSDAV, Local: "supported-report-set"}
+	Collection           = xml.Name{Space: NSDAV, Local: "collection"}
+	Principal            = xml.Name{Space: NSDAV, Local: "principal"}
+	Privilege            = xml.Name{Space: NSDAV, Local: "privilege"}
+	Read                 = xml.Name{Space: NSDAV, Local: "read"}
+	Write                = xml.Name{Space: NSDAV, Local: "write"}
+	SupportedReport      = xml.Name{Space: NSDAV, Local: "supported-report"}
+	Report               = xml.Name{Space: NSDAV, Local: "report"}
+	Href                 = xml.Name{Space: NSDAV, Local: "href"}
+
+	PropFind = xml.Name{Space: NSDAV, Local: "propfind"}
+	prop     = xml.Name{Space: NSDAV, Local: "prop"}
+	allProp  = xml.Name{Space: NSDAV, Local: "allprop"}
+	propName = xml.Name{Space: NSDAV, Local: "propname"}
+
+	Calendar               = xml.Name{Space: NSCalDAV, Local: "calendar"}
+	CalendarData           = xml.Name{Space: NSCalDAV, Local: "calendar-data"}
+	CalendarHomeSet        = xml.Name{Space: NSCalDAV, Local: "calendar-home-set"}
+	CalendarUserAddressSet = xml.Name{Space: NSCalDAV, Local: "calendar-user-address-set"}
+	SupportedComponentSet  = xml.Name{Space: NSCalDAV, Local: "supported-calendar-component-set"}
+	CalendarQuery          = xml.Name{Space: NSCalDAV, Local: "calendar-query"}
+	CalendarMultiget       = xml.Name{Space: NSCalDAV, Local: "calendar-multiget"}
+	timeRange              = xml.Name{Space: NSCalDAV, Local: "time-range"}
+	GetCTag                = xml.Name{Space: NSCalendarServer, Local: "getctag"}
+)
+
+// ErrInvalid is returned for request bodies that are not XML
+var ErrInvalid = errors.New("caldav: invalid request body")
+
+// Request is a PROPFIND or REPORT body
+type Request struct {
+	// Kind is the root element, PropFind for an empty body
+	Kind xml.Name
+	// AllProp is set for allprop, propname and empty bodies, Props lists the asked for properties otherwise
+	AllProp bool
+	Props   []xml.Name
+	// Hrefs are the resources a calendar-multiget asks for
+	Hrefs []string
+	// Start and End are the time-range of a calendar-query, zero when open
+	Start, End time.Time
+}
+
+// ParseRequest reads a request body, an empty body asks for every property
+func ParseRequest(r io.Reader) (*Request, error) {
+	req := &Request{}
+	dec := xml.NewDecoder(r)
+	var path []xml.Name
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case len(path) == 0:
+				req.Kind = t.Name
+			case len(path) == 2 && path[1] == prop:
+				req.Props = append(req.Props, t.Name)
+			case t.Name == allProp || t.Name == propName:
+				req.AllProp = true
+			case t.Name == timeRange:
+				for _, attr := range t.Attr {
+					value, err := time.Parse("20060102T150405Z", attr.Value)
+					if err != nil {
+						return nil, fmt.Errorf("%w: time-range %s %q", ErrInvalid, attr.Name.Local, attr.Value)
+					}
+					switch attr.Name.Local {
+					case "start":
+						req.Start = value
+					case "end":
+						req.End = value
+					}
+				}
+			}
+			path = append(path, t.Name)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if len(path) == 2 && t.Name == Href {
+				req.Hrefs = append(req.Hrefs, strings.TrimSpace(text.String()))
+			}
+			path = path[:len(path)-1]
+		}
+	}
+
+	if req.Kind == (xml.Name{}) {
+		req.Kind = PropFind
+		req.AllProp = true
+	}
+	return req, nil
+}
+
+// Wants reports if the response should have the property
+// calendar-data is big and only sent when it is asked for by name
+func (r *Request) Wants(name xml.Name) bool {
+	if r.AllProp {
+		return name != CalendarData
+	}
+	return slices.Contains(r.Props, name)
+}
+
+// Response is one resource of a multistatus
+type Response struct {
+	Href string
+	// Props are the values of the properties the resource has, as inner XML
+	Props map[xml.Name]string
+	// NotFound is set for the hrefs of a multiget that are not resources
+	NotFound bool
+}
+
+// WriteMultistatus writes the responses with the properties req asks for
+// the asked for properties a resource does not have are listed as not found
+func WriteMultistatus(w io.Writer, req *Request, responses []Response) error {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<D:multistatus xmlns:D=%q xmlns:C=%q xmlns:CS=%q>`, NSDAV, NSCalDAV, NSCalendarServer)
+	for _, res := range responses {
+		b.WriteString("<D:response>")
+		b.WriteString(Element(Href, EscapeHref(res.Href)))
+		if res.NotFound {
+			b.WriteString(Element(xml.Name{Space: NSDAV, Local: "status"}, status(http.StatusNotFound)))
+			b.WriteString("</D:response>")
+			continue
+		}
+
+		var found, missing []xml.Name
+		if req.AllProp {
+			for name := range res.Props {
+				if req.Wants(name) {
+					found = append(found, name)
+				}
+			}
+			slices.SortFunc(found, func(a, b xml.Name) int {
+				return strings.Compare(a.Space+a.Local, b.Space+b.Local)
+			})
+		} else {
+			for _, name := range req.Props {
+				if _, ok := res.Props[name]; ok {
+					found = append(found, name)
+				} else {
+					missing = append(missing, name)
+				}
+			}
+		}
+		writePropstat(&b, found, res.Props, http.StatusOK)
+		writePropstat(&b, missing, nil, http.StatusNotFound)
+		b.WriteString("</D:response>")
+	}
+	b.WriteString("</D:multistatus>")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writePropstat(b *bytes.Buffer, names []xml.Name, values map[xml.Name]string, code int) {
+	if len(names) == 0 {
+		return
+	}
+	b.WriteString("<D:propstat><D:prop>")
+	for _, name := range names {
+		b.WriteString(Element(name, values[name]))
+	}
+	b.WriteString("</D:prop>")
+	b.WriteString(Element(xml.Name{Space: NSDAV, Local: "status"}, status(code)))
+	b.WriteString("</D:propstat>")
+}
+
+func status(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+var prefixes = map[string]string{NSDAV: "D", NSCalDAV: "C", NSCalendarServer: "CS"}
+
+// Element writes name around the inner XML, elements of other namespaces declare theirs
+func Element(name xml.Name, inner string) string {
+	open, tag := name.Local, name.Local
+	if prefix, ok := prefixes[name.Space]; ok {
+		open, tag = prefix+":"+name.Local, prefix+":"+name.Local
+	} else if name.Space != "" {
+		open = fmt.Sprintf("%s xmlns=%q", name.Local, name.Space)
+	}
+	if inner == "" {
+		return "<" + open + "/>"
+	}
+	return "<" + open + ">" + inner + "</" + tag + ">"
+}
+
+// Comp names a component type in supported-calendar-component-set
+func Comp(name string) string {
+	return fmt.Sprintf(`<C:comp name=%q/>`, name)
+}
+
+// Text escapes s for use as inner XML
+func Text(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// EscapeHref escapes each segment of a path and the result for use as inner XML
+func EscapeHref(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return Text(strings.Join(segments, "/"))
+}
@@ -0,0 +1,100 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRequest(t *testing.T) {
+	req, err := ParseRequest(strings.NewReader(`<?xml version="1.0"?>
+<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/" xmlns:a="http://apple.com/ns/ical/">
+  <d:prop><d:resourcetype/><cs:getctag/><a:calendar-color/></d:prop>
+</d:propfind>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []xml.Name{ResourceType, GetCTag, {Space: "http://apple.com/ns/ical/", Local: "calendar-color"}}
+	if req.Kind != PropFind || req.AllProp || !slices.Equal(req.Props, want) {
+		t.Errorf("propfind = %+v", req)
+	}
+
+	req, err = ParseRequest(strings.NewReader(""))
+	if err != nil || req.Kind != PropFind || !req.AllProp || req.Wants(CalendarData) || !req.Wants(GetETag) {
+		t.Errorf("empty body = %+v, %v", req, err)
+	}
+
+	req, err = ParseRequest(strings.NewReader(`<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data><C:comp name="VCALENDAR"><C:comp name="VEVENT"/></C:comp></C:calendar-data></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+    <C:time-range start="20250701T000000Z" end="20250801T000000Z"/>
+  </C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Kind != CalendarQuery || !slices.Equal(req.Props, []xml.Name{GetETag, CalendarData}) ||
+		!req.Start.Equal(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)) || !req.End.Equal(time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("calendar-query = %+v", req)
+	}
+
+	req, err = ParseRequest(strings.NewReader(`<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/></D:prop>
+  <D:href>/caldav/ddays/a.ics</D:href>
+  <D:href> /caldav/ddays/b%20c.ics </D:href>
+</C:calendar-multiget>`))
+	if err != nil || req.Kind != CalendarMultiget || !slices.Equal(req.Hrefs, []string{"/caldav/ddays/a.ics", "/caldav/ddays/b%20c.ics"}) {
+		t.Errorf("calendar-multiget = %+v, %v", req, err)
+	}
+
+	for _, body := range []string{`<D:propfind xmlns:D="DAV:">`, `<C:calendar-query xmlns:C="urn:ietf:params:xml:ns:caldav"><C:time-range start="tomorrow"/></C:calendar-query>`} {
+		if _, err := ParseRequest(strings.NewReader(body)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("ParseRequest(%q) = %v", body, err)
+		}
+	}
+}
+
+func TestWriteMultistatus(t *testing.T) {
+	color := xml.Name{Space: "http://apple.com/ns/ical/", Local: "calendar-color"}
+	req := &Request{Kind: PropFind, Props: []xml.Name{ResourceType, DisplayName, color}}
+	responses := []Response{
+		{Href: "/caldav/ddays/", Props: map[xml.Name]string{
+			ResourceType: Element(Collection, "") + Element(Calendar, ""),
+			DisplayName:  Text("us & them"),
+			GetCTag:      "1",
+		}},
+		{Href: "/caldav/ddays/a b.ics", NotFound: true},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteMultistatus(&buf, req, responses); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<D:response><D:href>/caldav/ddays/</D:href><D:propstat><D:prop><D:resourcetype><D:collection/><C:calendar/></D:resourcetype><D:displayname>us &amp; them</D:displayname></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>`,
+		`<D:propstat><D:prop><calendar-color xmlns="http://apple.com/ns/ical/"/></D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat></D:response>`,
+		`<D:response><D:href>/caldav/ddays/a%20b.ics</D:href><D:status>HTTP/1.1 404 Not Found</D:status></D:response>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("multistatus is missing %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "getctag") {
+		t.Errorf("property that was not asked for:\n%s", out)
+	}
+
+	// the output is XML the decoder reads back
+	var ms struct {
+		Responses []struct {
+			Href string `xml:"href"`
+		} `xml:"response"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &ms); err != nil || len(ms.Responses) != 2 {
+		t.Errorf("unmarshal: %+v, %v", ms, err)
+	}
+}
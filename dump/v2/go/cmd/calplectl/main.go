@@ -0,0 +1,401 @@
+// calplectl runs operator tasks against the store the server is configured with
+//
+//	calplectl <command> [flags] [args] [-- server flags]
+//
+// the server flags, like -storage or -config, come after -- and the environment works as for the server
+// run calplectl without a command for the list of commands
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"calple/admin"
+	"calple/server"
+	"calple/store"
+)
+
+// env is what every command gets
+type env struct {
+	ctx context.Context
+	cfg *server.Config
+	st  store.Store
+}
+
+type command struct {
+	usage string
+	help  string
+	// the number of positional arguments
+	args int
+	// flags adds the command's flags to fs, nil for none
+	flags func(fs *flag.FlagSet) func(e *env, args []string) error
+	run   func(e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"user": {
+		usage: "user <email>", help: "show the account, its sign in methods, sessions and tokens", args: 1,
+		run: showUser,
+	},
+	"connection": {
+		usage: "connection <email>", help: "show every connection of the user with the partner's side of it", args: 1,
+		run: showConnections,
+	},
+	"disconnect": {
+		usage: "disconnect <email>", help: "end the user's active connection for both partners and unshare their events", args: 1,
+		run: disconnect,
+	},
+	"resend-invitation": {
+		usage: "resend-invitation <email> <connection id>", help: "mail a pending invitation to the invited user again", args: 2,
+		run: resendInvitation,
+	},
+	"cancel-invitation": {
+		usage: "cancel-invitation <email> <connection id>", help: "remove a pending invitation from both users", args: 2,
+		run: cancelInvitation,
+	},
+	"feedback": {
+		usage: "feedback [-open]", help: "list the feedback of every user, oldest first",
+		flags: listFeedback,
+	},
+	"reply": {
+		usage: "reply <user id> <feedback id> <comment>", help: "set the admin comment shown with the feedback", args: 3,
+		run: replyFeedback,
+	},
+	"ideas": {
+		usage: "ideas", help: "list the idea posts",
+		run: listIdeas,
+	},
+	"post": {
+		usage: "post <post id>", help: "show a post with its comments", args: 1,
+		run: showPost,
+	},
+	"delete-post": {
+		usage: "delete-post <post id>", help: "remove a post with its comments", args: 1,
+		run: deletePost,
+	},
+	"delete-comment": {
+		usage: "delete-comment <post id> <comment id>", help: "remove a comment", args: 2,
+		run: deleteComment,
+	},
+	"check": {
+		usage: "check [-fix]", help: "look for orphaned and one-sided connections and events whose creator is gone",
+		flags: check,
+	},
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	// the server flags follow --, split them off before the command parses its own
+	args, serverArgs := os.Args[2:], []string{}
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, serverArgs = args[:i], args[i+1:]
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: calplectl %s [-- server flags]\n%s\n", cmd.usage, cmd.help)
+		fs.PrintDefaults()
+	}
+	run := cmd.run
+	if cmd.flags != nil {
+		run = cmd.flags(fs)
+	}
+	fs.Parse(args)
+	if fs.NArg() != cmd.args {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := server.LoadConfig(serverArgs)
+	if err != nil {
+		fatal(err)
+	}
+	ctx := context.Background()
+	st, err := server.OpenStore(ctx, cfg)
+	if err != nil {
+		fatal(err)
+	}
+	defer st.Close()
+
+	if err := run(&env{ctx: ctx, cfg: cfg, st: st}, fs.Args()); err != nil {
+		fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: calplectl <command> [flags] [args] [-- server flags]")
+	fmt.Fprintln(os.Stderr)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%s\n", commands[name].usage, commands[name].help)
+	}
+	w.Flush()
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "ERROR:", err)
+	os.Exit(1)
+}
+
+func showUser(e *env, args []string) error {
+	info, err := admin.LookupUser(e.ctx, e.st, args[0])
+	if err != nil {
+		return lookupErr(args[0], err)
+	}
+	u := info.User
+	w := table()
+	fmt.Fprintf(w, "id\t%s\n", u.ID)
+	fmt.Fprintf(w, "email\t%s\n", u.Email)
+	fmt.Fprintf(w, "name\t%s\n", u.Name)
+	fmt.Fprintf(w, "started dating\t%s\n", u.StartedDating)
+	fmt.Fprintf(w, "created\t%s\n", formatTime(u.CreatedAt))
+	fmt.Fprintf(w, "last login\t%s\n", formatTime(u.LastLoginAt))
+	if !u.DeletedAt.IsZero() {
+		fmt.Fprintf(w, "deleted\t%s\n", formatTime(u.DeletedAt))
+	}
+	for _, ident := range info.Identities {
+		fmt.Fprintf(w, "identity\t%s %s (%s), last login %s\n", ident.Provider, ident.Subject, ident.Email, formatTime(ident.LastLoginAt))
+	}
+	now := time.Now()
+	for _, s := range info.Sessions {
+		state := "active"
+		if !s.ExpiresAt.After(now) {
+			state = "expired"
+		}
+		fmt.Fprintf(w, "session\t%s, %s, last seen %s from %s\n", state, s.UserAgent, formatTime(s.LastSeenAt), s.IP)
+	}
+	for _, t := range info.Tokens {
+		fmt.Fprintf(w, "token\t%s (%s...) %s, last used %s\n", t.Name, t.Prefix, strings.Join(t.Scopes, ","), formatTime(t.LastUsedAt))
+	}
+	return w.Flush()
+}
+
+func showConnections(e *env, args []string) error {
+	user, err := lookup(e, args[0])
+	if err != nil {
+		return err
+	}
+	conns, err := admin.Connections(e.ctx, e.st, user.ID)
+	if err != nil {
+		return err
+	}
+	if len(conns) == 0 {
+		fmt.Printf("%s has no connections\n", user.Email)
+		return nil
+	}
+
+	w := table()
+	fmt.Fprintln(w, "ID\tSTATUS\tROLE\tPARTNER\tPARTNER SIDE\tUPDATED")
+	for _, info := range conns {
+		conn := info.Connection
+		partner := conn.PartnerEmail + " (missing)"
+		if info.Partner != nil {
+			partner = info.Partner.Email
+		}
+		mirror := "missing"
+		if info.Mirror != nil {
+			mirror = info.Mirror.Status + " " + info.Mirror.Role
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", conn.ID, conn.Status, conn.Role, partner, mirror, formatTime(conn.UpdatedAt))
+	}
+	return w.Flush()
+}
+
+func disconnect(e *env, args []string) error {
+	user, err := lookup(e, args[0])
+	if err != nil {
+		return err
+	}
+	conn, err := admin.ForceDisconnect(e.ctx, e.st, user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("disconnected %s from %s (connection %s)\n", user.Email, conn.PartnerEmail, conn.ID)
+	return nil
+}
+
+func resendInvitation(e *env, args []string) error {
+	user, err := lookup(e, args[0])
+	if err != nil {
+		return err
+	}
+	if err := admin.ResendInvitation(e.ctx, e.st, e.cfg.Mailer(), e.cfg.FrontendURL, user.ID, args[1]); err != nil {
+		return err
+	}
+	fmt.Printf("invitation %s sent again\n", args[1])
+	return nil
+}
+
+func cancelInvitation(e *env, args []string) error {
+	user, err := lookup(e, args[0])
+	if err != nil {
+		return err
+	}
+	if err := admin.CancelInvitation(e.ctx, e.st, user.ID, args[1]); err != nil {
+		return err
+	}
+	fmt.Printf("invitation %s cancelled\n", args[1])
+	return nil
+}
+
+func listFeedback(fs *flag.FlagSet) func(e *env, args []string) error {
+	open := fs.Bool("open", false, "only the feedback without an admin comment")
+	return func(e *env, args []string) error {
+		feedback, err := e.st.Feedback().List(e.ctx)
+		if err != nil {
+			return err
+		}
+		for _, f := range feedback {
+			if *open && f.AdminComment != "" {
+				continue
+			}
+			fmt.Printf("%s  user %s  feedback %s  [%s]\n", formatTime(f.SubmittedAt), f.UserID, f.ID, f.Category)
+			fmt.Printf("    %s\n", f.FeedbackText)
+			if f.AdminComment != "" {
+				fmt.Printf("    reply: %s\n", f.AdminComment)
+			}
+		}
+		return nil
+	}
+}
+
+func replyFeedback(e *env, args []string) error {
+	if err := e.st.Feedback().SetAdminComment(e.ctx, args[0], args[1], args[2]); err != nil {
+		return err
+	}
+	fmt.Printf("replied to feedback %s\n", args[1])
+	return nil
+}
+
+func listIdeas(e *env, args []string) error {
+	ideas, err := e.st.Ideas().List(e.ctx)
+	if err != nil {
+		return err
+	}
+	w := table()
+	fmt.Fprintln(w, "ID\tCREATED\tAUTHOR\tLIKES\tTITLE")
+	for _, idea := range ideas {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", idea.ID, idea.CreatedAt, idea.Author, idea.Likes, idea.Title)
+	}
+	return w.Flush()
+}
+
+func showPost(e *env, args []string) error {
+	ideas, err := e.st.Ideas().List(e.ctx)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(ideas, func(idea store.Idea) bool { return idea.ID == args[0] })
+	if i < 0 {
+		return fmt.Errorf("post %s: %w", args[0], store.ErrNotFound)
+	}
+	idea := ideas[i]
+	fmt.Printf("%s by %s, %s, %d likes\n", idea.Title, idea.Author, idea.CreatedAt, idea.Likes)
+	fmt.Printf("    %s\n", idea.Description)
+
+	comments, err := e.st.Ideas().ListComments(e.ctx, idea.ID)
+	if err != nil {
+		return err
+	}
+	for _, cm := range comments {
+		fmt.Printf("comment %s by %s, %s\n    %s\n", cm.ID, cm.Author, cm.CreatedAt, cm.Content)
+	}
+	return nil
+}
+
+func deletePost(e *env, args []string) error {
+	if err := admin.DeletePost(e.ctx, e.st, args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("deleted post %s\n", args[0])
+	return nil
+}
+
+func deleteComment(e *env, args []string) error {
+	if err := admin.DeleteComment(e.ctx, e.st, args[0], args[1]); err != nil {
+		return err
+	}
+	fmt.Printf("deleted comment %s\n", args[1])
+	return nil
+}
+
+func check(fs *flag.FlagSet) func(e *env, args []string) error {
+	fix := fs.Bool("fix", false, "remove the orphaned and one-sided connection documents, events are only reported")
+	return func(e *env, args []string) error {
+		problems, err := admin.Check(e.ctx, e.st)
+		if err != nil {
+			return err
+		}
+		if len(problems) == 0 {
+			fmt.Println("no problems found")
+			return nil
+		}
+		w := table()
+		fmt.Fprintln(w, "KIND\tUSER\tID\tDETAIL")
+		for _, p := range problems {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Kind, p.UserID, p.ID, p.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if !*fix {
+			return nil
+		}
+		fixed, err := admin.Fix(e.ctx, e.st, problems)
+		fmt.Printf("removed %d connection documents\n", fixed)
+		return err
+	}
+}
+
+func lookup(e *env, email string) (*store.User, error) {
+	user, err := e.st.Users().GetByEmail(e.ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, lookupErr(email, err)
+	}
+	return user, nil
+}
+
+func lookupErr(email string, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("no user with email %s", email)
+	}
+	return err
+}
+
+func table() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
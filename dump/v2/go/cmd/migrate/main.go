@@ -0,0 +1,110 @@
+// migrate runs the data migrations against the store the server is configured with
+//
+//	migrate [-dry-run] [-only name,...] [-redo] [-batch n] [-status] [-rollback version] [-- server flags]
+//
+// the server flags, like -storage or -config, come after -- and the environment works as for the server
+// opening the store applies its schema migrations first, as starting the server would
+// -rollback then reverts the sql schema migrations newer than version, 0 for an empty database
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+
+	"calple/migrate"
+	"calple/server"
+	"calple/store/sqlstore"
+)
+
+func main() {
+	_ = godotenv.Load()
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "count the changes without writing them")
+	only := fs.String("only", "", "comma separated migrations to run instead of all of them")
+	redo := fs.Bool("redo", false, "run finished migrations again from the first user")
+	batch := fs.Int("batch", migrate.DefaultBatchSize, "users per batch, progress is recorded after each")
+	status := fs.Bool("status", false, "list the migrations and how far they got, then exit")
+	rollback := fs.Int("rollback", -1, "revert the sql schema to this version, then exit")
+	fs.Parse(os.Args[1:])
+
+	cfg, err := server.LoadConfig(fs.Args())
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx := context.Background()
+	st, err := server.OpenStore(ctx, cfg)
+	if err != nil {
+		fatal(err)
+	}
+	defer st.Close()
+
+	if *rollback >= 0 {
+		sqlStore, ok := st.(*sqlstore.Store)
+		if !ok {
+			fatal(fmt.Errorf("-rollback needs the sqlite storage, not %s", cfg.Storage))
+		}
+		if err := sqlStore.Rollback(ctx, *rollback); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("schema reverted to version %d\n", *rollback)
+		return
+	}
+
+	if *status {
+		runs, err := migrate.Status(ctx, st, migrate.Migrations)
+		if err != nil {
+			fatal(err)
+		}
+		for i, m := range migrate.Migrations {
+			state := "pending"
+			if run := runs[i]; run != nil && !run.FinishedAt.IsZero() {
+				state = fmt.Sprintf("finished %s, %d users, %d changed", run.FinishedAt.Format("2006-01-02 15:04"), run.Users, run.Changed)
+			} else if run != nil {
+				state = fmt.Sprintf("stopped after user %s, %d users, %d changed", run.Cursor, run.Users, run.Changed)
+			}
+			fmt.Printf("%s  %s\n    %s\n", m.Name, state, m.Description)
+		}
+		return
+	}
+
+	opts := migrate.Options{
+		DryRun:    *dryRun,
+		Redo:      *redo,
+		BatchSize: *batch,
+		Progress:  os.Stdout,
+	}
+	if *only != "" {
+		opts.Only = strings.Split(*only, ",")
+	}
+	if opts.DryRun {
+		fmt.Println("DRY RUN: nothing is written")
+	}
+
+	results, err := migrate.Run(ctx, st, migrate.Migrations, opts)
+	for i, res := range results {
+		switch {
+		case res.Finished:
+			fmt.Printf("%s: already finished\n", res.Name)
+		case err != nil && i == len(results)-1:
+			// the next run resumes after the last recorded batch
+			fmt.Printf("%s: stopped, %d users, %d changed\n", res.Name, res.Users, res.Changed)
+		default:
+			fmt.Printf("%s: done, %d users, %d changed\n", res.Name, res.Users, res.Changed)
+		}
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "ERROR:", err)
+	os.Exit(1)
+}
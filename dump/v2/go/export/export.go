@@ -0,0 +1,345 @@
+// Package export builds the archive of everything calple stores for a user
+// every collection is written as json, the tabular ones also as csv for spreadsheets
+// and the json of the user's own records can be imported again
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"calple/r2"
+	"calple/store"
+)
+
+// Images opens uploaded images by their public url, r2.Config implements it
+// urls that are not uploads of the app fail with r2.ErrNotInBucket and are only referenced in ddays.json
+type Images interface {
+	OpenImage(ctx context.Context, url string) (io.ReadCloser, error)
+}
+
+// Manifest is manifest.json, the index of the archive
+type Manifest struct {
+	UserID     string    `json:"userId"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Files      []string  `json:"files"`
+	// images that could not be read from the bucket, their urls are still in ddays.json
+	MissingImages []string `json:"missingImages"`
+}
+
+// archive adds files to the zip and remembers their names for the manifest
+type archive struct {
+	zw       *zip.Writer
+	manifest Manifest
+}
+
+func (a *archive) create(name string) (io.Writer, error) {
+	a.manifest.Files = append(a.manifest.Files, name)
+	return a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.manifest.ExportedAt})
+}
+
+func (a *archive) json(name string, v any) error {
+	w, err := a.create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (a *archive) csv(name string, header []string, rows [][]string) error {
+	w, err := a.create(name)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// Write writes the zip with everything stored for the user to w
+// the images the user uploaded for their ddays are included when images is not nil
+func Write(ctx context.Context, st store.Store, images Images, uid string, w io.Writer) error {
+	user, err := st.Users().Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	a := &archive{
+		zw: zip.NewWriter(w),
+		manifest: Manifest{
+			UserID:        uid,
+			ExportedAt:    time.Now().UTC(),
+			MissingImages: []string{},
+		},
+	}
+	sections := []func(context.Context, store.Store, *store.User, *archive) error{
+		writeAccount,
+		writeConnections,
+		writeDDays,
+		writePeriods,
+		writeCheckins,
+		writePins,
+		writeIdeas,
+		writeFeedback,
+	}
+	for _, section := range sections {
+		if err := section(ctx, st, user, a); err != nil {
+			return err
+		}
+	}
+	if images != nil {
+		if err := writeImages(ctx, st, images, user, a); err != nil {
+			return err
+		}
+	}
+
+	if err := a.json("manifest.json", a.manifest); err != nil {
+		return err
+	}
+	return a.zw.Close()
+}
+
+// profile, sign in providers, devices and api tokens
+// secrets (oauth tokens, password and token hashes) are never part of the models' json
+func writeAccount(ctx context.Context, st store.Store, user *store.User, a *archive) error {
+	if err := a.json("profile.json", user); err != nil {
+		return err
+	}
+
+	identities, err := st.Identities().ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("identities.json", identities); err != nil {
+		return err
+	}
+
+	sessions, err := st.Sessions().ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("sessions.json", sessions); err != nil {
+		return err
+	}
+
+	tokens, err := st.Tokens().ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	return a.json("api_tokens.json", tokens)
+}
+
+func writeConnections(ctx context.Context, st store.Store, user *store.User, a *archive) error {
+	connections, err := st.Connections().List(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("connections.json", connections); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(connections))
+	for _, conn := range connections {
+		rows = append(rows, []string{conn.ID, conn.PartnerEmail, conn.Role, conn.Status,
+			formatTime(conn.CreatedAt), formatTime(conn.UpdatedAt)})
+	}
+	return a.csv("connections.csv", []string{"id", "partnerEmail", "role", "status", "createdAt", "updatedAt"}, rows)
+}
+
+// the events the user created and the ones shared with them
+func writeDDays(ctx context.Context, st store.Store, user *store.User, a *archive) error {
+	ddays, err := st.DDays().ListVisible(ctx, user.ID, "99991231")
+	if err != nil {
+		return err
+	}
+	if err := a.json("ddays.json", ddays); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(ddays))
+	for _, d := range ddays {
+		rows = append(rows, []string{d.ID, d.Title, d.Group, d.Description, d.Date, d.EndDate,
+			strconv.FormatBool(d.IsAnnual), d.RRule, joinList(d.ExDates), d.CreatedBy, joinList(d.ConnectedUsers), d.ImageURL,
+			formatTime(d.CreatedAt), formatTime(d.UpdatedAt)})
+	}
+	err = a.csv("ddays.csv", []string{"id", "title", "group", "description", "date", "endDate",
+		"isAnnual", "rrule", "exdates", "createdBy", "connectedUsers", "imageUrl", "createdAt", "updatedAt"}, rows)
+	if err != nil {
+		return err
+	}
+
+	// the milestones themselves are generated from startedDating, only the ones the user hid are stored
+	hidden, err := st.DDays().ListHiddenMilestones(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	return a.json("hidden_milestones.json", hidden)
+}
+
+func writePeriods(ctx context.Context, st store.Store, user *store.User, a *archive) error {
+	days, err := st.Periods().ListDays(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("period_days.json", days); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(days))
+	for _, d := range days {
+		rows = append(rows, []string{d.ID, d.Date, strconv.FormatBool(d.IsPeriod), joinList(d.Symptoms),
+			strconv.FormatInt(d.CrampIntensity, 10), joinList(d.Mood), joinList(d.Activities), joinList(d.SexActivity),
+			d.Notes, formatTime(d.CreatedAt), formatTime(d.UpdatedAt)})
+	}
+	err = a.csv("period_days.csv", []string{"id", "date", "isPeriod", "symptoms", "crampIntensity", "mood",
+		"activities", "sexActivity", "notes", "createdAt", "updatedAt"}, rows)
+	if err != nil {
+		return err
+	}
+
+	settings, err := st.Periods().GetSettings(ctx, user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return a.json("cycle_settings.json", settings)
+}
+
+func writeCheckins(ctx context.Context, st store.Store, user *store.User, a *archive) error {
+	checkins, err := st.Checkins().List(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("checkins.json", checkins); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(checkins))
+	for _, ci := range checkins {
+		rows = append(rows, []string{ci.ID, ci.Date, ci.Mood, ci.Energy, ci.PeriodStatus, ci.SexualMood, ci.Note,
+			formatTime(ci.CreatedAt), formatTime(ci.UpdatedAt)})
+	}
+	return a.csv("checkins.csv", []string{"id", "date", "mood", "energy", "periodStatus", "sexualMood", "note",
+		"createdAt", "updatedAt"}, rows)
+}
+
+func writePins(ctx context.Context, st store.Store, user *store.User, a *archive) error {
+	pins, err := st.Pins().List(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("pins.json", pins); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(pins))
+	for _, p := range pins {
+		rows = append(rows, []string{p.ID, strconv.FormatFloat(p.Lat, 'f', -1, 64), strconv.FormatFloat(p.Lng, 'f', -1, 64),
+			p.Title, p.Description, p.Location, p.Date, formatTime(p.CreatedAt), formatTime(p.UpdatedAt)})
+	}
+	return a.csv("pins.csv", []string{"id", "lat", "lng", "title", "description", "location", "date",
+		"createdAt", "updatedAt"}, rows)
+}
+
+// the user's posts, the comments they wrote on any post and their bookmarked post IDs
+func writeIdeas(ctx context.Context, st store.Store, user *store.User, a *archive) error {
+	posts, err := st.Ideas().ListByAuthor(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("ideas/posts.json", posts); err != nil {
+		return err
+	}
+
+	comments, err := st.Ideas().ListCommentsByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("ideas/comments.json", comments); err != nil {
+		return err
+	}
+
+	bookmarks, err := st.Ideas().ListBookmarks(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	return a.json("ideas/bookmarks.json", bookmarks)
+}
+
+func writeFeedback(ctx context.Context, st store.Store, user *store.User, a *archive) error {
+	feedback, err := st.Feedback().ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := a.json("feedback.json", feedback); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(feedback))
+	for _, f := range feedback {
+		rows = append(rows, []string{f.ID, f.Category, f.FeedbackText, f.AdminComment, formatTime(f.SubmittedAt)})
+	}
+	return a.csv("feedback.csv", []string{"id", "category", "feedbackText", "adminComment", "submittedAt"}, rows)
+}
+
+// the images of the user's own events, the partner's uploads are in the partner's export
+// an image that cannot be read is listed in the manifest instead of failing the export
+func writeImages(ctx context.Context, st store.Store, images Images, user *store.User, a *archive) error {
+	ddays, err := st.DDays().ListByCreator(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, d := range ddays {
+		if d.ImageURL == "" {
+			continue
+		}
+		rc, err := images.OpenImage(ctx, d.ImageURL)
+		if errors.Is(err, r2.ErrNotInBucket) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("ERROR: Failed to read image of dday %s for export: %v\n", d.ID, err)
+			a.manifest.MissingImages = append(a.manifest.MissingImages, d.ImageURL)
+			continue
+		}
+
+		w, err := a.create("images/" + d.ID + "-" + path.Base(d.ImageURL))
+		if err == nil {
+			_, err = io.Copy(w, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// lists share one csv cell
+func joinList(list []string) string {
+	return strings.Join(list, "; ")
+}
@@ -0,0 +1,305 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"calple/r2"
+	"calple/store"
+	"calple/store/memstore"
+)
+
+const (
+	aliceID    = "alice-uid"
+	aliceEmail = "alice@example.com"
+	bobID      = "bob-uid"
+	bobEmail   = "bob@example.com"
+)
+
+// images serves the urls in data, anything else is outside the bucket
+type images map[string]string
+
+func (im images) OpenImage(ctx context.Context, url string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(url, "https://pub-x.r2.dev/") {
+		return nil, r2.ErrNotInBucket
+	}
+	data, ok := im[url]
+	if !ok {
+		return nil, errors.New("no such object")
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func seed(t *testing.T) store.Store {
+	t.Helper()
+	ctx := context.Background()
+	st := memstore.New()
+	now := time.Now()
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(st.Users().Save(ctx, &store.User{ID: aliceID, Email: aliceEmail, Name: "Alice",
+		Tokens: &store.OAuthTokens{AccessToken: "secret-access"}, CreatedAt: now}))
+	must(st.Users().Save(ctx, &store.User{ID: bobID, Email: bobEmail, Name: "Bob", CreatedAt: now}))
+	for _, d := range []store.DDay{
+		{Title: "Trip", Date: "20250101", ImageURL: "https://pub-x.r2.dev/ddays/trip", CreatorID: aliceID, CreatedBy: aliceEmail,
+			ConnectedUsers: []string{bobEmail}, SharedWith: []string{bobID}},
+		{Title: "Lost", Date: "20250102", ImageURL: "https://pub-x.r2.dev/ddays/lost", CreatorID: aliceID, CreatedBy: aliceEmail},
+		{Title: "Linked", Date: "20250103", ImageURL: "https://example.com/cat.png", CreatorID: aliceID, CreatedBy: aliceEmail},
+		{Title: "Concert", Date: "20250202", CreatorID: bobID, CreatedBy: bobEmail,
+			ConnectedUsers: []string{aliceEmail}, SharedWith: []string{aliceID}},
+		{Title: "Not mine", Date: "20250202", CreatorID: bobID, CreatedBy: bobEmail},
+	} {
+		must(st.DDays().Create(ctx, &d))
+	}
+	must(st.Checkins().Save(ctx, aliceID, &store.Checkin{Date: "2025-01-02", Mood: "tired"}))
+	must(st.Checkins().Save(ctx, aliceID, &store.Checkin{Date: "2025-01-01", Mood: "happy, calm"}))
+	must(st.Tokens().Create(ctx, &store.APIToken{UserID: aliceID, Name: "script", Hash: "secret-hash"}))
+	return st
+}
+
+func TestWrite(t *testing.T) {
+	st := seed(t)
+	var buf bytes.Buffer
+	im := images{"https://pub-x.r2.dev/ddays/trip": "jpeg bytes"}
+	if err := Write(context.Background(), st, im, aliceID, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"profile.json", "connections.csv", "period_days.json", "pins.csv",
+		"ideas/comments.json", "feedback.csv", "manifest.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+	for name, data := range files {
+		if strings.Contains(data, "secret-") {
+			t.Errorf("%s leaks a secret: %s", name, data)
+		}
+	}
+
+	var ddays []store.DDay
+	if err := json.Unmarshal([]byte(files["ddays.json"]), &ddays); err != nil || len(ddays) != 4 {
+		t.Errorf("ddays.json = %d events, %v", len(ddays), err)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(files["checkins.csv"])).ReadAll()
+	if err != nil || len(rows) != 3 || rows[1][1] != "2025-01-01" || rows[1][2] != "happy, calm" {
+		t.Errorf("checkins.csv = %v, %v", rows, err)
+	}
+
+	// only the image in the bucket is copied, the unreadable one is reported
+	var image string
+	for name, data := range files {
+		if strings.HasPrefix(name, "images/") {
+			image = data
+		}
+	}
+	if image != "jpeg bytes" {
+		t.Errorf("image = %q", image)
+	}
+	var manifest Manifest
+	json.Unmarshal([]byte(files["manifest.json"]), &manifest)
+	if len(manifest.MissingImages) != 1 || manifest.MissingImages[0] != "https://pub-x.r2.dev/ddays/lost" {
+		t.Errorf("missing images = %v", manifest.MissingImages)
+	}
+	if len(manifest.Files) != len(files)-1 {
+		t.Errorf("manifest lists %d of %d files", len(manifest.Files), len(files)-1)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	st := seed(t)
+	jobs := NewJobs(st, nil, t.TempDir())
+	ctx := context.Background()
+
+	job, err := jobs.Start(aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Get("bob-uid", job.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("other user sees the job: %v", err)
+	}
+
+	job, err = jobs.Wait(ctx, aliceID, job.ID)
+	if err != nil || job.Status != StatusDone || job.Size == 0 {
+		t.Fatalf("job = %+v, %v", job, err)
+	}
+	f, _, err := jobs.Open(aliceID, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// expired exports are deleted when the next one starts
+	jobs.TTL = 0
+	time.Sleep(time.Millisecond)
+	next, err := jobs.Start(aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs.Wait(ctx, aliceID, next.ID)
+	if _, err := jobs.Get(aliceID, job.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expired job still there: %v", err)
+	}
+
+	// a failed export reports it instead of serving a broken zip
+	failed, _ := jobs.Start("ghost")
+	failed, _ = jobs.Wait(ctx, "ghost", failed.ID)
+	if failed.Status != StatusFailed {
+		t.Errorf("export of a missing user = %+v", failed)
+	}
+	if _, _, err := jobs.Open("ghost", failed.ID); !errors.Is(err, ErrNotReady) {
+		t.Errorf("open failed export: %v", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	if err := Write(ctx, seed(t), nil, aliceID, &buf); err != nil {
+		t.Fatal(err)
+	}
+	archive := bytes.NewReader(buf.Bytes())
+
+	// carol moves alice's data into her account on another store
+	st := memstore.New()
+	if err := st.Users().Save(ctx, &store.User{ID: "carol-uid", Email: "carol@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	st.Checkins().Save(ctx, "carol-uid", &store.Checkin{Date: "2025-01-01", Mood: "mine", UpdatedAt: later})
+
+	run := func(opts ImportOptions) *ImportReport {
+		t.Helper()
+		report, err := Import(ctx, st, "carol-uid", archive, archive.Size(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	mood := func() string {
+		ci, _ := st.Checkins().GetByDate(ctx, "carol-uid", "2025-01-01")
+		return ci.Mood
+	}
+
+	report := run(ImportOptions{DryRun: true})
+	if ddays := report.Sections[SectionDDays]; ddays.Created != 3 || len(ddays.Changes) != 3 {
+		t.Errorf("dry run ddays = %+v", ddays)
+	}
+	if checkins := report.Sections[SectionCheckins]; checkins.Created != 1 || checkins.Skipped != 1 {
+		t.Errorf("dry run checkins = %+v", checkins)
+	}
+	if ddays, _ := st.DDays().ListByCreator(ctx, "carol-uid"); len(ddays) != 0 {
+		t.Fatalf("dry run wrote %d events", len(ddays))
+	}
+
+	// only the events alice created become carol's
+	run(ImportOptions{})
+	ddays, _ := st.DDays().ListByCreator(ctx, "carol-uid")
+	if len(ddays) != 3 {
+		t.Fatalf("imported %d events", len(ddays))
+	}
+	if mood() != "mine" {
+		t.Errorf("skip overwrote the checkin")
+	}
+
+	// carol's checkin is newer than the archive's
+	if report := run(ImportOptions{Conflict: ConflictNewer}); report.Sections[SectionCheckins].Updated != 0 {
+		t.Errorf("newer = %+v", report.Sections[SectionCheckins])
+	}
+	if report := run(ImportOptions{Conflict: ConflictOverwrite, Sections: []string{SectionCheckins}}); len(report.Sections) != 1 {
+		t.Errorf("sections = %v", report.Sections)
+	}
+	if mood() != "happy, calm" {
+		t.Errorf("overwrite kept %q", mood())
+	}
+	if ddays, _ := st.DDays().ListByCreator(ctx, "carol-uid"); len(ddays) != 3 {
+		t.Errorf("importing again duplicated events: %d", len(ddays))
+	}
+
+	// a subset with only period history
+	var subset bytes.Buffer
+	zw := zip.NewWriter(&subset)
+	w, _ := zw.Create("calple-export/period_days.json")
+	w.Write([]byte(`[{"date": "2025-01-05", "isPeriod": true}, {"date": "5 Jan"}]`))
+	zw.Close()
+	report, err := Import(ctx, st, "carol-uid", bytes.NewReader(subset.Bytes()), int64(subset.Len()), ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if periods := report.Sections[SectionPeriods]; periods.Created != 1 || periods.Invalid != 1 {
+		t.Errorf("periods = %+v", periods)
+	}
+	_, err = Import(ctx, st, "carol-uid", bytes.NewReader(subset.Bytes()), int64(subset.Len()), ImportOptions{Sections: []string{SectionPins}})
+	if !errors.Is(err, ErrNothingToImport) {
+		t.Errorf("import without the section: %v", err)
+	}
+}
+
+// restored events can be edited again and their rules are checked like new ones
+func TestImportDDayRecurrence(t *testing.T) {
+	ctx := context.Background()
+	st := memstore.New()
+	if err := st.Users().Save(ctx, &store.User{ID: "carol-uid", Email: "carol@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, _ := zw.Create("ddays.json")
+	w.Write([]byte(`[
+		{"title": "Anniversary", "date": "20240214", "isAnnual": true, "exdates": ["20260214", "20250214", "20260214"]},
+		{"title": "Gym", "date": "20250106", "rrule": "RRULE:FREQ=weekly;BYDAY=MO"},
+		{"title": "Broken", "date": "20250107", "rrule": "FREQ=SOMETIMES"},
+		{"title": "Undated", "rrule": "FREQ=DAILY"},
+		{"title": "Bad exdate", "date": "20250108", "rrule": "FREQ=DAILY", "exdates": ["tomorrow"]}
+	]`))
+	zw.Close()
+
+	report, err := Import(ctx, st, "carol-uid", bytes.NewReader(archive.Bytes()), int64(archive.Len()), ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ddays := report.Sections[SectionDDays]; ddays.Created != 2 || ddays.Invalid != 3 {
+		t.Errorf("ddays = %+v", ddays)
+	}
+	ddays, _ := st.DDays().ListByCreator(ctx, "carol-uid")
+	rules := map[string]string{}
+	for _, d := range ddays {
+		if !d.Editable {
+			t.Errorf("%s is read only", d.Title)
+		}
+		rules[d.Title] = d.RRule + " " + strings.Join(d.ExDates, ",")
+	}
+	if rules["Anniversary"] != "FREQ=YEARLY 20250214,20260214" || rules["Gym"] != "FREQ=WEEKLY;BYDAY=MO " {
+		t.Errorf("rules = %q", rules)
+	}
+}
@@ -0,0 +1,527 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"time"
+
+	"calple/recurrence"
+	"calple/store"
+)
+
+// conflict rules for records that already exist in the account
+const (
+	ConflictSkip      = "skip"      // keep what the account has
+	ConflictOverwrite = "overwrite" // replace it with the archive's version
+	ConflictNewer     = "newer"     // replace it when the archive's updatedAt is later
+)
+
+// Conflicts are the valid conflict rules
+var Conflicts = []string{ConflictSkip, ConflictOverwrite, ConflictNewer}
+
+// the parts of an archive that can be imported
+// accounts, connections, ideas and feedback belong to the environment they were created in and are left out
+const (
+	SectionDDays    = "ddays"    // ddays.json, only the events the user created
+	SectionPeriods  = "periods"  // period_days.json and cycle_settings.json
+	SectionCheckins = "checkins" // checkins.json
+	SectionPins     = "pins"     // pins.json
+)
+
+// Sections are the sections in the order they are imported
+var Sections = []string{SectionDDays, SectionPeriods, SectionCheckins, SectionPins}
+
+// change actions in an import report
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+)
+
+var (
+	// ErrInvalidArchive is returned when the zip or one of its json files cannot be read
+	ErrInvalidArchive = errors.New("export: invalid archive")
+	// ErrInvalidOptions is returned for an unknown conflict rule or section
+	ErrInvalidOptions = errors.New("export: invalid import options")
+	// ErrNothingToImport is returned when the archive has none of the requested sections
+	ErrNothingToImport = errors.New("export: nothing to import")
+)
+
+// ImportOptions controls how an archive is merged into the account
+type ImportOptions struct {
+	Conflict string // one of Conflicts, skip when empty
+	// DryRun reports the changes without writing them
+	DryRun bool
+	// Sections limits the import, every section in the archive when empty
+	Sections []string
+}
+
+// ImportReport is what an import changed, or would change on a dry run
+type ImportReport struct {
+	DryRun   bool                      `json:"dryRun"`
+	Conflict string                    `json:"conflict"`
+	Sections map[string]*SectionReport `json:"sections"`
+}
+
+// SectionReport counts the records of one section
+// duplicates within the archive count as skipped, records failing validation as invalid
+type SectionReport struct {
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Skipped int      `json:"skipped"`
+	Invalid int      `json:"invalid"`
+	Changes []Change `json:"changes"`
+}
+
+// Change is one record that is created or updated
+// the key is how records are matched: the date, or the date and title for events and pins
+type Change struct {
+	Action string `json:"action"`
+	Key    string `json:"key"`
+}
+
+// Import merges an archive written by Write, or a zip with some of its files, into the user's account
+// records are matched by ID first, so restoring into the same environment updates in place,
+// and by their natural key otherwise, so moving between environments does not duplicate them
+func Import(ctx context.Context, st store.Store, uid string, r io.ReaderAt, size int64, opts ImportOptions) (*ImportReport, error) {
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+	if !slices.Contains(Conflicts, opts.Conflict) {
+		return nil, fmt.Errorf("%w: unknown conflict rule %q", ErrInvalidOptions, opts.Conflict)
+	}
+	for _, section := range opts.Sections {
+		if !slices.Contains(Sections, section) {
+			return nil, fmt.Errorf("%w: unknown section %q", ErrInvalidOptions, section)
+		}
+	}
+
+	user, err := st.Users().Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	im := &importer{
+		st:    st,
+		user:  user,
+		opts:  opts,
+		now:   time.Now(),
+		files: map[string]*zip.File{},
+		report: &ImportReport{
+			DryRun:   opts.DryRun,
+			Conflict: opts.Conflict,
+			Sections: map[string]*SectionReport{},
+		},
+	}
+	for _, f := range zr.File {
+		// archives unpacked and zipped again often gain a top level folder
+		if f.FileInfo().IsDir() || path.Base(path.Dir(f.Name)) == "images" {
+			continue
+		}
+		im.files[path.Base(f.Name)] = f
+	}
+
+	// events are matched to the creator by the archive's profile, older archives only have the email
+	var profile store.User
+	if _, err := im.read("profile.json", &profile); err != nil {
+		return nil, err
+	}
+	im.profileID = profile.ID
+	im.profileEmail = profile.Email
+
+	sections := map[string]func(context.Context) error{
+		SectionDDays:    im.ddays,
+		SectionPeriods:  im.periods,
+		SectionCheckins: im.checkins,
+		SectionPins:     im.pins,
+	}
+	for _, section := range Sections {
+		if len(opts.Sections) > 0 && !slices.Contains(opts.Sections, section) {
+			continue
+		}
+		if err := sections[section](ctx); err != nil {
+			return nil, err
+		}
+	}
+	if len(im.report.Sections) == 0 {
+		return nil, ErrNothingToImport
+	}
+	return im.report, nil
+}
+
+type importer struct {
+	st           store.Store
+	user         *store.User
+	opts         ImportOptions
+	now          time.Time
+	files        map[string]*zip.File
+	profileID    string
+	profileEmail string
+	report       *ImportReport
+}
+
+// read decodes the json file into v, false when the archive does not have it
+func (im *importer) read(name string, v any) (bool, error) {
+	f, ok := im.files[name]
+	if !ok {
+		return false, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return false, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, name, err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return false, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, name, err)
+	}
+	return true, nil
+}
+
+// section returns the report of a section that is in the archive
+func (im *importer) section(name string) *SectionReport {
+	rep, ok := im.report.Sections[name]
+	if !ok {
+		rep = &SectionReport{Changes: []Change{}}
+		im.report.Sections[name] = rep
+	}
+	return rep
+}
+
+// apply runs the conflict rule for one record and writes it unless skipped or on a dry run
+// existing is the updatedAt of the record in the account, nil when there is none
+func (im *importer) apply(rep *SectionReport, seen map[string]bool, key string, existing *time.Time, updatedAt time.Time, write func() error) error {
+	if seen[key] {
+		rep.Skipped++
+		return nil
+	}
+	seen[key] = true
+
+	action := ActionCreate
+	if existing != nil {
+		action = ActionUpdate
+		if im.opts.Conflict == ConflictSkip ||
+			im.opts.Conflict == ConflictNewer && !updatedAt.After(*existing) {
+			rep.Skipped++
+			return nil
+		}
+	}
+
+	if action == ActionCreate {
+		rep.Created++
+	} else {
+		rep.Updated++
+	}
+	rep.Changes = append(rep.Changes, Change{Action: action, Key: key})
+	if im.opts.DryRun {
+		return nil
+	}
+	return write()
+}
+
+// timestamps missing in files from other trackers are set to the time of the import
+// the conflict rule compares the updatedAt from the archive, so a missing one is never newer
+func (im *importer) stamp(createdAt, updatedAt *time.Time) {
+	if createdAt.IsZero() {
+		*createdAt = im.now
+	}
+	if updatedAt.IsZero() {
+		*updatedAt = im.now
+	}
+}
+
+// events created by the archive's owner, without a profile in the archive every event counts as theirs
+func (im *importer) ownDDay(d store.DDay) bool {
+	if im.profileID != "" && d.CreatorID != "" {
+		return d.CreatorID == im.profileID
+	}
+	return im.profileEmail == "" || d.CreatedBy == im.profileEmail
+}
+
+// the events the user created, shares are kept for people who have an account here
+func (im *importer) ddays(ctx context.Context) error {
+	var ddays []store.DDay
+	if ok, err := im.read("ddays.json", &ddays); !ok || err != nil {
+		return err
+	}
+	rep := im.section(SectionDDays)
+
+	existing, err := im.st.DDays().ListByCreator(ctx, im.user.ID)
+	if err != nil {
+		return err
+	}
+	byID := map[string]store.DDay{}
+	byKey := map[string]store.DDay{}
+	for _, d := range existing {
+		byID[d.ID] = d
+		byKey[d.Date+" "+d.Title] = d
+	}
+
+	seen := map[string]bool{}
+	for _, d := range ddays {
+		if !im.ownDDay(d) {
+			continue
+		}
+		if d.Title == "" || d.Date != "" && !isDate(d.Date, "20060102") || !normalizeRecurrence(&d) {
+			rep.Invalid++
+			continue
+		}
+
+		key := d.Date + " " + d.Title
+		prev, found := byID[d.ID]
+		if !found {
+			prev, found = byKey[key]
+		}
+
+		d.CreatorID = im.user.ID
+		d.CreatedBy = im.user.Email
+		d.Editable = true
+		// shares are resolved again by email, people without an account here are dropped
+		emails := d.ConnectedUsers
+		d.ConnectedUsers, d.SharedWith = []string{}, []string{}
+		for _, email := range emails {
+			if email == im.user.Email || email == im.profileEmail {
+				continue
+			}
+			if u, err := im.st.Users().GetByEmail(ctx, email); err == nil && u.ID != im.user.ID {
+				d.ConnectedUsers = append(d.ConnectedUsers, u.Email)
+				d.SharedWith = append(d.SharedWith, u.ID)
+			}
+		}
+		incoming := d.UpdatedAt
+		im.stamp(&d.CreatedAt, &d.UpdatedAt)
+
+		var updatedAt *time.Time
+		if found {
+			updatedAt = &prev.UpdatedAt
+		}
+		err := im.apply(rep, seen, key, updatedAt, incoming, func() error {
+			if !found {
+				return im.st.DDays().Create(ctx, &d)
+			}
+			d.ID = prev.ID
+			d.CreatedAt = prev.CreatedAt
+			return im.st.DDays().Update(ctx, &d)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *importer) periods(ctx context.Context) error {
+	var days []store.PeriodDay
+	hasDays, err := im.read("period_days.json", &days)
+	if err != nil {
+		return err
+	}
+	var settings store.CycleSettings
+	hasSettings, err := im.read("cycle_settings.json", &settings)
+	if err != nil {
+		return err
+	}
+	if !hasDays && !hasSettings {
+		return nil
+	}
+	rep := im.section(SectionPeriods)
+
+	existing, err := im.st.Periods().ListDays(ctx, im.user.ID)
+	if err != nil {
+		return err
+	}
+	byDate := map[string]store.PeriodDay{}
+	for _, d := range existing {
+		byDate[d.Date] = d
+	}
+
+	seen := map[string]bool{}
+	for _, d := range days {
+		if !isDate(d.Date, time.DateOnly) {
+			rep.Invalid++
+			continue
+		}
+		prev, found := byDate[d.Date]
+		incoming := d.UpdatedAt
+		im.stamp(&d.CreatedAt, &d.UpdatedAt)
+
+		var updatedAt *time.Time
+		if found {
+			updatedAt = &prev.UpdatedAt
+		}
+		err := im.apply(rep, seen, d.Date, updatedAt, incoming, func() error {
+			d.ID = prev.ID
+			if found {
+				d.CreatedAt = prev.CreatedAt
+			}
+			return im.st.Periods().SaveDay(ctx, im.user.ID, &d)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !hasSettings {
+		return nil
+	}
+	if settings.CycleLength <= 0 || settings.PeriodLength <= 0 {
+		rep.Invalid++
+		return nil
+	}
+	prev, err := im.st.Periods().GetSettings(ctx, im.user.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	incoming := settings.UpdatedAt
+	im.stamp(&settings.CreatedAt, &settings.UpdatedAt)
+
+	var updatedAt *time.Time
+	if prev != nil {
+		updatedAt = &prev.UpdatedAt
+	}
+	return im.apply(rep, seen, "cycleSettings", updatedAt, incoming, func() error {
+		settings.ID = ""
+		if prev != nil {
+			settings.ID = prev.ID
+			settings.CreatedAt = prev.CreatedAt
+		}
+		return im.st.Periods().SaveSettings(ctx, im.user.ID, &settings)
+	})
+}
+
+func (im *importer) checkins(ctx context.Context) error {
+	var checkins []store.Checkin
+	if ok, err := im.read("checkins.json", &checkins); !ok || err != nil {
+		return err
+	}
+	rep := im.section(SectionCheckins)
+
+	existing, err := im.st.Checkins().List(ctx, im.user.ID)
+	if err != nil {
+		return err
+	}
+	byDate := map[string]store.Checkin{}
+	for _, ci := range existing {
+		byDate[ci.Date] = ci
+	}
+
+	seen := map[string]bool{}
+	for _, ci := range checkins {
+		if !isDate(ci.Date, time.DateOnly) {
+			rep.Invalid++
+			continue
+		}
+		prev, found := byDate[ci.Date]
+		incoming := ci.UpdatedAt
+		im.stamp(&ci.CreatedAt, &ci.UpdatedAt)
+
+		var updatedAt *time.Time
+		if found {
+			updatedAt = &prev.UpdatedAt
+		}
+		err := im.apply(rep, seen, ci.Date, updatedAt, incoming, func() error {
+			ci.ID = prev.ID
+			if found {
+				ci.CreatedAt = prev.CreatedAt
+			}
+			return im.st.Checkins().Save(ctx, im.user.ID, &ci)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *importer) pins(ctx context.Context) error {
+	var pins []store.Pin
+	if ok, err := im.read("pins.json", &pins); !ok || err != nil {
+		return err
+	}
+	rep := im.section(SectionPins)
+
+	existing, err := im.st.Pins().List(ctx, im.user.ID)
+	if err != nil {
+		return err
+	}
+	byID := map[string]store.Pin{}
+	byKey := map[string]store.Pin{}
+	for _, p := range existing {
+		byID[p.ID] = p
+		byKey[p.Date+" "+p.Title] = p
+	}
+
+	seen := map[string]bool{}
+	for _, p := range pins {
+		if p.Title == "" || p.Date == "" {
+			rep.Invalid++
+			continue
+		}
+		key := p.Date + " " + p.Title
+		prev, found := byID[p.ID]
+		if !found {
+			prev, found = byKey[key]
+		}
+		incoming := p.UpdatedAt
+		im.stamp(&p.CreatedAt, &p.UpdatedAt)
+
+		var updatedAt *time.Time
+		if found {
+			updatedAt = &prev.UpdatedAt
+		}
+		err := im.apply(rep, seen, key, updatedAt, incoming, func() error {
+			if !found {
+				return im.st.Pins().Create(ctx, im.user.ID, &p)
+			}
+			p.ID = prev.ID
+			return im.st.Pins().Update(ctx, im.user.ID, &p)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeRecurrence checks the rule and excluded dates like the create handler and writes them in their canonical form
+func normalizeRecurrence(d *store.DDay) bool {
+	exdates := []string{}
+	for _, exdate := range d.ExDates {
+		if !isDate(exdate, "20060102") {
+			return false
+		}
+		if !slices.Contains(exdates, exdate) {
+			exdates = append(exdates, exdate)
+		}
+	}
+	slices.Sort(exdates)
+	d.ExDates = exdates
+
+	if d.RRule == "" && d.IsAnnual {
+		d.RRule = recurrence.Annual
+	}
+	if d.RRule != "" {
+		rule, err := recurrence.Parse(d.RRule)
+		if err != nil || d.Date == "" {
+			return false
+		}
+		d.RRule = rule.String()
+	}
+	d.IsAnnual = d.RRule == recurrence.Annual
+	return true
+}
+
+func isDate(date, layout string) bool {
+	if len(date) != len(layout) {
+		return false
+	}
+	_, err := time.Parse(layout, date)
+	return err == nil
+}
@@ -0,0 +1,191 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"calple/store"
+	"calple/util"
+)
+
+// job status values
+const (
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+var (
+	// ErrJobNotFound is returned for unknown, expired and other users' jobs
+	ErrJobNotFound = errors.New("export: job not found")
+	// ErrNotReady is returned when opening an export that is still running or failed
+	ErrNotReady = errors.New("export: export is not ready")
+)
+
+// Job is an export being built in the background
+type Job struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"-"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Size       int64     `json:"size,omitempty"` // bytes of the finished zip
+	CreatedAt  time.Time `json:"createdAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	path string
+	done chan struct{}
+}
+
+// Jobs builds exports in the background and keeps the zips in a directory until they expire
+// the jobs live in the memory of one instance, like the in-memory rate limiter
+type Jobs struct {
+	st     store.Store
+	images Images
+	dir    string
+
+	// finished exports are kept this long for downloading
+	TTL time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobs writes the zips to dir, the system temp dir when it is empty
+func NewJobs(st store.Store, images Images, dir string) *Jobs {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "calple-exports")
+	}
+	return &Jobs{
+		st:     st,
+		images: images,
+		dir:    dir,
+		TTL:    24 * time.Hour,
+		jobs:   map[string]*Job{},
+	}
+}
+
+// Start begins an export of the user's data
+// a user has one export at a time, while one runs Start returns it instead of starting another
+func (j *Jobs) Start(uid string) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.prune(time.Now())
+	for _, job := range j.jobs {
+		if job.UserID == uid && job.Status == StatusRunning {
+			return *job, nil
+		}
+	}
+
+	id, err := util.RandomToken(16)
+	if err != nil {
+		return Job{}, err
+	}
+	if err := os.MkdirAll(j.dir, 0o700); err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:        id,
+		UserID:    uid,
+		Status:    StatusRunning,
+		CreatedAt: time.Now(),
+		path:      filepath.Join(j.dir, id+".zip"),
+		done:      make(chan struct{}),
+	}
+	j.jobs[id] = job
+
+	go j.run(job)
+	return *job, nil
+}
+
+// the export outlives the request that started it
+func (j *Jobs) run(job *Job) {
+	size, err := j.build(context.Background(), job)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job.FinishedAt = time.Now()
+	if err != nil {
+		fmt.Printf("ERROR: Export %s for user %s failed: %v\n", job.ID, job.UserID, err)
+		os.Remove(job.path)
+		job.Status = StatusFailed
+		job.Error = "Failed to build the export"
+	} else {
+		job.Status = StatusDone
+		job.Size = size
+	}
+	close(job.done)
+}
+
+func (j *Jobs) build(ctx context.Context, job *Job) (int64, error) {
+	f, err := os.OpenFile(job.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	if err := Write(ctx, j.st, j.images, job.UserID, f); err != nil {
+		f.Close()
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	return info.Size(), f.Close()
+}
+
+// Get returns the user's job
+func (j *Jobs) Get(uid, id string) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok || job.UserID != uid {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Wait blocks until the job finished or ctx is done and returns the job as it is then
+func (j *Jobs) Wait(ctx context.Context, uid, id string) (Job, error) {
+	j.mu.Lock()
+	job, ok := j.jobs[id]
+	j.mu.Unlock()
+	if !ok || job.UserID != uid {
+		return Job{}, ErrJobNotFound
+	}
+
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+	}
+	return j.Get(uid, id)
+}
+
+// Open opens the zip of a finished job, the caller closes it
+func (j *Jobs) Open(uid, id string) (*os.File, Job, error) {
+	job, err := j.Get(uid, id)
+	if err != nil {
+		return nil, job, err
+	}
+	if job.Status != StatusDone {
+		return nil, job, ErrNotReady
+	}
+	f, err := os.Open(job.path)
+	return f, job, err
+}
+
+// prune forgets expired jobs and deletes their zips, called with the lock held
+func (j *Jobs) prune(now time.Time) {
+	for id, job := range j.jobs {
+		if job.Status != StatusRunning && now.Sub(job.FinishedAt) > j.TTL {
+			os.Remove(job.path)
+			delete(j.jobs, id)
+		}
+	}
+}
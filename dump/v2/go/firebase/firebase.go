@@ -11,15 +11,15 @@ import (
 )
 
 // initialize firebase/firestore client
-func InitFirebase(ctx context.Context) (*firestore.Client, error) {
+// credentialsJSON takes precedence over the credentials file
+func InitFirebase(ctx context.Context, credentialsJSON, credFile string) (*firestore.Client, error) {
 	var opt option.ClientOption
-	credFile := "firebase_credentials.json"
 
-	if content := os.Getenv("FIREBASE_CREDENTIALS_JSON"); content != "" {
-		fmt.Printf("DEBUG: Initializing Firebase with credentials from environment variable\n")
-		opt = option.WithCredentialsJSON([]byte(content))
+	if credentialsJSON != "" {
+		fmt.Printf("DEBUG: Initializing Firebase with credentials from config\n")
+		opt = option.WithCredentialsJSON([]byte(credentialsJSON))
 	} else {
-		fmt.Printf("DEBUG: No FIREBASE_CREDENTIALS_JSON environment variable found, using local file\n")
+		fmt.Printf("DEBUG: No Firebase credentials JSON configured, using local file\n")
 		// Check if credentials file exists
 		if _, err := os.Stat(credFile); os.IsNotExist(err) {
 			fmt.Printf("ERROR: Firebase credentials file does not exist: %s\n", credFile)
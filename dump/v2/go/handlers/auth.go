@@ -2,71 +2,94 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	oauth2api "google.golang.org/api/oauth2/v2"
-	"google.golang.org/api/option"
+
+	"calple/accounts"
+	"calple/identity"
+	"calple/keyring"
+	"calple/store"
+	"calple/util"
 )
 
-func getOAuthConfig() *oauth2.Config {
-	env := os.Getenv("ENV")
-	var redirectURL string
-	if env == "development" {
-		redirectURL = "http://localhost:5000/google/oauth/callback"
-	} else {
-		redirectURL = "https://api.calple.date/google/oauth/callback"
-	}
+// errors from signing in with an identity that the callback reports to the user
+var (
+	errIdentityLinked  = errors.New("identity is linked to another account")
+	errEmailUnverified = errors.New("provider did not verify the email")
+	errEmailTaken      = errors.New("email belongs to an existing account")
+)
 
-	return &oauth2.Config{
-		ClientID:     os.Getenv("OAUTH2_CLIENT_ID"),
-		ClientSecret: os.Getenv("OAUTH2_CLIENT_SECRET"),
-		RedirectURL:  redirectURL,
-		Scopes: []string{
-			"openid",
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
+// the provider comes from /oauth/:provider/..., the original /google/oauth/... routes have no param
+func providerName(c *gin.Context) string {
+	if name := c.Param("provider"); name != "" {
+		return name
 	}
+	return "google"
 }
 
 // init OAuth2 configuration
+// with ?link=true a signed in user adds the provider to their account instead of signing in
+// with ?remember=true the session lasts weeks instead of hours
 func Login(c *gin.Context) {
-	oauthConfig := getOAuthConfig()
-	fmt.Printf("Using Redirect URI: %s\n", oauthConfig.RedirectURL)
+	name := providerName(c)
+	provider, err := getConfig(c).Providers.Get(name)
+	if err != nil {
+		c.String(http.StatusNotFound, "Unknown identity provider: %s", name)
+		return
+	}
 
-	state := fmt.Sprintf("%d", time.Now().UnixNano())
+	// the state ties the callback to this browser, so it has to be unguessable
+	state, err := util.RandomToken(32)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to create OAuth state")
+		return
+	}
 	session := sessions.Default(c)
 
 	// Clear any existing state first
 	session.Delete("state")
+	session.Delete("link_user_id")
 
 	// Add diagnostic logging
-	fmt.Printf("DEBUG: Setting new session state '%s'\n", state)
-	fmt.Printf("DEBUG: Session ID: %v\n", session.ID())
+	fmt.Printf("DEBUG: Setting new session state '%s' for provider %s\n", state, name)
+
+	// linking keeps the current session as it is
+	if c.Query("link") == "true" {
+		uid, ok := session.Get("user_id").(string)
+		if !ok || uid == "" {
+			c.String(http.StatusUnauthorized, "Sign in before linking another provider")
+			return
+		}
+		session.Set("link_user_id", uid)
+	} else if c.Query("remember") == "true" {
+		session.Set("remember", "true")
+	} else {
+		session.Delete("remember")
+	}
 
 	session.Set("state", state)
-	err := session.Save()
+	session.Set("provider", name)
+	err = session.Save()
 	if err != nil {
 		fmt.Printf("ERROR: Failed to save session: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to save session")
 		return
 	}
 
-	// Verify the state was saved
-	if savedState := session.Get("state"); savedState != state {
-		fmt.Printf("ERROR: State verification failed. Expected: %s, Got: %v\n", state, savedState)
+	authURL, err := provider.AuthCodeURL(context.Background(), state)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to build %s login url: %v\n", name, err)
+		c.String(http.StatusBadGateway, "Identity provider is unavailable")
+		return
 	}
-
-	authURL := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
 	c.Redirect(http.StatusFound, authURL)
 }
 
@@ -87,13 +110,11 @@ func Callback(c *gin.Context) {
 
 	// validate state
 	session := sessions.Default(c)
-	fmt.Printf("DEBUG: Session ID in callback: %v\n", session.ID())
-
 	storedState := session.Get("state")
 	fmt.Printf("DEBUG: Stored state: %v, Received state: %s\n", storedState, c.Query("state"))
 
 	if storedState == nil {
-		fmt.Printf("ERROR: Session state is nil. All session data: %+v\n", session)
+		fmt.Printf("ERROR: Session state is nil\n")
 		c.String(http.StatusBadRequest, "Invalid OAuth state: session state is nil")
 		return
 	}
@@ -103,77 +124,254 @@ func Callback(c *gin.Context) {
 		// Clear the invalid session
 		session.Clear()
 		session.Save()
-		c.String(http.StatusBadRequest, fmt.Sprintf("Invalid OAuth state: received %s, expected %s", c.Query("state"), storedState.(string)))
+		c.String(http.StatusBadRequest, "Invalid OAuth state")
+		return
+	}
+
+	// the state was issued for one provider, a code from another is rejected
+	name := providerName(c)
+	if session.Get("provider") != name {
+		c.String(http.StatusBadRequest, "Invalid OAuth state: started with another provider")
 		return
 	}
+	linkUID, _ := session.Get("link_user_id").(string)
 
 	// Clear the state after successful validation
 	session.Delete("state")
+	session.Delete("provider")
+	session.Delete("link_user_id")
 
-	oauthConfig := getOAuthConfig()
-	// exchange code for token
-	token, err := oauthConfig.Exchange(context.Background(), c.Query("code"))
+	provider, err := getConfig(c).Providers.Get(name)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("Token exchange error: %v", err))
+		c.String(http.StatusNotFound, "Unknown identity provider: %s", name)
 		return
 	}
 
-	// fetch user info
-	svc, err := oauth2api.NewService(context.Background(), option.WithTokenSource(oauthConfig.TokenSource(context.Background(), token)))
+	// exchange code for token and fetch user info
+	ident, token, err := provider.Exchange(context.Background(), c.Query("code"))
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("Failed to create OAuth2 service: %v", err))
+		c.String(http.StatusInternalServerError, fmt.Sprintf("Token exchange error: %v", err))
+		return
+	}
+
+	user, err := signInIdentity(context.Background(), getStore(c), getConfig(c).Keyring, ident, token, linkUID)
+	switch {
+	case errors.Is(err, errIdentityLinked):
+		c.String(http.StatusConflict, "This %s account is already linked to another calple account", name)
+		return
+	case errors.Is(err, errEmailTaken):
+		c.String(http.StatusConflict, "An account with this email exists, sign in to it and link %s from the settings", name)
+		return
+	case errors.Is(err, errEmailUnverified):
+		c.String(http.StatusForbidden, "Your %s account has no verified email", name)
+		return
+	case err != nil:
+		c.String(http.StatusInternalServerError, fmt.Sprintf("User upsert error: %v", err))
 		return
 	}
-	userinfo, err := svc.Userinfo.Get().Do()
+
+	// set user_id in session
+	session.Set("user_id", user.ID)
+	err = session.Save()
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch user info: %v", err))
+		c.String(http.StatusInternalServerError, "Failed to save session after login")
 		return
 	}
 
-	// firestore upsert user data after auth
-	fsClient := c.MustGet("firestore").(*firestore.Client)
-	userDocRef := fsClient.Collection("users").Doc(userinfo.Id)
-	// check if user already exists
-	doc, err := userDocRef.Get(context.Background())
-	isReturningUser := false
-	if err == nil && doc.Exists() {
-		isReturningUser = true
+	c.Redirect(http.StatusFound, getConfig(c).FrontendURL)
+}
+
+// signInIdentity finds or creates the user for an external identity and records the login
+// the user is found by, in order: the linked identity, the link request, a google account
+// from before identities were stored (keyed by the google subject), or the same verified email
+// the account keeps its email, a provider with another one does not change it (see accounts.ChangeEmail)
+func signInIdentity(ctx context.Context, st store.Store, kr *keyring.Keyring, ident *identity.Identity, token *oauth2.Token, linkUID string) (*store.User, error) {
+	now := time.Now()
+
+	linked, err := st.Identities().Get(ctx, ident.Provider, ident.Subject)
+	if errors.Is(err, store.ErrNotFound) {
+		linked = nil
+	} else if err != nil {
+		return nil, err
+	}
+	if linked != nil && linkUID != "" && linked.UserID != linkUID {
+		return nil, errIdentityLinked
+	}
+
+	var user *store.User
+	switch {
+	case linkUID != "":
+		user, err = st.Users().Get(ctx, linkUID)
+	case linked != nil:
+		user, err = st.Users().Get(ctx, linked.UserID)
+		// the account was deleted, the identity starts over
+		if errors.Is(err, store.ErrNotFound) {
+			linked = nil
+			user, err = findIdentityUser(ctx, st, ident)
+		}
+	default:
+		user, err = findIdentityUser(ctx, st, ident)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	isReturningUser := user != nil
+	if user == nil {
+		if ident.Email == "" || !ident.EmailVerified {
+			return nil, errEmailUnverified
+		}
+		user = &store.User{
+			ID:        uuid.NewString(),
+			Email:     ident.Email,
+			CreatedAt: now,
+			Sex:       "female",
+		}
+	}
+	if user.Name == "" {
+		user.Name = ident.Name
 	}
+	user.ReturningUser = isReturningUser
+	user.LastLoginAt = now
 
-	userData := map[string]interface{}{
-		"email": userinfo.Email,
-		"name":  userinfo.Name,
-		"tokens": map[string]interface{}{
-			"access_token":  token.AccessToken,
-			"refresh_token": token.RefreshToken,
-			"expiry":        token.Expiry,
-		},
-		"returning_user": isReturningUser,
-		"last_login_at":  time.Now(),
+	// google refresh tokens used to be stored on the user, they move to the identity
+	// and are removed from the user on every sign in, in clear text they would otherwise stay
+	prevTokens := user.Tokens
+	user.Tokens = nil
+	record := &store.Identity{
+		Provider:  ident.Provider,
+		Subject:   ident.Subject,
+		CreatedAt: now,
+	}
+	if linked != nil {
+		prevTokens = linked.Tokens
+		record.CreatedAt = linked.CreatedAt
+	}
+	tokens, err := sealTokens(kr, token, prevTokens)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt tokens: %w", err)
 	}
+	record.UserID = user.ID
+	record.Email = ident.Email
+	record.Tokens = tokens
+	record.LastLoginAt = now
 
-	if !isReturningUser {
-		userData["created_at"] = time.Now()
-		userData["sex"] = "female"
-		userData["startedDating"] = nil
+	if err := st.Users().Save(ctx, user); err != nil {
+		return nil, err
 	}
+	if err := st.Identities().Link(ctx, record); err != nil {
+		return nil, err
+	}
+	if err := acceptPendingShares(ctx, st, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
 
-	_, err = userDocRef.Set(context.Background(), userData, firestore.MergeAll)
+// match an identity that is not linked yet to an existing user, nil if there is none
+func findIdentityUser(ctx context.Context, st store.Store, ident *identity.Identity) (*store.User, error) {
+	// google users from before identities were stored have the google subject as their ID
+	if ident.Provider == "google" {
+		user, err := st.Users().Get(ctx, ident.Subject)
+		if err == nil || !errors.Is(err, store.ErrNotFound) {
+			return user, err
+		}
+	}
+	if ident.Email == "" {
+		return nil, nil
+	}
+
+	user, err := st.Users().GetByEmail(ctx, ident.Email)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// an unverified email could be anyone's, it must not take over the account
+	if !ident.EmailVerified {
+		return nil, errEmailTaken
+	}
+	return user, nil
+}
+
+// encrypt the oauth tokens for storage
+// google only sends a refresh token on the first consent, so the stored one is kept otherwise
+// returns nil without a keyring, then nothing is written and the tokens are never stored in clear text
+func sealTokens(kr *keyring.Keyring, token *oauth2.Token, prev *store.OAuthTokens) (*store.OAuthTokens, error) {
+	if kr == nil {
+		return nil, nil
+	}
+
+	accessToken, err := kr.Encrypt(token.AccessToken)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("Firestore upsert error: %v", err))
+		return nil, err
+	}
+
+	var refreshToken string
+	if token.RefreshToken != "" {
+		refreshToken, err = kr.Encrypt(token.RefreshToken)
+	} else if prev != nil {
+		// also moves older tokens to the current key
+		refreshToken, err = kr.Rotate(prev.RefreshToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.OAuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expiry:       token.Expiry,
+	}, nil
+}
+
+// DevLogin signs in with just an email, creating the user if needed
+// it is only routed in development with a local (memory or sqlite) store
+// so the whole api can be used offline without google oauth
+func DevLogin(c *gin.Context) {
+	email := strings.ToLower(strings.TrimSpace(c.Query("email")))
+	if !util.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
 		return
 	}
 
-	// set user_id in session
-	session.Set("user_id", userinfo.Id)
-	err = session.Save()
+	st := getStore(c)
+	ctx := context.Background()
+
+	user, err := st.Users().GetByEmail(ctx, email)
+	if errors.Is(err, store.ErrNotFound) {
+		now := time.Now()
+		name := c.Query("name")
+		if name == "" {
+			name = strings.Split(email, "@")[0]
+		}
+		user = &store.User{
+			ID:          uuid.NewString(),
+			Email:       email,
+			Name:        name,
+			Sex:         "female",
+			CreatedAt:   now,
+			LastLoginAt: now,
+		}
+		err = st.Users().Save(ctx, user)
+	}
+	if err == nil {
+		err = acceptPendingShares(ctx, st, user)
+	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to save session after login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("user_id", user.ID)
+	if err := session.Save(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
 		return
 	}
 
-	var frontendURL = os.Getenv("FRONTEND_URL")
-	c.Redirect(http.StatusFound, frontendURL)
+	c.JSON(http.StatusOK, gin.H{"authenticated": true, "user": userProfile(user)})
 }
 
 // auth status returns whether the user is authenticated
@@ -185,20 +383,22 @@ func AuthStatus(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"authenticated": false})
 		return
 	}
-	fsClient := c.MustGet("firestore").(*firestore.Client)
-	doc, err := fsClient.Collection("users").Doc(uid.(string)).Get(context.Background())
-	if err != nil || !doc.Exists() {
+	user, err := getStore(c).Users().Get(context.Background(), uid.(string))
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"authenticated": false})
 		return
 	}
-	data := doc.Data()
-	delete(data, "tokens")
-	c.JSON(http.StatusOK, gin.H{"authenticated": true, "user": data})
+	// the frontend offers to restore a deleted account instead of loading the app
+	if !user.DeletedAt.IsZero() {
+		c.JSON(http.StatusOK, gin.H{"authenticated": true, "user": userProfile(user), "purgeAt": accounts.PurgeAt(user)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authenticated": true, "user": userProfile(user)})
 }
 
 // clear session and redirect to frontend
 func Logout(c *gin.Context) {
 	sessions.Default(c).Clear()
 	sessions.Default(c).Save()
-	c.Redirect(http.StatusFound, os.Getenv("FRONTEND_URL"))
+	c.Redirect(http.StatusFound, getConfig(c).FrontendURL)
 }
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"calple/caldav"
+	"calple/ical"
+	"calple/store"
+)
+
+// where calendar apps find the server, the root is the user's principal and calendar home
+const calDAVPath = "/caldav/"
+
+// apps that are only given the host look here first
+const wellKnownCalDAV = "/.well-known/caldav"
+
+// the one calendar of every user, the events they created and the ones shared with them
+const calDAVCalendarPath = calDAVPath + "ddays/"
+
+// the largest PROPFIND or REPORT body read
+const maxCalDAVRequestSize = 1 << 20
+
+// CalDAVAuth asks calendar apps for an api token with a Basic challenge, the token is the password
+// session cookies are not accepted, so the unsafe methods need no csrf token
+func CalDAVAuth(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="calple", charset="UTF-8"`)
+	if c.GetHeader("Authorization") == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	c.Next()
+}
+
+// CalDAVWellKnown points calendar apps that only know the host to the server, RFC 6764
+func CalDAVWellKnown(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, calDAVPath)
+}
+
+// CalDAVOptions tells calendar apps the server speaks CalDAV
+func CalDAVOptions(c *gin.Context) {
+	c.Header("DAV", "1, 3, calendar-access")
+	c.Header("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+	c.Status(http.StatusOK)
+}
+
+// calDAVEvents lists the resources of the calendar, undated events have no place in it
+func calDAVEvents(ctx context.Context, st store.Store, uid string) ([]store.DDay, error) {
+	ddays, err := st.DDays().ListVisible(ctx, uid, "99991231")
+	if err != nil {
+		return nil, err
+	}
+	out := ddays[:0]
+	for _, d := range ddays {
+		if _, ok := ddayEvent(&d); ok {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// calDAVName is the file name of an event in uid's calendar
+// their events keep the name the calendar app created them under, imported ones are named after the UID
+// like the apps name them, the others after their ID
+// a partner who imported the same calendar has events with the same UIDs, those keep their ID
+func calDAVName(d *store.DDay, uid string) string {
+	if d.CreatorID == uid && d.CalDAVName != "" {
+		return d.CalDAVName
+	}
+	if d.CreatorID == uid && d.ICalUID != "" && !strings.Contains(d.ICalUID, "/") {
+		return d.ICalUID + ".ics"
+	}
+	return d.ID + ".ics"
+}
+
+func findCalDAV(ddays []store.DDay, uid, name string) *store.DDay {
+	for i := range ddays {
+		if calDAVName(&ddays[i], uid) == name {
+			return &ddays[i]
+		}
+	}
+	return nil
+}
+
+// every save sets updatedAt, microseconds are what firestore keeps of it
+func calDAVETag(d *store.DDay) string {
+	return fmt.Sprintf(`"%x"`, d.UpdatedAt.UnixMicro())
+}
+
+// etagMatches checks an If-Match header, which may list several etags or be *
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarData is the event alone in a VCALENDAR, the body of its resource
+func calendarData(d *store.DDay) ([]byte, error) {
+	ev, _ := ddayEvent(d)
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, &ical.Calendar{Events: []ical.Event{ev}}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func calDAVHref(path string) string {
+	return caldav.Element(caldav.Href, caldav.EscapeHref(path))
+}
+
+func principalResponse(user *CurrentUser) caldav.Response {
+	return caldav.Response{Href: calDAVPath, Props: map[xml.Name]string{
+		caldav.ResourceType:           caldav.Element(caldav.Collection, "") + caldav.Element(caldav.Principal, ""),
+		caldav.DisplayName:            caldav.Text(user.Name),
+		caldav.CurrentUserPrincipal:   calDAVHref(calDAVPath),
+		caldav.PrincipalURL:           calDAVHref(calDAVPath),
+		caldav.CalendarHomeSet:        calDAVHref(calDAVPath),
+		caldav.CalendarUserAddressSet: caldav.Element(caldav.Href, caldav.Text("mailto:"+user.Email)),
+	}}
+}
+
+// the ctag changes whenever an event is added, changed or removed, apps skip syncing while it stays the same
+func calendarResponse(user *CurrentUser, ddays []store.DDay) caldav.Response {
+	sum := sha256.New()
+	for i := range ddays {
+		fmt.Fprintf(sum, "%s %s\n", calDAVName(&ddays[i], user.ID), calDAVETag(&ddays[i]))
+	}
+
+	// a token with only ddays:read gets a read only calendar
+	privileges := caldav.Element(caldav.Privilege, caldav.Element(caldav.Read, ""))
+	if user.HasScope("ddays:write") {
+		privileges += caldav.Element(caldav.Privilege, caldav.Element(caldav.Write, ""))
+	}
+	reports := caldav.Element(caldav.SupportedReport, caldav.Element(caldav.Report, caldav.Element(caldav.CalendarQuery, ""))) +
+		caldav.Element(caldav.SupportedReport, caldav.Element(caldav.Report, caldav.Element(caldav.CalendarMultiget, "")))
+
+	return caldav.Response{Href: calDAVCalendarPath, Props: map[xml.Name]string{
+		caldav.ResourceType:          caldav.Element(caldav.Collection, "") + caldav.Element(caldav.Calendar, ""),
+		caldav.DisplayName:           caldav.Text(calendarName),
+		caldav.SupportedComponentSet: caldav.Comp("VEVENT"),
+		caldav.SupportedReportSet:    reports,
+		caldav.PrivilegeSet:          privileges,
+		caldav.CurrentUserPrincipal:  calDAVHref(calDAVPath),
+		caldav.GetCTag:               caldav.Text(hex.EncodeToString(sum.Sum(nil))[:16]),
+	}}
+}
+
+func eventResponse(user *CurrentUser, d *store.DDay, req *caldav.Request) (caldav.Response, error) {
+	props := map[xml.Name]string{
+		caldav.ResourceType:    "",
+		caldav.GetETag:         caldav.Text(calDAVETag(d)),
+		caldav.GetContentType:  "text/calendar; charset=utf-8; component=VEVENT",
+		caldav.GetLastModified: d.UpdatedAt.UTC().Format(http.TimeFormat),
+	}
+	if req.Wants(caldav.CalendarData) {
+		data, err := calendarData(d)
+		if err != nil {
+			return caldav.Response{}, err
+		}
+		props[caldav.CalendarData] = caldav.Text(string(data))
+	}
+	return caldav.Response{Href: calDAVCalendarPath + calDAVName(d, user.ID), Props: props}, nil
+}
+
+// readCalDAVRequest reads a PROPFIND or REPORT body, false when the response was already written
+func readCalDAVRequest(c *gin.Context) (*caldav.Request, bool) {
+	req, err := caldav.ParseRequest(http.MaxBytesReader(c.Writer, c.Request.Body, maxCalDAVRequestSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return nil, false
+	}
+	return req, true
+}
+
+func writeMultistatus(c *gin.Context, req *caldav.Request, responses []caldav.Response) {
+	var buf bytes.Buffer
+	if err := caldav.WriteMultistatus(&buf, req, responses); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write response"})
+		return
+	}
+	c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", buf.Bytes())
+}
+
+// CalDAVPropfind describes the principal, the calendar or one event
+// Depth: 0 is only the resource itself, anything else adds its children
+func CalDAVPropfind(c *gin.Context) {
+	user := currentUser(c)
+
+	req, ok := readCalDAVRequest(c)
+	if !ok {
+		return
+	}
+	children := c.GetHeader("Depth") != "0"
+
+	path := c.Request.URL.Path
+	if path == calDAVPath && !children {
+		writeMultistatus(c, req, []caldav.Response{principalResponse(user)})
+		return
+	}
+
+	ddays, err := calDAVEvents(context.Background(), getStore(c), user.ID)
+	if err != nil {
+		fmt.Printf("ERROR: caldav events of %s: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
+	}
+
+	var responses []caldav.Response
+	switch {
+	case path == calDAVPath:
+		responses = append(responses, principalResponse(user), calendarResponse(user, ddays))
+	case path == calDAVCalendarPath:
+		responses = append(responses, calendarResponse(user, ddays))
+		if !children {
+			break
+		}
+		for i := range ddays {
+			res, err := eventResponse(user, &ddays[i], req)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write calendar"})
+				return
+			}
+			responses = append(responses, res)
+		}
+	default:
+		d := findCalDAV(ddays, user.ID, c.Param("file"))
+		if d == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "D-Day not found"})
+			return
+		}
+		res, err := eventResponse(user, d, req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write calendar"})
+			return
+		}
+		responses = append(responses, res)
+	}
+	writeMultistatus(c, req, responses)
+}
+
+// CalDAVReport answers calendar-query and calendar-multiget on the calendar
+// recurring events are in every time range after their first day, their occurrences are not expanded
+func CalDAVReport(c *gin.Context) {
+	user := currentUser(c)
+
+	req, ok := readCalDAVRequest(c)
+	if !ok {
+		return
+	}
+	if req.Kind != caldav.CalendarQuery && req.Kind != caldav.CalendarMultiget {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unsupported report"})
+		return
+	}
+
+	ddays, err := calDAVEvents(context.Background(), getStore(c), user.ID)
+	if err != nil {
+		fmt.Printf("ERROR: caldav events of %s: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
+	}
+
+	var matches []*store.DDay
+	var responses []caldav.Response
+	if req.Kind == caldav.CalendarQuery {
+		for i := range ddays {
+			ev, _ := ddayEvent(&ddays[i])
+			if !req.End.IsZero() && !ev.Start.Before(req.End) {
+				continue
+			}
+			if !req.Start.IsZero() && ev.RRule == "" && !ev.End.After(req.Start) {
+				continue
+			}
+			matches = append(matches, &ddays[i])
+		}
+	} else {
+		for _, href := range req.Hrefs {
+			var d *store.DDay
+			// hrefs may be full urls, only their path counts
+			if u, err := url.Parse(href); err == nil {
+				if name, ok := strings.CutPrefix(u.Path, calDAVCalendarPath); ok {
+					d = findCalDAV(ddays, user.ID, name)
+				}
+			}
+			if d == nil {
+				responses = append(responses, caldav.Response{Href: href, NotFound: true})
+				continue
+			}
+			matches = append(matches, d)
+		}
+	}
+
+	for _, d := range matches {
+		res, err := eventResponse(user, d, req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write calendar"})
+			return
+		}
+		responses = append(responses, res)
+	}
+	writeMultistatus(c, req, responses)
+}
+
+// CalDAVGet returns one event as a calendar
+func CalDAVGet(c *gin.Context) {
+	user := currentUser(c)
+
+	ddays, err := calDAVEvents(context.Background(), getStore(c), user.ID)
+	if err != nil {
+		fmt.Printf("ERROR: caldav events of %s: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
+	}
+	d := findCalDAV(ddays, user.ID, c.Param("file"))
+	if d == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "D-Day not found"})
+		return
+	}
+
+	data, err := calendarData(d)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write calendar"})
+		return
+	}
+	c.Header("ETag", calDAVETag(d))
+	c.Header("Last-Modified", d.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+}
+
+// CalDAVPut creates or replaces an event from a calendar app
+// only the creator can change an event, like in UpdateDDay
+// changes to single occurrences of a recurring event are not kept, calple has no way to store them
+// new events keep the name the app picked, apps find them again by it
+// no etag is returned, the stored event is not what was sent when it had times, so apps fetch it again
+func CalDAVPut(c *gin.Context) {
+	user := currentUser(c)
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxICSSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Calendar data is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read calendar data"})
+		return
+	}
+	cal, err := ical.Decode(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not an iCalendar file"})
+		return
+	}
+	var ev *ical.Event
+	for i := range cal.Events {
+		if cal.Events[i].RecurrenceID.IsZero() {
+			ev = &cal.Events[i]
+			break
+		}
+	}
+	if ev == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No event in the calendar data"})
+		return
+	}
+
+	ddays, err := calDAVEvents(ctx, st, user.ID)
+	if err != nil {
+		fmt.Printf("ERROR: caldav events of %s: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
+	}
+	existing := findCalDAV(ddays, user.ID, c.Param("file"))
+
+	if c.GetHeader("If-None-Match") == "*" && existing != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Event already exists"})
+		return
+	}
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && (existing == nil || !etagMatches(ifMatch, calDAVETag(existing))) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Event was changed"})
+		return
+	}
+	if existing != nil && existing.CreatorID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only creator can update"})
+		return
+	}
+	// a UID names one of the user's resources, RFC 4791 no-uid-conflict
+	if existing == nil {
+		for i := range ddays {
+			if other, _ := ddayEvent(&ddays[i]); ddays[i].CreatorID == user.ID && other.UID == ev.UID {
+				c.JSON(http.StatusConflict, gin.H{"error": "Another event has this UID"})
+				return
+			}
+		}
+	}
+
+	dday, reason := importedDDay(ev, "", existing)
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	now := time.Now()
+	if existing != nil {
+		// the event keeps its name, so it keeps its UID too
+		dday.ICalUID = existing.ICalUID
+		updateImported(existing, &dday, now)
+		if err := st.DDays().Update(ctx, existing); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event: " + err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	createImported(user, &dday, now)
+	dday.CalDAVName = c.Param("file")
+	if err := st.DDays().Create(ctx, &dday); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event: " + err.Error()})
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+// CalDAVDelete deletes an event, only the creator can
+func CalDAVDelete(c *gin.Context) {
+	user := currentUser(c)
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	ddays, err := calDAVEvents(ctx, st, user.ID)
+	if err != nil {
+		fmt.Printf("ERROR: caldav events of %s: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
+	}
+	d := findCalDAV(ddays, user.ID, c.Param("file"))
+	if d == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "D-Day not found"})
+		return
+	}
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && !etagMatches(ifMatch, calDAVETag(d)) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Event was changed"})
+		return
+	}
+	if d.CreatorID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only creator can delete"})
+		return
+	}
+	if err := st.DDays().Delete(ctx, d.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
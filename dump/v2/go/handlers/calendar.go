@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"calple/ical"
+	"calple/recurrence"
+	"calple/store"
+	"calple/util"
+)
+
+// every feed secret starts with this so leaked feed urls are easy to recognize
+const feedSecretPrefix = "cplf_"
+
+// calendarName is what calendar apps show for the subscribed calendar
+const calendarName = "calple"
+
+// the UID of an event that was not imported is its ID with this suffix
+const calendarUIDSuffix = "@calple"
+
+// the largest .ics file ImportDDaysICS reads
+const maxICSSize = 2 << 20
+
+// ddayEvent converts an event to a VEVENT, false for undated events, which have no place in a calendar
+func ddayEvent(d *store.DDay) (ical.Event, bool) {
+	start, err := time.Parse("20060102", d.Date)
+	if err != nil {
+		return ical.Event{}, false
+	}
+	end := start
+	if t, err := time.Parse("20060102", d.EndDate); err == nil && t.After(start) {
+		end = t
+	}
+
+	uid := d.ICalUID
+	if uid == "" {
+		uid = d.ID + calendarUIDSuffix
+	}
+	ev := ical.Event{
+		UID:         uid,
+		Summary:     d.Title,
+		Description: d.Description,
+		Image:       d.ImageURL,
+		Start:       start,
+		End:         end.AddDate(0, 0, 1),
+		RRule:       d.RRule,
+		Created:     d.CreatedAt,
+		Modified:    d.UpdatedAt,
+	}
+	if ev.RRule == "" && d.IsAnnual {
+		ev.RRule = recurrence.Annual
+	}
+	if d.Group != "" {
+		ev.Categories = []string{d.Group}
+	}
+	for _, exdate := range d.ExDates {
+		if t, err := time.Parse("20060102", exdate); err == nil {
+			ev.ExDates = append(ev.ExDates, t)
+		}
+	}
+	return ev, true
+}
+
+// writeCalendar responds with every dated event the user created or that was shared with them
+func writeCalendar(c *gin.Context, st store.Store, uid string) {
+	ddays, err := st.DDays().ListVisible(context.Background(), uid, "99991231")
+	if err != nil {
+		fmt.Printf("ERROR: calendar of %s: %v\n", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
+	}
+
+	cal := ical.Calendar{Name: calendarName}
+	for i := range ddays {
+		if ev, ok := ddayEvent(&ddays[i]); ok {
+			cal.Events = append(cal.Events, ev)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, &cal); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write calendar"})
+		return
+	}
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// GetDDaysICS downloads the user's events as an .ics file
+func GetDDaysICS(c *gin.Context) {
+	c.Header("Content-Disposition", `attachment; filename="calple.ics"`)
+	writeCalendar(c, getStore(c), currentUser(c).ID)
+}
+
+// GetFeedICS serves the calendar of the user a feed secret belongs to
+// calendar apps cannot sign in, the secret in the url is all they have
+// unknown secrets and deleted accounts both look like a missing feed
+func GetFeedICS(c *gin.Context) {
+	secret, ok := strings.CutSuffix(c.Param("file"), ".ics")
+	if !ok || !strings.HasPrefix(secret, feedSecretPrefix) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return
+	}
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	feed, err := st.Feeds().GetByHash(ctx, hashTokenSecret(secret))
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return
+	}
+	user, err := st.Users().Get(ctx, feed.UserID)
+	if errors.Is(err, store.ErrNotFound) || err == nil && !user.DeletedAt.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return
+	}
+
+	writeCalendar(c, st, user.ID)
+}
+
+// GetFeed returns the user's feed without its secret, null when they have none
+func GetFeed(c *gin.Context) {
+	feed, err := getStore(c).Feeds().Get(context.Background(), currentUser(c).ID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusOK, gin.H{"feed": nil})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feed": feed})
+}
+
+// RotateFeed creates the user's feed or replaces its secret, the old url stops working
+// the url is only in this response
+func RotateFeed(c *gin.Context) {
+	user := currentUser(c)
+
+	secret, err := util.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
+		return
+	}
+	secret = feedSecretPrefix + secret
+
+	feed := store.Feed{
+		UserID:    user.ID,
+		Prefix:    secret[:len(feedSecretPrefix)+6],
+		Hash:      hashTokenSecret(secret),
+		CreatedAt: time.Now(),
+	}
+	if err := getStore(c).Feeds().Save(context.Background(), &feed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":  getConfig(c).PublicURL + "/feeds/" + secret + ".ics",
+		"feed": feed,
+	})
+}
+
+// DeleteFeed turns the user's feed off
+func DeleteFeed(c *gin.Context) {
+	if err := getStore(c).Feeds().Delete(context.Background(), currentUser(c).ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feed deleted"})
+}
+
+// ICSImportReport is what ImportDDaysICS did, or would do on a dry run, with every event in the file
+type ICSImportReport struct {
+	DryRun  bool        `json:"dryRun"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Skipped int         `json:"skipped"`
+	Events  []ICSChange `json:"events"`
+}
+
+// ICSChange is one event of the file, ID is the event it created or updated
+type ICSChange struct {
+	UID    string `json:"uid"`
+	Title  string `json:"title"`
+	Action string `json:"action"` // created, updated or skipped
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ImportDDaysICS adds the events of an .ics file to the user's events
+// events are matched by their UID, so importing the same file again updates the events instead of adding them twice
+// the events of a calple calendar are matched by their ID, events shared by the partner are left alone
+// group puts every event in that group, otherwise the first category of the event is its group
+func ImportDDaysICS(c *gin.Context) {
+	user := currentUser(c)
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	group := strings.TrimSpace(c.Query("group"))
+	report := ICSImportReport{DryRun: c.Query("dryRun") == "true", Events: []ICSChange{}}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxICSSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Calendar file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read calendar file"})
+		return
+	}
+	cal, err := ical.Decode(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not an iCalendar file"})
+		return
+	}
+
+	ddays, err := st.DDays().ListVisible(ctx, user.ID, "99991231")
+	if err != nil {
+		fmt.Printf("ERROR: calendar import for %s: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
+	}
+	byUID := map[string]*store.DDay{}
+	for i := range ddays {
+		d := &ddays[i]
+		if d.CreatorID == user.ID && d.ICalUID != "" {
+			byUID[d.ICalUID] = d
+		}
+	}
+	for i := range ddays {
+		// events that were imported keep their own UID, calple's only stand for events not imported
+		if uid := ddays[i].ID + calendarUIDSuffix; byUID[uid] == nil {
+			byUID[uid] = &ddays[i]
+		}
+	}
+
+	seen := map[string]bool{}
+	now := time.Now()
+	for i := range cal.Events {
+		ev := &cal.Events[i]
+		change := ICSChange{UID: ev.UID, Title: ev.Summary, Action: "skipped"}
+
+		existing := byUID[ev.UID]
+		dday, reason := importedDDay(ev, group, existing)
+		switch {
+		case reason != "":
+			change.Reason = reason
+		case seen[ev.UID]:
+			change.Reason = "Same UID as an earlier event in the file"
+		case existing != nil && existing.CreatorID != user.ID:
+			change.ID = existing.ID
+			change.Reason = "Shared with you by someone else"
+		case existing != nil && sameDDay(existing, &dday):
+			change.ID = existing.ID
+			change.Reason = "Unchanged"
+		case existing != nil:
+			change.Action = "updated"
+			change.ID = existing.ID
+			updateImported(existing, &dday, now)
+			if !report.DryRun {
+				if err := st.DDays().Update(ctx, existing); err != nil {
+					fmt.Printf("ERROR: calendar import for %s: %v\n", user.ID, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event: " + err.Error()})
+					return
+				}
+			}
+		default:
+			change.Action = "created"
+			createImported(user, &dday, now)
+			if !report.DryRun {
+				if err := st.DDays().Create(ctx, &dday); err != nil {
+					fmt.Printf("ERROR: calendar import for %s: %v\n", user.ID, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event: " + err.Error()})
+					return
+				}
+				change.ID = dday.ID
+			}
+		}
+		if reason == "" {
+			seen[ev.UID] = true
+		}
+
+		switch change.Action {
+		case "created":
+			report.Created++
+		case "updated":
+			report.Updated++
+		default:
+			report.Skipped++
+		}
+		report.Events = append(report.Events, change)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// importedDDay converts a VEVENT to an event, existing is the event it updates if any
+// the reason is why the event cannot be imported, "" when it can
+func importedDDay(ev *ical.Event, group string, existing *store.DDay) (store.DDay, string) {
+	switch {
+	case ev.UID == "":
+		return store.DDay{}, "No UID"
+	case ev.Start.IsZero():
+		return store.DDay{}, "No start date"
+	case ev.Status == "CANCELLED":
+		return store.DDay{}, "Cancelled"
+	case !ev.RecurrenceID.IsZero():
+		// calple has no way to change a single occurrence
+		return store.DDay{}, "Changes one occurrence of a recurring event"
+	case strings.TrimSpace(ev.Summary) == "":
+		return store.DDay{}, "No title"
+	}
+
+	d := store.DDay{
+		Title:       strings.TrimSpace(ev.Summary),
+		Group:       group,
+		Description: ev.Description,
+		Date:        ev.Start.Format("20060102"),
+		ImageURL:    ev.Image,
+		RRule:       ev.RRule,
+		ICalUID:     ev.UID,
+	}
+	if last := ev.End.AddDate(0, 0, -1); last.After(ev.Start) {
+		d.EndDate = last.Format("20060102")
+	}
+	if d.Group == "" && len(ev.Categories) > 0 {
+		d.Group = ev.Categories[0]
+	}
+	for _, exdate := range ev.ExDates {
+		d.ExDates = append(d.ExDates, exdate.Format("20060102"))
+	}
+	// what the file does not have is kept, like the picture uploaded in the app
+	if existing != nil {
+		if d.Group == "" {
+			d.Group = existing.Group
+		}
+		if d.ImageURL == "" {
+			d.ImageURL = existing.ImageURL
+		}
+		// events exported from calple keep their calple UID
+		if existing.ICalUID == "" && ev.UID == existing.ID+calendarUIDSuffix {
+			d.ICalUID = ""
+		}
+	}
+	if msg := normalizeRecurrence(&d); msg != "" {
+		return store.DDay{}, msg
+	}
+	return d, ""
+}
+
+// createImported makes the user the creator of an imported event
+// it is shared with the partner like the events created in the app
+func createImported(user *CurrentUser, d *store.DDay, now time.Time) {
+	d.CreatedBy = user.Email
+	d.CreatorID = user.ID
+	d.ConnectedUsers = []string{}
+	d.SharedWith = []string{}
+	if user.Partner != nil && user.Partner.ID != "" {
+		d.ConnectedUsers = []string{user.Partner.Email}
+		d.SharedWith = []string{user.Partner.ID}
+	}
+	d.CreatedAt = now
+	d.UpdatedAt = now
+	d.Editable = true
+}
+
+// updateImported copies what a calendar file has over an existing event, the shares stay as they are
+func updateImported(existing, d *store.DDay, now time.Time) {
+	existing.Title = d.Title
+	existing.Group = d.Group
+	existing.Description = d.Description
+	existing.Date = d.Date
+	existing.EndDate = d.EndDate
+	existing.ImageURL = d.ImageURL
+	existing.IsAnnual = d.IsAnnual
+	existing.RRule = d.RRule
+	existing.ExDates = d.ExDates
+	existing.ICalUID = d.ICalUID
+	existing.UpdatedAt = now
+}
+
+// sameDDay reports if importing b into a would change nothing
+func sameDDay(a, b *store.DDay) bool {
+	return a.Title == b.Title && a.Group == b.Group && a.Description == b.Description &&
+		a.Date == b.Date && a.EndDate == b.EndDate && a.ImageURL == b.ImageURL &&
+		a.RRule == b.RRule && slices.Equal(a.ExDates, b.ExDates) && a.ICalUID == b.ICalUID
+}
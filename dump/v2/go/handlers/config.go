@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"calple/identity"
+	"calple/keyring"
+	"calple/mailer"
+	"calple/r2"
+	"calple/ratelimit"
+)
+
+// Config is the part of the server configuration the handlers need
+// it is built once at startup instead of reading env variables per request
+type Config struct {
+	FrontendURL string
+	// where the api itself is reachable, the calendar feed urls point here
+	PublicURL string
+	// sign in providers by name, google is always registered
+	Providers *identity.Registry
+	// sends the verification, password reset and magic link emails
+	Mailer mailer.Mailer
+	// rate limit policies by the name used with RateLimit
+	RateLimits map[string]ratelimit.Policy
+	R2         R2Config
+
+	// encrypts oauth tokens before they are stored
+	// nil when no key is configured, then tokens are not stored at all
+	Keyring *keyring.Keyring
+}
+
+// cloudflare r2 bucket for dday images
+type R2Config = r2.Config
+
+// get the handler config from context
+// this is set by the middleware in server.NewRouter
+func getConfig(c *gin.Context) *Config {
+	return c.MustGet("config").(*Config)
+}
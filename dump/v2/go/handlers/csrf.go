@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"calple/util"
+)
+
+// the frontend sends the token from GetCSRFToken in this header on every unsafe request
+const csrfHeader = "X-CSRF-Token"
+
+// the synchronizer token is kept with the session on the server
+const csrfSessionKey = "csrf_token"
+
+// GetCSRFToken returns the session's csrf token, creating the session if needed
+// the token stays the same for the whole session, sign in included
+func GetCSRFToken(c *gin.Context) {
+	token, err := csrfToken(sessions.Default(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create csrf token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"csrfToken": token})
+}
+
+func csrfToken(session sessions.Session) (string, error) {
+	if token, ok := session.Get(csrfSessionKey).(string); ok && token != "" {
+		return token, nil
+	}
+	token, err := util.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	session.Set(csrfSessionKey, token)
+	if err := session.Save(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RequireCSRF checks the csrf header on requests that can change data
+// the session cookie is sent by the browser on cross site requests too (SameSite=None in production)
+// api tokens are not sent automatically, so bearer requests do not need it
+func RequireCSRF(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if c.GetHeader("Authorization") != "" {
+		c.Next()
+		return
+	}
+	// CalDAVAuth turns away cookies, calendar apps get its challenge instead
+	if path := c.Request.URL.Path; strings.HasPrefix(path, calDAVPath) || path == wellKnownCalDAV {
+		c.Next()
+		return
+	}
+
+	expected, _ := sessions.Default(c).Get(csrfSessionKey).(string)
+	given := c.GetHeader(csrfHeader)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(given)) != 1 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+		return
+	}
+	c.Next()
+}
@@ -2,86 +2,54 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-
 	"github.com/google/uuid"
 
+	"calple/r2"
+	"calple/recurrence"
+	"calple/store"
 	"calple/util"
 )
 
-type DDay struct {
-	ID             string    `json:"id"`
-	Title          string    `json:"title"`
-	Group          string    `json:"group"`
-	Description    string    `json:"description"`
-	Date           string    `json:"date,omitempty"`
-	EndDate        string    `json:"endDate,omitempty"`
-	ImageURL       string    `json:"imageUrl,omitempty"`
-	IsAnnual       bool      `json:"isAnnual"`
-	CreatedBy      string    `json:"createdBy"`
-	ConnectedUsers []string  `json:"connectedUsers"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
-	Editable       bool      `json:"editable,omitempty"` // if the event can be edited by the user
-}
-
 type UploadRequest struct {
 	FileSize int64 `json:"fileSize"`
 }
 
 // fetch all events for the current user
 func GetDDays(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
+	user := currentUser(c)
 
-	// firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
+	ctx := context.Background()
 
-	// user email from firestore
-	userDoc, err := fsClient.Collection("users").Doc(uid.(string)).Get(context.Background())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
-		return
-	}
-	userEmail := userDoc.Data()["email"].(string)
+	userEmail := user.Email
 
 	// parse view date from query params
 	viewDate := c.Query("view")
 	// ex) "202507"
 
-	if viewDate == "" {
+	if len(viewDate) != 6 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing view date parameter"})
 		return
 	}
 
-	ctx := context.Background()
-	events := []DDay{}
-	seen := make(map[string]bool)
-
 	// 1. query for all events that START before the END of the viewed month.
 	// 2. manually filter out events that also END before the START of the month.
-	// reason: firestore "one range filter per query" limitation
 
-	year, _ := strconv.Atoi(viewDate[0:4])
-	month, _ := strconv.Atoi(viewDate[4:6])
+	year, err1 := strconv.Atoi(viewDate[0:4])
+	month, err2 := strconv.Atoi(viewDate[4:6])
+	if err1 != nil || err2 != nil || month < 1 || month > 12 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid view date parameter. Use YYYYMM"})
+		return
+	}
 
 	// first day of the viewed month ex) "20250601"
 	viewMonthStartStr := viewDate + "01"
@@ -92,158 +60,158 @@ func GetDDays(c *gin.Context) {
 
 	fmt.Printf("DEBUG: GetDDays - userEmail: %s, viewMonthStartStr: %s, viewMonthEndStr: %s\n", userEmail, viewMonthStartStr, viewMonthEndStr)
 
-	// debug: if user has any active connections
-	connectionDocs, err := fsClient.Collection("users").Doc(uid.(string)).Collection("connections").
-		Where("status", "==", "active").
-		Documents(ctx).GetAll()
-
-	if err == nil && len(connectionDocs) > 0 {
-		connectionData := connectionDocs[0].Data()
-		partnerEmail := connectionData["partnerEmail"].(string)
-		fmt.Printf("DEBUG: User %s has active connection with %s\n", userEmail, partnerEmail)
-	} else {
-		fmt.Printf("DEBUG: User %s has no active connections\n", userEmail)
-	}
-
-	queries := []firestore.Query{
-		// Q1: events created by the user that start before the end of the month
-		fsClient.Collection("ddays").
-			Where("createdBy", "==", userEmail).
-			Where("date", "<=", viewMonthEndStr),
-
-		// Q2: events the user is connected to that start before the end of the month
-		fsClient.Collection("ddays").
-			Where("connectedUsers", "array-contains", userEmail).
-			Where("date", "<=", viewMonthEndStr),
-
-		// Q3: annual events created by the user
-		fsClient.Collection("ddays").
-			Where("createdBy", "==", userEmail).
-			Where("isAnnual", "==", true),
+	candidates, err := st.DDays().ListVisible(ctx, user.ID, viewMonthEndStr)
+	if err != nil {
+		fmt.Printf("ERROR: DDay query failed: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
 	}
+	fmt.Printf("DEBUG: Found %d candidate events\n", len(candidates))
 
-	for i, q := range queries {
-		docs, err := q.Documents(ctx).GetAll()
-		if err != nil {
-			fmt.Printf("ERROR: Firestore query failed: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
-			return // stop execution if a query fails
-		}
-		fmt.Printf("DEBUG: Query %d found %d documents\n", i+1, len(docs))
-
-		// debug: show details of each event found
-		for _, doc := range docs {
-			data := doc.Data()
-			title, _ := data["title"].(string)
-			createdBy, _ := data["createdBy"].(string)
-			connectedUsers := util.ToStringSlice(data["connectedUsers"])
-			fmt.Printf("DEBUG: Event '%s' - createdBy: %s, connectedUsers: %v\n", title, createdBy, connectedUsers)
+	events := []store.DDay{}
+	for _, dday := range candidates {
+		if dday.EndDate == "" {
+			dday.EndDate = dday.Date
 		}
 
-		for _, doc := range docs {
-			if seen[doc.Ref.ID] {
+		if rule, ok := ddayRule(&dday); ok {
+			// recurring events are listed with the occurrences that overlap the month
+			if !expandOccurrences(&dday, rule, viewMonthStartStr, viewMonthEndStr) {
 				continue
 			}
-
-			data := doc.Data()
-			dateStr, _ := data["date"].(string)
-			endDateStr, _ := data["endDate"].(string)
-			if endDateStr == "" {
-				endDateStr = dateStr
+		} else {
+			// filter out events that end before our view starts.
+			// event is visible if its end date is on or after the first day of the month.
+			// endDate != "" is for undated events it needs this to be visible from client side
+			if dday.EndDate != "" && dday.EndDate < viewMonthStartStr {
+				continue
 			}
+		}
 
-			var isAnnual bool
-			if val, ok := data["isAnnual"].(bool); ok {
-				isAnnual = val
-			}
+		events = append(events, withPendingShares(dday, user.ID))
+	}
 
-			if isAnnual {
-				// only compare month for annual events ignore year and endDate filter
-				if len(dateStr) >= 8 && len(viewDate) >= 6 {
-					if dateStr[4:6] != viewDate[4:6] {
-						continue
-					}
-				}
-			} else {
-				// filter out events that end before our view starts.
-				// event is visible if its end date is on or after the first day of the month.
-				// endDateStr != "" is for undated events it needs this to be visible from client side
-				if endDateStr != "" && endDateStr < viewMonthStartStr {
-					continue
-				}
-			}
+	// the milestones of the couple are generated for the month, not stored
+	legacy := slices.ContainsFunc(candidates, func(d store.DDay) bool { return isAnniversaryEvent(&d, user.ID) })
+	milestones, err := milestoneDDays(ctx, st, user, viewMonthStartStr, viewMonthEndStr, !legacy)
+	if err != nil {
+		fmt.Printf("ERROR: Milestone query failed: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events from database."})
+		return
+	}
+	events = append(events, milestones...)
 
-			seen[doc.Ref.ID] = true
+	c.JSON(http.StatusOK, gin.H{
+		"ddays": events,
+		"date":  viewDate,
+	})
+}
 
-			title, _ := data["title"].(string)
-			group, _ := data["group"].(string)
-			description, _ := data["description"].(string)
-			imageUrl, _ := data["imageUrl"].(string)
-			createdBy, _ := data["createdBy"].(string)
-			var createdAt, updatedAt time.Time
-			if ct, ok := data["createdAt"].(time.Time); ok {
-				createdAt = ct
-			}
-			if ut, ok := data["updatedAt"].(time.Time); ok {
-				updatedAt = ut
-			}
+// validate YYYYMMDD date string
+// returns the error message for the client or "" if valid
+func validateDDayDate(date string) string {
+	if len(date) != 8 {
+		return "Invalid date format. Use YYYYMMDD"
+	}
+	_, err1 := strconv.Atoi(date[0:4])
+	month, err2 := strconv.Atoi(date[4:6])
+	day, err3 := strconv.Atoi(date[6:8])
+	if err1 != nil || err2 != nil || err3 != nil || month < 1 || month > 12 || day < 1 || day > 31 {
+		return "Invalid date values"
+	}
+	return ""
+}
 
-			connectedUsers := util.ToStringSlice(data["connectedUsers"])
-			fmt.Printf("DEBUG: Event '%s' - createdBy: %s, connectedUsers: %v\n", title, createdBy, connectedUsers)
+// ddayRule returns the parsed recurrence of a dated event, events only marked isAnnual repeat yearly
+func ddayRule(dday *store.DDay) (*recurrence.Rule, bool) {
+	rrule := dday.RRule
+	if rrule == "" && dday.IsAnnual {
+		rrule = recurrence.Annual
+	}
+	if rrule == "" || dday.Date == "" {
+		return nil, false
+	}
+	rule, err := recurrence.Parse(rrule)
+	if err != nil {
+		fmt.Printf("ERROR: DDay %s has an invalid rule %q: %v\n", dday.ID, rrule, err)
+		return nil, false
+	}
+	return rule, true
+}
 
-			editable := true
-			if val, ok := data["editable"]; ok {
-				if b, ok := val.(bool); ok {
-					editable = b
-				}
-			}
+// expandOccurrences sets the start dates of the occurrences that overlap first..last (YYYYMMDD)
+// every occurrence lasts as long as the first one, false if none overlaps
+func expandOccurrences(dday *store.DDay, rule *recurrence.Rule, first, last string) bool {
+	start, err1 := time.Parse("20060102", dday.Date)
+	end, err2 := time.Parse("20060102", dday.EndDate)
+	from, err3 := time.Parse("20060102", first)
+	to, err4 := time.Parse("20060102", last)
+	if err := errors.Join(err1, err3, err4); err != nil {
+		return false
+	}
+	// an occurrence that started before the month can still be running in it
+	if err2 == nil && end.After(start) {
+		from = from.Add(-end.Sub(start))
+	}
+
+	var except []time.Time
+	for _, exdate := range dday.ExDates {
+		if t, err := time.Parse("20060102", exdate); err == nil {
+			except = append(except, t)
+		}
+	}
+
+	dday.Occurrences = []string{}
+	for _, t := range rule.Between(start, from, to, except) {
+		dday.Occurrences = append(dday.Occurrences, t.Format("20060102"))
+	}
+	return len(dday.Occurrences) > 0
+}
 
-			events = append(events, DDay{
-				ID:             doc.Ref.ID,
-				Title:          title,
-				Group:          group,
-				Description:    description,
-				Date:           dateStr,
-				EndDate:        endDateStr,
-				ImageURL:       imageUrl,
-				IsAnnual:       isAnnual,
-				CreatedBy:      createdBy,
-				ConnectedUsers: connectedUsers,
-				CreatedAt:      createdAt,
-				UpdatedAt:      updatedAt,
-				Editable:       editable,
-			})
+// normalizeRecurrence checks the rule and excluded dates of the event and writes them in their canonical form
+// an event only marked isAnnual gets the yearly rule, and isAnnual is set when the rule is the yearly one
+// returns the error message for the client or "" if valid
+func normalizeRecurrence(dday *store.DDay) string {
+	exdates := []string{}
+	for _, exdate := range dday.ExDates {
+		if msg := validateDDayDate(exdate); msg != "" {
+			return "Invalid exdate " + exdate + ": " + msg
+		}
+		if !util.Contains(exdates, exdate) {
+			exdates = append(exdates, exdate)
 		}
 	}
+	slices.Sort(exdates)
+	dday.ExDates = exdates
 
-	c.JSON(http.StatusOK, gin.H{
-		"ddays": events,
-		"date":  viewDate,
-	})
+	if dday.RRule == "" && dday.IsAnnual {
+		dday.RRule = recurrence.Annual
+	}
+	if dday.RRule != "" {
+		if dday.Date == "" {
+			return "A recurring event needs a date"
+		}
+		rule, err := recurrence.Parse(dday.RRule)
+		if err != nil {
+			return "Invalid recurrence rule: " + strings.TrimPrefix(err.Error(), recurrence.ErrInvalid.Error()+": ")
+		}
+		dday.RRule = rule.String()
+	}
+	dday.IsAnnual = dday.RRule == recurrence.Annual
+	return ""
 }
 
 // create new event
 func CreateDDay(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
+	user := currentUser(c)
 
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
+	ctx := context.Background()
 
-	// get user email from firestore
-	userDoc, err := fsClient.Collection("users").Doc(uid.(string)).Get(context.Background())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
-		return
-	}
-	userEmail := userDoc.Data()["email"].(string)
+	userEmail := user.Email
 
 	// parse request body
-	var dday DDay
+	var dday store.DDay
 	if err := c.ShouldBindJSON(&dday); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
@@ -252,16 +220,8 @@ func CreateDDay(c *gin.Context) {
 	if dday.Date != "" {
 		// validate date format
 		// expected format: YYYYMMDD
-		if len(dday.Date) != 8 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYYMMDD"})
-			fmt.Println("Invalid date format:", dday.Date)
-			return
-		}
-		_, err1 := strconv.Atoi(dday.Date[0:4])
-		month, err2 := strconv.Atoi(dday.Date[4:6])
-		day, err3 := strconv.Atoi(dday.Date[6:8])
-		if err1 != nil || err2 != nil || err3 != nil || month < 1 || month > 12 || day < 1 || day > 31 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date values"})
+		if msg := validateDDayDate(dday.Date); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 			return
 		}
 	}
@@ -272,201 +232,233 @@ func CreateDDay(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("DEBUG: CreateDDay - userEmail: %s, original connectedUsers: %v\n", userEmail, dday.ConnectedUsers)
-
-	connectedUsers := dday.ConnectedUsers
-	connectionDocs, err := fsClient.Collection("users").Doc(uid.(string)).Collection("connections").
-		Where("status", "==", "active").
-		Documents(context.Background()).GetAll()
-
-	if err == nil && len(connectionDocs) > 0 {
-		connectionData := connectionDocs[0].Data()
-		partnerEmail := connectionData["partnerEmail"].(string)
+	if msg := normalizeRecurrence(&dday); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	dday.Occurrences = nil
 
-		fmt.Printf("DEBUG: CreateDDay - found partner: %s\n", partnerEmail)
+	connectedUsers, sharedWith, pendingUsers, err := resolveShares(ctx, st, dday.ConnectedUsers)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event: " + err.Error()})
+		return
+	}
 
-		// add partner to connectedUsers if not already present
-		if !util.Contains(connectedUsers, partnerEmail) {
-			connectedUsers = append(connectedUsers, partnerEmail)
-			fmt.Printf("DEBUG: CreateDDay - added partner to connectedUsers: %v\n", connectedUsers)
-		} else {
-			fmt.Printf("DEBUG: CreateDDay - partner already in connectedUsers\n")
-		}
-	} else {
-		fmt.Printf("DEBUG: CreateDDay - no active connection found\n")
+	// share with the partner if not already present
+	if user.Partner != nil && user.Partner.ID != "" && !util.Contains(sharedWith, user.Partner.ID) {
+		connectedUsers = append(connectedUsers, user.Partner.Email)
+		sharedWith = append(sharedWith, user.Partner.ID)
 	}
 
 	// set current time for timestamps
 	now := time.Now()
 
-	fmt.Printf("DEBUG: CreateDDay - final connectedUsers: %v\n", connectedUsers)
-
-	// create a new document in the ddays collection
-	newDDay := map[string]interface{}{
-		"title":          dday.Title,
-		"group":          dday.Group,
-		"description":    dday.Description,
-		"date":           dday.Date,
-		"endDate":        dday.EndDate,
-		"imageUrl":       dday.ImageURL,
-		"isAnnual":       dday.IsAnnual,
-		"createdBy":      userEmail,
-		"connectedUsers": connectedUsers,
-		"createdAt":      now,
-		"updatedAt":      now,
-		"editable":       dday.Editable || true,
-	}
-
-	// add document to Firestore
-	newDoc, _, err := fsClient.Collection("ddays").Add(context.Background(), newDDay)
-	if err != nil {
+	dday.ID = ""
+	dday.CreatedBy = userEmail
+	dday.CreatorID = user.ID
+	dday.ConnectedUsers = connectedUsers
+	dday.SharedWith = sharedWith
+	dday.PendingUsers = pendingUsers
+	dday.CreatedAt = now
+	dday.UpdatedAt = now
+	dday.Editable = true
+
+	if err := st.DDays().Create(ctx, &dday); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event: " + err.Error()})
 		return
 	}
 
-	// return created evetn
-	dday.ID = newDoc.ID
-	dday.CreatedBy = userEmail
-	dday.CreatedAt = now
-	dday.UpdatedAt = now
+	c.JSON(http.StatusCreated, gin.H{"dday": withPendingShares(dday, user.ID)})
+}
 
-	c.JSON(http.StatusCreated, gin.H{"dday": dday})
+// fields a client is allowed to change on an event
+// nil means the field was not sent
+type DDayUpdateRequest struct {
+	Title          *string   `json:"title"`
+	Group          *string   `json:"group"`
+	Description    *string   `json:"description"`
+	Date           *string   `json:"date"`
+	EndDate        *string   `json:"endDate"`
+	ImageURL       *string   `json:"imageUrl"`
+	IsAnnual       *bool     `json:"isAnnual"`
+	RRule          *string   `json:"rrule"` // wins over isAnnual, "" ends the recurrence
+	ExDates        *[]string `json:"exdates"`
+	ConnectedUsers *[]string `json:"connectedUsers"`
 }
 
 // update existing event
 func UpdateDDay(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	user := currentUser(c)
 
-	// get user email from firestore
-	userDoc, err := fsClient.Collection("users").Doc(uid.(string)).Get(context.Background())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
-		return
-	}
-	userEmail := userDoc.Data()["email"].(string)
+	st := getStore(c)
+	ctx := context.Background()
 
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
+	var req DDayUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	if dateVal, ok := updates["date"]; ok {
-		dateStr, isString := dateVal.(string)
-		if !isString {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "date field must be a string"})
+	// only validate non-empty date strings.
+	if req.Date != nil && *req.Date != "" {
+		if msg := validateDDayDate(*req.Date); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 			return
 		}
-		// only validate non-empty date strings.
-		if dateStr != "" {
-			if len(dateStr) != 8 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYYMMDD"})
-				return
-			}
-			_, err1 := strconv.Atoi(dateStr[0:4])
-			month, err2 := strconv.Atoi(dateStr[4:6])
-			day, err3 := strconv.Atoi(dateStr[6:8])
-			if err1 != nil || err2 != nil || err3 != nil || month < 1 || month > 12 || day < 1 || day > 31 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date values"})
-				return
-			}
-		}
 	}
 
-	if titleVal, ok := updates["title"]; ok {
-		if titleStr, isString := titleVal.(string); !isString || titleStr == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Title cannot be empty if provided"})
-			return
-		}
+	if req.Title != nil && *req.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title cannot be empty if provided"})
+		return
 	}
 
 	// get event ID from URL
 	id := c.Param("id")
-	ddayRef := fsClient.Collection("ddays").Doc(id)
-	docSnap, err := ddayRef.Get(context.Background())
-	if err != nil || !docSnap.Exists() {
+	dday, err := st.DDays().Get(ctx, id)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "D-Day not found"})
 		return
 	}
-	if docSnap.Data()["createdBy"].(string) != userEmail {
+	if dday.CreatorID != user.ID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Only creator can update"})
 		return
 	}
 
-	firestoreUpdates := []firestore.Update{}
-	for key, value := range updates {
-		// prevent users from updating protected fields
-		if key == "id" || key == "createdBy" || key == "createdAt" {
-			continue
+	if req.Title != nil {
+		dday.Title = *req.Title
+	}
+	if req.Group != nil {
+		dday.Group = *req.Group
+	}
+	if req.Description != nil {
+		dday.Description = *req.Description
+	}
+	if req.Date != nil {
+		dday.Date = *req.Date
+	}
+	if req.EndDate != nil {
+		dday.EndDate = *req.EndDate
+	}
+	if req.ImageURL != nil {
+		dday.ImageURL = *req.ImageURL
+	}
+	if req.RRule != nil {
+		dday.RRule = *req.RRule
+		dday.IsAnnual = false
+	} else if req.IsAnnual != nil {
+		// older clients only know isAnnual, it turns the yearly rule on and off
+		if !*req.IsAnnual && dday.RRule == recurrence.Annual {
+			dday.RRule = ""
 		}
-		firestoreUpdates = append(firestoreUpdates, firestore.Update{Path: key, Value: value})
+		dday.IsAnnual = *req.IsAnnual
 	}
-	// always update 'updatedAt' timestamp
-	firestoreUpdates = append(firestoreUpdates, firestore.Update{Path: "updatedAt", Value: time.Now()})
-
-	if _, err := ddayRef.Update(context.Background(), firestoreUpdates); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event: " + err.Error()})
-		return
+	if req.ExDates != nil {
+		dday.ExDates = *req.ExDates
 	}
-
-	updatedDoc, err := ddayRef.Get(context.Background())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated event"})
+	if msg := normalizeRecurrence(dday); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
+	if req.ConnectedUsers != nil {
+		connectedUsers, sharedWith, pendingUsers, err := resolveShares(ctx, st, *req.ConnectedUsers)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event: " + err.Error()})
+			return
+		}
+		dday.ConnectedUsers = connectedUsers
+		dday.SharedWith = sharedWith
+		dday.PendingUsers = pendingUsers
+	}
+	// always update 'updatedAt' timestamp
+	dday.UpdatedAt = time.Now()
 
-	var updatedDDay DDay
-	if err := updatedDoc.DataTo(&updatedDDay); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse updated event data"})
+	if err := st.DDays().Update(ctx, dday); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event: " + err.Error()})
 		return
 	}
-	updatedDDay.ID = updatedDoc.Ref.ID
-
-	c.JSON(http.StatusOK, gin.H{"dday": updatedDDay})
 
+	c.JSON(http.StatusOK, gin.H{"dday": withPendingShares(*dday, user.ID)})
 }
 
 // delete existing event
 func DeleteDDay(c *gin.Context) {
-	// get user ID from session
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
-	// get user email from firestore
-	userDoc, _ := fsClient.Collection("users").Doc(uid.(string)).Get(context.Background())
-	userEmail := userDoc.Data()["email"].(string)
+	user := currentUser(c)
+
+	st := getStore(c)
+	ctx := context.Background()
 
 	id := c.Param("id")
-	ddayRef := fsClient.Collection("ddays").Doc(id)
-	docSnap, err := ddayRef.Get(context.Background())
-	if err != nil || !docSnap.Exists() {
+	dday, err := st.DDays().Get(ctx, id)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "D-Day not found"})
 		return
 	}
-	if docSnap.Data()["createdBy"].(string) != userEmail {
+	if dday.CreatorID != user.ID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Only creator can delete"})
 		return
 	}
-	if _, err := ddayRef.Delete(context.Background()); err != nil {
+	if err := st.DDays().Delete(ctx, id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "D-Day deleted"})
 }
 
+// resolveShares finds the accounts behind the emails an event is shared with
+// events are shared by user ID, the emails are kept next to them for display
+// emails without an account are pending, they get the event when they sign up (see acceptPendingShares)
+func resolveShares(ctx context.Context, st store.Store, emails []string) (connected, shared, pending []string, err error) {
+	connected, shared, pending = []string{}, []string{}, []string{}
+	for _, email := range emails {
+		email = normalizeEmail(email)
+		if email == "" || util.Contains(connected, email) || util.Contains(pending, email) {
+			continue
+		}
+		u, err := st.Users().GetByEmail(ctx, email)
+		if errors.Is(err, store.ErrNotFound) {
+			pending = append(pending, email)
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		connected = append(connected, u.Email)
+		shared = append(shared, u.ID)
+	}
+	return connected, shared, pending, nil
+}
+
+// withPendingShares lists the pending emails with the others for the creator,
+// so answers do not tell which emails have an account and sending the list back keeps them
+func withPendingShares(d store.DDay, uid string) store.DDay {
+	if d.CreatorID != uid || len(d.PendingUsers) == 0 {
+		return d
+	}
+	d.ConnectedUsers = append(slices.Clone(d.ConnectedUsers), d.PendingUsers...)
+	return d
+}
+
+// acceptPendingShares shares the events that were shared with the user's email before it had an account
+// it runs on every sign in, so the events a failed sign in left pending are picked up the next time
+func acceptPendingShares(ctx context.Context, st store.Store, user *store.User) error {
+	email := normalizeEmail(user.Email)
+	ddays, err := st.DDays().ListPending(ctx, email)
+	if err != nil {
+		return err
+	}
+	for _, d := range ddays {
+		d.PendingUsers = slices.DeleteFunc(d.PendingUsers, func(e string) bool { return e == email })
+		if d.CreatorID != user.ID && !util.Contains(d.SharedWith, user.ID) {
+			d.ConnectedUsers = append(d.ConnectedUsers, user.Email)
+			d.SharedWith = append(d.SharedWith, user.ID)
+		}
+		if err := st.DDays().Update(ctx, &d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // generate presigned URL for upload to R2
 func GetDDayUploadURL(c *gin.Context) {
 	var req UploadRequest
@@ -484,48 +476,24 @@ func GetDDayUploadURL(c *gin.Context) {
 		return
 	}
 
-	accountID := os.Getenv("R2_ACCOUNT_ID")
-	accessKeyID := os.Getenv("R2_ACCESS_KEY_ID")
-	accessKeySecret := os.Getenv("R2_ACCESS_KEY_SECRET")
-	bucketName := os.Getenv("R2_BUCKET_NAME")
-
-	// AWS config loader
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyID, accessKeySecret, "")),
-		config.WithRegion("auto"),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to configure R2 client"})
-		return
-	}
-
-	// create S3 client
-	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID))
-	})
-
-	presignClient := s3.NewPresignClient(s3Client)
-
-	// generate unique key (filename)
-	objectKey := "ddays/" + uuid.New().String()
+	bucket := getConfig(c).R2
 
-	presignedURL, err := presignClient.PresignPutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(objectKey),
-		// while PresignPutObject doesn't directly enforce a range,
-		// the client MUST set the Content-Length header, which will be checked on the frontend
-	}, s3.WithPresignExpires(time.Minute*15))
+	// generate unique key (filename) under the user's prefix, deleting the account deletes only those
+	objectKey := r2.ImagePrefix(currentUser(c).ID) + uuid.New().String()
 
+	// while PresignPutObject doesn't directly enforce a range,
+	// the client MUST set the Content-Length header, which will be checked on the frontend
+	presignedURL, err := bucket.PresignUpload(context.TODO(), objectKey, time.Minute*15)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create presigned URL"})
 		return
 	}
 
 	// public URL stored in firestore
-	publicURL := fmt.Sprintf("https://pub-%s.r2.dev/%s", os.Getenv("R2_PUBLIC_BUCKET_ID"), objectKey)
+	publicURL := bucket.PublicURL(objectKey)
 
 	c.JSON(http.StatusOK, gin.H{
-		"uploadUrl": presignedURL.URL,
+		"uploadUrl": presignedURL,
 		"publicUrl": publicURL,
 	})
 }
@@ -0,0 +1,620 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"calple/accounts"
+	"calple/mailer"
+	"calple/store"
+	"calple/util"
+)
+
+// accounts without google sign in with an email and password or a magic link
+// they are stored as an identity of this provider with the email as the subject
+const emailProvider = "email"
+
+// how long the emailed links work
+const (
+	verifyTokenTTL = 24 * time.Hour
+	resetTokenTTL  = time.Hour
+	magicTokenTTL  = 15 * time.Minute
+	emailTokenTTL  = 24 * time.Hour
+)
+
+// bcrypt ignores everything after 72 bytes
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// compared against when there is no account so a login takes as long either way
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("calple-dummy-password"), bcrypt.DefaultCost)
+
+type SignupRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Name     string `json:"name"`
+}
+
+type PasswordLoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Remember bool   `json:"remember"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type LoginTokenRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Remember bool   `json:"remember"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Remember bool   `json:"remember"`
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// returns the message for a password that is not allowed, empty when it is fine
+func passwordProblem(password string) string {
+	if len(password) < minPasswordLength {
+		return fmt.Sprintf("Password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Sprintf("Password must be at most %d bytes", maxPasswordLength)
+	}
+	return ""
+}
+
+// Signup emails a verification link, the account is only created once it is opened
+// the response is the same whether or not the email is taken so accounts cannot be probed
+func Signup(c *gin.Context) {
+	var req SignupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := normalizeEmail(req.Email)
+	if !util.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+	if problem := passwordProblem(req.Password); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	st := getStore(c)
+	cfg := getConfig(c)
+	ctx := context.Background()
+
+	_, err := st.Users().GetByEmail(ctx, email)
+	if err == nil {
+		// tell the owner instead, they may have forgotten they signed up with google
+		err = cfg.Mailer.Send(ctx, mailer.Message{
+			To:      email,
+			Subject: "You already have a Calple account",
+			Body: "Someone tried to sign up for Calple with this email, but it already has an account.\n\n" +
+				"Sign in with Google or reset your password at " + cfg.FrontendURL + "/auth/forgot-password\n\n" +
+				"If this was not you, you can ignore this email.",
+		})
+		if err != nil {
+			fmt.Printf("ERROR: Signup - failed to send mail: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Check your email to finish signing up"})
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = strings.Split(email, "@")[0]
+	}
+	secret, err := issueLoginToken(ctx, st, &store.LoginToken{
+		Purpose:      store.LoginTokenVerify,
+		Email:        email,
+		Name:         name,
+		PasswordHash: string(hash),
+	}, verifyTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create verification link"})
+		return
+	}
+
+	err = cfg.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your Calple account",
+		Body: "Welcome to Calple! Open this link to confirm your email and sign in:\n\n" +
+			loginLink(cfg, "/auth/verify", secret) + "\n\n" +
+			"The link works for 24 hours. If you did not sign up, you can ignore this email.",
+	})
+	if err != nil {
+		fmt.Printf("ERROR: Signup - failed to send mail: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your email to finish signing up"})
+}
+
+// VerifyEmail finishes a signup and signs in
+func VerifyEmail(c *gin.Context) {
+	var req LoginTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	t, ok := consumeLoginToken(c, store.LoginTokenVerify, req.Token)
+	if !ok {
+		return
+	}
+
+	user, err := signInEmail(ctx, st, nil, t.Email, t.Name, t.PasswordHash)
+	if err != nil {
+		fmt.Printf("ERROR: VerifyEmail - %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	startSession(c, user, req.Remember)
+}
+
+// PasswordLogin signs in with an email and password
+func PasswordLogin(c *gin.Context) {
+	var req PasswordLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	ident, err := st.Identities().Get(ctx, emailProvider, normalizeEmail(req.Email))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+	// magic link only accounts have no password
+	if ident == nil || ident.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(ident.PasswordHash), []byte(req.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	user, err := st.Users().Get(ctx, ident.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if err == nil {
+		user, err = signInEmail(ctx, st, user, ident.Subject, "", "")
+	}
+	if err != nil {
+		fmt.Printf("ERROR: PasswordLogin - %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+	startSession(c, user, req.Remember)
+}
+
+// RequestMagicLink emails a link that signs in without a password
+// an email without an account gets one when the link is opened
+func RequestMagicLink(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := normalizeEmail(req.Email)
+	if !util.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+
+	cfg := getConfig(c)
+	ctx := context.Background()
+
+	secret, err := issueLoginToken(ctx, getStore(c), &store.LoginToken{
+		Purpose: store.LoginTokenMagic,
+		Email:   email,
+	}, magicTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sign in link"})
+		return
+	}
+
+	err = cfg.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Sign in to Calple",
+		Body: "Open this link to sign in to Calple:\n\n" +
+			loginLink(cfg, "/auth/magic", secret) + "\n\n" +
+			"The link works for 15 minutes and only once. If you did not ask for it, you can ignore this email.",
+	})
+	if err != nil {
+		fmt.Printf("ERROR: RequestMagicLink - failed to send mail: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your email for a sign in link"})
+}
+
+// MagicLogin signs in with a magic link token
+func MagicLogin(c *gin.Context) {
+	var req LoginTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, ok := consumeLoginToken(c, store.LoginTokenMagic, req.Token)
+	if !ok {
+		return
+	}
+
+	user, err := signInEmail(context.Background(), getStore(c), nil, t.Email, "", "")
+	if err != nil {
+		fmt.Printf("ERROR: MagicLogin - %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+	startSession(c, user, req.Remember)
+}
+
+// ForgotPassword emails a reset link when the email has an account
+// google users can use it to add a password
+func ForgotPassword(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := normalizeEmail(req.Email)
+
+	st := getStore(c)
+	cfg := getConfig(c)
+	ctx := context.Background()
+
+	// the response never says whether the account exists
+	accepted := gin.H{"message": "If the email has an account, a reset link is on its way"}
+
+	user, err := st.Users().GetByEmail(ctx, email)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	secret, err := issueLoginToken(ctx, st, &store.LoginToken{
+		Purpose: store.LoginTokenReset,
+		Email:   email,
+		UserID:  user.ID,
+	}, resetTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset link"})
+		return
+	}
+
+	err = cfg.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your Calple password",
+		Body: "Open this link to choose a new password:\n\n" +
+			loginLink(cfg, "/auth/reset-password", secret) + "\n\n" +
+			"The link works for one hour. If you did not ask for it, you can ignore this email.",
+	})
+	if err != nil {
+		fmt.Printf("ERROR: ForgotPassword - failed to send mail: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// ResetPassword sets the new password and signs in
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// checked before the token is used up
+	if problem := passwordProblem(req.Password); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	t, ok := consumeLoginToken(c, store.LoginTokenReset, req.Token)
+	if !ok {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user, err := st.Users().Get(ctx, t.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if err == nil {
+		user, err = signInEmail(ctx, st, user, t.Email, "", string(hash))
+	}
+	if err == nil {
+		// whoever knew the old password is signed out everywhere
+		err = st.Sessions().DeleteByUser(ctx, user.ID, "")
+	}
+	if err != nil {
+		fmt.Printf("ERROR: ResetPassword - %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	startSession(c, user, req.Remember)
+}
+
+// RequestEmailChange emails a link to the new address, the email only changes once it is opened
+// the response is the same whether or not the email is taken so accounts cannot be probed
+func RequestEmailChange(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := normalizeEmail(req.Email)
+	if !util.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+
+	user := currentUser(c)
+	if email == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This is already your email"})
+		return
+	}
+
+	st := getStore(c)
+	cfg := getConfig(c)
+	ctx := context.Background()
+
+	accepted := gin.H{"message": "Check your new email to confirm the change"}
+
+	msg := mailer.Message{To: email}
+	_, err := st.Users().GetByEmail(ctx, email)
+	if err == nil {
+		msg.Subject = "Your email is already used on Calple"
+		msg.Body = "Someone tried to move another Calple account to this email, but it already has an account.\n\n" +
+			"If this was not you, you can ignore this email."
+	} else if errors.Is(err, store.ErrNotFound) {
+		secret, err := issueLoginToken(ctx, st, &store.LoginToken{
+			Purpose: store.LoginTokenEmail,
+			Email:   email,
+			UserID:  user.ID,
+		}, emailTokenTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create confirmation link"})
+			return
+		}
+		msg.Subject = "Confirm your new Calple email"
+		msg.Body = "Open this link to use this email for your Calple account:\n\n" +
+			loginLink(cfg, "/auth/change-email", secret) + "\n\n" +
+			"The link works for 24 hours. If you did not ask for it, you can ignore this email."
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if err := cfg.Mailer.Send(ctx, msg); err != nil {
+		fmt.Printf("ERROR: RequestEmailChange - failed to send mail: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// ConfirmEmailChange moves the account to the confirmed email and tells the old one
+// partners keep sharing with the account, they see the new email from then on
+func ConfirmEmailChange(c *gin.Context) {
+	var req LoginTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	st := getStore(c)
+	cfg := getConfig(c)
+	ctx := context.Background()
+
+	t, ok := consumeLoginToken(c, store.LoginTokenEmail, req.Token)
+	if !ok {
+		return
+	}
+
+	prev, err := st.Users().Get(ctx, t.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+	prevEmail := prev.Email
+
+	user, err := accounts.ChangeEmail(ctx, st, t.UserID, t.Email)
+	if errors.Is(err, accounts.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already used by another account"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR: ConfirmEmailChange - %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	if prevEmail != user.Email {
+		err = cfg.Mailer.Send(ctx, mailer.Message{
+			To:      prevEmail,
+			Subject: "Your Calple email was changed",
+			Body: "Your Calple account now uses " + user.Email + " instead of this email.\n\n" +
+				"If this was not you, reset your password at " + cfg.FrontendURL + "/auth/forgot-password",
+		})
+		if err != nil {
+			fmt.Printf("ERROR: ConfirmEmailChange - failed to send mail: %v\n", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email changed", "user": userProfile(user)})
+}
+
+// the emailed links open the frontend, which posts the token back
+// so link scanners in mail clients cannot use up a token by prefetching it
+func loginLink(cfg *Config, path, secret string) string {
+	return cfg.FrontendURL + path + "?token=" + url.QueryEscape(secret)
+}
+
+// random secret for an emailed link, only its hash is stored
+func issueLoginToken(ctx context.Context, st store.Store, t *store.LoginToken, ttl time.Duration) (string, error) {
+	secret, err := util.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	t.Hash = hashTokenSecret(secret)
+	t.CreatedAt = now
+	t.ExpiresAt = now.Add(ttl)
+	if err := st.LoginTokens().Create(ctx, t); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// use up an emailed token, writes the error response and returns false when it is not valid
+func consumeLoginToken(c *gin.Context, purpose, secret string) (*store.LoginToken, bool) {
+	t, err := getStore(c).LoginTokens().Consume(context.Background(), purpose, hashTokenSecret(secret))
+	if errors.Is(err, store.ErrNotFound) || (err == nil && time.Now().After(t.ExpiresAt)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify link"})
+		return nil, false
+	}
+	return t, true
+}
+
+// signInEmail records a login through the email provider
+// user is nil when it should be found by email or created, every caller has proven the email
+// passwordHash replaces the stored password when it is set
+func signInEmail(ctx context.Context, st store.Store, user *store.User, email, name, passwordHash string) (*store.User, error) {
+	now := time.Now()
+
+	isReturningUser := true
+	if user == nil {
+		var err error
+		user, err = st.Users().GetByEmail(ctx, email)
+		if errors.Is(err, store.ErrNotFound) {
+			isReturningUser = false
+			if name == "" {
+				name = strings.Split(email, "@")[0]
+			}
+			user = &store.User{
+				ID:        uuid.NewString(),
+				Email:     email,
+				Name:      name,
+				Sex:       "female",
+				CreatedAt: now,
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	ident, err := st.Identities().Get(ctx, emailProvider, email)
+	if errors.Is(err, store.ErrNotFound) {
+		ident = &store.Identity{Provider: emailProvider, Subject: email, CreatedAt: now}
+	} else if err != nil {
+		return nil, err
+	}
+	ident.UserID = user.ID
+	ident.Email = email
+	ident.LastLoginAt = now
+	if passwordHash != "" {
+		ident.PasswordHash = passwordHash
+	}
+
+	user.ReturningUser = isReturningUser
+	user.LastLoginAt = now
+	if err := st.Users().Save(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := st.Identities().Link(ctx, ident); err != nil {
+		return nil, err
+	}
+	if err := acceptPendingShares(ctx, st, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// sign in as user and answer like AuthStatus
+// remember keeps the session for weeks instead of hours
+func startSession(c *gin.Context, user *store.User, remember bool) {
+	session := sessions.Default(c)
+	session.Set("user_id", user.ID)
+	if remember {
+		session.Set("remember", "true")
+	} else {
+		session.Delete("remember")
+	}
+	if err := session.Save(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authenticated": true, "user": userProfile(user)})
+}
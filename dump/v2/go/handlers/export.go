@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"calple/export"
+)
+
+// small accounts are exported within the request, larger ones are polled
+const exportWait = 5 * time.Second
+
+// largest archive accepted by ImportUser
+const maxImportSize = 64 << 20
+
+// get the export jobs from context
+// this is set by the middleware in server.NewRouter
+func getExports(c *gin.Context) *export.Jobs {
+	return c.MustGet("exports").(*export.Jobs)
+}
+
+// ExportUser builds the zip with all of the user's data
+// when it is ready within a few seconds the zip is the response
+// otherwise 202 with the job to poll at statusUrl and fetch from downloadUrl
+func ExportUser(c *gin.Context) {
+	uid := currentUser(c).ID
+	jobs := getExports(c)
+
+	job, err := jobs.Start(uid)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to start export for %s: %v\n", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportWait)
+	defer cancel()
+	job, err = jobs.Wait(ctx, uid, job.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+		return
+	}
+
+	if job.Status == export.StatusDone {
+		sendExport(c, uid, job.ID)
+		return
+	}
+	if job.Status == export.StatusFailed {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": job.Error, "job": job})
+		return
+	}
+	c.JSON(http.StatusAccepted, exportStatus(job))
+}
+
+// GetExportStatus reports the progress of an export started with ExportUser
+func GetExportStatus(c *gin.Context) {
+	job, err := getExports(c).Get(currentUser(c).ID, c.Param("id"))
+	if errors.Is(err, export.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	c.JSON(http.StatusOK, exportStatus(job))
+}
+
+// DownloadExport sends the zip of a finished export
+func DownloadExport(c *gin.Context) {
+	uid := currentUser(c).ID
+	job, err := getExports(c).Get(uid, c.Param("id"))
+	if errors.Is(err, export.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	if job.Status != export.StatusDone {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "job": job})
+		return
+	}
+	sendExport(c, uid, job.ID)
+}
+
+func sendExport(c *gin.Context, uid, id string) {
+	f, job, err := getExports(c).Open(uid, id)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to open export %s: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read export"})
+		return
+	}
+	defer f.Close()
+
+	name := fmt.Sprintf("calple-export-%s.zip", job.CreatedAt.Format("20060102"))
+	c.DataFromReader(http.StatusOK, job.Size, "application/zip", f, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, name),
+	})
+}
+
+func exportStatus(job export.Job) gin.H {
+	return gin.H{
+		"job":         job,
+		"statusUrl":   "/api/user/export/" + job.ID,
+		"downloadUrl": "/api/user/export/" + job.ID + "/download",
+	}
+}
+
+// ImportUser merges an archive from ExportUser, or a zip with some of its files, into the account
+// the zip is the request body, the query sets the conflict rule (skip, overwrite or newer),
+// the sections to import and dryRun=true to only report what would change
+func ImportUser(c *gin.Context) {
+	user := currentUser(c)
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	opts := export.ImportOptions{
+		Conflict: c.DefaultQuery("conflict", export.ConflictSkip),
+		DryRun:   c.Query("dryRun") == "true",
+	}
+	for _, section := range strings.Split(c.Query("sections"), ",") {
+		if section = strings.TrimSpace(section); section != "" {
+			opts.Sections = append(opts.Sections, section)
+		}
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Archive is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read archive"})
+		return
+	}
+
+	report, err := export.Import(ctx, st, user.ID, bytes.NewReader(data), int64(len(data)), opts)
+	switch {
+	case errors.Is(err, export.ErrInvalidOptions), errors.Is(err, export.ErrInvalidArchive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": strings.TrimPrefix(err.Error(), "export: ")})
+		return
+	case errors.Is(err, export.ErrNothingToImport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Archive has nothing to import"})
+		return
+	case err != nil:
+		fmt.Printf("ERROR: Import for user %s failed: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import archive"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
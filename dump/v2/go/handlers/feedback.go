@@ -2,14 +2,13 @@ package handlers
 
 import (
 	"context"
-	"log" // 1. Add the "log" package
+	"log"
 	"net/http"
 	"time"
 
-	"cloud.google.com/go/firestore"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"google.golang.org/api/iterator"
+
+	"calple/store"
 )
 
 type FeedbackPayload struct {
@@ -23,12 +22,7 @@ type AdminCommentPayload struct {
 
 // SubmitFeedback handles the submission of user feedback.
 func SubmitFeedback(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
 	var payload FeedbackPayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
@@ -36,22 +30,17 @@ func SubmitFeedback(c *gin.Context) {
 		return
 	}
 
-	fsClient, ok := c.MustGet("firestore").(*firestore.Client)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get Firestore client"})
-		return
-	}
+	st := getStore(c)
 	ctx := context.Background()
 
-	feedbackData := map[string]interface{}{
-		"feedbackText": payload.FeedbackText,
-		"submittedAt":  time.Now(),
-		"adminComment": "",
-		"category":     payload.Category,
+	feedback := store.Feedback{
+		FeedbackText: payload.FeedbackText,
+		SubmittedAt:  time.Now(),
+		AdminComment: "",
+		Category:     payload.Category,
 	}
 
-	_, _, err := fsClient.Collection("users").Doc(uid.(string)).Collection("feedback").Add(ctx, feedbackData)
-	if err != nil {
+	if err := st.Feedback().Create(ctx, user.ID, &feedback); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
 		return
 	}
@@ -60,41 +49,21 @@ func SubmitFeedback(c *gin.Context) {
 }
 
 func GetUserFeedback(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
-	log.Printf("Fetching feedback for UID: %s", uid.(string)) // Add this log
+	log.Printf("Fetching feedback for UID: %s", user.ID)
 
-	fsClient, ok := c.MustGet("firestore").(*firestore.Client)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get Firestore client"})
-		return
-	}
+	st := getStore(c)
 	ctx := context.Background()
 
-	feedbackList := make([]map[string]interface{}, 0)
-
-	iter := fsClient.Collection("users").Doc(uid.(string)).Collection("feedback").OrderBy("submittedAt", firestore.Asc).Documents(ctx)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			log.Printf("Firestore query error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to iterate feedback documents"})
-			return
-		}
-		data := doc.Data()
-		data["id"] = doc.Ref.ID
-		feedbackList = append(feedbackList, data)
+	feedbackList, err := st.Feedback().ListByUser(ctx, user.ID)
+	if err != nil {
+		log.Printf("Feedback query error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to iterate feedback documents"})
+		return
 	}
 
-	log.Printf("Found %d feedback documents for UID: %s", len(feedbackList), uid.(string)) // Add this log
+	log.Printf("Found %d feedback documents for UID: %s", len(feedbackList), user.ID)
 
 	c.JSON(http.StatusOK, feedbackList)
 }
@@ -2,129 +2,68 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
-	"cloud.google.com/go/firestore"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-)
-
-type Idea struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Author      string    `json:"author"`
-	CreatedAt   string    `json:"created_at"`
-	UpdatedAt   string    `json:"updated_at"`
-	Likes       int       `json:"likes"`
-	Tags        []string  `json:"tags"`
-	Comments    []Comment `json:"comments"`
-}
 
-type Comment struct {
-	ID        string `json:"id"`
-	Author    string `json:"author"`
-	CreatedAt string `json:"created_at"`
-	Content   string `json:"content"`
-}
+	"calple/store"
+)
 
 // getAllpost; returns all posts from the database
 // IMPORTANT: auth shouldn't be required for this endpoint
 // so that users can see posts without logging in
 
 func GetAllPosts(c *gin.Context) {
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
-
-	q1, err := fsClient.Collection("ideas").Documents(context.Background()).GetAll()
+	st := getStore(c)
 
+	ideas, err := st.Ideas().List(context.Background())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
 		return
 	}
 
-	ideas := []Idea{}
-	for _, doc := range q1 {
-		var idea Idea
-		if err := doc.DataTo(&idea); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse post data"})
-			return
-		}
-		idea.ID = doc.Ref.ID
-		ideas = append(ideas, idea)
-	}
-
 	c.JSON(http.StatusOK, ideas)
 }
 
 // getPost; get posts that user has created
 // IMPORTANT: this requires user to be authenticated unlike getAllPosts
 func GetPost(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	// get user posts from firestore
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	postsRef := userDocRef.Collection("posts")
-	q, err := postsRef.Documents(context.Background()).GetAll()
+	// get user posts from store
+	posts, err := st.Ideas().ListByAuthor(context.Background(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
 		return
 	}
 
-	posts := []Idea{}
-	for _, doc := range q {
-		var post Idea
-		if err := doc.DataTo(&post); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse post data"})
-			return
-		}
-		post.ID = doc.Ref.ID
-		posts = append(posts, post)
-	}
-
 	c.JSON(http.StatusOK, posts)
 }
 
 // addpost; adds a new post to the database
 // IMPORTANT: this requires user to be authenticated like getPost
 func AddPost(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
+	ctx := context.Background()
 
-	// get user email from session
-	userDoc, err := fsClient.Collection("users").Doc(uid.(string)).Get(context.Background())
-	if err != nil || !userDoc.Exists() {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-		return
-	}
-	userName := userDoc.Data()["name"].(string)
-
-	var newPost Idea
+	var newPost store.Idea
 	if err := c.ShouldBindJSON(&newPost); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post data"})
 		return
 	}
 
-	newPost.Author = userName
+	newPost.ID = ""
+	newPost.Author = user.Name
 	newPost.CreatedAt = newPost.UpdatedAt
 	newPost.Likes = 0
 	newPost.Tags = []string{}
-	newPost.Comments = []Comment{}
+	newPost.Comments = []store.Comment{}
 
 	// post title is required
 	if newPost.Title == "" {
@@ -132,33 +71,18 @@ func AddPost(c *gin.Context) {
 		return
 	}
 
-	// add post to firestore
-	postDocRef, _, err := fsClient.Collection("ideas").Add(context.Background(), newPost)
-	if err != nil {
+	// add post to store and to user's posts collection
+	if err := st.Ideas().Create(ctx, user.ID, &newPost); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add post"})
 		return
 	}
-	newPost.ID = postDocRef.ID
-
-	// add post to user's posts collection
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	_, err = userDocRef.Collection("posts").Doc(postDocRef.ID).Set(context.Background(), newPost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add post to user"})
-		return
-	}
 
 	c.JSON(http.StatusCreated, newPost)
 }
 
 // deletePost; deletes a post from the database
 func DeletePost(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
 	postID := c.Param("id")
 	if postID == "" {
@@ -166,51 +90,36 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	// delete post from firestore
-	postDocRef := fsClient.Collection("ideas").Doc(postID)
-	if _, err := postDocRef.Delete(context.Background()); err != nil {
+	// delete post and the user's copy
+	if err := st.Ideas().Delete(context.Background(), user.ID, postID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
 		return
 	}
 
-	// also delete from user's posts collection
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	if _, err := userDocRef.Collection("posts").Doc(postID).Delete(context.Background()); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post from user"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
 
 // UpdatePost; updates an existing post
 func UpdatePost(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
 	postID := c.Param("id")
 	if postID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Post ID is required"})
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	var updatedPost Idea
+	var updatedPost store.Idea
 	if err := c.ShouldBindJSON(&updatedPost); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post data"})
 		return
 	}
 
-	// update post in firestore
-	postDocRef := fsClient.Collection("ideas").Doc(postID)
-	if _, err := postDocRef.Set(context.Background(), updatedPost, firestore.MergeAll); err != nil {
+	// update post in store
+	updatedPost.ID = postID
+	if err := st.Ideas().Update(context.Background(), &updatedPost); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
 		return
 	}
@@ -220,12 +129,7 @@ func UpdatePost(c *gin.Context) {
 
 // AddComment; adds a comment to a post
 func AddComment(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
 	postID := c.Param("id")
 	if postID == "" {
@@ -233,15 +137,16 @@ func AddComment(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	var newComment Comment
+	var newComment store.Comment
 	if err := c.ShouldBindJSON(&newComment); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment data"})
 		return
 	}
 
-	newComment.Author = uid.(string)
+	newComment.ID = ""
+	newComment.Author = user.ID
 	newComment.CreatedAt = time.Now().Format(time.RFC3339)
 
 	if newComment.Content == "" {
@@ -249,64 +154,19 @@ func AddComment(c *gin.Context) {
 		return
 	}
 
-	// add comment to post's comments collection
-	postDocRef := fsClient.Collection("ideas").Doc(postID)
-	commentDocRef, _, err := postDocRef.Collection("comments").Add(context.Background(), newComment)
-	if err != nil {
+	// add comment to post's comments collection and the user's copy
+	// this also increments the comments count on the post
+	if err := st.Ideas().AddComment(context.Background(), user.ID, postID, &newComment); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
 		return
 	}
-	newComment.ID = commentDocRef.ID
-
-	// also add comment to user's comments collection
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	_, err = userDocRef.Collection("comments").Doc(commentDocRef.ID).Set(context.Background(), newComment)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment to user"})
-		return
-	}
-
-	// update post's comments count
-	_, err = postDocRef.Update(context.Background(), []firestore.Update{
-		{Path: "comments_count",
-
-			Value: firestore.Increment(1)},
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comments count"})
-		return
-	}
-
-	// increment comments count in user's posts collection
-	_, err = userDocRef.Collection("posts").Doc(postID).Update(context.Background(), []firestore.Update{
-		{Path: "comments_count", Value: firestore.Increment(1)},
-	})
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comments count in user's posts"})
-		return
-	}
-
-	// increment comments count in post's comments collection
-	_, err = postDocRef.Update(context.Background(), []firestore.Update{
-		{Path: "comments_count", Value: firestore.Increment(1)},
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comments count in post's comments"})
-		return
-	}
 
 	c.JSON(http.StatusCreated, newComment)
 }
 
 // DeleteComment; deletes a comment from a post
 func DeleteComment(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
 	postID := c.Param("post_id")
 	commentID := c.Param("comment_id")
@@ -315,51 +175,20 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	// delete comment from post's comments collection
-	postDocRef := fsClient.Collection("ideas").Doc(postID)
-	commentDocRef := postDocRef.Collection("comments").Doc(commentID)
-	if _, err := commentDocRef.Delete(context.Background()); err != nil {
+	// delete comment from post's comments collection and the user's copy
+	// this also decrements the comments count on the post
+	if err := st.Ideas().DeleteComment(context.Background(), user.ID, postID, commentID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		return
 	}
 
-	// also delete from user's comments collection
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	if _, err := userDocRef.Collection("comments").Doc(commentID).Delete(context.Background()); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment from user"})
-		return
-	}
-
-	// decrement comments count in post's comments collection
-	if _, err := postDocRef.Update(context.Background(), []firestore.Update{
-		{Path: "comments_count", Value: firestore.Increment(-1)},
-	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comments count"})
-		return
-	}
-
-	// decrement comments count in user's posts collection
-	if _, err := userDocRef.Collection("posts").Doc(postID).Update(context.Background(), []firestore.Update{
-		{Path: "comments_count", Value: firestore.Increment(-1)},
-	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comments count in user's posts"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
 }
 
 // UpdateComment; updates an existing comment
 func UpdateComment(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
 	postID := c.Param("post_id")
 	commentID := c.Param("comment_id")
 	if postID == "" || commentID == "" {
@@ -367,17 +196,17 @@ func UpdateComment(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	var updatedComment Comment
+	var updatedComment store.Comment
 	if err := c.ShouldBindJSON(&updatedComment); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment data"})
 		return
 	}
 
 	// update comment in post's comments collection
-	commentDocRef := fsClient.Collection("ideas").Doc(postID).Collection("comments").Doc(commentID)
-	if _, err := commentDocRef.Set(context.Background(), updatedComment, firestore.MergeAll); err != nil {
+	updatedComment.ID = commentID
+	if err := st.Ideas().UpdateComment(context.Background(), postID, &updatedComment); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
 		return
 	}
@@ -387,48 +216,16 @@ func UpdateComment(c *gin.Context) {
 
 // LikePost; increments the likes count for a post
 func LikePost(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	postID := c.Param("id")
-	if postID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Post ID is required"})
-		return
-	}
-
-	fsClient := c.MustGet("firestore").(*firestore.Client)
-
-	// increment likes count in post document
-	postDocRef := fsClient.Collection("ideas").Doc(postID)
-	if _, err := postDocRef.Update(context.Background(), []firestore.Update{
-		{Path: "likes", Value: firestore.Increment(1)},
-	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like post"})
-		return
-	}
-	// also increment likes count in user's posts collection
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	if _, err := userDocRef.Collection("posts").Doc(postID).Update(context.Background(), []firestore.Update{
-		{Path: "likes", Value: firestore.Increment(1)},
-	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update likes count in user's posts"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Post liked successfully"})
+	changeLikes(c, 1, "Failed to like post", "Post liked successfully")
 }
 
 // UnlikePost; decrements the likes count for a post
 func UnlikePost(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	changeLikes(c, -1, "Failed to unlike post", "Post unliked successfully")
+}
+
+func changeLikes(c *gin.Context, delta int, failMsg, okMsg string) {
+	user := currentUser(c)
 
 	postID := c.Param("id")
 	if postID == "" {
@@ -436,25 +233,18 @@ func UnlikePost(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	// decrement likes count in post document
-	postDocRef := fsClient.Collection("ideas").Doc(postID)
-	if _, err := postDocRef.Update(context.Background(), []firestore.Update{
-		{Path: "likes", Value: firestore.Increment(-1)},
-	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlike post"})
-		return
-	}
-	// also decrement likes count in user's posts collection
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	if _, err := userDocRef.Collection("posts").Doc(postID).Update(context.Background(), []firestore.Update{
-		{Path: "likes", Value: firestore.Increment(-1)},
-	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update likes count in user's posts"})
+	// change likes count in post document and in user's posts collection
+	if err := st.Ideas().AddLikes(context.Background(), user.ID, postID, delta); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failMsg})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Post unliked successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": okMsg})
 }
 
 // GetPostComments; retrieves all comments for a post
@@ -465,38 +255,20 @@ func GetPostComments(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	// get comments from post's comments collection
-	postDocRef := fsClient.Collection("ideas").Doc(postID)
-	q, err := postDocRef.Collection("comments").Documents(context.Background()).GetAll()
+	comments, err := st.Ideas().ListComments(context.Background(), postID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
 		return
 	}
 
-	comments := []Comment{}
-	for _, doc := range q {
-		var comment Comment
-		if err := doc.DataTo(&comment); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse comment data"})
-			return
-		}
-		comment.ID = doc.Ref.ID
-		comments = append(comments, comment)
-	}
-
 	c.JSON(http.StatusOK, comments)
 }
 
 // bookmarkPost; adds a post to user's bookmarks
 func BookmarkPost(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
 	postID := c.Param("id")
 	if postID == "" {
@@ -504,14 +276,10 @@ func BookmarkPost(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
 	// add post to user's bookmarks collection
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	_, err := userDocRef.Collection("bookmarks").Doc(postID).Set(context.Background(), map[string]interface{}{
-		"post_id": postID,
-	})
-	if err != nil {
+	if err := st.Ideas().Bookmark(context.Background(), user.ID, postID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to bookmark post"})
 		return
 	}
@@ -521,12 +289,7 @@ func BookmarkPost(c *gin.Context) {
 
 // unbookmarkPost; removes a post from user's bookmarks
 func UnbookmarkPost(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
 	postID := c.Param("id")
 	if postID == "" {
@@ -534,11 +297,10 @@ func UnbookmarkPost(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
 	// remove post from user's bookmarks collection
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	if _, err := userDocRef.Collection("bookmarks").Doc(postID).Delete(context.Background()); err != nil {
+	if err := st.Ideas().Unbookmark(context.Background(), user.ID, postID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unbookmark post"})
 		return
 	}
@@ -548,27 +310,15 @@ func UnbookmarkPost(c *gin.Context) {
 
 // GetBookmarks; retrieves all bookmarked posts for a user
 func GetBookmarks(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+	user := currentUser(c)
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	// get user's bookmarks from firestore
-	userDocRef := fsClient.Collection("users").Doc(uid.(string))
-	q, err := userDocRef.Collection("bookmarks").Documents(context.Background()).GetAll()
+	bookmarks, err := st.Ideas().ListBookmarks(context.Background(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bookmarks"})
 		return
 	}
 
-	bookmarks := []string{}
-	for _, doc := range q {
-		bookmarks = append(bookmarks, doc.Ref.ID)
-	}
-
 	c.JSON(http.StatusOK, bookmarks)
 }
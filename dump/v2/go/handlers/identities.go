@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"calple/store"
+)
+
+// list the names of the configured sign in providers for the login page
+func GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": getConfig(c).Providers.Names()})
+}
+
+// list the providers linked to the user's account
+func GetIdentities(c *gin.Context) {
+	user := currentUser(c)
+
+	identities, err := getStore(c).Identities().ListByUser(context.Background(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// unlink a provider, the last one is kept so the account can still be signed in to
+func DeleteIdentity(c *gin.Context) {
+	user := currentUser(c)
+	st := getStore(c)
+	ctx := context.Background()
+
+	identities, err := st.Identities().ListByUser(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch identities"})
+		return
+	}
+	if len(identities) <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot unlink the only sign in method"})
+		return
+	}
+
+	if err := st.Identities().Unlink(ctx, user.ID, c.Param("provider"), c.Param("subject")); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
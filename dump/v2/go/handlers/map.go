@@ -2,27 +2,15 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
-	"cloud.google.com/go/firestore"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"google.golang.org/api/iterator"
-)
 
-type Pin struct {
-	ID          string    `json:"id" firestore:"-"`
-	Lat         float64   `json:"lat" firestore:"lat"`
-	Lng         float64   `json:"lng" firestore:"lng"`
-	Title       string    `json:"title" firestore:"title"`
-	Description string    `json:"description" firestore:"description"`
-	Location    string    `json:"location" firestore:"location"`
-	Date        string    `json:"date" firestore:"date"` // ISO yyyy-MM-dd
-	CreatedAt   time.Time `json:"createdAt" firestore:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt" firestore:"updatedAt"`
-}
+	"calple/store"
+)
 
 type PinRequest struct {
 	Lat         float64 `json:"lat" binding:"required"`
@@ -34,68 +22,22 @@ type PinRequest struct {
 }
 
 func GetPins(c *gin.Context) {
-	session := sessions.Default(c)
-	uidInter := session.Get("user_id")
-	if uidInter == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-	uid := uidInter.(string)
+	user := currentUser(c)
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 	ctx := context.Background()
 
-	// helper to load pins from a user's subcollection
-	loadPins := func(userID string) ([]Pin, error) {
-		snapIter := fsClient.Collection("users").Doc(userID).
-			Collection("pins").
-			OrderBy("createdAt", firestore.Desc).
-			Documents(ctx)
-		defer snapIter.Stop()
-
-		var out []Pin
-		for {
-			doc, err := snapIter.Next()
-			if err != nil {
-				if err == iterator.Done {
-					break
-				}
-				return nil, err
-			}
-			var p Pin
-			if err := doc.DataTo(&p); err != nil {
-				return nil, err
-			}
-			p.ID = doc.Ref.ID
-			out = append(out, p)
-		}
-		return out, nil
-	}
-
 	// load own pins
-	userPins, err := loadPins(uid)
+	userPins, err := st.Pins().List(ctx, user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user pins"})
 		return
 	}
 
-	// check for active partner
-	connIter, err := fsClient.Collection("users").Doc(uid).
-		Collection("connections").
-		Where("status", "==", "active").
-		Limit(1).
-		Documents(ctx).
-		GetAll()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query connections"})
-		return
-	}
-
-	var partnerPins []Pin
-	if len(connIter) > 0 {
-		if partnerUID, ok := connIter[0].Data()["partnerUID"].(string); ok && partnerUID != "" {
-			partnerPins, _ = loadPins(partnerUID)
-		}
+	// partner pins if there is an active partner
+	var partnerPins []store.Pin
+	if user.Partner != nil && user.Partner.ID != "" {
+		partnerPins, _ = st.Pins().List(ctx, user.Partner.ID)
 	}
 
 	fmt.Printf("DEBUG: Loaded %d user pins and %d partner pins\n", len(userPins), len(partnerPins))
@@ -107,13 +49,7 @@ func GetPins(c *gin.Context) {
 }
 
 func CreatePin(c *gin.Context) {
-	session := sessions.Default(c)
-	uidInter := session.Get("user_id")
-	if uidInter == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-	uid := uidInter.(string)
+	uid := currentUser(c).ID
 
 	var req PinRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -121,41 +57,31 @@ func CreatePin(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 	ctx := context.Background()
 
 	now := time.Now()
-	newPin := map[string]interface{}{
-		"lat":         req.Lat,
-		"lng":         req.Lng,
-		"title":       req.Title,
-		"description": req.Description,
-		"location":    req.Location,
-		"date":        req.Date,
-		"createdAt":   now,
-		"updatedAt":   now,
+	pin := store.Pin{
+		Lat:         req.Lat,
+		Lng:         req.Lng,
+		Title:       req.Title,
+		Description: req.Description,
+		Location:    req.Location,
+		Date:        req.Date,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 
-	docRef, _, err := fsClient.Collection("users").
-		Doc(uid).
-		Collection("pins").
-		Add(ctx, newPin)
-	if err != nil {
+	if err := st.Pins().Create(ctx, uid, &pin); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pin"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"id": docRef.ID})
+	c.JSON(http.StatusCreated, gin.H{"id": pin.ID})
 }
 
 func UpdatePin(c *gin.Context) {
-	session := sessions.Default(c)
-	uidInter := session.Get("user_id")
-	if uidInter == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-	uid := uidInter.(string)
+	uid := currentUser(c).ID
 
 	pinID := c.Param("id")
 	var req PinRequest
@@ -164,25 +90,25 @@ func UpdatePin(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 	ctx := context.Background()
 
-	updates := []firestore.Update{
-		{Path: "lat", Value: req.Lat},
-		{Path: "lng", Value: req.Lng},
-		{Path: "title", Value: req.Title},
-		{Path: "description", Value: req.Description},
-		{Path: "location", Value: req.Location},
-		{Path: "date", Value: req.Date},
-		{Path: "updatedAt", Value: time.Now()},
+	pin := store.Pin{
+		ID:          pinID,
+		Lat:         req.Lat,
+		Lng:         req.Lng,
+		Title:       req.Title,
+		Description: req.Description,
+		Location:    req.Location,
+		Date:        req.Date,
+		UpdatedAt:   time.Now(),
 	}
 
-	_, err := fsClient.Collection("users").
-		Doc(uid).
-		Collection("pins").
-		Doc(pinID).
-		Update(ctx, updates)
-	if err != nil {
+	if err := st.Pins().Update(ctx, uid, &pin); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pin not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pin"})
 		return
 	}
@@ -191,24 +117,13 @@ func UpdatePin(c *gin.Context) {
 
 // DeletePin removes a pin by ID.
 func DeletePin(c *gin.Context) {
-	session := sessions.Default(c)
-	uidInter := session.Get("user_id")
-	if uidInter == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-	uid := uidInter.(string)
+	uid := currentUser(c).ID
 
 	pinID := c.Param("id")
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 	ctx := context.Background()
 
-	_, err := fsClient.Collection("users").
-		Doc(uid).
-		Collection("pins").
-		Doc(pinID).
-		Delete(ctx)
-	if err != nil {
+	if err := st.Pins().Delete(ctx, uid, pinID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pin"})
 		return
 	}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"calple/accounts"
+	"calple/store"
+)
+
+// CurrentUser is the signed in user, resolved once per request by RequireAuth
+type CurrentUser struct {
+	ID    string
+	Email string
+	Name  string
+	Sex   string
+	// MM/DD/YYYY, empty until the couple sets it
+	StartedDating string
+
+	// nil when the user has no active connection
+	Partner *Partner
+
+	// set when the request is authenticated with an api token instead of the session
+	TokenID string
+	Scopes  []string
+}
+
+// Partner is the other side of the active connection
+type Partner struct {
+	ConnectionID string
+	// empty when the partner's user document no longer exists
+	ID    string
+	Email string
+	Name  string
+	Sex   string
+	// MM/DD/YYYY
+	StartedDating string
+}
+
+// RequireAuth loads the signed in user and their active partner into the context
+// every route behind it can use currentUser instead of reading the session
+// an Authorization: Bearer token is used instead of the session cookie when present, or Basic with the token as password
+func RequireAuth(c *gin.Context) {
+	st := getStore(c)
+	ctx := context.Background()
+
+	var uid string
+	var token *store.APIToken
+	if header := c.GetHeader("Authorization"); header != "" {
+		secret, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			// calendar apps only know Basic auth, the token is the password and the username is ignored
+			_, secret, ok = c.Request.BasicAuth()
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		t, err := authenticateToken(ctx, st, strings.TrimSpace(secret))
+		if errors.Is(err, store.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if err != nil {
+			fmt.Printf("ERROR: RequireAuth - failed to look up token: %v\n", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+			return
+		}
+		uid, token = t.UserID, t
+	} else {
+		sessionUID, ok := sessions.Default(c).Get("user_id").(string)
+		if !ok || sessionUID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		uid = sessionUID
+	}
+
+	user, err := st.Users().Get(ctx, uid)
+	if errors.Is(err, store.ErrNotFound) {
+		// the session or token outlived the account
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR: RequireAuth - failed to load user %s: %v\n", uid, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+	// a deleted account can only be restored until it is purged
+	if !user.DeletedAt.IsZero() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "Account is scheduled for deletion",
+			"purgeAt": accounts.PurgeAt(user),
+		})
+		return
+	}
+
+	current := &CurrentUser{
+		ID:    user.ID,
+		Email: user.Email,
+		Name:  user.Name,
+		Sex:   user.Sex,
+
+		StartedDating: user.StartedDating,
+	}
+	if token != nil {
+		current.TokenID = token.ID
+		current.Scopes = token.Scopes
+	}
+
+	partner, err := loadPartner(ctx, st, uid)
+	if err != nil {
+		fmt.Printf("ERROR: RequireAuth - failed to load partner of %s: %v\n", uid, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch connection"})
+		return
+	}
+	current.Partner = partner
+
+	c.Set("user", current)
+	c.Next()
+}
+
+// find the token for a bearer secret
+// unknown and expired tokens are both reported as store.ErrNotFound
+func authenticateToken(ctx context.Context, st store.Store, secret string) (*store.APIToken, error) {
+	if !strings.HasPrefix(secret, tokenSecretPrefix) {
+		return nil, store.ErrNotFound
+	}
+	token, err := st.Tokens().GetByHash(ctx, hashTokenSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !token.ExpiresAt.IsZero() && now.After(token.ExpiresAt) {
+		return nil, store.ErrNotFound
+	}
+
+	// last use is only for display, a minute of precision saves a write per request
+	if now.Sub(token.LastUsedAt) > time.Minute {
+		if err := st.Tokens().MarkUsed(ctx, token.ID, now); err != nil {
+			fmt.Printf("ERROR: failed to update token last use: %v\n", err)
+		}
+	}
+	return token, nil
+}
+
+// resolve the active connection and the partner's user document
+// returns nil without an error when there is no active connection
+func loadPartner(ctx context.Context, st store.Store, uid string) (*Partner, error) {
+	conn, err := st.Connections().Active(ctx, uid)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	partner := &Partner{
+		ConnectionID: conn.ID,
+		Email:        conn.PartnerEmail,
+	}
+
+	// the connection's email is kept for display, the user document has the current one
+	user, err := connectionPartner(ctx, st, conn)
+	if errors.Is(err, store.ErrNotFound) {
+		return partner, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the couple is apart while the partner's account waits to be purged
+	if !user.DeletedAt.IsZero() {
+		return nil, nil
+	}
+
+	partner.ID = user.ID
+	partner.Email = user.Email
+	partner.Name = user.Name
+	partner.Sex = user.Sex
+	partner.StartedDating = user.StartedDating
+	return partner, nil
+}
+
+// the partner's user document, found by email for connections from before partner IDs
+// until the data migration gave them one
+func connectionPartner(ctx context.Context, st store.Store, conn *store.Connection) (*store.User, error) {
+	if conn.PartnerUID != "" {
+		return st.Users().Get(ctx, conn.PartnerUID)
+	}
+	if conn.PartnerEmail == "" {
+		return nil, store.ErrNotFound
+	}
+	user, err := st.Users().GetByEmail(ctx, conn.PartnerEmail)
+	if email := strings.ToLower(conn.PartnerEmail); errors.Is(err, store.ErrNotFound) && email != conn.PartnerEmail {
+		user, err = st.Users().GetByEmail(ctx, email)
+	}
+	return user, err
+}
+
+// get the signed in user from context
+// only valid on routes behind RequireAuth
+func currentUser(c *gin.Context) *CurrentUser {
+	return c.MustGet("user").(*CurrentUser)
+}
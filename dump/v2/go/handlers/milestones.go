@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"calple/milestone"
+	"calple/store"
+	"calple/util"
+)
+
+// the event UpdateUserMetadata used to create for startedDating, the generated anniversaries replace it
+const anniversaryTitle = "Anniversary"
+
+// coupleStart returns the day the couple started dating
+// it is kept the same for both partners, the partner's date covers a user who connected after setting none
+func coupleStart(user *CurrentUser) (time.Time, bool) {
+	date := user.StartedDating
+	if date == "" && user.Partner != nil {
+		date = user.Partner.StartedDating
+	}
+	t, err := time.Parse("01/02/2006", date)
+	return t, err == nil
+}
+
+// isAnniversaryEvent reports whether the event is the stored anniversary of older versions of the app
+func isAnniversaryEvent(d *store.DDay, uid string) bool {
+	return d.CreatorID == uid && d.Title == anniversaryTitle && d.IsAnnual && !d.Editable
+}
+
+// milestoneDDays returns the milestones from first to last (YYYYMMDD) the user has not hidden, as events
+// the anniversaries are left out when the user still has the stored anniversary event
+func milestoneDDays(ctx context.Context, st store.Store, user *CurrentUser, first, last string, anniversaries bool) ([]store.DDay, error) {
+	start, ok := coupleStart(user)
+	if !ok {
+		return nil, nil
+	}
+	from, err1 := time.Parse("20060102", first)
+	to, err2 := time.Parse("20060102", last)
+	if err1 != nil || err2 != nil {
+		return nil, nil
+	}
+
+	hidden, err := st.DDays().ListHiddenMilestones(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []store.DDay{}
+	for _, m := range milestone.Between(start, from, to) {
+		if util.Contains(hidden, m.Key) || !anniversaries && m.Key[len(m.Key)-1] == 'y' {
+			continue
+		}
+		date := m.Date.Format("20060102")
+		out = append(out, store.DDay{
+			ID:             "milestone-" + m.Key,
+			Title:          m.Title,
+			Group:          "important",
+			Date:           date,
+			EndDate:        date,
+			CreatedBy:      user.Email,
+			CreatorID:      user.ID,
+			ConnectedUsers: []string{},
+			SharedWith:     []string{},
+			System:         true,
+			Milestone:      m.Key,
+		})
+	}
+	return out, nil
+}
+
+// moveAnniversary moves the user's stored anniversary event, if they have one, to the new startedDating
+func moveAnniversary(ctx context.Context, st store.Store, uid, startedDating string) error {
+	t, err := time.Parse("01/02/2006", startedDating)
+	if err != nil {
+		return nil
+	}
+	ddays, err := st.DDays().ListByCreator(ctx, uid)
+	if err != nil {
+		return err
+	}
+	for i := range ddays {
+		if !isAnniversaryEvent(&ddays[i], uid) {
+			continue
+		}
+		ddays[i].Date = t.Format("20060102")
+		ddays[i].UpdatedAt = time.Now()
+		return st.DDays().Update(ctx, &ddays[i])
+	}
+	return nil
+}
+
+// GetHiddenMilestones lists the keys of the milestones the user hid
+func GetHiddenMilestones(c *gin.Context) {
+	user := currentUser(c)
+
+	hidden, err := getStore(c).DDays().ListHiddenMilestones(context.Background(), user.ID)
+	if err != nil {
+		fmt.Printf("ERROR: failed to list hidden milestones: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch hidden milestones"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hidden": hidden})
+}
+
+// HideMilestone keeps a generated milestone out of the user's events, the partner still sees it
+func HideMilestone(c *gin.Context) {
+	setMilestoneHidden(c, true)
+}
+
+// ShowMilestone brings a hidden milestone back
+func ShowMilestone(c *gin.Context) {
+	setMilestoneHidden(c, false)
+}
+
+func setMilestoneHidden(c *gin.Context, hide bool) {
+	user := currentUser(c)
+	key := c.Param("key")
+	if !milestone.Valid(key) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Milestone not found"})
+		return
+	}
+
+	st := getStore(c)
+	ctx := context.Background()
+
+	var err error
+	if hide {
+		err = st.DDays().HideMilestone(ctx, user.ID, key)
+	} else {
+		err = st.DDays().ShowMilestone(ctx, user.ID, key)
+	}
+	if err != nil {
+		fmt.Printf("ERROR: failed to update hidden milestone %s: %v\n", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update milestone"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"milestone": key, "hidden": hide})
+}
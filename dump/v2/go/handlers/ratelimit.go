@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"calple/ratelimit"
+)
+
+// get the rate limiter from context
+// this is set by the middleware in server.NewRouter
+func getLimiter(c *gin.Context) ratelimit.Limiter {
+	return c.MustGet("limiter").(ratelimit.Limiter)
+}
+
+// RateLimit limits the route with the named policy from the config
+// requests are counted per user behind RequireAuth and per client ip otherwise
+// a policy that is not configured (or turned off) lets everything through
+func RateLimit(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, ok := getConfig(c).RateLimits[name]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		key := name + ":ip:" + c.ClientIP()
+		if _, ok := c.Get("user"); ok {
+			key = name + ":user:" + currentUser(c).ID
+		}
+
+		allowed, wait, err := getLimiter(c).Allow(context.Background(), key, policy)
+		if err != nil {
+			// a broken shared store should not take the api down with it
+			fmt.Printf("ERROR: Rate limiter failed for %s: %v\n", key, err)
+			c.Next()
+			return
+		}
+		if !allowed {
+			seconds := int(math.Ceil(wait.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -4,70 +4,47 @@ import (
 	"context"
 	"net/http"
 
-	"cloud.google.com/go/firestore"
 	"github.com/gin-gonic/gin"
-)
 
-type Roulette struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-}
+	"calple/store"
+)
 
-// getAllpost; returns all posts from the database
-// IMPORTANT: auth shouldn't be required for this endpoint
-// so that users can see posts without logging in
+// getIdeaRoulette; returns all roulette ideas from the database
 func GetIdeaRoulette(c *gin.Context) {
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
-
-	q1, err := fsClient.Collection("roulette").Documents(context.Background()).GetAll()
+	st := getStore(c)
 
+	ideas, err := st.Roulette().List(context.Background())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
 		return
 	}
 
-	ideas := []Roulette{}
-	for _, doc := range q1 {
-		var roulette Roulette
-		if err := doc.DataTo(&roulette); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse post data"})
-			return
-		}
-		roulette.ID = doc.Ref.ID
-		ideas = append(ideas, roulette)
-	}
-
 	c.JSON(http.StatusOK, ideas)
 }
 
 // addIdeaRoulette; adds a new idea to the roulette
 func AddIdeaRoulette(c *gin.Context) {
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
-	var roulette Roulette
+	var roulette store.Roulette
 	if err := c.ShouldBindJSON(&roulette); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
 	// add the new idea to the database
-	docRef, _, err := fsClient.Collection("roulette").Add(context.Background(), roulette)
-	if err != nil {
+	roulette.ID = ""
+	if err := st.Roulette().Create(context.Background(), &roulette); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add idea"})
 		return
 	}
 
-	roulette.ID = docRef.ID
 	c.JSON(http.StatusCreated, roulette)
 }
 
 // deleteIdeaRoulette; deletes an idea from the roulette
 func DeleteIdeaRoulette(c *gin.Context) {
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
 	// get the ID from the URL parameter
 	id := c.Param("id")
@@ -77,8 +54,7 @@ func DeleteIdeaRoulette(c *gin.Context) {
 	}
 
 	// delete the idea from the database
-	_, err := fsClient.Collection("roulette").Doc(id).Delete(context.Background())
-	if err != nil {
+	if err := st.Roulette().Delete(context.Background(), id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete idea"})
 		return
 	}
@@ -88,8 +64,7 @@ func DeleteIdeaRoulette(c *gin.Context) {
 
 // editIdeaRoulette; edits an existing idea in the roulette
 func EditIdeaRoulette(c *gin.Context) {
-	// get firestore client from context
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 
 	// get the ID from the URL parameter
 	id := c.Param("id")
@@ -98,15 +73,15 @@ func EditIdeaRoulette(c *gin.Context) {
 		return
 	}
 
-	var roulette Roulette
+	var roulette store.Roulette
 	if err := c.ShouldBindJSON(&roulette); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
 	// update the idea in the database
-	_, err := fsClient.Collection("roulette").Doc(id).Set(context.Background(), roulette)
-	if err != nil {
+	roulette.ID = id
+	if err := st.Roulette().Update(context.Background(), &roulette); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update idea"})
 		return
 	}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"calple/sessionstore"
+	"calple/store"
+)
+
+// SessionInfo is a signed in device
+type SessionInfo struct {
+	store.Session
+	// the session of this request
+	Current bool `json:"current"`
+}
+
+// list the devices the user is signed in on, most recently seen first
+func GetSessions(c *gin.Context) {
+	user := currentUser(c)
+	current := sessionstore.PublicID(sessions.Default(c).ID())
+
+	list, err := getStore(c).Sessions().ListByUser(context.Background(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	now := time.Now()
+	out := []SessionInfo{}
+	for _, sess := range list {
+		if now.After(sess.ExpiresAt) {
+			continue
+		}
+		out = append(out, SessionInfo{Session: sess, Current: sess.ID == current})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": out})
+}
+
+// sign out one device, the current one included
+func DeleteSession(c *gin.Context) {
+	user := currentUser(c)
+	st := getStore(c)
+	ctx := context.Background()
+
+	sess, err := st.Sessions().Get(ctx, c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) || (err == nil && sess.UserID != user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err == nil {
+		err = st.Sessions().Delete(ctx, sess.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// sign out every other device
+func DeleteOtherSessions(c *gin.Context) {
+	user := currentUser(c)
+	current := sessionstore.PublicID(sessions.Default(c).ID())
+
+	if err := getStore(c).Sessions().DeleteByUser(context.Background(), user.ID, current); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signed out of every other device"})
+}
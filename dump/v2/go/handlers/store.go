@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"calple/store"
+)
+
+// get the storage backend from context
+// this is set by the middleware in server.NewRouter
+func getStore(c *gin.Context) store.Store {
+	return c.MustGet("store").(store.Store)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"calple/store"
+	"calple/util"
+)
+
+// every secret starts with this so leaked tokens are easy to recognize
+const tokenSecretPrefix = "cpl_"
+
+// resources a token can be scoped to, each with a :read and a :write scope
+// write also allows read
+var tokenResources = []string{"ddays", "connection", "ideas", "roulette", "periods", "user", "checkin", "feedback", "pins"}
+
+type CreateTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// 0 means the token does not expire
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+func validScope(scope string) bool {
+	resource, access, ok := strings.Cut(scope, ":")
+	return ok && (access == "read" || access == "write") && util.Contains(tokenResources, resource)
+}
+
+// HasScope reports whether the request may use scope
+// session users are not limited by scopes
+func (u *CurrentUser) HasScope(scope string) bool {
+	if u.TokenID == "" {
+		return true
+	}
+	if util.Contains(u.Scopes, scope) {
+		return true
+	}
+	resource, access, _ := strings.Cut(scope, ":")
+	return access == "read" && util.Contains(u.Scopes, resource+":write")
+}
+
+// RequireScope checks the token scope for a resource
+// requests that only read need resource:read, everything else resource:write
+// the WebDAV methods PROPFIND and REPORT only read too
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := resource + ":write"
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+			scope = resource + ":read"
+		}
+		if !currentUser(c).HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token is missing the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects api tokens
+// used for routes a leaked token should never reach, like managing tokens
+func RequireSession(c *gin.Context) {
+	if currentUser(c).TokenID != "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This route requires a signed in session"})
+		return
+	}
+	c.Next()
+}
+
+// random secret, only its hash is stored
+func newTokenSecret() (string, error) {
+	secret, err := util.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return tokenSecretPrefix + secret, nil
+}
+
+// the secrets are random so a plain sha256 is enough, no salt or slow hash needed
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// list the user's tokens, secrets are never returned
+func GetTokens(c *gin.Context) {
+	user := currentUser(c)
+	st := getStore(c)
+
+	tokens, err := st.Tokens().ListByUser(context.Background(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// create a token, the secret is only in this response
+func CreateToken(c *gin.Context) {
+	user := currentUser(c)
+
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+		return
+	}
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope})
+			return
+		}
+		if !util.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresInDays must be between 0 and 365"})
+		return
+	}
+
+	secret, err := newTokenSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	now := time.Now()
+	token := store.APIToken{
+		UserID:    user.ID,
+		Name:      req.Name,
+		Prefix:    secret[:len(tokenSecretPrefix)+6],
+		Hash:      hashTokenSecret(secret),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays > 0 {
+		token.ExpiresAt = now.AddDate(0, 0, req.ExpiresInDays)
+	}
+
+	if err := getStore(c).Tokens().Create(context.Background(), &token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": secret, "apiToken": token})
+}
+
+// revoke a token by ID
+func DeleteToken(c *gin.Context) {
+	user := currentUser(c)
+	st := getStore(c)
+
+	if err := st.Tokens().Delete(context.Background(), user.ID, c.Param("id")); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+
+	"calple/accounts"
+	"calple/store"
 )
 
 type UserMetadata struct {
@@ -20,25 +23,66 @@ type UserMetadata struct {
 	UpdatedAt     time.Time `json:"updatedAt"`
 }
 
+// UserProfile is the allowlist of user fields the api returns to the user themselves
+// anything else on the user document (like oauth tokens) stays on the server
+type UserProfile struct {
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	Sex           string    `json:"sex"`
+	StartedDating string    `json:"startedDating"`
+	ReturningUser bool      `json:"returning_user"`
+	LastLoginAt   time.Time `json:"last_login_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// PartnerProfile is the allowlist of user fields a partner can see
+type PartnerProfile struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	Name          string `json:"name"`
+	Sex           string `json:"sex"`
+	StartedDating string `json:"startedDating"`
+}
+
+func userProfile(u *store.User) UserProfile {
+	return UserProfile{
+		ID:            u.ID,
+		Email:         u.Email,
+		Name:          u.Name,
+		Sex:           u.Sex,
+		StartedDating: u.StartedDating,
+		ReturningUser: u.ReturningUser,
+		LastLoginAt:   u.LastLoginAt,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+	}
+}
+
+func partnerProfile(u *store.User) PartnerProfile {
+	return PartnerProfile{
+		ID:            u.ID,
+		Email:         u.Email,
+		Name:          u.Name,
+		Sex:           u.Sex,
+		StartedDating: u.StartedDating,
+	}
+}
+
 type UpdateUserMetadataRequest struct {
 	Sex           *string `json:"sex,omitempty"`
 	StartedDating *string `json:"startedDating,omitempty"` // YYYY-MM-DD
 }
 
 func GetUserMetadata(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 	ctx := context.Background()
 
-	doc, err := fsClient.Collection("users").Doc(uid.(string)).Get(ctx)
+	// the middleware only keeps the basic fields, the metadata needs the full document
+	user, err := st.Users().Get(ctx, currentUser(c).ID)
 	if err != nil {
-		if strings.Contains(err.Error(), "NotFound") {
+		if errors.Is(err, store.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
@@ -46,18 +90,11 @@ func GetUserMetadata(c *gin.Context) {
 		return
 	}
 
-	data := doc.Data()
-
-	c.JSON(http.StatusOK, gin.H{"userMetadata": data})
+	c.JSON(http.StatusOK, gin.H{"userMetadata": userProfile(user)})
 }
 
 func UpdateUserMetadata(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
+	current := currentUser(c)
 
 	var req UpdateUserMetadataRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -65,29 +102,24 @@ func UpdateUserMetadata(c *gin.Context) {
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 	ctx := context.Background()
-	uidStr := uid.(string)
 
 	// fetch previous startedDating value
-	// this is needed to determine if we need to create or update event
-	userDoc, err := fsClient.Collection("users").Doc(uidStr).Get(ctx)
+	// this is needed to determine if the anniversary event moves
+	user, err := st.Users().Get(ctx, current.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
 		return
 	}
-	prevStartedDating, _ := userDoc.Data()["startedDating"].(string)
-
-	updateData := []firestore.Update{
-		{Path: "updatedAt", Value: time.Now()},
-	}
+	prevStartedDating := user.StartedDating
 
 	if req.Sex != nil {
 		if *req.Sex != "male" && *req.Sex != "female" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid value for sex"})
 			return
 		}
-		updateData = append(updateData, firestore.Update{Path: "sex", Value: *req.Sex})
+		user.Sex = *req.Sex
 	}
 
 	if req.StartedDating != nil {
@@ -96,185 +128,115 @@ func UpdateUserMetadata(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format for startedDating. Use MM/DD/YYYY"})
 			return
 		}
-		updateData = append(updateData, firestore.Update{Path: "startedDating", Value: *req.StartedDating})
+		user.StartedDating = *req.StartedDating
 	}
 
-	userDocRef := fsClient.Collection("users").Doc(uidStr)
-	_, err = userDocRef.Update(ctx, updateData)
-	if err != nil {
+	user.UpdatedAt = time.Now()
+	if err := st.Users().Save(ctx, user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user metadata"})
 		return
 	}
 
-	// event handling for startedDating
+	// the milestones follow startedDating on their own, only the anniversary event older versions stored is moved
 	if req.StartedDating != nil && *req.StartedDating != prevStartedDating {
-		userEmail := userDoc.Data()["email"].(string)
-		ddayTitle := "Anniversary"
-		ddayDate := ""
-		t, _ := time.Parse("01/02/2006", *req.StartedDating)
-		ddayDate = t.Format("20060102")
-
-		ddayQuery := fsClient.Collection("ddays").
-			Where("createdBy", "==", userEmail).
-			Where("title", "==", ddayTitle).
-			Limit(1)
-		ddayDocs, err := ddayQuery.Documents(ctx).GetAll()
+		if err := moveAnniversary(ctx, st, user.ID, *req.StartedDating); err != nil {
+			fmt.Printf("ERROR: failed to move the anniversary of %s: %v\n", user.ID, err)
+		}
+	}
 
+	// if startedDating updated, also update for partner
+	if req.StartedDating != nil && current.Partner != nil && current.Partner.ID != "" {
+		partner, err := st.Users().Get(ctx, current.Partner.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing event"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve partner"})
 			return
 		}
-
-		if strings.TrimSpace(prevStartedDating) == "" && *req.StartedDating != "" {
-			newDDay := map[string]interface{}{
-				"title":          ddayTitle,
-				"group":          "important",
-				"description":    "The day everything started",
-				"date":           ddayDate,
-				"isAnnual":       true,
-				"createdBy":      userEmail,
-				"connectedUsers": []string{},
-				"createdAt":      time.Now(),
-				"updatedAt":      time.Now(),
-				"editable":       false,
+		if partner.StartedDating != *req.StartedDating {
+			partner.StartedDating = *req.StartedDating
+			partner.UpdatedAt = time.Now()
+			if err := st.Users().Save(ctx, partner); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update partner metadata"})
+				return
 			}
-			_, _, _ = fsClient.Collection("ddays").Add(ctx, newDDay)
-		} else if prevStartedDating != "" && *req.StartedDating != "" && len(ddayDocs) > 0 {
-			ddayRef := ddayDocs[0].Ref
-			_, _ = ddayRef.Update(ctx, []firestore.Update{
-				{Path: "date", Value: ddayDate},
-				{Path: "updatedAt", Value: time.Now()},
-			})
-		}
-	}
-
-	// if startedDating updated, also update for partner
-	if req.StartedDating != nil {
-		connectionDocs, _ := fsClient.Collection("users").Doc(uidStr).Collection("connections").
-			Where("status", "==", "active").Limit(1).Documents(ctx).GetAll()
-
-		if len(connectionDocs) > 0 {
-			connectionData := connectionDocs[0].Data()
-			if partnerUID, ok := connectionData["partnerUID"].(string); ok && partnerUID != "" {
-				partnerDocRef := fsClient.Collection("users").Doc(partnerUID)
-				parsedDate := *req.StartedDating
-				partnerDocRef.Update(ctx, []firestore.Update{
-					{Path: "startedDating", Value: parsedDate},
-					{Path: "updatedAt", Value: time.Now()},
-				})
+			if err := moveAnniversary(ctx, st, partner.ID, *req.StartedDating); err != nil {
+				fmt.Printf("ERROR: failed to move the anniversary of %s: %v\n", partner.ID, err)
 			}
 		}
 	}
 
-	updatedDoc, err := userDocRef.Get(ctx)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated metadata"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"userMetadata": updatedDoc.Data()})
+	c.JSON(http.StatusOK, gin.H{"userMetadata": userProfile(user)})
 }
 
 func GetPartnerMetadata(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	user := currentUser(c)
+	// a partner without an account has no metadata
+	if user.Partner == nil || user.Partner.ID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No partner connection found"})
 		return
 	}
 
-	fsClient := c.MustGet("firestore").(*firestore.Client)
+	st := getStore(c)
 	ctx := context.Background()
 
-	connectionDocs, err := fsClient.Collection("users").Doc(uid.(string)).Collection("connections").
-		Where("status", "==", "active").
-		Documents(ctx).GetAll()
-
+	partner, err := st.Users().Get(ctx, user.Partner.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch connection"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch partner data"})
 		return
 	}
 
-	if len(connectionDocs) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No partner connection found"})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{"partnerMetadata": partnerProfile(partner)})
+}
 
-	connectionData := connectionDocs[0].Data()
-	partnerEmail := connectionData["partnerEmail"].(string)
+// DeleteUser starts the grace period of the account and signs it out everywhere
+// the data stays until the purge, so signing in again and restoring brings it all back
+func DeleteUser(c *gin.Context) {
+	uid := currentUser(c).ID
 
-	partnerUserDocs, err := fsClient.Collection("users").
-		Where("email", "==", partnerEmail).
-		Documents(ctx).GetAll()
+	st := getStore(c)
+	ctx := context.Background()
 
-	if err != nil || len(partnerUserDocs) == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch partner data"})
+	user, err := accounts.Delete(ctx, st, uid, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user account"})
 		return
 	}
 
-	partnerDoc := partnerUserDocs[0]
-	partnerData := partnerDoc.Data()
+	// clear session
+	session := sessions.Default(c)
+	session.Clear()
+	session.Save()
+
+	// clear cookie
+	c.SetCookie("session", "", -1, "/", "", true, true)
 
-	c.JSON(http.StatusOK, gin.H{"partnerMetadata": partnerData})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User account scheduled for deletion",
+		"purgeAt": accounts.PurgeAt(user),
+	})
 }
 
-func DeleteUser(c *gin.Context) {
-	session := sessions.Default(c)
-	uid := session.Get("user_id")
-	if uid == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+// RestoreUser cancels the deletion of the signed in account during its grace period
+// it is routed outside RequireAuth, which turns deleted accounts away
+func RestoreUser(c *gin.Context) {
+	uid, ok := sessions.Default(c).Get("user_id").(string)
+	if !ok || uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	// get client from context
-	fsClient, ok := c.MustGet("firestore").(*firestore.Client)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get Firestore client"})
+	user, err := accounts.Restore(context.Background(), getStore(c), uid)
+	if errors.Is(err, accounts.ErrNotDeleted) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account is not scheduled for deletion"})
 		return
 	}
-
-	ctx := context.Background()
-	uidStr := uid.(string)
-
-	userDoc, err := fsClient.Collection("users").Doc(uidStr).Get(ctx)
-	if err != nil {
-		// if user doc is not found it might have been already deleted
-		// just proceed with cleanup
-	}
-
-	if userDoc.Exists() {
-		// remove connections
-		connections, _ := fsClient.Collection("users").Doc(uidStr).Collection("connections").Documents(ctx).GetAll()
-		for _, connDoc := range connections {
-			connData := connDoc.Data()
-			if partnerEmail, ok := connData["partnerEmail"].(string); ok {
-				partnerDocs, _ := fsClient.Collection("users").Where("email", "==", partnerEmail).Limit(1).Documents(ctx).GetAll()
-				if len(partnerDocs) > 0 {
-					partnerID := partnerDocs[0].Ref.ID
-					fsClient.Collection("users").Doc(partnerID).Collection("connections").Doc(connDoc.Ref.ID).Delete(ctx)
-				}
-			}
-		}
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
 	}
-
-	// deleting a document does not delete its subcollections
-	// for a full cleanup you would need to recursively delete all documents in all subcollections
-	// cause Firestore does not support deleting a document with subcollections in one go
-	// this is a simplified cleanup for the connections.
-
-	// delete user document from users collection
-	_, err = fsClient.Collection("users").Doc(uidStr).Delete(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user document from database"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user account"})
 		return
 	}
 
-	// clear session
-	session.Clear()
-	session.Save()
-
-	// clear cookie
-	c.SetCookie("session", "", -1, "/", "", true, true)
-
-	c.JSON(http.StatusOK, gin.H{"message": "User account deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "User account restored", "user": userProfile(user)})
 }
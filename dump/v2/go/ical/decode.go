@@ -0,0 +1,322 @@
+package ical
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	// the server image has no zoneinfo, the TZIDs of timed events are looked up in the embedded copy
+	_ "time/tzdata"
+)
+
+// ErrInvalid is returned when the data is not an iCalendar stream
+var ErrInvalid = errors.New("ical: not a calendar")
+
+// Decode reads the VEVENTs of every VCALENDAR in r
+// timed events are turned into the days they cover in their own time zone, floating times count as UTC
+// time zones are looked up by their TZID in the tz database, the VTIMEZONE definitions are not read
+// and unknown ones count as UTC
+// an event whose start cannot be read is returned with a zero Start
+func Decode(r io.Reader) (*Calendar, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := unfold(string(data))
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, ErrInvalid
+	}
+
+	cal := &Calendar{}
+	var stack []string
+	var ev *rawEvent
+	for _, line := range lines {
+		p, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		switch p.name {
+		case "BEGIN":
+			component := strings.ToUpper(p.value)
+			stack = append(stack, component)
+			if component == "VEVENT" && len(stack) == 2 {
+				ev = &rawEvent{}
+			}
+			continue
+		case "END":
+			if len(stack) == 2 && ev != nil {
+				cal.Events = append(cal.Events, ev.event())
+				ev = nil
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		switch {
+		case len(stack) == 1 && p.name == "X-WR-CALNAME":
+			cal.Name = unescape(p.value)
+		// properties of alarms and other components nested in the event are not the event's
+		case len(stack) == 2 && ev != nil:
+			ev.set(p)
+		}
+	}
+	return cal, nil
+}
+
+// property is a content line, name;param=value:value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfold joins the continuation lines, which start with a space or a tab
+func unfold(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseLine splits a content line, colons and semicolons inside quoted parameter values do not count
+func parseLine(line string) (property, bool) {
+	p := property{params: map[string]string{}}
+	quoted := false
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == ';' || c == ':':
+			part := line[start:i]
+			if p.name == "" {
+				p.name = strings.ToUpper(part)
+			} else {
+				key, value, _ := strings.Cut(part, "=")
+				p.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+			}
+			start = i + 1
+			if c == ':' {
+				p.value = line[i+1:]
+				return p, p.name != ""
+			}
+		}
+	}
+	return p, false
+}
+
+// unescape reads TEXT values, RFC 5545 3.3.11
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitText splits a list of TEXT values on the commas that are not escaped
+func splitText(s string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			out = append(out, unescape(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(out, unescape(s[start:]))
+}
+
+// rawEvent collects the properties of a VEVENT until its END
+type rawEvent struct {
+	Event
+	start, end, recurrenceID *property
+	duration                 string
+	exdates                  []*property
+}
+
+func (ev *rawEvent) set(p property) {
+	switch p.name {
+	case "UID":
+		ev.UID = p.value
+	case "SUMMARY":
+		ev.Summary = unescape(p.value)
+	case "DESCRIPTION":
+		ev.Description = unescape(p.value)
+	case "CATEGORIES":
+		for _, c := range splitText(p.value) {
+			if c = strings.TrimSpace(c); c != "" {
+				ev.Categories = append(ev.Categories, c)
+			}
+		}
+	case "ATTACH", "IMAGE":
+		// binary attachments are not kept, only links
+		if ev.Image == "" && (strings.HasPrefix(p.value, "https://") || strings.HasPrefix(p.value, "http://")) {
+			ev.Image = p.value
+		}
+	case "DTSTART":
+		ev.start = &p
+	case "DTEND":
+		ev.end = &p
+	case "DURATION":
+		ev.duration = p.value
+	case "RRULE":
+		ev.RRule = p.value
+	case "EXDATE":
+		ev.exdates = append(ev.exdates, &p)
+	case "RECURRENCE-ID":
+		ev.recurrenceID = &p
+	case "STATUS":
+		ev.Status = strings.ToUpper(p.value)
+	case "CREATED":
+		ev.Created, _ = parseDateTime(p.value, nil)
+	case "LAST-MODIFIED":
+		ev.Modified, _ = parseDateTime(p.value, nil)
+	}
+}
+
+// event resolves the dates, End is the day after the last day the event covers
+func (ev *rawEvent) event() Event {
+	out := ev.Event
+	if ev.start == nil {
+		return out
+	}
+	start, timed, err := parseValue(ev.start)
+	if err != nil {
+		return out
+	}
+
+	end := start
+	switch d, ok := parseDuration(ev.duration); {
+	case ev.end != nil:
+		if t, _, err := parseValue(ev.end); err == nil {
+			end = t
+		}
+	case ok:
+		end = start.Add(d)
+	case !timed:
+		// a date without an end lasts the day
+		end = start.AddDate(0, 0, 1)
+	}
+
+	out.Start = dateOf(start)
+	last := out.Start
+	if end.After(start) {
+		// the end is exclusive, an event ending at midnight does not cover the next day
+		last = dateOf(end.Add(-time.Nanosecond))
+	}
+	out.End = last.AddDate(0, 0, 1)
+
+	for _, p := range ev.exdates {
+		for _, value := range strings.Split(p.value, ",") {
+			q := *p
+			q.value = value
+			if t, _, err := parseValue(&q); err == nil {
+				out.ExDates = append(out.ExDates, dateOf(t))
+			}
+		}
+	}
+	if ev.recurrenceID != nil {
+		if t, _, err := parseValue(ev.recurrenceID); err == nil {
+			out.RecurrenceID = dateOf(t)
+		}
+	}
+	return out
+}
+
+// parseValue reads a DATE or DATE-TIME property, timed reports which one it was
+func parseValue(p *property) (t time.Time, timed bool, err error) {
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(p.value) == len("20060102") {
+		t, err = time.Parse("20060102", p.value)
+		return t, false, err
+	}
+	var loc *time.Location
+	if tzid := p.params["TZID"]; tzid != "" {
+		loc, _ = time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+	}
+	t, err = parseDateTime(p.value, loc)
+	return t, true, err
+}
+
+// parseDateTime reads a DATE-TIME in UTC (with a Z), in loc or floating
+func parseDateTime(value string, loc *time.Location) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+// parseDuration reads the dur-value of RFC 5545 3.3.6, like P1D, PT1H30M or P2W
+func parseDuration(s string) (time.Duration, bool) {
+	s, negative := strings.CutPrefix(s, "-")
+	s = strings.TrimPrefix(s, "+")
+	s, ok := strings.CutPrefix(s, "P")
+	if !ok || s == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	for s != "" {
+		if s[0] == 'T' {
+			units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+			s = s[1:]
+			continue
+		}
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, false
+		}
+		n, err := strconv.Atoi(s[:i])
+		unit, ok := units[s[i]]
+		if err != nil || !ok {
+			return 0, false
+		}
+		d += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	if negative {
+		d = -d
+	}
+	return d, true
+}
+
+// dateOf is the day t falls on where it happens, as a UTC date
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
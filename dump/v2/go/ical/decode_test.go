@@ -0,0 +1,136 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"X-WR-CALNAME:Our\\, calendar",
+		"BEGIN:VTIMEZONE",
+		"TZID:Asia/Seoul",
+		"BEGIN:STANDARD",
+		"DTSTART:19700101T000000",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+		// a trip over three days, with a folded description
+		"BEGIN:VEVENT",
+		"UID:trip@example.com",
+		"DTSTART;VALUE=DATE:20250710",
+		"DTEND;VALUE=DATE:20250713",
+		"SUMMARY:Trip\\; Busan",
+		"DESCRIPTION:ferry\\, then",
+		"  train\\nback on sunday",
+		"CATEGORIES:travel,fun\\,stuff",
+		"ATTACH;FMTTYPE=image/jpeg:https://images.example.com/trip.jpg",
+		"BEGIN:VALARM",
+		"DESCRIPTION:not the event's",
+		"TRIGGER:-PT15M",
+		"END:VALARM",
+		"END:VEVENT",
+		// breakfast in seoul is on the 10th there, even though it is the 9th in utc
+		"BEGIN:VEVENT",
+		"UID:breakfast@example.com",
+		`DTSTART;TZID="Asia/Seoul":20250710T070000`,
+		"DURATION:PT2H",
+		"SUMMARY:Breakfast",
+		"RRULE:FREQ=WEEKLY;BYDAY=TH",
+		"EXDATE;TZID=Asia/Seoul:20250717T070000,20250724T070000",
+		"END:VEVENT",
+		// a timed event ending at midnight only covers its own day
+		"BEGIN:VEVENT",
+		"UID:party@example.com",
+		"DTSTART:20250801T200000Z",
+		"DTEND:20250802T000000Z",
+		"SUMMARY:Party",
+		"STATUS:cancelled",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:party@example.com",
+		"RECURRENCE-ID;VALUE=DATE:20250801",
+		"DTSTART;VALUE=DATE:20250801",
+		"SUMMARY:Moved party",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:broken@example.com",
+		"DTSTART:someday",
+		"SUMMARY:Broken",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	cal, err := Decode(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.Name != "Our, calendar" || len(cal.Events) != 5 {
+		t.Fatalf("calendar %q with %d events", cal.Name, len(cal.Events))
+	}
+
+	day := func(s string) time.Time {
+		d, _ := time.Parse("20060102", s)
+		return d
+	}
+	trip, breakfast, party, moved, broken := cal.Events[0], cal.Events[1], cal.Events[2], cal.Events[3], cal.Events[4]
+	if trip.Summary != "Trip; Busan" || trip.Description != "ferry, then train\nback on sunday" ||
+		!slices.Equal(trip.Categories, []string{"travel", "fun,stuff"}) || trip.Image != "https://images.example.com/trip.jpg" ||
+		!trip.Start.Equal(day("20250710")) || !trip.End.Equal(day("20250713")) {
+		t.Errorf("trip = %+v", trip)
+	}
+	if !breakfast.Start.Equal(day("20250710")) || !breakfast.End.Equal(day("20250711")) || breakfast.RRule != "FREQ=WEEKLY;BYDAY=TH" ||
+		!slices.EqualFunc(breakfast.ExDates, []time.Time{day("20250717"), day("20250724")}, time.Time.Equal) {
+		t.Errorf("breakfast = %+v", breakfast)
+	}
+	if !party.Start.Equal(day("20250801")) || !party.End.Equal(day("20250802")) || party.Status != "CANCELLED" {
+		t.Errorf("party = %+v", party)
+	}
+	if !moved.RecurrenceID.Equal(day("20250801")) || !moved.End.Equal(day("20250802")) {
+		t.Errorf("moved party = %+v", moved)
+	}
+	if !broken.Start.IsZero() {
+		t.Errorf("broken = %+v", broken)
+	}
+
+	if _, err := Decode(strings.NewReader("not a calendar")); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Decode of plain text: %v", err)
+	}
+}
+
+// what Encode writes, Decode reads back
+func TestRoundTrip(t *testing.T) {
+	in := Event{
+		UID:         "x@calple",
+		Summary:     strings.Repeat("우리의 백일; ", 10),
+		Description: "a, b\\c\nd",
+		Categories:  []string{"important"},
+		Image:       "https://images.calple.test/x.jpg",
+		Start:       time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC),
+		End:         time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC),
+		RRule:       "FREQ=YEARLY",
+		ExDates:     []time.Time{time.Date(2026, 7, 10, 0, 0, 0, 0, time.UTC)},
+		Created:     time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		Modified:    time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC),
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, &Calendar{Name: "calple", Events: []Event{in}}); err != nil {
+		t.Fatal(err)
+	}
+	cal, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := cal.Events[0]
+	if out.UID != in.UID || out.Summary != in.Summary || out.Description != in.Description || out.Image != in.Image ||
+		!slices.Equal(out.Categories, in.Categories) || !out.Start.Equal(in.Start) || !out.End.Equal(in.End) ||
+		out.RRule != in.RRule || !slices.EqualFunc(out.ExDates, in.ExDates, time.Time.Equal) ||
+		!out.Created.Equal(in.Created) || !out.Modified.Equal(in.Modified) {
+		t.Errorf("round trip\n got %+v\nwant %+v", out, in)
+	}
+}
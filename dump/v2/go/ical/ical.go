@@ -0,0 +1,162 @@
+// Package ical writes ddays as iCalendar (RFC 5545) events and reads the events of other calendars
+// every event is a whole day event, so only dates are written and no time zones are needed
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ProdID names the app in the calendars it writes
+const ProdID = "-//calple//calple//EN"
+
+// Calendar is a VCALENDAR
+type Calendar struct {
+	// Name is shown by the clients that subscribe to the calendar (X-WR-CALNAME)
+	Name   string
+	Events []Event
+}
+
+// Event is an all day VEVENT
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Categories  []string
+	// Image is the url of a picture for the event, written as an attachment
+	Image string
+	// Start is the first day, End the day after the last one as RFC 5545 has it for dates
+	Start, End time.Time
+	// RRule is the recurrence rule without the RRULE: prefix, empty for a single event
+	RRule   string
+	ExDates []time.Time
+	Created time.Time
+	// Modified is also the DTSTAMP, so the same event is always written the same way
+	Modified time.Time
+	// Status is CANCELLED for events that were called off, empty when not given
+	Status string
+	// RecurrenceID is set on an event that changes one occurrence of a recurring event with the same UID
+	RecurrenceID time.Time
+}
+
+// lines longer than this many octets are folded
+const maxLine = 75
+
+// Encode writes the calendar to w
+func Encode(w io.Writer, cal *Calendar) error {
+	bw := bufio.NewWriter(w)
+	e := &encoder{w: bw}
+
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", ProdID)
+	e.line("CALSCALE", "GREGORIAN")
+	if cal.Name != "" {
+		e.line("X-WR-CALNAME", escape(cal.Name))
+	}
+	for i := range cal.Events {
+		e.event(&cal.Events[i])
+	}
+	e.line("END", "VCALENDAR")
+
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) event(ev *Event) {
+	e.line("BEGIN", "VEVENT")
+	e.line("UID", escape(ev.UID))
+	stamp := ev.Modified
+	if stamp.IsZero() {
+		stamp = ev.Created
+	}
+	e.line("DTSTAMP", formatTime(stamp))
+	if !ev.Created.IsZero() {
+		e.line("CREATED", formatTime(ev.Created))
+	}
+	if !ev.Modified.IsZero() {
+		e.line("LAST-MODIFIED", formatTime(ev.Modified))
+	}
+	if !ev.RecurrenceID.IsZero() {
+		e.line("RECURRENCE-ID;VALUE=DATE", formatDate(ev.RecurrenceID))
+	}
+	e.line("DTSTART;VALUE=DATE", formatDate(ev.Start))
+	e.line("DTEND;VALUE=DATE", formatDate(ev.End))
+	if ev.RRule != "" {
+		e.line("RRULE", ev.RRule)
+	}
+	if len(ev.ExDates) > 0 {
+		dates := make([]string, len(ev.ExDates))
+		for i, d := range ev.ExDates {
+			dates[i] = formatDate(d)
+		}
+		e.line("EXDATE;VALUE=DATE", strings.Join(dates, ","))
+	}
+	e.line("SUMMARY", escape(ev.Summary))
+	if ev.Description != "" {
+		e.line("DESCRIPTION", escape(ev.Description))
+	}
+	if len(ev.Categories) > 0 {
+		categories := make([]string, len(ev.Categories))
+		for i, c := range ev.Categories {
+			categories[i] = escape(c)
+		}
+		e.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	if ev.Image != "" {
+		e.line("ATTACH", ev.Image)
+	}
+	if ev.Status != "" {
+		e.line("STATUS", ev.Status)
+	}
+	// whole day events should not block the day in the partner's schedule
+	e.line("TRANSP", "TRANSPARENT")
+	e.line("END", "VEVENT")
+}
+
+// line writes a content line, folded so no physical line is longer than maxLine octets
+func (e *encoder) line(name, value string) {
+	if e.err != nil {
+		return
+	}
+	s := name + ":" + value
+	limit := maxLine
+	for len(s) > limit {
+		// fold before a rune, never inside one
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, e.err = e.w.WriteString(s[:cut] + "\r\n "); e.err != nil {
+			return
+		}
+		s = s[cut:]
+		// the space that starts the continuation line counts towards its length
+		limit = maxLine - 1
+	}
+	_, e.err = e.w.WriteString(s + "\r\n")
+}
+
+// escape writes TEXT values, RFC 5545 3.3.11
+func escape(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
@@ -0,0 +1,71 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	created := time.Date(2025, 6, 1, 9, 30, 0, 0, time.FixedZone("KST", 9*60*60))
+	cal := Calendar{Name: "calple", Events: []Event{{
+		UID:         "trip@calple",
+		Summary:     "Trip; Busan, Korea",
+		Description: "line one\nline two \\ done",
+		Categories:  []string{"travel"},
+		Start:       time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC),
+		End:         time.Date(2025, 7, 13, 0, 0, 0, 0, time.UTC),
+		RRule:       "FREQ=YEARLY",
+		ExDates:     []time.Time{time.Date(2026, 7, 10, 0, 0, 0, 0, time.UTC)},
+		Created:     created,
+	}}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, &cal); err != nil {
+		t.Fatal(err)
+	}
+	want := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:" + ProdID + "\r\n" +
+		"CALSCALE:GREGORIAN\r\n" +
+		"X-WR-CALNAME:calple\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:trip@calple\r\n" +
+		"DTSTAMP:20250601T003000Z\r\n" +
+		"CREATED:20250601T003000Z\r\n" +
+		"DTSTART;VALUE=DATE:20250710\r\n" +
+		"DTEND;VALUE=DATE:20250713\r\n" +
+		"RRULE:FREQ=YEARLY\r\n" +
+		"EXDATE;VALUE=DATE:20260710\r\n" +
+		"SUMMARY:Trip\\; Busan\\, Korea\r\n" +
+		"DESCRIPTION:line one\\nline two \\\\ done\r\n" +
+		"CATEGORIES:travel\r\n" +
+		"TRANSP:TRANSPARENT\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFolding(t *testing.T) {
+	// multi byte runes must not be split between lines
+	summary := strings.Repeat("우리의 백일 ", 20)
+	cal := Calendar{Events: []Event{{UID: "x", Summary: summary}}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, &cal); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	for _, line := range lines {
+		if len(line) > maxLine {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+	unfolded := strings.ReplaceAll(buf.String(), "\r\n ", "")
+	if !strings.Contains(unfolded, "SUMMARY:"+summary+"\r\n") {
+		t.Errorf("unfolded summary does not match:\n%s", unfolded)
+	}
+}
@@ -0,0 +1,61 @@
+// Package identity signs users in with external OAuth 2.0 / OpenID Connect providers
+// every provider is registered by name and reached through /oauth/{provider}/login
+package identity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"golang.org/x/oauth2"
+)
+
+// Identity is who the provider says the user is
+type Identity struct {
+	Provider string
+	// Subject is the provider's stable ID for the user, never reused or changed
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider runs the authorization code flow with one identity provider
+type Provider interface {
+	Name() string
+	// AuthCodeURL is where the user is sent to sign in
+	AuthCodeURL(ctx context.Context, state string) (string, error)
+	// Exchange trades the callback code for the user's identity and the provider tokens
+	Exchange(ctx context.Context, code string) (*Identity, *oauth2.Token, error)
+}
+
+// Registry holds the configured providers by name
+type Registry struct {
+	providers map[string]Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: map[string]Provider{}}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("identity: unknown provider %q", name)
+	}
+	return p, nil
+}
+
+// Names returns the registered provider names in order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,172 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig configures a generic OpenID Connect provider
+// the endpoints are read from {Issuer}/.well-known/openid-configuration
+type OIDCConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// defaults to openid, email and profile
+	Scopes []string
+	// extra parameters for the authorization url, like access_type=offline for google
+	AuthParams map[string]string
+	// used for discovery, token and userinfo requests, defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// OIDCProvider discovers its endpoints on first use
+// so the server starts even when the provider is unreachable
+type OIDCProvider struct {
+	cfg OIDCConfig
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+func NewOIDC(cfg OIDCConfig) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &OIDCProvider{cfg: cfg}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+// discover fetches the discovery document once, failures are retried on the next call
+func (p *OIDCProvider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.cfg.Name, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery for %s: status %d", p.cfg.Name, res.StatusCode)
+	}
+
+	var doc discoveryDocument
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.cfg.Name, err)
+	}
+	// a document for another issuer means a misconfiguration or a spoofed endpoint
+	if strings.TrimSuffix(doc.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery for %s: issuer %q does not match %q", p.cfg.Name, doc.Issuer, p.cfg.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("oidc discovery for %s: missing endpoints", p.cfg.Name)
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+func (p *OIDCProvider) oauthConfig(doc *discoveryDocument) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  doc.AuthorizationEndpoint,
+			TokenURL: doc.TokenEndpoint,
+		},
+	}
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	opts := []oauth2.AuthCodeOption{}
+	for key, value := range p.cfg.AuthParams {
+		opts = append(opts, oauth2.SetAuthURLParam(key, value))
+	}
+	return p.oauthConfig(doc).AuthCodeURL(state, opts...), nil
+}
+
+// Exchange reads the identity from the userinfo endpoint
+// it is fetched from the discovered endpoint over the provider's tls, so the id token is not needed
+func (p *OIDCProvider) Exchange(ctx context.Context, code string) (*Identity, *oauth2.Token, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.cfg.HTTPClient)
+	conf := p.oauthConfig(doc)
+	token, err := conf.Exchange(ctx, code)
+	if err != nil {
+		return nil, nil, fmt.Errorf("token exchange with %s: %w", p.cfg.Name, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, doc.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := conf.Client(ctx, token).Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("userinfo from %s: %w", p.cfg.Name, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("userinfo from %s: status %d", p.cfg.Name, res.StatusCode)
+	}
+
+	var info struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"` // some providers send "true" as a string
+		Name          string `json:"name"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return nil, nil, fmt.Errorf("userinfo from %s: %w", p.cfg.Name, err)
+	}
+	if info.Subject == "" {
+		return nil, nil, errors.New("userinfo from " + p.cfg.Name + " has no subject")
+	}
+
+	return &Identity{
+		Provider:      p.cfg.Name,
+		Subject:       info.Subject,
+		Email:         strings.ToLower(strings.TrimSpace(info.Email)),
+		EmailVerified: info.EmailVerified == true || info.EmailVerified == "true",
+		Name:          info.Name,
+	}, token, nil
+}
@@ -0,0 +1,119 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// mockIssuer is a minimal openid connect provider that accepts the code "good-code"
+func mockIssuer(t *testing.T, issuer string, userinfo map[string]any) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		iss := issuer
+		if iss == "" {
+			iss = srv.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access-1",
+			"refresh_token": "refresh-1",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(userinfo)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOIDCProvider(t *testing.T) {
+	srv := mockIssuer(t, "", map[string]any{
+		"sub":            "subject-1",
+		"email":          " Alice@Example.com",
+		"email_verified": "true",
+		"name":           "Alice",
+	})
+	p := NewOIDC(OIDCConfig{
+		Name:        "test",
+		Issuer:      srv.URL + "/",
+		ClientID:    "client",
+		RedirectURL: "http://localhost/oauth/test/callback",
+	})
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(authURL, srv.URL+"/authorize?") || q.Get("state") != "state-1" ||
+		q.Get("client_id") != "client" || q.Get("scope") != "openid email profile" {
+		t.Fatalf("auth url = %s", authURL)
+	}
+
+	ident, token, err := p.Exchange(ctx, "good-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Provider: "test", Subject: "subject-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if *ident != want {
+		t.Fatalf("identity = %+v, want %+v", *ident, want)
+	}
+	if token.RefreshToken != "refresh-1" {
+		t.Fatalf("refresh token = %q", token.RefreshToken)
+	}
+
+	if _, _, err := p.Exchange(ctx, "bad-code"); err == nil {
+		t.Fatal("exchange with a bad code succeeded")
+	}
+}
+
+func TestOIDCIssuerMismatch(t *testing.T) {
+	srv := mockIssuer(t, "https://evil.example.com", map[string]any{"sub": "x"})
+	p := NewOIDC(OIDCConfig{Name: "test", Issuer: srv.URL, ClientID: "client"})
+
+	if _, err := p.AuthCodeURL(context.Background(), "state"); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err = %v, want an issuer mismatch", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(NewOIDC(OIDCConfig{Name: "b"}), NewOIDC(OIDCConfig{Name: "a"}))
+	if names := r.Names(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("names = %v", names)
+	}
+	if _, err := r.Get("c"); err == nil {
+		t.Fatal("unknown provider found")
+	}
+}
@@ -0,0 +1,133 @@
+// Package keyring encrypts small secrets, like oauth tokens, before they are stored
+// values are sealed with AES-256-GCM and tagged with the id of the key that sealed them
+// so keys can be rotated: the first key encrypts, every key can still decrypt
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix of every sealed value, values without it are legacy plaintext
+const prefix = "enc:v1:"
+
+var ErrUnknownKey = errors.New("keyring: value was sealed with a key that is not configured")
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+type Keyring struct {
+	keys []key // keys[0] is the primary key
+}
+
+// New builds a keyring from base64 encoded 32 byte keys, primary key first
+// generate one with: openssl rand -base64 32
+func New(encodedKeys []string) (*Keyring, error) {
+	if len(encodedKeys) == 0 {
+		return nil, errors.New("keyring: no keys")
+	}
+
+	kr := &Keyring{}
+	for i, encoded := range encodedKeys {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %d is not valid base64: %w", i, err)
+		}
+		if len(raw) != 32 {
+			return nil, fmt.Errorf("keyring: key %d is %d bytes, want 32", i, len(raw))
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys = append(kr.keys, key{id: keyID(raw), aead: aead})
+	}
+	return kr, nil
+}
+
+// short fingerprint stored next to the ciphertext, it does not reveal the key
+func keyID(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:4])
+}
+
+// Encrypt seals plaintext with the primary key
+// empty strings stay empty so missing tokens are not turned into ciphertext
+func (kr *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	primary := kr.keys[0]
+	nonce := make([]byte, primary.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := primary.aead.Seal(nonce, nonce, []byte(plaintext), []byte(primary.id))
+	return prefix + primary.id + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by any key in the keyring
+// legacy plaintext values (without the prefix) are returned unchanged
+func (kr *Keyring) Decrypt(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", errors.New("keyring: malformed value")
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("keyring: malformed value: %w", err)
+	}
+
+	for _, k := range kr.keys {
+		if k.id != id {
+			continue
+		}
+		if len(sealed) < k.aead.NonceSize() {
+			return "", errors.New("keyring: malformed value")
+		}
+		nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+		plaintext, err := k.aead.Open(nil, nonce, ciphertext, []byte(k.id))
+		if err != nil {
+			return "", fmt.Errorf("keyring: %w", err)
+		}
+		return string(plaintext), nil
+	}
+	return "", ErrUnknownKey
+}
+
+// NeedsRotation reports whether value is plaintext or sealed with an older key
+func (kr *Keyring) NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, prefix+kr.keys[0].id+":")
+}
+
+// Rotate re-seals value with the primary key, values that are current are returned as is
+func (kr *Keyring) Rotate(value string) (string, error) {
+	if !kr.NeedsRotation(value) {
+		return value, nil
+	}
+	plaintext, err := kr.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return kr.Encrypt(plaintext)
+}
@@ -0,0 +1,98 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	kr, err := New([]string{newKey(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := kr.Encrypt("refresh-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "refresh-token") || !strings.HasPrefix(sealed, prefix) {
+		t.Fatalf("sealed = %q", sealed)
+	}
+	again, _ := kr.Encrypt("refresh-token")
+	if again == sealed {
+		t.Error("encrypting twice gave the same ciphertext")
+	}
+
+	got, err := kr.Decrypt(sealed)
+	if err != nil || got != "refresh-token" {
+		t.Fatalf("decrypt = %q, %v", got, err)
+	}
+
+	// tampering is detected
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := kr.Decrypt(tampered); err == nil {
+		t.Error("tampered value decrypted")
+	}
+
+	if empty, _ := kr.Encrypt(""); empty != "" {
+		t.Errorf("empty value sealed to %q", empty)
+	}
+	if plain, _ := kr.Decrypt("legacy"); plain != "legacy" {
+		t.Errorf("legacy plaintext = %q", plain)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	oldKey, newKeyValue := newKey(t), newKey(t)
+
+	old, _ := New([]string{oldKey})
+	sealed, _ := old.Encrypt("secret")
+
+	rotated, err := New([]string{newKeyValue, oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rotated.Decrypt(sealed); err != nil || got != "secret" {
+		t.Fatalf("old value after rotation = %q, %v", got, err)
+	}
+	if !rotated.NeedsRotation(sealed) || !rotated.NeedsRotation("plaintext") {
+		t.Error("old and plaintext values should need rotation")
+	}
+
+	resealed, err := rotated.Rotate(sealed)
+	if err != nil || rotated.NeedsRotation(resealed) {
+		t.Fatalf("rotate = %q, %v", resealed, err)
+	}
+
+	// once the old key is dropped only the resealed value can be read
+	current, _ := New([]string{newKeyValue})
+	if _, err := current.Decrypt(sealed); err != ErrUnknownKey {
+		t.Errorf("old value without old key: %v", err)
+	}
+	if got, _ := current.Decrypt(resealed); got != "secret" {
+		t.Errorf("resealed = %q", got)
+	}
+}
+
+func TestNewRejectsBadKeys(t *testing.T) {
+	for _, keys := range [][]string{
+		nil,
+		{"not base64!"},
+		{base64.StdEncoding.EncodeToString([]byte("too short"))},
+	} {
+		if _, err := New(keys); err == nil {
+			t.Errorf("New(%q) succeeded", keys)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package mailer sends the account emails: verification, password reset and magic links
+// production sends over smtp, development writes the mails to files or the console
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages, implementations must be safe for concurrent use
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig is a relay that accepts PLAIN auth, net/smtp upgrades to tls with STARTTLS
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTP(cfg SMTPConfig) Mailer {
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	return smtpMailer{cfg: cfg}
+}
+
+func (m smtpMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	// net/smtp has no context support, run it in the background so a slow relay
+	// does not outlive the request
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(m.cfg.Host, m.cfg.Port), auth, m.cfg.From, []string{msg.To}, encode(m.cfg.From, msg))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("send mail to %s: %w", msg.To, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fileMailer writes every message as an .eml file, handy for local development and tests
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) Mailer {
+	return fileMailer{dir: dir, from: from}
+}
+
+func (m fileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return fmt.Errorf("mail directory: %w", err)
+	}
+	name := time.Now().UTC().Format("20060102T150405") + "-" + uuid.NewString()[:8] + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), encode(m.from, msg), 0o600)
+}
+
+// consoleMailer prints the messages, the default in development
+type consoleMailer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewConsole(out io.Writer) Mailer {
+	return &consoleMailer{out: out}
+}
+
+func (m *consoleMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.out, "MAIL: to %s - %s\n%s\n", msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// encode builds a minimal rfc 5322 message
+func encode(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// line breaks in a header would start new headers
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
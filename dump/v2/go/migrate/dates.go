@@ -0,0 +1,126 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"calple/store"
+)
+
+// the formats dates were written in by older clients and imports
+var dateLayouts = []string{
+	"2006-01-02",
+	"20060102",
+	"2006/01/02",
+	"2006.01.02",
+	"2006-1-2",
+	"2006/1/2",
+	time.RFC3339,
+}
+
+// normalizeDate returns the date in layout, empty dates and ones that cannot be read are kept as they are
+func normalizeDate(date, layout string) string {
+	if date == "" {
+		return date
+	}
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l, date); err == nil {
+			return t.Format(layout)
+		}
+	}
+	return date
+}
+
+// ddays are YYYYMMDD, period days, checkins and pins are YYYY-MM-DD
+// a day that would end up on the date of another one of the same kind is left for a person to merge
+// the records keep their updatedAt, the rewrite is not an edit
+func normalizeDates(ctx context.Context, st store.Store, user *store.User, dryRun bool) (int, error) {
+	changed := 0
+
+	ddays, err := st.DDays().ListByCreator(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range ddays {
+		date, endDate := normalizeDate(d.Date, "20060102"), normalizeDate(d.EndDate, "20060102")
+		if date == d.Date && endDate == d.EndDate {
+			continue
+		}
+		changed++
+		if dryRun {
+			continue
+		}
+		d.Date, d.EndDate = date, endDate
+		if err := st.DDays().Update(ctx, &d); err != nil {
+			return changed, err
+		}
+	}
+
+	days, err := st.Periods().ListDays(ctx, user.ID)
+	if err != nil {
+		return changed, err
+	}
+	taken := map[string]bool{}
+	for _, d := range days {
+		taken[d.Date] = true
+	}
+	for _, d := range days {
+		date := normalizeDate(d.Date, "2006-01-02")
+		if date == d.Date || taken[date] {
+			continue
+		}
+		taken[date] = true
+		changed++
+		if dryRun {
+			continue
+		}
+		d.Date = date
+		if err := st.Periods().SaveDay(ctx, user.ID, &d); err != nil {
+			return changed, err
+		}
+	}
+
+	checkins, err := st.Checkins().List(ctx, user.ID)
+	if err != nil {
+		return changed, err
+	}
+	taken = map[string]bool{}
+	for _, ci := range checkins {
+		taken[ci.Date] = true
+	}
+	for _, ci := range checkins {
+		date := normalizeDate(ci.Date, "2006-01-02")
+		if date == ci.Date || taken[date] {
+			continue
+		}
+		taken[date] = true
+		changed++
+		if dryRun {
+			continue
+		}
+		ci.Date = date
+		if err := st.Checkins().Save(ctx, user.ID, &ci); err != nil {
+			return changed, err
+		}
+	}
+
+	pins, err := st.Pins().List(ctx, user.ID)
+	if err != nil {
+		return changed, err
+	}
+	for _, p := range pins {
+		date := normalizeDate(p.Date, "2006-01-02")
+		if date == p.Date {
+			continue
+		}
+		changed++
+		if dryRun {
+			continue
+		}
+		p.Date = date
+		if err := st.Pins().Update(ctx, user.ID, &p); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,184 @@
+// Package migrate rewrites the data older versions of the app stored
+// the schema of each backend is brought up to date when the store opens, these fix the data itself
+// and only use the store interfaces, so they run on every backend
+//
+// a migration visits the users in ID order and records its progress after every batch
+// an interrupted run resumes after the last recorded user, and migrations skip records
+// that are already up to date, so running one again does no harm
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"calple/store"
+)
+
+// Migration brings the data of one user up to date
+type Migration struct {
+	// NNNN_what, migrations run in the order of their names
+	Name        string
+	Description string
+	// User returns how many records it changed, with dryRun set it only counts them
+	User func(ctx context.Context, st store.Store, user *store.User, dryRun bool) (int, error)
+}
+
+// Migrations lists every migration in the order they run
+var Migrations = []Migration{
+	// the others find events by creator ID, which legacy events only get here
+	{"0001_partner_uids", "reference partners by user ID next to their email", partnerUIDs},
+	{"0002_normalize_dates", "rewrite dates to the formats the handlers expect", normalizeDates},
+	{"0003_annual_rrule", "give annual events the yearly recurrence rule", annualRules},
+	{"0004_user_tokens", "remove the google tokens stored on users in clear text", userTokens},
+}
+
+// DefaultBatchSize is how many users are read at once and how often progress is recorded
+const DefaultBatchSize = 100
+
+// ErrUnknownMigration is returned when Options.Only names a migration that does not exist
+var ErrUnknownMigration = errors.New("migrate: unknown migration")
+
+type Options struct {
+	// DryRun counts the changes without writing them or recording progress
+	DryRun bool
+	// Only runs the named migrations, empty runs all of them
+	Only []string
+	// Redo runs finished migrations again from the first user
+	Redo      bool
+	BatchSize int
+	// Progress gets a line after every batch, nil is quiet
+	Progress io.Writer
+}
+
+// Result of one migration in a run
+type Result struct {
+	Name string
+	// Finished is set when the migration had already finished and did not run
+	Finished bool
+	// Resumed is the user the run continued after, empty when it started from the first user
+	Resumed string
+	Users   int
+	Changed int
+}
+
+// Run applies the migrations that have not finished yet, in order
+// it stops at the first migration that fails, the results include the one that failed
+func Run(ctx context.Context, st store.Store, migrations []Migration, opts Options) ([]Result, error) {
+	selected, err := selectMigrations(migrations, opts.Only)
+	if err != nil {
+		return nil, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	results := []Result{}
+	for _, m := range selected {
+		res, err := run(ctx, st, m, opts)
+		results = append(results, res)
+		if err != nil {
+			return results, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+	}
+	return results, nil
+}
+
+// Status returns the recorded run of every migration, nil for the ones that never ran
+func Status(ctx context.Context, st store.Store, migrations []Migration) ([]*store.MigrationRun, error) {
+	out := make([]*store.MigrationRun, len(migrations))
+	for i, m := range migrations {
+		r, err := st.Migrations().Get(ctx, m.Name)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[i] = r
+	}
+	return out, nil
+}
+
+func selectMigrations(migrations []Migration, only []string) ([]Migration, error) {
+	sorted := slices.Clone(migrations)
+	slices.SortStableFunc(sorted, func(a, b Migration) int { return strings.Compare(a.Name, b.Name) })
+	if len(only) == 0 {
+		return sorted, nil
+	}
+
+	for _, name := range only {
+		if !slices.ContainsFunc(sorted, func(m Migration) bool { return m.Name == name }) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownMigration, name)
+		}
+	}
+	return slices.DeleteFunc(sorted, func(m Migration) bool { return !slices.Contains(only, m.Name) }), nil
+}
+
+func run(ctx context.Context, st store.Store, m Migration, opts Options) (Result, error) {
+	res := Result{Name: m.Name}
+	rec, err := st.Migrations().Get(ctx, m.Name)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && opts.Redo) {
+		rec = &store.MigrationRun{Name: m.Name, StartedAt: time.Now()}
+	} else if err != nil {
+		return res, err
+	}
+	if !rec.FinishedAt.IsZero() {
+		res.Finished = true
+		return res, nil
+	}
+
+	progress := func(format string, args ...any) {
+		if opts.Progress != nil {
+			fmt.Fprintf(opts.Progress, m.Name+": "+format+"\n", args...)
+		}
+	}
+	res.Resumed = rec.Cursor
+	if rec.Cursor != "" {
+		progress("resuming after user %s", rec.Cursor)
+	}
+
+	cursor := rec.Cursor
+	for {
+		users, err := st.Users().List(ctx, cursor, opts.BatchSize)
+		if err != nil {
+			return res, err
+		}
+
+		changed := 0
+		for i := range users {
+			n, err := m.User(ctx, st, &users[i], opts.DryRun)
+			if err != nil {
+				return res, fmt.Errorf("user %s: %w", users[i].ID, err)
+			}
+			changed += n
+		}
+		if len(users) > 0 {
+			cursor = users[len(users)-1].ID
+		}
+		res.Users += len(users)
+		res.Changed += changed
+
+		// the batch is recorded once all of its users are done
+		last := len(users) < opts.BatchSize
+		if !opts.DryRun {
+			rec.Cursor = cursor
+			rec.Users += len(users)
+			rec.Changed += changed
+			if last {
+				rec.FinishedAt = time.Now()
+			}
+			if err := st.Migrations().Save(ctx, rec); err != nil {
+				return res, err
+			}
+		}
+		progress("%d users, %d changed", res.Users, res.Changed)
+		if last {
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"calple/recurrence"
+	"calple/store"
+	"calple/store/memstore"
+	"calple/store/sqlstore"
+)
+
+// migrations only use the store interfaces, so they run against every local backend
+func backends(t *testing.T) map[string]store.Store {
+	t.Helper()
+	sqlite, err := sqlstore.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "calple.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]store.Store{"memory": memstore.New(), "sqlite": sqlite}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func seedUsers(t *testing.T, st store.Store, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		must(t, st.Users().Save(context.Background(), &store.User{ID: id, Email: id + "@example.com", CreatedAt: time.Now()}))
+	}
+}
+
+func TestRunResumes(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seedUsers(t, st, "a", "b", "c", "d", "e")
+
+			// counts every user it visits and fails once on c
+			visits := map[string]int{}
+			fail := true
+			migrations := []Migration{{Name: "0001_count", User: func(ctx context.Context, st store.Store, user *store.User, dryRun bool) (int, error) {
+				if user.ID == "c" && fail && !dryRun {
+					return 0, errors.New("boom")
+				}
+				if !dryRun {
+					visits[user.ID]++
+				}
+				return 1, nil
+			}}}
+
+			results, err := Run(ctx, st, migrations, Options{DryRun: true, BatchSize: 2})
+			must(t, err)
+			if results[0].Users != 5 || results[0].Changed != 5 || len(visits) != 0 {
+				t.Fatalf("dry run = %+v, visits %v", results[0], visits)
+			}
+			if runs, _ := st.Migrations().List(ctx); len(runs) != 0 {
+				t.Fatalf("dry run recorded %+v", runs)
+			}
+
+			if _, err := Run(ctx, st, migrations, Options{BatchSize: 2}); err == nil {
+				t.Fatal("failing migration succeeded")
+			}
+			run, err := st.Migrations().Get(ctx, "0001_count")
+			must(t, err)
+			if run.Cursor != "b" || run.Users != 2 || !run.FinishedAt.IsZero() {
+				t.Fatalf("recorded run = %+v", run)
+			}
+
+			// the next run starts after the last finished batch
+			fail = false
+			var progress bytes.Buffer
+			results, err = Run(ctx, st, migrations, Options{BatchSize: 2, Progress: &progress})
+			must(t, err)
+			if results[0].Resumed != "b" || results[0].Users != 3 {
+				t.Errorf("resumed run = %+v", results[0])
+			}
+			if !strings.Contains(progress.String(), "0001_count: resuming after user b") {
+				t.Errorf("progress:\n%s", progress.String())
+			}
+			if visits["a"] != 1 || visits["c"] != 1 || visits["e"] != 1 {
+				t.Errorf("visits = %v", visits)
+			}
+			run, err = st.Migrations().Get(ctx, "0001_count")
+			must(t, err)
+			if run.Users != 5 || run.Changed != 5 || run.FinishedAt.IsZero() {
+				t.Errorf("finished run = %+v", run)
+			}
+
+			// finished migrations only run again when asked to
+			results, err = Run(ctx, st, migrations, Options{})
+			must(t, err)
+			if !results[0].Finished || visits["a"] != 1 {
+				t.Errorf("second run = %+v, visits %v", results[0], visits)
+			}
+			_, err = Run(ctx, st, migrations, Options{Redo: true})
+			must(t, err)
+			if visits["a"] != 2 {
+				t.Errorf("redo visits = %v", visits)
+			}
+
+			if _, err := Run(ctx, st, migrations, Options{Only: []string{"0002_missing"}}); !errors.Is(err, ErrUnknownMigration) {
+				t.Errorf("unknown migration: %v", err)
+			}
+		})
+	}
+}
+
+func TestNormalizeDates(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seedUsers(t, st, "alice")
+			updated := time.Now().UTC().Truncate(time.Second)
+
+			trip := store.DDay{Title: "Trip", Date: "2025-07-10", EndDate: "2025/7/12", CreatorID: "alice", UpdatedAt: updated}
+			must(t, st.DDays().Create(ctx, &trip))
+			undated := store.DDay{Title: "Someday", CreatorID: "alice", UpdatedAt: updated}
+			must(t, st.DDays().Create(ctx, &undated))
+			must(t, st.Periods().SaveDay(ctx, "alice", &store.PeriodDay{Date: "20250101", IsPeriod: true}))
+			// the same day in both formats is left alone
+			must(t, st.Periods().SaveDay(ctx, "alice", &store.PeriodDay{Date: "2025/01/02"}))
+			must(t, st.Periods().SaveDay(ctx, "alice", &store.PeriodDay{Date: "2025-01-02"}))
+			must(t, st.Checkins().Save(ctx, "alice", &store.Checkin{Date: "2025-1-3", Mood: "happy"}))
+			pin := store.Pin{Title: "Cafe", Date: "not a date"}
+			must(t, st.Pins().Create(ctx, "alice", &pin))
+
+			results, err := Run(ctx, st, Migrations, Options{Only: []string{"0002_normalize_dates"}, DryRun: true})
+			must(t, err)
+			if results[0].Changed != 3 {
+				t.Fatalf("dry run changed %d", results[0].Changed)
+			}
+			if d, _ := st.DDays().Get(ctx, trip.ID); d.Date != "2025-07-10" {
+				t.Fatalf("dry run wrote %s", d.Date)
+			}
+
+			_, err = Run(ctx, st, Migrations, Options{})
+			must(t, err)
+
+			d, err := st.DDays().Get(ctx, trip.ID)
+			must(t, err)
+			if d.Date != "20250710" || d.EndDate != "20250712" || !d.UpdatedAt.Equal(updated) {
+				t.Errorf("trip = %s %s %v", d.Date, d.EndDate, d.UpdatedAt)
+			}
+			days, _ := st.Periods().ListDays(ctx, "alice")
+			dates := map[string]bool{}
+			for _, day := range days {
+				dates[day.Date] = true
+			}
+			if len(days) != 3 || !dates["2025-01-01"] || !dates["2025/01/02"] || !dates["2025-01-02"] {
+				t.Errorf("period days = %v", dates)
+			}
+			if ci, err := st.Checkins().GetByDate(ctx, "alice", "2025-01-03"); err != nil || ci.Mood != "happy" {
+				t.Errorf("checkin = %+v, %v", ci, err)
+			}
+			if pins, _ := st.Pins().List(ctx, "alice"); pins[0].Date != "not a date" {
+				t.Errorf("pin date = %s", pins[0].Date)
+			}
+
+			// nothing is left to change
+			results, err = Run(ctx, st, Migrations, Options{Only: []string{"0002_normalize_dates"}, Redo: true, DryRun: true})
+			must(t, err)
+			if results[0].Changed != 0 {
+				t.Errorf("second pass would change %d", results[0].Changed)
+			}
+		})
+	}
+}
+
+func TestAnnualRules(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seedUsers(t, st, "alice")
+
+			// saved the way older versions did, with only the flag
+			anniversary := store.DDay{Title: "Anniversary", Date: "20200101", IsAnnual: true, CreatorID: "alice"}
+			must(t, st.DDays().Create(ctx, &anniversary))
+			anniversary.RRule = ""
+			must(t, st.DDays().Update(ctx, &anniversary))
+			weekly := store.DDay{Title: "Date night", Date: "20250103", RRule: "FREQ=WEEKLY", CreatorID: "alice"}
+			must(t, st.DDays().Create(ctx, &weekly))
+
+			results, err := Run(ctx, st, Migrations, Options{Only: []string{"0003_annual_rrule"}})
+			must(t, err)
+			if results[0].Changed != 1 {
+				t.Errorf("changed %d events, want 1", results[0].Changed)
+			}
+			if d, _ := st.DDays().Get(ctx, anniversary.ID); d.RRule != recurrence.Annual {
+				t.Errorf("anniversary rule = %q", d.RRule)
+			}
+			if d, _ := st.DDays().Get(ctx, weekly.ID); d.RRule != "FREQ=WEEKLY" {
+				t.Errorf("weekly rule = %q", d.RRule)
+			}
+		})
+	}
+}
+
+func TestUserTokens(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seedUsers(t, st, "bob")
+			must(t, st.Users().Save(ctx, &store.User{ID: "alice", Email: "alice@example.com",
+				Tokens: &store.OAuthTokens{AccessToken: "ya29.plain", RefreshToken: "1//plain"}}))
+
+			results, err := Run(ctx, st, Migrations, Options{Only: []string{"0004_user_tokens"}})
+			must(t, err)
+			if results[0].Changed != 1 {
+				t.Errorf("changed %d users, want 1", results[0].Changed)
+			}
+			for _, id := range []string{"alice", "bob"} {
+				u, err := st.Users().Get(ctx, id)
+				must(t, err)
+				if u.Tokens != nil {
+					t.Errorf("%s still has tokens %+v", id, u.Tokens)
+				}
+			}
+		})
+	}
+}
+
+// a store whose events still only name their creator by email, like legacy firestore data
+type legacyStore struct {
+	store.Store
+	ddays []string
+}
+
+func (s *legacyStore) BackfillPartnerUIDs(ctx context.Context, user *store.User, dryRun bool) (int, error) {
+	changed := 0
+	for _, id := range s.ddays {
+		d, err := s.DDays().Get(ctx, id)
+		if err != nil {
+			return changed, err
+		}
+		if d.CreatorID != "" || d.CreatedBy != user.Email {
+			continue
+		}
+		changed++
+		if dryRun {
+			continue
+		}
+		d.CreatorID = user.ID
+		if err := s.DDays().Update(ctx, d); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// events without a creator ID get it before the migrations that look them up by creator
+func TestLegacyEvents(t *testing.T) {
+	ctx := context.Background()
+	st := &legacyStore{Store: memstore.New()}
+	seedUsers(t, st, "alice")
+
+	d := store.DDay{Title: "Anniversary", Date: "2020-01-01", IsAnnual: true, CreatedBy: "alice@example.com"}
+	must(t, st.DDays().Create(ctx, &d))
+	d.RRule = ""
+	must(t, st.DDays().Update(ctx, &d))
+	st.ddays = append(st.ddays, d.ID)
+
+	results, err := Run(ctx, st, Migrations, Options{})
+	must(t, err)
+	changed := map[string]int{}
+	for _, r := range results {
+		changed[r.Name] = r.Changed
+	}
+	if changed["0001_partner_uids"] != 1 || changed["0002_normalize_dates"] != 1 || changed["0003_annual_rrule"] != 1 {
+		t.Errorf("changed = %v", changed)
+	}
+	got, err := st.DDays().Get(ctx, d.ID)
+	must(t, err)
+	if got.CreatorID != "alice" || got.Date != "20200101" || got.RRule != recurrence.Annual {
+		t.Errorf("event = %+v", got)
+	}
+}
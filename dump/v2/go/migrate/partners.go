@@ -0,0 +1,22 @@
+package migrate
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+// a store that still has partners referenced only by email, firestore is the only one
+// sqlite filled in the IDs in its schema migrations and the memory store starts empty
+type partnerBackfiller interface {
+	BackfillPartnerUIDs(ctx context.Context, user *store.User, dryRun bool) (int, error)
+}
+
+// connections and ddays referenced partners by email, they get the user IDs next to the emails
+func partnerUIDs(ctx context.Context, st store.Store, user *store.User, dryRun bool) (int, error) {
+	b, ok := st.(partnerBackfiller)
+	if !ok {
+		return 0, nil
+	}
+	return b.BackfillPartnerUIDs(ctx, user, dryRun)
+}
@@ -0,0 +1,32 @@
+package migrate
+
+import (
+	"context"
+
+	"calple/recurrence"
+	"calple/store"
+)
+
+// events saved before recurrence rules only had isAnnual, they get the yearly rule it stood for
+// events that already have a rule keep it
+func annualRules(ctx context.Context, st store.Store, user *store.User, dryRun bool) (int, error) {
+	ddays, err := st.DDays().ListByCreator(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, d := range ddays {
+		if !d.IsAnnual || d.RRule != "" {
+			continue
+		}
+		changed++
+		if dryRun {
+			continue
+		}
+		d.RRule = recurrence.Annual
+		if err := st.DDays().Update(ctx, &d); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,23 @@
+package migrate
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+// google tokens used to be stored on the user in clear text, sign in now keeps them encrypted on the identity
+// the ones left on users are removed, google sends a new refresh token when the user consents again
+func userTokens(ctx context.Context, st store.Store, user *store.User, dryRun bool) (int, error) {
+	if user.Tokens == nil {
+		return 0, nil
+	}
+	if dryRun {
+		return 1, nil
+	}
+	user.Tokens = nil
+	if err := st.Users().Save(ctx, user); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
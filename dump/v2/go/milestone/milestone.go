@@ -0,0 +1,117 @@
+// Package milestone derives the milestones of a couple from the day they started dating
+// the day counts are korean style, the first day together is day 1, so the 100th day is 99 days after it
+// there is one every 100 days up to the 1000th and one every 1000 days after that, plus the yearly anniversaries
+package milestone
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Milestone is one generated day
+type Milestone struct {
+	// Key names the milestone independently of the start date, like 100d or 2y
+	// so a hidden milestone stays hidden when the couple corrects the date
+	Key   string
+	Title string
+	Date  time.Time
+}
+
+// the day counts up to this one are every 100 days, after it every 1000
+const hundredsUpTo = 1000
+
+// Between returns the milestones of a couple that started on start that fall from from to to, both included, in order
+func Between(start, from, to time.Time) []Milestone {
+	start, from, to = day(start), day(from), day(to)
+	out := []Milestone{}
+	if to.Before(start) {
+		return out
+	}
+
+	// whole days from start, so the count does not drift with daylight saving
+	first, last := dayNumber(start, from), dayNumber(start, to)
+	for n := nextDayCount(max(first, 1)); n <= last; n = nextDayCount(n + 1) {
+		out = append(out, Milestone{
+			Key:   strconv.Itoa(n) + "d",
+			Title: fmt.Sprintf("%d days", n),
+			Date:  start.AddDate(0, 0, n-1),
+		})
+	}
+
+	for n := max(from.Year()-start.Year(), 1); n <= to.Year()-start.Year(); n++ {
+		date := anniversary(start, n)
+		if date.Before(from) || date.After(to) {
+			continue
+		}
+		out = append(out, Milestone{
+			Key:   strconv.Itoa(n) + "y",
+			Title: ordinal(n) + " anniversary",
+			Date:  date,
+		})
+	}
+
+	// a day count on the day of an anniversary comes first
+	slices.SortStableFunc(out, func(a, b Milestone) int { return a.Date.Compare(b.Date) })
+	return out
+}
+
+// Valid reports whether key names a milestone Between can return
+func Valid(key string) bool {
+	n, err := strconv.Atoi(key[:max(len(key)-1, 0)])
+	if err != nil || n < 1 || strconv.Itoa(n)+key[len(key)-1:] != key {
+		return false
+	}
+	switch {
+	case strings.HasSuffix(key, "d"):
+		return nextDayCount(n) == n
+	case strings.HasSuffix(key, "y"):
+		return true
+	}
+	return false
+}
+
+// nextDayCount returns the first milestone day count from n on
+func nextDayCount(n int) int {
+	step := 100
+	if n > hundredsUpTo {
+		step = 1000
+	}
+	return (n + step - 1) / step * step
+}
+
+// dayNumber returns the number of the day t is counting start as day 1
+func dayNumber(start, t time.Time) int {
+	return int(t.Sub(start).Hours()/24) + 1
+}
+
+// anniversary returns the nth anniversary of start
+// a start on the 29th of february has its anniversaries on the 28th in the other years
+func anniversary(start time.Time, n int) time.Time {
+	date := time.Date(start.Year()+n, start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	if date.Month() != start.Month() {
+		date = date.AddDate(0, 0, -date.Day())
+	}
+	return date
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// day drops the time of t, milestones are compared as UTC dates
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,66 @@
+package milestone
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("20060102", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name            string
+		start, from, to string
+		want            []string
+	}{
+		{"the first day counts", "20250101", "20250101", "20250430", []string{"100d 20250410"}},
+		{"hundreds up to a thousand", "20250101", "20250101", "20280101",
+			[]string{"100d 20250410", "200d 20250719", "300d 20251027", "1y 20260101", "400d 20260204", "500d 20260515",
+				"600d 20260823", "700d 20261201", "2y 20270101", "800d 20270311", "900d 20270619", "1000d 20270927", "3y 20280101"}},
+		{"thousands after that", "20200101", "20250101", "20271231", []string{"5y 20250101", "2000d 20250622", "6y 20260101", "7y 20270101"}},
+		{"window in the middle", "20250101", "20250501", "20250731", []string{"200d 20250719"}},
+		{"leap day anniversary", "20240229", "20250201", "20250228", []string{"1y 20250228"}},
+		{"nothing before the start", "20300101", "20250101", "20251231", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, m := range Between(date(tt.start), date(tt.from), date(tt.to)) {
+				got = append(got, m.Key+" "+m.Date.Format("20060102"))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitles(t *testing.T) {
+	got := []string{}
+	for _, m := range Between(date("20000101"), date("20000101"), date("20131231")) {
+		if m.Key[len(m.Key)-1] == 'y' {
+			got = append(got, m.Title)
+		}
+	}
+	if got[0] != "1st anniversary" || got[1] != "2nd anniversary" || got[2] != "3rd anniversary" || got[10] != "11th anniversary" {
+		t.Errorf("titles = %v", got)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for key, want := range map[string]bool{
+		"100d": true, "1000d": true, "3000d": true, "1y": true, "25y": true,
+		"150d": false, "1500d": false, "0y": false, "01y": false, "-1y": false, "100": false, "y": false, "": false, "1w": false,
+	} {
+		if got := Valid(key); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package r2 talks to the cloudflare r2 bucket that holds the dday images
+package r2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ErrNotInBucket is returned for urls that do not point into the bucket
+var ErrNotInBucket = errors.New("r2: url is not in the bucket")
+
+// Config is the bucket and the credentials for it
+type Config struct {
+	AccountID       string
+	AccessKeyID     string
+	AccessKeySecret string
+	BucketName      string
+	PublicBucketID  string
+}
+
+// r2 speaks the s3 api on a per account endpoint
+func (cfg Config) client(ctx context.Context) (*s3.Client, error) {
+	awsConfig, err := config.LoadDefaultConfig(ctx,
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.AccessKeySecret, "")),
+		config.WithRegion("auto"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(fmt.Sprintf("https://%s.r2.cloudflarestorage.com", cfg.AccountID))
+	}), nil
+}
+
+// PresignUpload returns a url the browser can PUT the object to until it expires
+func (cfg Config) PresignUpload(ctx context.Context, key string, expires time.Duration) (string, error) {
+	client, err := cfg.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := s3.NewPresignClient(client).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(cfg.BucketName),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// PublicURL is where the object is served from, this is what ddays store
+func (cfg Config) PublicURL(key string) string {
+	return fmt.Sprintf("https://pub-%s.r2.dev/%s", cfg.PublicBucketID, key)
+}
+
+// KeyFromURL is the object key of a public url, false for urls outside the bucket
+func (cfg Config) KeyFromURL(url string) (string, bool) {
+	if cfg.PublicBucketID == "" {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(url, cfg.PublicURL(""))
+	return key, ok && key != ""
+}
+
+// ImagePrefix is where the images uid uploads are put, the upload url handler names every key under it
+// the image url of an event is set by its creator, so the prefix is what proves an image is theirs
+func ImagePrefix(uid string) string {
+	return "ddays/" + uid + "/"
+}
+
+// ownedKey is the object key of a public url under uid's ImagePrefix
+func (cfg Config) ownedKey(uid, url string) (string, bool) {
+	key, ok := cfg.KeyFromURL(url)
+	if !ok || uid == "" || !strings.HasPrefix(key, ImagePrefix(uid)) {
+		return "", false
+	}
+	// the prefix is only a prefix when nothing walks back out of it
+	if strings.Contains(key, "..") {
+		return "", false
+	}
+	return key, true
+}
+
+// OpenImage reads the object behind a public url
+func (cfg Config) OpenImage(ctx context.Context, url string) (io.ReadCloser, error) {
+	key, ok := cfg.KeyFromURL(url)
+	if !ok || cfg.BucketName == "" {
+		return nil, ErrNotInBucket
+	}
+	client, err := cfg.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// DeleteImage deletes the object behind a public url if uid uploaded it
+// urls outside the bucket or outside the user's ImagePrefix are left alone,
+// an event can point at anyone's image and deleting an account must not take theirs
+// deleting a missing object is not an error
+func (cfg Config) DeleteImage(ctx context.Context, uid, url string) error {
+	key, ok := cfg.ownedKey(uid, url)
+	if !ok || cfg.BucketName == "" {
+		return nil
+	}
+	client, err := cfg.client(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.BucketName),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,24 @@
+package r2
+
+import "testing"
+
+func TestOwnedKey(t *testing.T) {
+	cfg := Config{PublicBucketID: "x"}
+	for _, tc := range []struct {
+		uid, url string
+		want     string
+	}{
+		{"alice", "https://pub-x.r2.dev/ddays/alice/1.jpg", "ddays/alice/1.jpg"},
+		// someone else's upload, an upload from before the per user prefix, or no upload at all
+		{"alice", "https://pub-x.r2.dev/ddays/bob/1.jpg", ""},
+		{"alice", "https://pub-x.r2.dev/ddays/alicex/1.jpg", ""},
+		{"alice", "https://pub-x.r2.dev/ddays/1.jpg", ""},
+		{"alice", "https://pub-x.r2.dev/ddays/alice/../bob/1.jpg", ""},
+		{"alice", "https://images.example.com/ddays/alice/1.jpg", ""},
+		{"", "https://pub-x.r2.dev/ddays//1.jpg", ""},
+	} {
+		if got, ok := cfg.ownedKey(tc.uid, tc.url); got != tc.want || ok != (tc.want != "") {
+			t.Errorf("ownedKey(%q, %q) = %q, %v", tc.uid, tc.url, got, ok)
+		}
+	}
+}
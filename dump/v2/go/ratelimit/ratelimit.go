@@ -0,0 +1,92 @@
+// Package ratelimit throttles requests with token buckets
+// the memory limiter is enough for a single instance, several instances need a shared Limiter
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Policy allows Burst requests at once, refilled at Requests per Per
+type Policy struct {
+	Requests int
+	Per      time.Duration
+	// defaults to Requests
+	Burst int
+}
+
+func (p Policy) capacity() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Requests)
+}
+
+// tokens added per second
+func (p Policy) rate() float64 {
+	return float64(p.Requests) / p.Per.Seconds()
+}
+
+// Limiter takes one token from the bucket of key
+// when the bucket is empty it returns false and how long until the next token
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (bool, time.Duration, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket is back at capacity, so it can be dropped
+}
+
+// Memory keeps the buckets in process memory
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+
+	// replaced in tests
+	now func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// full buckets are dropped every this many calls so the map does not grow forever
+const pruneEvery = 1000
+
+func (m *Memory) Allow(ctx context.Context, key string, policy Policy) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.calls++
+	if m.calls%pruneEvery == 0 {
+		for k, b := range m.buckets {
+			if !now.Before(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+	}
+
+	capacity, rate := policy.capacity(), policy.rate()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		// rounded so float noise does not show up in the wait
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second)).Round(time.Millisecond)
+		return false, wait, nil
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((capacity - b.tokens) / rate * float64(time.Second)))
+	return true, 0, nil
+}
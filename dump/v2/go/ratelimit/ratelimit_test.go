@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+	policy := Policy{Requests: 2, Per: time.Minute, Burst: 3}
+
+	allow := func(key string) (bool, time.Duration) {
+		t.Helper()
+		ok, wait, err := m.Allow(ctx, key, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok, wait
+	}
+
+	// the burst is available at once
+	for i := range 3 {
+		if ok, _ := allow("a"); !ok {
+			t.Fatalf("request %d was limited", i)
+		}
+	}
+	ok, wait := allow("a")
+	if ok || wait != 30*time.Second {
+		t.Fatalf("empty bucket: ok %v, wait %v", ok, wait)
+	}
+
+	// other keys have their own bucket
+	if ok, _ := allow("b"); !ok {
+		t.Fatal("another key was limited")
+	}
+
+	// refills at the policy rate
+	now = now.Add(29 * time.Second)
+	if ok, wait := allow("a"); ok || wait != time.Second {
+		t.Fatalf("before refill: ok %v, wait %v", ok, wait)
+	}
+	now = now.Add(time.Second)
+	if ok, _ := allow("a"); !ok {
+		t.Fatal("not refilled after 30 seconds")
+	}
+
+	// never more than the burst after a long pause
+	now = now.Add(time.Hour)
+	for range 3 {
+		allow("a")
+	}
+	if ok, _ := allow("a"); ok {
+		t.Fatal("bucket refilled past its burst")
+	}
+}
+
+func TestMemoryPrune(t *testing.T) {
+	m := NewMemory()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	policy := Policy{Requests: 1, Per: time.Second}
+
+	m.Allow(context.Background(), "old", policy)
+	now = now.Add(time.Minute)
+	for i := 0; i < pruneEvery; i++ {
+		m.Allow(context.Background(), "new", policy)
+	}
+	if _, ok := m.buckets["old"]; ok {
+		t.Fatal("full bucket was not pruned")
+	}
+}
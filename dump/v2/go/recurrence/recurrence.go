@@ -0,0 +1,425 @@
+// Package recurrence expands the RFC 5545 recurrence rules (RRULE) of ddays
+// events are whole days, so the rules work on dates and the parts that pick times (BYHOUR and the like)
+// are not supported, nor are BYYEARDAY, BYWEEKNO and BYSETPOS
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the FREQ of a rule
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// Annual is the rule of the events that were only marked isAnnual
+const Annual = "FREQ=YEARLY"
+
+// ErrInvalid is wrapped by every error Parse returns
+var ErrInvalid = errors.New("recurrence: invalid rule")
+
+// maxPeriods bounds the expansion of rules that rarely or never match, like the 30th of February
+const maxPeriods = 100000
+
+// WeekdayNum is a BYDAY entry like MO, 2SA or -1FR
+type WeekdayNum struct {
+	// N is the nth such weekday of the month or year, negative counts from the end, 0 is every one
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a parsed RRULE
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// Count is the number of occurrences, 0 for no limit
+	Count int
+	// Until is the last day an occurrence can fall on, zero for no limit
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func weekdayName(d time.Weekday) string {
+	return strings.ToUpper(d.String()[:2])
+}
+
+// Parse reads a rule like FREQ=WEEKLY;BYDAY=FR, with or without the RRULE: prefix
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(name)
+		if !ok || value == "" {
+			return nil, invalid("%q is not NAME=VALUE", part)
+		}
+		if seen[name] {
+			return nil, invalid("%s is given twice", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			if !slices.Contains([]Frequency{Daily, Weekly, Monthly, Yearly}, r.Freq) {
+				err = invalid("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+			}
+		case "INTERVAL":
+			r.Interval, err = number(name, value, 1, 10000)
+		case "COUNT":
+			r.Count, err = number(name, value, 1, 10000)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = numbers(name, value, 31, true)
+		case "BYMONTH":
+			var months []int
+			months, err = numbers(name, value, 12, false)
+			for _, m := range months {
+				r.ByMonth = append(r.ByMonth, time.Month(m))
+			}
+		case "WKST":
+			day, ok := weekdays[strings.ToUpper(value)]
+			if !ok {
+				err = invalid("WKST %q is not a weekday", value)
+			}
+			r.WeekStart = day
+		default:
+			err = invalid("%s is not supported", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, invalid("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, invalid("COUNT and UNTIL cannot both be given")
+	}
+	if r.Freq == Weekly && len(r.ByMonthDay) > 0 {
+		return nil, invalid("BYMONTHDAY cannot be used with FREQ=WEEKLY")
+	}
+	for _, wd := range r.ByDay {
+		if wd.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return nil, invalid("numbered BYDAY like 2SA needs FREQ=MONTHLY or FREQ=YEARLY")
+		}
+	}
+	return r, nil
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+func number(name, value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, invalid("%s must be a number from %d to %d", name, min, max)
+	}
+	return n, nil
+}
+
+// numbers reads a comma separated list of 1 to max, or -max to -1 when negative is allowed
+func numbers(name, value string, max int, negative bool) ([]int, error) {
+	var out []int
+	for _, s := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n == 0 || n > max || n < -max || (n < 0 && !negative) {
+			return nil, invalid("%s %q is out of range", name, s)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// UNTIL is a date, or a date with a time that only the date is kept of
+func parseUntil(value string) (time.Time, error) {
+	if len(value) >= 8 {
+		if t, err := time.Parse("20060102", value[:8]); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, invalid("UNTIL %q is not a YYYYMMDD date", value)
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var out []WeekdayNum
+	for _, s := range strings.Split(strings.ToUpper(value), ",") {
+		if len(s) < 2 {
+			return nil, invalid("BYDAY %q is not a weekday", s)
+		}
+		day, ok := weekdays[s[len(s)-2:]]
+		if !ok {
+			return nil, invalid("BYDAY %q is not a weekday", s)
+		}
+		wd := WeekdayNum{Day: day}
+		if prefix := s[:len(s)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 || n > 53 || n < -53 {
+				return nil, invalid("BYDAY %q has a bad number", s)
+			}
+			wd.N = n
+		}
+		out = append(out, wd)
+	}
+	return out, nil
+}
+
+// String writes the rule back in a fixed order, so equal rules are equal strings
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = weekdayName(wd.Day)
+			if wd.N != 0 {
+				days[i] = strconv.Itoa(wd.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayName(r.WeekStart))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences that fall from from to to, both included, in order
+// start is the first occurrence (DTSTART) and counts towards COUNT even when the rule would not pick it
+// the days in except (EXDATE) are left out but still count, as RFC 5545 has it
+func (r *Rule) Between(start, from, to time.Time, except []time.Time) []time.Time {
+	start, from, to = day(start), day(from), day(to)
+	if !r.Until.IsZero() && r.Until.Before(to) {
+		to = r.Until
+	}
+
+	out := []time.Time{}
+	count := 0
+	// emit reports false once the expansion is done
+	emit := func(t time.Time) bool {
+		if t.After(to) {
+			return false
+		}
+		count++
+		if !t.Before(from) && !slices.ContainsFunc(except, func(e time.Time) bool { return day(e).Equal(t) }) {
+			out = append(out, t)
+		}
+		return r.Count == 0 || count < r.Count
+	}
+
+	if !emit(start) {
+		return out
+	}
+	for k := 0; k < maxPeriods; k++ {
+		period := r.period(start, k)
+		if period.After(to) {
+			break
+		}
+		for _, t := range r.candidates(start, period) {
+			if !t.After(start) {
+				continue
+			}
+			if !emit(t) {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// period returns the first day of the kth period after the one start is in
+func (r *Rule) period(start time.Time, k int) time.Time {
+	n := k * r.Interval
+	switch r.Freq {
+	case Daily:
+		return start.AddDate(0, 0, n)
+	case Weekly:
+		offset := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+		return start.AddDate(0, 0, 7*n-offset)
+	case Monthly:
+		return time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(start.Year()+n, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// candidates returns the days the rule picks in the period, in order
+func (r *Rule) candidates(start, period time.Time) []time.Time {
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		if r.matchesDay(period) {
+			days = []time.Time{period}
+		}
+	case Weekly:
+		weekdays := []time.Weekday{start.Weekday()}
+		if len(r.ByDay) > 0 {
+			weekdays = weekdays[:0]
+			for _, wd := range r.ByDay {
+				weekdays = append(weekdays, wd.Day)
+			}
+		}
+		for _, wd := range weekdays {
+			t := period.AddDate(0, 0, (int(wd)-int(r.WeekStart)+7)%7)
+			if r.inMonths(t.Month()) {
+				days = append(days, t)
+			}
+		}
+	case Monthly:
+		if r.inMonths(period.Month()) {
+			days = r.monthDays(start, period.Year(), period.Month())
+		}
+	case Yearly:
+		year := period.Year()
+		if len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) > 0 {
+			// numbered weekdays count through the whole year
+			first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+			days = r.weekdaysIn(first, first.AddDate(1, 0, -1))
+			break
+		}
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+			if len(r.ByMonthDay) > 0 || len(r.ByDay) > 0 {
+				months = []time.Month{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+			}
+		}
+		for _, m := range months {
+			days = append(days, r.monthDays(start, year, m)...)
+		}
+	}
+	slices.SortFunc(days, func(a, b time.Time) int { return a.Compare(b) })
+	return slices.CompactFunc(days, func(a, b time.Time) bool { return a.Equal(b) })
+}
+
+// monthDays returns the days of the month picked by BYMONTHDAY and BYDAY, both when both are given
+// without either it is the day of the month of start, months that lack it are skipped
+// except under the Annual rule, which moves a leap day to the 28th like the anniversary milestones do
+func (r *Rule) monthDays(start time.Time, year int, month time.Month) []time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1)
+
+	var byMonthDay []time.Time
+	for _, d := range r.ByMonthDay {
+		if d < 0 {
+			d = last.Day() + 1 + d
+		}
+		if d >= 1 && d <= last.Day() {
+			byMonthDay = append(byMonthDay, first.AddDate(0, 0, d-1))
+		}
+	}
+
+	switch {
+	case len(r.ByMonthDay) > 0 && len(r.ByDay) > 0:
+		byDay := r.weekdaysIn(first, last)
+		return slices.DeleteFunc(byMonthDay, func(t time.Time) bool {
+			return !slices.ContainsFunc(byDay, t.Equal)
+		})
+	case len(r.ByMonthDay) > 0:
+		return byMonthDay
+	case len(r.ByDay) > 0:
+		return r.weekdaysIn(first, last)
+	case start.Day() <= last.Day():
+		return []time.Time{first.AddDate(0, 0, start.Day()-1)}
+	case r.String() == Annual:
+		return []time.Time{last}
+	default:
+		return nil
+	}
+}
+
+// weekdaysIn returns the days from first to last picked by BYDAY, numbered entries count within that range
+func (r *Rule) weekdaysIn(first, last time.Time) []time.Time {
+	var out []time.Time
+	for _, wd := range r.ByDay {
+		var all []time.Time
+		for t := first.AddDate(0, 0, (int(wd.Day)-int(first.Weekday())+7)%7); !t.After(last); t = t.AddDate(0, 0, 7) {
+			all = append(all, t)
+		}
+		switch {
+		case wd.N == 0:
+			out = append(out, all...)
+		case wd.N > 0 && wd.N <= len(all):
+			out = append(out, all[wd.N-1])
+		case wd.N < 0 && -wd.N <= len(all):
+			out = append(out, all[len(all)+wd.N])
+		}
+	}
+	return out
+}
+
+// daily rules use the BY parts as filters
+func (r *Rule) matchesDay(t time.Time) bool {
+	if !r.inMonths(t.Month()) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 {
+		last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if !slices.ContainsFunc(r.ByMonthDay, func(d int) bool { return d == t.Day() || last+1+d == t.Day() }) {
+			return false
+		}
+	}
+	if len(r.ByDay) > 0 && !slices.ContainsFunc(r.ByDay, func(wd WeekdayNum) bool { return wd.Day == t.Weekday() }) {
+		return false
+	}
+	return true
+}
+
+func (r *Rule) inMonths(m time.Month) bool {
+	return len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, m)
+}
+
+// day drops the time of t, occurrences are compared as UTC dates
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
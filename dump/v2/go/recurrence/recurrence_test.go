@@ -0,0 +1,112 @@
+package recurrence
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("20060102", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func dates(ts []time.Time) []string {
+	out := make([]string, len(ts))
+	for i, t := range ts {
+		out[i] = t.Format("20060102")
+	}
+	return out
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		start    string
+		from, to string
+		except   []string
+		want     []string
+	}{
+		{"weekly date night", "FREQ=WEEKLY;BYDAY=FR", "20250103", "20250101", "20250131", nil,
+			[]string{"20250103", "20250110", "20250117", "20250124", "20250131"}},
+		{"every other week from a later window", "FREQ=WEEKLY;INTERVAL=2", "20250101", "20250201", "20250228", nil,
+			[]string{"20250212", "20250226"}},
+		{"monthsary skips short months", "FREQ=MONTHLY", "20250131", "20250101", "20250531", nil,
+			[]string{"20250131", "20250331", "20250531"}},
+		{"every 100 days", "FREQ=DAILY;INTERVAL=100", "20250101", "20250101", "20251231", nil,
+			[]string{"20250101", "20250411", "20250720", "20251028"}},
+		{"second saturday", "FREQ=MONTHLY;BYDAY=2SA", "20250111", "20250101", "20250430", nil,
+			[]string{"20250111", "20250208", "20250308", "20250412"}},
+		{"last friday", "FREQ=MONTHLY;BYDAY=-1FR", "20250131", "20250201", "20250331", nil,
+			[]string{"20250228", "20250328"}},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1", "20250131", "20250201", "20250430", nil,
+			[]string{"20250228", "20250331", "20250430"}},
+		{"annual", Annual, "19990315", "20250301", "20250331", nil,
+			[]string{"20250315"}},
+		{"annual leap day falls on the 28th in other years", Annual, "20240229", "20250101", "20281231", nil,
+			[]string{"20250228", "20260228", "20270228", "20280229"}},
+		{"leap day only in leap years", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "20240229", "20250101", "20281231", nil,
+			[]string{"20280229"}},
+		{"yearly by month and weekday", "FREQ=YEARLY;BYMONTH=5;BYDAY=2SU", "20250511", "20260101", "20261231", nil,
+			[]string{"20260510"}},
+		{"count includes the start", "FREQ=WEEKLY;COUNT=3", "20250101", "20250101", "20251231", nil,
+			[]string{"20250101", "20250108", "20250115"}},
+		{"count includes excluded days", "FREQ=WEEKLY;COUNT=3", "20250101", "20250101", "20251231", []string{"20250108"},
+			[]string{"20250101", "20250115"}},
+		{"until is inclusive", "FREQ=DAILY;UNTIL=20250103T235959Z", "20250101", "20250101", "20250131", nil,
+			[]string{"20250101", "20250102", "20250103"}},
+		{"nothing before the start", "FREQ=YEARLY", "20300101", "20250101", "20251231", nil,
+			[]string{}},
+		{"never matches", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", "20250101", "20250201", "20250228", nil,
+			[]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var except []time.Time
+			for _, e := range tt.except {
+				except = append(except, date(e))
+			}
+			got := dates(r.Between(date(tt.start), date(tt.from), date(tt.to), except))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	r, err := Parse("RRULE:freq=monthly;byday=2sa,-1FR;wkst=SU;interval=3;until=20261231")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.String(), "FREQ=MONTHLY;INTERVAL=3;UNTIL=20261231;BYDAY=2SA,-1FR;WKST=SU"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{
+		"",
+		"BYDAY=MO",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT=2;UNTIL=20250101",
+		"FREQ=WEEKLY;BYDAY=2MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;INTERVAL=0",
+	} {
+		if _, err := Parse(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %v, want ErrInvalid", bad, err)
+		}
+	}
+}
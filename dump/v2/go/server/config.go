@@ -0,0 +1,477 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+
+	"calple/handlers"
+	"calple/identity"
+	"calple/keyring"
+	"calple/mailer"
+	"calple/r2"
+	"calple/ratelimit"
+)
+
+// Config is loaded once at startup, in increasing priority from
+// defaults, an optional yaml/toml file, env variables and command line flags
+type Config struct {
+	Env          string `yaml:"env" toml:"env"` // "development" or anything else for production
+	Port         string `yaml:"port" toml:"port"`
+	FrontendURL  string `yaml:"frontendUrl" toml:"frontendUrl"`
+	CookieDomain string `yaml:"cookieDomain" toml:"cookieDomain"`
+	// where the api itself is reachable, used for the oauth redirect urls and the calendar feed urls
+	PublicURL string `yaml:"publicUrl" toml:"publicUrl"`
+
+	Storage    string `yaml:"storage" toml:"storage"` // firestore, memory or sqlite
+	SQLitePath string `yaml:"sqlitePath" toml:"sqlitePath"`
+
+	// base64 encoded 32 byte keys for the oauth tokens stored on users
+	// the first key encrypts, the others are only used to decrypt during a rotation
+	TokenKeys []string `yaml:"tokenKeys" toml:"tokenKeys"`
+
+	Firebase FirebaseConfig `yaml:"firebase" toml:"firebase"`
+	Google   GoogleConfig   `yaml:"google" toml:"google"`
+	R2       R2Config       `yaml:"r2" toml:"r2"`
+	Mail     MailConfig     `yaml:"mail" toml:"mail"`
+
+	// openid connect providers besides google, by the name used in /oauth/{name}/login
+	Providers map[string]ProviderConfig `yaml:"providers" toml:"providers"`
+
+	// ips or cidr ranges of the proxies in front of the api, only they can set X-Forwarded-For
+	// with none the client ip is the address of the connection
+	TrustedProxies []string `yaml:"trustedProxies" toml:"trustedProxies"`
+
+	// rate limit policies by name, each one overrides the matching default
+	RateLimits map[string]RateLimitConfig `yaml:"rateLimits" toml:"rateLimits"`
+}
+
+type FirebaseConfig struct {
+	CredentialsJSON string `yaml:"credentialsJson" toml:"credentialsJson"`
+	CredentialsFile string `yaml:"credentialsFile" toml:"credentialsFile"`
+}
+
+// google oauth client
+type GoogleConfig struct {
+	ClientID     string `yaml:"clientId" toml:"clientId"`
+	ClientSecret string `yaml:"clientSecret" toml:"clientSecret"`
+	RedirectURL  string `yaml:"redirectUrl" toml:"redirectUrl"`
+}
+
+// any openid connect provider, the endpoints are discovered from the issuer
+type ProviderConfig struct {
+	Issuer       string   `yaml:"issuer" toml:"issuer"`
+	ClientID     string   `yaml:"clientId" toml:"clientId"`
+	ClientSecret string   `yaml:"clientSecret" toml:"clientSecret"`
+	RedirectURL  string   `yaml:"redirectUrl" toml:"redirectUrl"`
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+}
+
+// outgoing mail for email logins
+type MailConfig struct {
+	Driver string `yaml:"driver" toml:"driver"` // smtp, file or console
+	From   string `yaml:"from" toml:"from"`
+	Dir    string `yaml:"dir" toml:"dir"` // where the file driver writes .eml files
+
+	SMTPHost     string `yaml:"smtpHost" toml:"smtpHost"`
+	SMTPPort     string `yaml:"smtpPort" toml:"smtpPort"`
+	SMTPUsername string `yaml:"smtpUsername" toml:"smtpUsername"`
+	SMTPPassword string `yaml:"smtpPassword" toml:"smtpPassword"`
+}
+
+// token bucket of Requests per Per, with room for Burst requests at once
+// zero requests turns the policy off
+type RateLimitConfig struct {
+	Requests int    `yaml:"requests" toml:"requests"`
+	Per      string `yaml:"per" toml:"per"` // duration like 1m or 1h
+	Burst    int    `yaml:"burst" toml:"burst"`
+}
+
+// the policies the router uses, requests are counted per user or per ip when signed out
+var defaultRateLimits = map[string]RateLimitConfig{
+	"api":      {Requests: 300, Per: "1m"}, // every signed in request
+	"auth":     {Requests: 10, Per: "15m"}, // logins, signups and emailed links, per ip
+	"invite":   {Requests: 10, Per: "1h"},  // connection invites reveal whether an email is registered
+	"feedback": {Requests: 5, Per: "1h"},
+	"ideas":    {Requests: 20, Per: "1h"}, // new idea posts
+	"upload":   {Requests: 60, Per: "1h"}, // dday image upload urls
+	"export":   {Requests: 5, Per: "1h"},  // data exports read every collection of the user
+	"import":   {Requests: 20, Per: "1h"}, // dry runs count too
+}
+
+// google signs in through the same openid connect flow as every other provider
+const googleIssuer = "https://accounts.google.com"
+
+// cloudflare r2 bucket for dday images
+type R2Config struct {
+	AccountID       string `yaml:"accountId" toml:"accountId"`
+	AccessKeyID     string `yaml:"accessKeyId" toml:"accessKeyId"`
+	AccessKeySecret string `yaml:"accessKeySecret" toml:"accessKeySecret"`
+	BucketName      string `yaml:"bucketName" toml:"bucketName"`
+	PublicBucketID  string `yaml:"publicBucketId" toml:"publicBucketId"`
+}
+
+func (cfg *Config) Development() bool {
+	return cfg.Env == "development"
+}
+
+// LoadConfig builds the config for the binary, args are the command line arguments without the program name
+// the file is given with -config or CONFIG_FILE and its format is picked from the extension
+func LoadConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+
+	fs := flag.NewFlagSet("calple", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a yaml or toml config file")
+	env := fs.String("env", "", "environment, development or production")
+	port := fs.String("port", "", "port to listen on")
+	storage := fs.String("storage", "", "storage backend: firestore, memory or sqlite")
+	sqlitePath := fs.String("sqlite-path", "", "sqlite database file")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	cfg.loadEnv()
+
+	// flags win over everything else
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			cfg.Env = *env
+		case "port":
+			cfg.Port = *port
+		case "storage":
+			cfg.Storage = *storage
+		case "sqlite-path":
+			cfg.SQLitePath = *sqlitePath
+		}
+	})
+
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config file %s: use a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// env variables override the file when they are set
+func (cfg *Config) loadEnv() {
+	for name, field := range map[string]*string{
+		"ENV":                       &cfg.Env,
+		"PORT":                      &cfg.Port,
+		"FRONTEND_URL":              &cfg.FrontendURL,
+		"COOKIE_DOMAIN":             &cfg.CookieDomain,
+		"PUBLIC_URL":                &cfg.PublicURL,
+		"STORAGE":                   &cfg.Storage,
+		"SQLITE_PATH":               &cfg.SQLitePath,
+		"FIREBASE_CREDENTIALS_JSON": &cfg.Firebase.CredentialsJSON,
+		"FIREBASE_CREDENTIALS_FILE": &cfg.Firebase.CredentialsFile,
+		"OAUTH2_CLIENT_ID":          &cfg.Google.ClientID,
+		"OAUTH2_CLIENT_SECRET":      &cfg.Google.ClientSecret,
+		"OAUTH2_REDIRECT_URL":       &cfg.Google.RedirectURL,
+		"R2_ACCOUNT_ID":             &cfg.R2.AccountID,
+		"R2_ACCESS_KEY_ID":          &cfg.R2.AccessKeyID,
+		"R2_ACCESS_KEY_SECRET":      &cfg.R2.AccessKeySecret,
+		"R2_BUCKET_NAME":            &cfg.R2.BucketName,
+		"R2_PUBLIC_BUCKET_ID":       &cfg.R2.PublicBucketID,
+		"MAIL_DRIVER":               &cfg.Mail.Driver,
+		"MAIL_FROM":                 &cfg.Mail.From,
+		"MAIL_DIR":                  &cfg.Mail.Dir,
+		"SMTP_HOST":                 &cfg.Mail.SMTPHost,
+		"SMTP_PORT":                 &cfg.Mail.SMTPPort,
+		"SMTP_USERNAME":             &cfg.Mail.SMTPUsername,
+		"SMTP_PASSWORD":             &cfg.Mail.SMTPPassword,
+	} {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	// comma separated, primary key first
+	if value, ok := os.LookupEnv("TOKEN_ENCRYPTION_KEYS"); ok {
+		cfg.TokenKeys = splitList(value)
+	}
+	if value, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		cfg.TrustedProxies = splitList(value)
+	}
+
+	// one extra provider can be configured from env, more need a config file
+	if issuer, ok := os.LookupEnv("OIDC_ISSUER"); ok {
+		name := os.Getenv("OIDC_PROVIDER_NAME")
+		if name == "" {
+			name = "oidc"
+		}
+		if cfg.Providers == nil {
+			cfg.Providers = map[string]ProviderConfig{}
+		}
+		cfg.Providers[name] = ProviderConfig{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}
+	}
+}
+
+// comma separated values, blanks are left out
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Port == "" {
+		cfg.Port = "5000"
+	}
+	if cfg.Storage == "" {
+		cfg.Storage = "firestore"
+	}
+	if cfg.SQLitePath == "" {
+		cfg.SQLitePath = "calple.db"
+	}
+	if cfg.Firebase.CredentialsFile == "" {
+		cfg.Firebase.CredentialsFile = "firebase_credentials.json"
+	}
+	if cfg.Mail.Driver == "" {
+		cfg.Mail.Driver = "console"
+		if cfg.Mail.SMTPHost != "" {
+			cfg.Mail.Driver = "smtp"
+		}
+	}
+	if cfg.Mail.From == "" {
+		cfg.Mail.From = "Calple <no-reply@calple.date>"
+	}
+	if cfg.Mail.Dir == "" {
+		cfg.Mail.Dir = "mail"
+	}
+
+	// fields left out of a configured policy come from its default
+	if cfg.RateLimits == nil {
+		cfg.RateLimits = map[string]RateLimitConfig{}
+	}
+	for name, def := range defaultRateLimits {
+		limit, ok := cfg.RateLimits[name]
+		if !ok {
+			cfg.RateLimits[name] = def
+			continue
+		}
+		if limit.Per == "" {
+			limit.Per = def.Per
+		}
+		cfg.RateLimits[name] = limit
+	}
+
+	// production runs on calple.date, development on localhost
+	if cfg.PublicURL == "" {
+		if cfg.Development() {
+			cfg.PublicURL = "http://localhost:" + cfg.Port
+		} else {
+			cfg.PublicURL = "https://api.calple.date"
+		}
+	}
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	if !cfg.Development() && cfg.CookieDomain == "" {
+		cfg.CookieDomain = ".calple.date"
+	}
+
+	// google keeps its original callback so the registered redirect url does not change
+	if cfg.Google.RedirectURL == "" {
+		cfg.Google.RedirectURL = cfg.PublicURL + "/google/oauth/callback"
+	}
+	for name, provider := range cfg.Providers {
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = cfg.PublicURL + "/oauth/" + name + "/callback"
+			cfg.Providers[name] = provider
+		}
+	}
+}
+
+func (cfg *Config) validate() error {
+	switch cfg.Storage {
+	case "firestore", "memory", "sqlite":
+	default:
+		return fmt.Errorf("unknown storage %q, use firestore, memory or sqlite", cfg.Storage)
+	}
+	if len(cfg.TokenKeys) > 0 {
+		if _, err := keyring.New(cfg.TokenKeys); err != nil {
+			return fmt.Errorf("TOKEN_ENCRYPTION_KEYS: %w", err)
+		}
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("TRUSTED_PROXIES: %q is not an ip or cidr range", proxy)
+		}
+	}
+	switch cfg.Mail.Driver {
+	case "smtp":
+		if cfg.Mail.SMTPHost == "" {
+			return errors.New("SMTP_HOST is required for the smtp mail driver")
+		}
+	case "file", "console":
+	default:
+		return fmt.Errorf("unknown mail driver %q, use smtp, file or console", cfg.Mail.Driver)
+	}
+	for name, limit := range cfg.RateLimits {
+		if limit.Requests < 0 || limit.Burst < 0 {
+			return fmt.Errorf("rate limit %q: requests and burst cannot be negative", name)
+		}
+		if limit.Requests == 0 {
+			continue
+		}
+		if per, err := time.ParseDuration(limit.Per); err != nil || per <= 0 {
+			return fmt.Errorf("rate limit %q: per must be a positive duration like 1m, got %q", name, limit.Per)
+		}
+	}
+	for name, provider := range cfg.Providers {
+		if !validProviderName(name) {
+			return fmt.Errorf("provider %q: use lowercase letters, digits and dashes", name)
+		}
+		if name == "google" {
+			return errors.New(`provider "google" is configured with the google section`)
+		}
+		if name == "email" {
+			return errors.New(`provider name "email" is used by email and password accounts`)
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return fmt.Errorf("provider %q: issuer and clientId are required", name)
+		}
+	}
+	return nil
+}
+
+// provider names are part of the callback url
+func validProviderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// policies that are turned off are left out, the handlers skip unknown policies
+func (cfg *Config) rateLimits() map[string]ratelimit.Policy {
+	policies := map[string]ratelimit.Policy{}
+	for name, limit := range cfg.RateLimits {
+		if limit.Requests == 0 {
+			continue
+		}
+		// checked by validate
+		per, _ := time.ParseDuration(limit.Per)
+		policies[name] = ratelimit.Policy{Requests: limit.Requests, Per: per, Burst: limit.Burst}
+	}
+	return policies
+}
+
+// Mailer sends mail through the configured driver, the console without one
+func (cfg *Config) Mailer() mailer.Mailer {
+	switch cfg.Mail.Driver {
+	case "smtp":
+		return mailer.NewSMTP(mailer.SMTPConfig{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			From:     cfg.Mail.From,
+		})
+	case "file":
+		return mailer.NewFile(cfg.Mail.Dir, cfg.Mail.From)
+	default:
+		return mailer.NewConsole(os.Stdout)
+	}
+}
+
+func (cfg *Config) identityProviders() *identity.Registry {
+	providers := []identity.Provider{
+		identity.NewOIDC(identity.OIDCConfig{
+			Name:         "google",
+			Issuer:       googleIssuer,
+			ClientID:     cfg.Google.ClientID,
+			ClientSecret: cfg.Google.ClientSecret,
+			RedirectURL:  cfg.Google.RedirectURL,
+			// a refresh token is only sent for offline access
+			AuthParams: map[string]string{"access_type": "offline"},
+		}),
+	}
+	for name, provider := range cfg.Providers {
+		providers = append(providers, identity.NewOIDC(identity.OIDCConfig{
+			Name:         name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		}))
+	}
+	return identity.NewRegistry(providers...)
+}
+
+// the handlers only get the parts they use
+func (cfg *Config) handlersConfig() *handlers.Config {
+	// the keys were checked by validate
+	var kr *keyring.Keyring
+	if len(cfg.TokenKeys) > 0 {
+		kr, _ = keyring.New(cfg.TokenKeys)
+	}
+
+	return &handlers.Config{
+		FrontendURL: cfg.FrontendURL,
+		PublicURL:   cfg.PublicURL,
+		Providers:   cfg.identityProviders(),
+		Mailer:      cfg.Mailer(),
+		RateLimits:  cfg.rateLimits(),
+		R2:          cfg.bucket(),
+		Keyring:     kr,
+	}
+}
+
+// the dday image bucket, for uploads and for deleting the images of purged accounts
+func (cfg *Config) bucket() r2.Config {
+	return r2.Config{
+		AccountID:       cfg.R2.AccountID,
+		AccessKeyID:     cfg.R2.AccessKeyID,
+		AccessKeySecret: cfg.R2.AccessKeySecret,
+		BucketName:      cfg.R2.BucketName,
+		PublicBucketID:  cfg.R2.PublicBucketID,
+	}
+}
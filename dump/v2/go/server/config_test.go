@@ -0,0 +1,196 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, "calple.yaml", `
+env: development
+port: "6000"
+frontendUrl: https://file.example.com
+storage: sqlite
+sqlitePath: file.db
+google:
+  clientId: file-client
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("FRONTEND_URL", "https://env.example.com")
+	t.Setenv("SQLITE_PATH", "env.db")
+
+	cfg, err := LoadConfig([]string{"-sqlite-path", "flag.db", "-port", "7000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Env != "development" || cfg.Google.ClientID != "file-client" || cfg.Storage != "sqlite" {
+		t.Errorf("file values not loaded: %+v", cfg)
+	}
+	if cfg.FrontendURL != "https://env.example.com" {
+		t.Errorf("env should override file, got frontend url %q", cfg.FrontendURL)
+	}
+	if cfg.SQLitePath != "flag.db" || cfg.Port != "7000" {
+		t.Errorf("flags should override env and file, got %q %q", cfg.SQLitePath, cfg.Port)
+	}
+	if cfg.Google.RedirectURL != "http://localhost:7000/google/oauth/callback" {
+		t.Errorf("redirect url default: %q", cfg.Google.RedirectURL)
+	}
+	if cfg.CookieDomain != "" {
+		t.Errorf("development cookies should not set a domain, got %q", cfg.CookieDomain)
+	}
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	path := writeConfig(t, "calple.toml", `
+frontendUrl = "https://calple.date"
+
+[r2]
+bucketName = "images"
+`)
+
+	cfg, err := LoadConfig([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.R2.BucketName != "images" || cfg.FrontendURL != "https://calple.date" {
+		t.Errorf("toml values not loaded: %+v", cfg)
+	}
+
+	// production defaults
+	if cfg.Port != "5000" || cfg.Storage != "firestore" || cfg.CookieDomain != ".calple.date" {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	if _, err := LoadConfig([]string{"-storage", "mongo"}); err == nil {
+		t.Error("unknown storage should fail")
+	}
+	if _, err := LoadConfig([]string{"-config", writeConfig(t, "calple.json", "{}")}); err == nil {
+		t.Error("unsupported config format should fail")
+	}
+
+	t.Setenv("MAIL_DRIVER", "smtp")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("smtp without a host should fail")
+	}
+	t.Setenv("MAIL_DRIVER", "pigeon")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("unknown mail driver should fail")
+	}
+	t.Setenv("MAIL_DRIVER", "")
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, everyone")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("a trusted proxy that is not an ip or range should fail")
+	}
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	t.Setenv("TOKEN_ENCRYPTION_KEYS", "c2hvcnQ=")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("a key that is not 32 bytes should fail")
+	}
+}
+
+func TestLoadConfigTokenKeys(t *testing.T) {
+	t.Setenv("TOKEN_ENCRYPTION_KEYS", "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=, BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA=")
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.TokenKeys) != 2 || cfg.TokenKeys[1] != "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA=" {
+		t.Fatalf("keys = %q", cfg.TokenKeys)
+	}
+	if cfg.handlersConfig().Keyring == nil {
+		t.Error("handlers get no keyring")
+	}
+}
+
+func TestLoadConfigProviders(t *testing.T) {
+	path := writeConfig(t, "calple.yaml", `
+publicUrl: https://api.example.com/
+providers:
+  okta:
+    issuer: https://example.okta.com
+    clientId: okta-client
+    redirectUrl: https://custom.example.com/callback
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("OIDC_PROVIDER_NAME", "keycloak")
+	t.Setenv("OIDC_ISSUER", "https://sso.example.com/realms/calple")
+	t.Setenv("OIDC_CLIENT_ID", "keycloak-client")
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Google.RedirectURL != "https://api.example.com/google/oauth/callback" {
+		t.Errorf("google redirect url: %q", cfg.Google.RedirectURL)
+	}
+	if got := cfg.Providers["okta"].RedirectURL; got != "https://custom.example.com/callback" {
+		t.Errorf("okta redirect url: %q", got)
+	}
+	keycloak := cfg.Providers["keycloak"]
+	if keycloak.ClientID != "keycloak-client" || keycloak.RedirectURL != "https://api.example.com/oauth/keycloak/callback" {
+		t.Errorf("keycloak from env: %+v", keycloak)
+	}
+
+	t.Setenv("OIDC_PROVIDER_NAME", "Bad Name")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("invalid provider name accepted")
+	}
+	t.Setenv("OIDC_PROVIDER_NAME", "google")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("provider named google accepted")
+	}
+}
+
+func TestLoadConfigRateLimits(t *testing.T) {
+	path := writeConfig(t, "calple.yaml", `
+rateLimits:
+  invite:
+    requests: 3
+  api:
+    requests: 0
+`)
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies := cfg.rateLimits()
+	if invite := policies["invite"]; invite.Requests != 3 || invite.Per != time.Hour {
+		t.Errorf("invite should keep the default period: %+v", invite)
+	}
+	if feedback := policies["feedback"]; feedback.Requests != 5 {
+		t.Errorf("feedback default: %+v", feedback)
+	}
+	if _, ok := policies["api"]; ok {
+		t.Error("api limit should be turned off")
+	}
+
+	path = writeConfig(t, "calple.yaml", `
+rateLimits:
+  upload:
+    requests: 5
+    per: soon
+`)
+	t.Setenv("CONFIG_FILE", path)
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("invalid rate limit period accepted")
+	}
+}
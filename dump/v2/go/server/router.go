@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"calple/export"
+	"calple/handlers"
+	"calple/ratelimit"
+	"calple/sessionstore"
+	"calple/store"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// Deps are the services the router needs that are opened outside of it
+type Deps struct {
+	Store store.Store
+	// counts requests for the rate limits, in memory when nil
+	// a limiter backed by a shared store keeps the counts across instances
+	Limiter ratelimit.Limiter
+	// builds the data exports, writing to the temp dir when nil
+	Exports *export.Jobs
+}
+
+// NewRouter builds the engine with every middleware and route
+// main and the tests share it, only the config and storage backend differ
+func NewRouter(cfg *Config, deps Deps) *gin.Engine {
+	st := deps.Store
+	handlersConfig := cfg.handlersConfig()
+	limiter := deps.Limiter
+	if limiter == nil {
+		limiter = ratelimit.NewMemory()
+	}
+	exports := deps.Exports
+	if exports == nil {
+		exports = export.NewJobs(st, cfg.bucket(), "")
+	}
+
+	router := gin.Default()
+
+	// X-Forwarded-For is only read from the configured proxies, anyone else could
+	// send a new address with every request and get a fresh rate limit each time
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fmt.Printf("ERROR: Failed to set trusted proxies: %v\n", err)
+	}
+
+	// set gin mode for prod
+	// in development mode, gin will log requests and errors
+	// in production avoid logging requests for performance and security
+	if !cfg.Development() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// session, the client address is resolved with the trusted proxies first
+	router.Use(sessionstore.ClientIP)
+	router.Use(sessions.Sessions("calple_session", newSessionStore(cfg, st)))
+
+	// CORS
+	corsConfig := cors.Config{
+		AllowOrigins:     []string{cfg.FrontendURL, "https://www.calple.date", "https://calple.date"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "X-CSRF-Token"},
+		ExposeHeaders:    []string{"Set-Cookie"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}
+	router.Use(cors.New(corsConfig))
+
+	// store, config, rate limiter and export jobs into context
+	// this middleware sets the storage backend and config in the context for use in handlers
+	router.Use(func(c *gin.Context) {
+		c.Set("store", st)
+		c.Set("config", handlersConfig)
+		c.Set("limiter", limiter)
+		c.Set("exports", exports)
+		c.Next()
+	})
+
+	// logging middleware for debugging
+	router.Use(func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		method := c.Request.Method
+
+		// process request
+		c.Next()
+
+		status := c.Writer.Status()
+		latency := time.Since(start)
+
+		fmt.Printf("DEBUG: %s %s - Status: %d, Latency: %v\n", method, path, status, latency)
+
+		if status >= 400 {
+			fmt.Printf("DEBUG: Error request - Method: %s, Path: %s, Status: %d, User-Agent: %s\n",
+				method, path, status, c.Request.UserAgent())
+		}
+	})
+
+	// every cookie authenticated request that changes data needs the csrf token
+	router.Use(handlers.RequireCSRF)
+
+	// auth routes
+	router.GET("/google/oauth/login", handlers.Login)
+	router.GET("/google/oauth/callback", handlers.Callback)
+	router.GET("/api/auth/status", handlers.AuthStatus)
+	router.GET("/api/auth/csrf", handlers.GetCSRFToken)
+	router.GET("/google/oauth/logout", handlers.Logout)
+
+	// every configured provider, google included
+	router.GET("/oauth/providers", handlers.GetProviders)
+	router.GET("/oauth/:provider/login", handlers.Login)
+	router.GET("/oauth/:provider/callback", handlers.Callback)
+
+	// email and password, magic link and password reset
+	// the emailed links open the frontend which posts the token to these routes
+	// limited per ip against password guessing and mail flooding
+	emailAuth := router.Group("/auth", handlers.RateLimit("auth"))
+	{
+		emailAuth.POST("/signup", handlers.Signup)
+		emailAuth.POST("/verify", handlers.VerifyEmail)
+		emailAuth.POST("/login", handlers.PasswordLogin)
+		emailAuth.POST("/magic", handlers.RequestMagicLink)
+		emailAuth.POST("/magic/verify", handlers.MagicLogin)
+		emailAuth.POST("/password/forgot", handlers.ForgotPassword)
+		emailAuth.POST("/password/reset", handlers.ResetPassword)
+		emailAuth.POST("/email/confirm", handlers.ConfirmEmailChange)
+	}
+
+	// offline login, only with a local store in development
+	if cfg.Development() && cfg.Storage != "firestore" {
+		router.GET("/dev/login", handlers.DevLogin)
+	}
+
+	// health check endpoint
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":      "healthy",
+			"timestamp":   time.Now().UTC(),
+			"environment": cfg.Env,
+		})
+	})
+
+	// firebase connectivity test endpoint
+	router.GET("/api/health/firebase", func(c *gin.Context) {
+		if err := st.Ping(context.Background()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "firebase_error",
+				"error":  err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "firebase_connected",
+			"message": "Firebase connection is working",
+		})
+	})
+
+	// public api routes
+	router.GET("/api/ideas/all", handlers.GetAllPosts)
+
+	// calendar apps subscribe without signing in, the secret in the url stands in for the user
+	router.GET("/feeds/:file", handlers.GetFeedICS)
+
+	// calendar apps sync the events both ways with an api token as their password
+	// PROPFIND and REPORT only read, so a ddays:read token gives a read only calendar
+	router.GET("/.well-known/caldav", handlers.CalDAVWellKnown)
+	router.Handle("PROPFIND", "/.well-known/caldav", handlers.CalDAVWellKnown)
+	caldav := router.Group("/caldav", handlers.CalDAVAuth, handlers.RequireAuth, handlers.RateLimit("api"), handlers.RequireScope("ddays"))
+	{
+		for _, path := range []string{"/", "/ddays/", "/ddays/:file"} {
+			caldav.OPTIONS(path, handlers.CalDAVOptions)
+			caldav.Handle("PROPFIND", path, handlers.CalDAVPropfind)
+		}
+		caldav.Handle("REPORT", "/ddays/", handlers.CalDAVReport)
+		caldav.GET("/ddays/:file", handlers.CalDAVGet)
+		caldav.HEAD("/ddays/:file", handlers.CalDAVGet)
+		caldav.PUT("/ddays/:file", handlers.CalDAVPut)
+		caldav.DELETE("/ddays/:file", handlers.CalDAVDelete)
+	}
+
+	// a deleted account is turned away by RequireAuth until it is restored
+	router.POST("/api/user/restore", handlers.RestoreUser)
+
+	// everything else under /api needs a signed in user
+	// api tokens only reach the resources they are scoped to
+	api := router.Group("/api", handlers.RequireAuth, handlers.RateLimit("api"))
+	{
+		// dday event routes
+		ddays := api.Group("/ddays", handlers.RequireScope("ddays"))
+		{
+			ddays.GET("", handlers.GetDDays)
+			ddays.POST("", handlers.CreateDDay)
+			ddays.PUT("/:id", handlers.UpdateDDay)
+			ddays.DELETE("/:id", handlers.DeleteDDay)
+			ddays.POST("/upload-url", handlers.RateLimit("upload"), handlers.GetDDayUploadURL)
+			ddays.POST("/import", handlers.RateLimit("import"), handlers.ImportDDaysICS)
+			ddays.GET("/milestones/hidden", handlers.GetHiddenMilestones)
+			ddays.PUT("/milestones/:key/hidden", handlers.HideMilestone)
+			ddays.DELETE("/milestones/:key/hidden", handlers.ShowMilestone)
+		}
+
+		// connection routes
+		connection := api.Group("/connection", handlers.RequireScope("connection"))
+		{
+			connection.GET("", handlers.GetConnection)
+			connection.POST("/invite", handlers.RateLimit("invite"), handlers.InviteConnection)
+			connection.GET("/pending", handlers.GetPendingInvitations)
+			connection.POST("/:id/accept", handlers.AcceptInvitation)
+			connection.POST("/:id/reject", handlers.RejectInvitation)
+		}
+
+		// idea routes
+		ideas := api.Group("/ideas", handlers.RequireScope("ideas"))
+		{
+			ideas.GET("", handlers.GetPost)
+			ideas.POST("", handlers.RateLimit("ideas"), handlers.AddPost)
+			ideas.PUT("/:id", handlers.UpdatePost)
+			ideas.DELETE("/:id", handlers.DeletePost)
+		}
+
+		// roulette routes
+		roulette := api.Group("/roulette", handlers.RequireScope("roulette"))
+		{
+			roulette.GET("", handlers.GetIdeaRoulette)
+			roulette.POST("", handlers.AddIdeaRoulette)
+			roulette.PUT("/:id", handlers.EditIdeaRoulette)
+			roulette.DELETE("/:id", handlers.DeleteIdeaRoulette)
+		}
+
+		// period tracking routes
+		periods := api.Group("/periods", handlers.RequireScope("periods"))
+		{
+			periods.GET("/days", handlers.GetPeriodDays)
+			periods.GET("/partner/days", handlers.GetPartnerPeriodDays)
+			periods.POST("/days", handlers.CreatePeriodDay)
+			periods.DELETE("/days/:date", handlers.DeletePeriodDay)
+
+			periods.GET("/settings", handlers.GetCycleSettings)
+			periods.PUT("/settings", handlers.UpdateCycleSettings)
+		}
+
+		// user routes
+		// deleting the account is never allowed with a token
+		user := api.Group("/user", handlers.RequireScope("user"))
+		{
+			user.GET("/metadata", handlers.GetUserMetadata)
+			user.PUT("/metadata", handlers.UpdateUserMetadata)
+			user.GET("/partner/metadata", handlers.GetPartnerMetadata)
+			user.DELETE("", handlers.RequireSession, handlers.DeleteUser)
+			user.POST("/email", handlers.RequireSession, handlers.RateLimit("auth"), handlers.RequestEmailChange)
+
+			// takeout of everything stored for the user, only from a signed in session
+			user.GET("/export", handlers.RequireSession, handlers.RateLimit("export"), handlers.ExportUser)
+			user.GET("/export/:id", handlers.RequireSession, handlers.GetExportStatus)
+			user.GET("/export/:id/download", handlers.RequireSession, handlers.DownloadExport)
+			user.POST("/import", handlers.RequireSession, handlers.RateLimit("import"), handlers.ImportUser)
+
+			// linked sign in providers
+			user.GET("/identities", handlers.GetIdentities)
+			user.DELETE("/identities/:provider/:subject", handlers.RequireSession, handlers.DeleteIdentity)
+		}
+
+		// checkin routes
+		checkin := api.Group("/checkin", handlers.RequireScope("checkin"))
+		{
+			checkin.POST("", handlers.CreateCheckin)
+			checkin.GET("/:date", handlers.GetTodayCheckin)
+			checkin.DELETE("/:date", handlers.DeleteCheckin)
+			checkin.GET("/partner/:date", handlers.GetPartnerCheckin)
+		}
+
+		// debug route
+		api.GET("/debug/connection", handlers.RequireScope("connection"), handlers.DebugConnection)
+
+		// feedback routes
+		feedback := api.Group("/feedback", handlers.RequireScope("feedback"))
+		{
+			feedback.POST("", handlers.RateLimit("feedback"), handlers.SubmitFeedback)
+			feedback.GET("", handlers.GetUserFeedback)
+		}
+
+		// map pin routes
+		pins := api.Group("/pins", handlers.RequireScope("pins"))
+		{
+			pins.GET("", handlers.GetPins)
+			pins.POST("", handlers.CreatePin)
+			pins.PUT("/:id", handlers.UpdatePin)
+			pins.DELETE("/:id", handlers.DeletePin)
+		}
+
+		// signed in devices, only from a signed in session
+		devices := api.Group("/sessions", handlers.RequireSession)
+		{
+			devices.GET("", handlers.GetSessions)
+			devices.DELETE("", handlers.DeleteOtherSessions)
+			devices.DELETE("/:id", handlers.DeleteSession)
+		}
+
+		// the events as an .ics file, and the secret feed url calendar apps subscribe to
+		api.GET("/ddays.ics", handlers.RequireScope("ddays"), handlers.GetDDaysICS)
+		feed := api.Group("/feed", handlers.RequireSession)
+		{
+			feed.GET("", handlers.GetFeed)
+			feed.POST("", handlers.RotateFeed)
+			feed.DELETE("", handlers.DeleteFeed)
+		}
+
+		// personal api token routes, only from a signed in session
+		tokens := api.Group("/tokens", handlers.RequireSession)
+		{
+			tokens.GET("", handlers.GetTokens)
+			tokens.POST("", handlers.CreateToken)
+			tokens.DELETE("/:id", handlers.DeleteToken)
+		}
+	}
+
+	return router
+}
+
+// sessions are kept in the store so they can be listed and revoked
+// the cookie only holds a random session secret
+// production cookies are shared across the calple.date subdomains
+func newSessionStore(cfg *Config, st store.Store) sessions.Store {
+	sessionStore := sessionstore.New(st.Sessions())
+	sessionStore.Options(sessions.Options{
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   !cfg.Development(),
+		SameSite: func() http.SameSite {
+			if cfg.Development() {
+				return http.SameSiteLaxMode
+			}
+			return http.SameSiteNoneMode
+		}(),
+		Domain: cfg.CookieDomain,
+	})
+	return sessionStore
+}
@@ -0,0 +1,2192 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"calple/accounts"
+	"calple/export"
+	"calple/handlers"
+	"calple/recurrence"
+	"calple/store"
+	"calple/store/memstore"
+)
+
+// testServer is the real router on an in-memory store
+// with an extra route that signs in as any user
+type testServer struct {
+	t       *testing.T
+	router  *gin.Engine
+	st      *memstore.Store
+	exports *export.Jobs
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerWith(t, &Config{})
+}
+
+// newTestServerWith fills in the basics on cfg, for tests that need more config
+func newTestServerWith(t *testing.T, cfg *Config) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg.Env = "development"
+	cfg.FrontendURL = "http://localhost:3000"
+	cfg.Storage = "memory"
+
+	st := memstore.New()
+	exports := export.NewJobs(st, nil, t.TempDir())
+	router := NewRouter(cfg, Deps{Store: st, Exports: exports})
+
+	// fake session, the oauth flow is not part of these tests
+	router.GET("/test/login/:uid", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("user_id", c.Param("uid"))
+		session.Save()
+		c.Status(http.StatusNoContent)
+	})
+
+	return &testServer{t: t, router: router, st: st, exports: exports}
+}
+
+// client sends requests with the session cookie of one user
+// or with an api token
+// unsafe requests get the session's csrf token unless noCSRF is set
+type client struct {
+	srv    *testServer
+	cookie string
+	token  string
+	csrf   string
+	noCSRF bool
+}
+
+// anon has no session
+func (s *testServer) anon() *client {
+	return &client{srv: s}
+}
+
+func (s *testServer) as(uid string) *client {
+	s.t.Helper()
+	return s.asDevice(uid, "")
+}
+
+// asDevice signs in with a user agent, each call is a new session
+func (s *testServer) asDevice(uid, userAgent string) *client {
+	s.t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/test/login/"+uid, nil)
+	req.Header.Set("User-Agent", userAgent)
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		s.t.Fatalf("login as %s: status %d", uid, w.Code)
+	}
+	return &client{srv: s, cookie: w.Header().Get("Set-Cookie")}
+}
+
+func (s *testServer) bearer(token string) *client {
+	return &client{srv: s, token: token}
+}
+
+// body is sent as json, or as it is when it is raw bytes
+func (c *client) do(method, path string, body any) *httptest.ResponseRecorder {
+	c.srv.t.Helper()
+	unsafe := method != http.MethodGet && method != http.MethodHead
+	if unsafe && c.token == "" && c.csrf == "" && !c.noCSRF {
+		c.fetchCSRF()
+	}
+	var reader *bytes.Reader
+	contentType := "application/json"
+	if raw, ok := body.([]byte); ok {
+		reader = bytes.NewReader(raw)
+		contentType = "application/octet-stream"
+	} else if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			c.srv.t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", contentType)
+	if c.cookie != "" {
+		req.Header.Set("Cookie", c.cookie)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if unsafe && c.csrf != "" && !c.noCSRF {
+		req.Header.Set("X-CSRF-Token", c.csrf)
+	}
+	w := httptest.NewRecorder()
+	c.srv.router.ServeHTTP(w, req)
+	return w
+}
+
+// fetchCSRF gets the csrf token like the frontend does, starting a session if there is none
+func (c *client) fetchCSRF() {
+	c.srv.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/csrf", nil)
+	if c.cookie != "" {
+		req.Header.Set("Cookie", c.cookie)
+	}
+	w := httptest.NewRecorder()
+	c.srv.router.ServeHTTP(w, req)
+	var out struct{ CSRFToken string }
+	expect(c.srv.t, w, http.StatusOK, &out)
+	if cookie := w.Header().Get("Set-Cookie"); cookie != "" {
+		c.cookie = cookie
+	}
+	c.csrf = out.CSRFToken
+}
+
+// expect checks the status and decodes the body into out when given
+func expect(t *testing.T, w *httptest.ResponseRecorder, status int, out any) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d, body: %s", w.Code, status, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+	}
+}
+
+// fixtures: alice and bob are partners, carol is on her own
+const (
+	aliceID = "alice-uid"
+	bobID   = "bob-uid"
+	carolID = "carol-uid"
+
+	aliceEmail = "alice@example.com"
+	bobEmail   = "bob@example.com"
+	carolEmail = "carol@example.com"
+)
+
+func (s *testServer) seedUsers() {
+	s.t.Helper()
+	ctx := context.Background()
+	users := []store.User{
+		{ID: aliceID, Email: aliceEmail, Name: "Alice", Sex: "female"},
+		{ID: bobID, Email: bobEmail, Name: "Bob", Sex: "male"},
+		{ID: carolID, Email: carolEmail, Name: "Carol", Sex: "female"},
+	}
+	for i := range users {
+		if err := s.st.Users().Save(ctx, &users[i]); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+}
+
+// connect makes alice and bob partners through the api
+func (s *testServer) connect() {
+	s.t.Helper()
+	var invite struct {
+		ConnectionID string `json:"connectionId"`
+	}
+	expect(s.t, s.as(aliceID).do(http.MethodPost, "/api/connection/invite", gin.H{"email": bobEmail}), http.StatusOK, &invite)
+	expect(s.t, s.as(bobID).do(http.MethodPost, "/api/connection/"+invite.ConnectionID+"/accept", nil), http.StatusOK, nil)
+}
+
+func newSeededServer(t *testing.T, connected bool) *testServer {
+	s := newTestServer(t)
+	s.seedUsers()
+	if connected {
+		s.connect()
+	}
+	return s
+}
+
+func TestUnauthorized(t *testing.T) {
+	s := newTestServer(t)
+	anon := s.anon()
+
+	routes := []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/api/ddays?view=202507"},
+		{http.MethodPost, "/api/ddays"},
+		{http.MethodPut, "/api/ddays/x"},
+		{http.MethodDelete, "/api/ddays/x"},
+		{http.MethodGet, "/api/ddays/milestones/hidden"},
+		{http.MethodPut, "/api/ddays/milestones/100d/hidden"},
+		{http.MethodDelete, "/api/ddays/milestones/100d/hidden"},
+		{http.MethodGet, "/api/connection"},
+		{http.MethodPost, "/api/connection/invite"},
+		{http.MethodGet, "/api/connection/pending"},
+		{http.MethodPost, "/api/connection/x/accept"},
+		{http.MethodPost, "/api/connection/x/reject"},
+		{http.MethodGet, "/api/ideas"},
+		{http.MethodPost, "/api/ideas"},
+		{http.MethodPut, "/api/ideas/x"},
+		{http.MethodDelete, "/api/ideas/x"},
+		{http.MethodGet, "/api/roulette"},
+		{http.MethodPost, "/api/roulette"},
+		{http.MethodPut, "/api/roulette/x"},
+		{http.MethodDelete, "/api/roulette/x"},
+		{http.MethodGet, "/api/periods/days"},
+		{http.MethodGet, "/api/periods/partner/days"},
+		{http.MethodPost, "/api/periods/days"},
+		{http.MethodDelete, "/api/periods/days/2025-07-01"},
+		{http.MethodGet, "/api/periods/settings"},
+		{http.MethodPut, "/api/periods/settings"},
+		{http.MethodGet, "/api/user/metadata"},
+		{http.MethodPut, "/api/user/metadata"},
+		{http.MethodGet, "/api/user/partner/metadata"},
+		{http.MethodDelete, "/api/user"},
+		{http.MethodPost, "/api/checkin"},
+		{http.MethodGet, "/api/checkin/2025-07-01"},
+		{http.MethodDelete, "/api/checkin/2025-07-01"},
+		{http.MethodGet, "/api/checkin/partner/2025-07-01"},
+		{http.MethodGet, "/api/debug/connection"},
+		{http.MethodPost, "/api/feedback"},
+		{http.MethodGet, "/api/feedback"},
+		{http.MethodGet, "/api/pins"},
+		{http.MethodPost, "/api/pins"},
+		{http.MethodPut, "/api/pins/x"},
+		{http.MethodDelete, "/api/pins/x"},
+		{http.MethodGet, "/api/ddays.ics"},
+		{http.MethodPost, "/api/ddays/import"},
+		{http.MethodGet, "/api/feed"},
+		{http.MethodPost, "/api/feed"},
+		{http.MethodDelete, "/api/feed"},
+		{"PROPFIND", "/caldav/"},
+		{"PROPFIND", "/caldav/ddays/"},
+		{"REPORT", "/caldav/ddays/"},
+		{http.MethodGet, "/caldav/ddays/x.ics"},
+		{http.MethodPut, "/caldav/ddays/x.ics"},
+		{http.MethodDelete, "/caldav/ddays/x.ics"},
+	}
+	// a session whose user no longer exists is treated like no session
+	ghost := s.as("ghost")
+
+	for _, r := range routes {
+		t.Run(r.method+" "+r.path, func(t *testing.T) {
+			var res struct {
+				Error string `json:"error"`
+			}
+			expect(t, anon.do(r.method, r.path, gin.H{}), http.StatusUnauthorized, &res)
+			if res.Error != "Unauthorized" {
+				t.Errorf("error = %q", res.Error)
+			}
+			expect(t, ghost.do(r.method, r.path, gin.H{}), http.StatusUnauthorized, nil)
+		})
+	}
+}
+
+func TestPublicRoutes(t *testing.T) {
+	s := newTestServer(t)
+	anon := s.anon()
+
+	expect(t, anon.do(http.MethodGet, "/health", nil), http.StatusOK, nil)
+	expect(t, anon.do(http.MethodGet, "/api/health/firebase", nil), http.StatusOK, nil)
+
+	var status struct {
+		Authenticated bool `json:"authenticated"`
+	}
+	expect(t, anon.do(http.MethodGet, "/api/auth/status", nil), http.StatusOK, &status)
+	if status.Authenticated {
+		t.Error("anonymous request reported as authenticated")
+	}
+
+	var ideas []store.Idea
+	expect(t, anon.do(http.MethodGet, "/api/ideas/all", nil), http.StatusOK, &ideas)
+}
+
+type ddaysResponse struct {
+	DDays []store.DDay `json:"ddays"`
+}
+
+func (c *client) createDDay(t *testing.T, body gin.H) store.DDay {
+	t.Helper()
+	var res struct {
+		DDay store.DDay `json:"dday"`
+	}
+	expect(t, c.do(http.MethodPost, "/api/ddays", body), http.StatusCreated, &res)
+	return res.DDay
+}
+
+func (c *client) listDDays(t *testing.T, view string) []store.DDay {
+	t.Helper()
+	var res ddaysResponse
+	expect(t, c.do(http.MethodGet, "/api/ddays?view="+view, nil), http.StatusOK, &res)
+	return res.DDays
+}
+
+func titles(ddays []store.DDay) map[string]bool {
+	out := map[string]bool{}
+	for _, d := range ddays {
+		out[d.Title] = true
+	}
+	return out
+}
+
+func TestDDays(t *testing.T) {
+	s := newSeededServer(t, true)
+	alice, bob, carol := s.as(aliceID), s.as(bobID), s.as(carolID)
+
+	t.Run("validation", func(t *testing.T) {
+		expect(t, alice.do(http.MethodGet, "/api/ddays", nil), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodGet, "/api/ddays?view=202513", nil), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/ddays", gin.H{"title": ""}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/ddays", gin.H{"title": "x", "date": "2025-07-01"}), http.StatusBadRequest, nil)
+	})
+
+	trip := alice.createDDay(t, gin.H{"title": "Trip", "date": "20250710", "endDate": "20250805"})
+	if !trip.Editable || trip.CreatedBy != aliceEmail {
+		t.Fatalf("created event = %+v", trip)
+	}
+
+	t.Run("shared with partner on create", func(t *testing.T) {
+		if len(trip.ConnectedUsers) != 1 || trip.ConnectedUsers[0] != bobEmail {
+			t.Fatalf("connectedUsers = %v, want [%s]", trip.ConnectedUsers, bobEmail)
+		}
+		if !titles(bob.listDDays(t, "202507"))["Trip"] {
+			t.Error("partner does not see the event")
+		}
+		if titles(carol.listDDays(t, "202507"))["Trip"] {
+			t.Error("unrelated user sees the event")
+		}
+	})
+
+	t.Run("month window", func(t *testing.T) {
+		// spans into august, not in june or september
+		if !titles(alice.listDDays(t, "202508"))["Trip"] {
+			t.Error("multi-day event missing from its last month")
+		}
+		if titles(alice.listDDays(t, "202506"))["Trip"] || titles(alice.listDDays(t, "202509"))["Trip"] {
+			t.Error("event visible outside its dates")
+		}
+
+		alice.createDDay(t, gin.H{"title": "Birthday", "date": "20200315", "isAnnual": true})
+		if !titles(alice.listDDays(t, "202603"))["Birthday"] {
+			t.Error("annual event missing in a later year")
+		}
+		if titles(alice.listDDays(t, "202604"))["Birthday"] {
+			t.Error("annual event shown in the wrong month")
+		}
+	})
+
+	t.Run("recurrence", func(t *testing.T) {
+		expect(t, alice.do(http.MethodPost, "/api/ddays", gin.H{"title": "x", "date": "20250101", "rrule": "FREQ=HOURLY"}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/ddays", gin.H{"title": "x", "rrule": "FREQ=DAILY"}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/ddays", gin.H{"title": "x", "date": "20250101", "rrule": "FREQ=DAILY", "exdates": []string{"2025-01-02"}}), http.StatusBadRequest, nil)
+
+		night := alice.createDDay(t, gin.H{"title": "Date night", "date": "20250704", "rrule": "RRULE:freq=weekly;byday=fr",
+			"exdates": []string{"20250718"}})
+		if night.RRule != "FREQ=WEEKLY;BYDAY=FR" || night.IsAnnual {
+			t.Fatalf("created recurring event = %+v", night)
+		}
+		occurrences := func(c *client, view, title string) []string {
+			for _, d := range c.listDDays(t, view) {
+				if d.Title == title {
+					return d.Occurrences
+				}
+			}
+			return nil
+		}
+		// shared with the partner like any other event
+		if got := occurrences(bob, "202507", "Date night"); !slices.Equal(got, []string{"20250704", "20250711", "20250725"}) {
+			t.Errorf("july occurrences = %v", got)
+		}
+		if got := occurrences(alice, "202506", "Date night"); got != nil {
+			t.Errorf("occurrences before the first one = %v", got)
+		}
+
+		// a two day event that repeats monthly shows in the month its occurrence runs into
+		alice.createDDay(t, gin.H{"title": "Monthsary", "date": "20250131", "endDate": "20250201", "rrule": "FREQ=MONTHLY;BYMONTHDAY=-1"})
+		if got := occurrences(alice, "202503", "Monthsary"); !slices.Equal(got, []string{"20250228", "20250331"}) {
+			t.Errorf("monthsary occurrences = %v", got)
+		}
+
+		// older clients toggle isAnnual, which maps to the yearly rule
+		// the first occurrence counts even when the rule would not pick it
+		expect(t, alice.do(http.MethodPut, "/api/ddays/"+night.ID, gin.H{"rrule": "FREQ=MONTHLY;BYDAY=2SA;COUNT=3"}), http.StatusOK, nil)
+		if got := occurrences(alice, "202508", "Date night"); !slices.Equal(got, []string{"20250809"}) {
+			t.Errorf("after the rule changed = %v", got)
+		}
+		if got := occurrences(alice, "202509", "Date night"); got != nil {
+			t.Errorf("occurrences after COUNT = %v", got)
+		}
+		// the rule is left out of the response when it is empty, so every update decodes into a fresh value
+		update := func(body gin.H) store.DDay {
+			var res struct {
+				DDay store.DDay `json:"dday"`
+			}
+			expect(t, alice.do(http.MethodPut, "/api/ddays/"+night.ID, body), http.StatusOK, &res)
+			return res.DDay
+		}
+		if res := update(gin.H{"isAnnual": true, "rrule": ""}); res.RRule != "" || res.IsAnnual {
+			t.Errorf("rrule wins over isAnnual: %+v", res)
+		}
+		if res := update(gin.H{"isAnnual": true}); res.RRule != recurrence.Annual || !res.IsAnnual {
+			t.Errorf("isAnnual did not set the yearly rule: %+v", res)
+		}
+		if res := update(gin.H{"isAnnual": false}); res.RRule != "" || res.IsAnnual {
+			t.Errorf("isAnnual did not clear the yearly rule: %+v", res)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		expect(t, alice.do(http.MethodPut, "/api/ddays/missing", gin.H{"title": "x"}), http.StatusNotFound, nil)
+		expect(t, bob.do(http.MethodPut, "/api/ddays/"+trip.ID, gin.H{"title": "Mine now"}), http.StatusForbidden, nil)
+		expect(t, alice.do(http.MethodPut, "/api/ddays/"+trip.ID, gin.H{"title": ""}), http.StatusBadRequest, nil)
+
+		var res struct {
+			DDay store.DDay `json:"dday"`
+		}
+		expect(t, alice.do(http.MethodPut, "/api/ddays/"+trip.ID, gin.H{"title": "Road trip"}), http.StatusOK, &res)
+		// fields that were not sent are kept
+		if res.DDay.Title != "Road trip" || res.DDay.Date != "20250710" || len(res.DDay.ConnectedUsers) != 1 {
+			t.Errorf("updated event = %+v", res.DDay)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		expect(t, alice.do(http.MethodDelete, "/api/ddays/missing", nil), http.StatusNotFound, nil)
+		expect(t, bob.do(http.MethodDelete, "/api/ddays/"+trip.ID, nil), http.StatusForbidden, nil)
+		expect(t, alice.do(http.MethodDelete, "/api/ddays/"+trip.ID, nil), http.StatusOK, nil)
+		if titles(bob.listDDays(t, "202507"))["Road trip"] {
+			t.Error("deleted event still visible to partner")
+		}
+	})
+
+	t.Run("upload url", func(t *testing.T) {
+		expect(t, alice.do(http.MethodPost, "/api/ddays/upload-url", gin.H{"fileSize": 6 * 1024 * 1024}), http.StatusRequestEntityTooLarge, nil)
+	})
+}
+
+func TestConnection(t *testing.T) {
+	s := newSeededServer(t, false)
+	alice, bob, carol := s.as(aliceID), s.as(bobID), s.as(carolID)
+
+	// events created before connecting are shared on accept
+	aliceEvent := alice.createDDay(t, gin.H{"title": "Alice's", "date": "20250701"})
+	bob.createDDay(t, gin.H{"title": "Bob's", "date": "20250702"})
+	if len(aliceEvent.ConnectedUsers) != 0 {
+		t.Fatalf("event shared before connecting: %v", aliceEvent.ConnectedUsers)
+	}
+
+	var conn struct {
+		Connected bool `json:"connected"`
+	}
+	expect(t, alice.do(http.MethodGet, "/api/connection", nil), http.StatusOK, &conn)
+	if conn.Connected {
+		t.Fatal("connected before any invitation")
+	}
+
+	t.Run("invite validation", func(t *testing.T) {
+		expect(t, alice.do(http.MethodPost, "/api/connection/invite", gin.H{}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/connection/invite", gin.H{"email": "nope"}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/connection/invite", gin.H{"email": aliceEmail}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/connection/invite", gin.H{"email": "ghost@example.com"}), http.StatusNotFound, nil)
+	})
+
+	var invite struct {
+		ConnectionID string `json:"connectionId"`
+	}
+	expect(t, alice.do(http.MethodPost, "/api/connection/invite", gin.H{"email": " BOB@example.com "}), http.StatusOK, &invite)
+	expect(t, alice.do(http.MethodPost, "/api/connection/invite", gin.H{"email": bobEmail}), http.StatusBadRequest, nil)
+
+	var pending struct {
+		Invitations []struct {
+			ID        string `json:"id"`
+			FromEmail string `json:"from_email"`
+			FromName  string `json:"from_name"`
+			Role      string `json:"role"`
+		} `json:"invitations"`
+	}
+	expect(t, bob.do(http.MethodGet, "/api/connection/pending", nil), http.StatusOK, &pending)
+	if len(pending.Invitations) != 1 || pending.Invitations[0].FromName != "Alice" || pending.Invitations[0].Role != store.RoleReceiver {
+		t.Fatalf("pending = %+v", pending.Invitations)
+	}
+
+	t.Run("accept", func(t *testing.T) {
+		expect(t, carol.do(http.MethodPost, "/api/connection/"+invite.ConnectionID+"/accept", nil), http.StatusNotFound, nil)
+		// only the receiver can accept
+		expect(t, alice.do(http.MethodPost, "/api/connection/"+invite.ConnectionID+"/accept", nil), http.StatusForbidden, nil)
+		expect(t, bob.do(http.MethodPost, "/api/connection/"+invite.ConnectionID+"/accept", nil), http.StatusOK, nil)
+
+		var res struct {
+			Connected bool       `json:"connected"`
+			Partner   store.User `json:"partner"`
+		}
+		expect(t, alice.do(http.MethodGet, "/api/connection", nil), http.StatusOK, &res)
+		if !res.Connected || res.Partner.Email != bobEmail {
+			t.Fatalf("connection = %+v", res)
+		}
+
+		got := titles(bob.listDDays(t, "202507"))
+		if !got["Alice's"] || !got["Bob's"] {
+			t.Errorf("bob sees %v after accepting, want both events", got)
+		}
+		if !titles(alice.listDDays(t, "202507"))["Bob's"] {
+			t.Error("alice does not see bob's event after accepting")
+		}
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		var res struct {
+			HasConnection bool `json:"hasConnection"`
+		}
+		expect(t, alice.do(http.MethodGet, "/api/debug/connection", nil), http.StatusOK, &res)
+		if !res.HasConnection {
+			t.Error("debug route does not report the connection")
+		}
+	})
+
+	t.Run("reject removes sharing", func(t *testing.T) {
+		expect(t, alice.do(http.MethodPost, "/api/connection/missing/reject", nil), http.StatusNotFound, nil)
+		expect(t, alice.do(http.MethodPost, "/api/connection/"+invite.ConnectionID+"/reject", nil), http.StatusOK, nil)
+
+		expect(t, bob.do(http.MethodGet, "/api/connection", nil), http.StatusOK, &conn)
+		if conn.Connected {
+			t.Error("partner still connected after removal")
+		}
+		if got := titles(bob.listDDays(t, "202507")); got["Alice's"] {
+			t.Error("partner still sees events after removal")
+		}
+		if got := titles(alice.listDDays(t, "202507")); got["Bob's"] {
+			t.Error("user still sees partner events after removal")
+		}
+	})
+}
+
+// connections from before partner IDs only have the partner's email, as it was typed
+func TestConnectionWithoutPartnerUID(t *testing.T) {
+	s := newSeededServer(t, false)
+	ctx := context.Background()
+	id, err := s.st.Connections().Invite(ctx, "", "BOB@example.com", aliceID, aliceEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := s.as(aliceID)
+
+	var pending struct {
+		Invitations []struct {
+			FromEmail string `json:"from_email"`
+			FromName  string `json:"from_name"`
+		} `json:"invitations"`
+	}
+	expect(t, alice.do(http.MethodGet, "/api/connection/pending", nil), http.StatusOK, &pending)
+	if len(pending.Invitations) != 1 || pending.Invitations[0].FromEmail != bobEmail || pending.Invitations[0].FromName != "Bob" {
+		t.Fatalf("pending = %+v", pending.Invitations)
+	}
+
+	if err := s.st.Connections().Accept(ctx, aliceID, "", id); err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		Connected bool       `json:"connected"`
+		Partner   store.User `json:"partner"`
+	}
+	expect(t, alice.do(http.MethodGet, "/api/connection", nil), http.StatusOK, &res)
+	if !res.Connected || res.Partner.ID != bobID || res.Partner.Email != bobEmail {
+		t.Fatalf("connection = %+v", res)
+	}
+
+	// a partner without an account has no metadata
+	id, err = s.st.Connections().Invite(ctx, "", "ghost@example.com", carolID, carolEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.st.Connections().Accept(ctx, carolID, "", id); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, s.as(carolID).do(http.MethodGet, "/api/user/partner/metadata", nil), http.StatusNotFound, nil)
+}
+
+func TestIdeas(t *testing.T) {
+	s := newSeededServer(t, false)
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	expect(t, alice.do(http.MethodPost, "/api/ideas", gin.H{"description": "no title"}), http.StatusBadRequest, nil)
+
+	var post store.Idea
+	expect(t, alice.do(http.MethodPost, "/api/ideas", gin.H{"title": "Picnic", "description": "in the park"}), http.StatusCreated, &post)
+	if post.ID == "" || post.Author != "Alice" {
+		t.Fatalf("created post = %+v", post)
+	}
+
+	var mine []store.Idea
+	expect(t, alice.do(http.MethodGet, "/api/ideas", nil), http.StatusOK, &mine)
+	if len(mine) != 1 {
+		t.Fatalf("alice's posts = %v", mine)
+	}
+	expect(t, bob.do(http.MethodGet, "/api/ideas", nil), http.StatusOK, &mine)
+	if len(mine) != 0 {
+		t.Fatalf("bob's posts = %v", mine)
+	}
+
+	expect(t, alice.do(http.MethodPut, "/api/ideas/"+post.ID, gin.H{"title": "Picnic!", "description": "at noon"}), http.StatusOK, nil)
+
+	var all []store.Idea
+	expect(t, s.anon().do(http.MethodGet, "/api/ideas/all", nil), http.StatusOK, &all)
+	if len(all) != 1 || all[0].Title != "Picnic!" {
+		t.Fatalf("all posts = %+v", all)
+	}
+
+	expect(t, alice.do(http.MethodDelete, "/api/ideas/"+post.ID, nil), http.StatusOK, nil)
+	expect(t, s.anon().do(http.MethodGet, "/api/ideas/all", nil), http.StatusOK, &all)
+	if len(all) != 0 {
+		t.Fatalf("posts after delete = %+v", all)
+	}
+}
+
+func TestRoulette(t *testing.T) {
+	s := newSeededServer(t, false)
+	c := s.as(aliceID)
+
+	expect(t, c.do(http.MethodPost, "/api/roulette", "not an object"), http.StatusBadRequest, nil)
+
+	var item store.Roulette
+	expect(t, c.do(http.MethodPost, "/api/roulette", gin.H{"title": "Bowling"}), http.StatusCreated, &item)
+	expect(t, c.do(http.MethodPut, "/api/roulette/"+item.ID, gin.H{"title": "Karaoke"}), http.StatusOK, nil)
+
+	var items []store.Roulette
+	expect(t, c.do(http.MethodGet, "/api/roulette", nil), http.StatusOK, &items)
+	if len(items) != 1 || items[0].Title != "Karaoke" {
+		t.Fatalf("roulette = %+v", items)
+	}
+
+	expect(t, c.do(http.MethodDelete, "/api/roulette/"+item.ID, nil), http.StatusOK, nil)
+	expect(t, c.do(http.MethodGet, "/api/roulette", nil), http.StatusOK, &items)
+	if len(items) != 0 {
+		t.Fatalf("roulette after delete = %+v", items)
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	s := newSeededServer(t, false)
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	expect(t, bob.do(http.MethodGet, "/api/periods/partner/days", nil), http.StatusNotFound, nil)
+	expect(t, alice.do(http.MethodPost, "/api/periods/days", gin.H{"date": "20250701"}), http.StatusBadRequest, nil)
+
+	var day store.PeriodDay
+	expect(t, alice.do(http.MethodPost, "/api/periods/days", gin.H{"date": "2025-07-01", "isPeriod": true}), http.StatusCreated, &day)
+	// same date again updates the existing day
+	var updated store.PeriodDay
+	expect(t, alice.do(http.MethodPost, "/api/periods/days", gin.H{"date": "2025-07-01", "isPeriod": true, "notes": "cramps"}), http.StatusOK, &updated)
+	if updated.ID != day.ID {
+		t.Fatalf("second save created %s, want update of %s", updated.ID, day.ID)
+	}
+
+	var days struct {
+		PeriodDays []store.PeriodDay `json:"periodDays"`
+	}
+	expect(t, alice.do(http.MethodGet, "/api/periods/days", nil), http.StatusOK, &days)
+	if len(days.PeriodDays) != 1 || days.PeriodDays[0].Notes != "cramps" {
+		t.Fatalf("period days = %+v", days.PeriodDays)
+	}
+
+	t.Run("partner", func(t *testing.T) {
+		s.connect()
+		expect(t, bob.do(http.MethodGet, "/api/periods/partner/days", nil), http.StatusOK, &days)
+		if len(days.PeriodDays) != 1 {
+			t.Fatalf("partner period days = %+v", days.PeriodDays)
+		}
+		expect(t, bob.do(http.MethodGet, "/api/periods/days", nil), http.StatusOK, &days)
+		if len(days.PeriodDays) != 0 {
+			t.Fatalf("bob's own period days = %+v", days.PeriodDays)
+		}
+	})
+
+	t.Run("settings", func(t *testing.T) {
+		var res struct {
+			CycleSettings store.CycleSettings `json:"cycleSettings"`
+		}
+		expect(t, alice.do(http.MethodGet, "/api/periods/settings", nil), http.StatusOK, &res)
+		if res.CycleSettings.CycleLength != 28 || res.CycleSettings.PeriodLength != 5 {
+			t.Fatalf("default settings = %+v", res.CycleSettings)
+		}
+		expect(t, alice.do(http.MethodPut, "/api/periods/settings", gin.H{"cycleLength": 50, "periodLength": 5}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPut, "/api/periods/settings", gin.H{"cycleLength": 30, "periodLength": 0}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPut, "/api/periods/settings", gin.H{"cycleLength": 30, "periodLength": 4}), http.StatusOK, nil)
+		expect(t, alice.do(http.MethodGet, "/api/periods/settings", nil), http.StatusOK, &res)
+		if res.CycleSettings.CycleLength != 30 || res.CycleSettings.PeriodLength != 4 {
+			t.Fatalf("saved settings = %+v", res.CycleSettings)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		expect(t, alice.do(http.MethodDelete, "/api/periods/days/2025-07-02", nil), http.StatusNotFound, nil)
+		expect(t, alice.do(http.MethodDelete, "/api/periods/days/2025-07-01", nil), http.StatusOK, nil)
+		expect(t, alice.do(http.MethodGet, "/api/periods/days", nil), http.StatusOK, &days)
+		if len(days.PeriodDays) != 0 {
+			t.Fatalf("period days after delete = %+v", days.PeriodDays)
+		}
+	})
+}
+
+func TestUser(t *testing.T) {
+	s := newSeededServer(t, false)
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	var meta struct {
+		UserMetadata store.User `json:"userMetadata"`
+	}
+	expect(t, alice.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+	if meta.UserMetadata.Email != aliceEmail {
+		t.Fatalf("metadata = %+v", meta.UserMetadata)
+	}
+	expect(t, alice.do(http.MethodGet, "/api/user/partner/metadata", nil), http.StatusNotFound, nil)
+
+	expect(t, alice.do(http.MethodPut, "/api/user/metadata", gin.H{"sex": "other"}), http.StatusBadRequest, nil)
+	expect(t, alice.do(http.MethodPut, "/api/user/metadata", gin.H{"startedDating": "2024-02-14"}), http.StatusBadRequest, nil)
+
+	s.connect()
+
+	t.Run("started dating is shared", func(t *testing.T) {
+		expect(t, alice.do(http.MethodPut, "/api/user/metadata", gin.H{"startedDating": "02/14/2024"}), http.StatusOK, &meta)
+		if meta.UserMetadata.StartedDating != "02/14/2024" {
+			t.Fatalf("metadata = %+v", meta.UserMetadata)
+		}
+
+		var partner struct {
+			PartnerMetadata store.User `json:"partnerMetadata"`
+		}
+		expect(t, alice.do(http.MethodGet, "/api/user/partner/metadata", nil), http.StatusOK, &partner)
+		if partner.PartnerMetadata.Email != bobEmail {
+			t.Fatalf("partner metadata = %+v", partner.PartnerMetadata)
+		}
+		expect(t, bob.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+		if meta.UserMetadata.StartedDating != "02/14/2024" {
+			t.Errorf("partner startedDating = %q", meta.UserMetadata.StartedDating)
+		}
+
+		// the anniversaries are generated milestones that cannot be edited
+		anniversary := func(view string) *store.DDay {
+			for _, d := range alice.listDDays(t, view) {
+				if d.Milestone == "1y" {
+					return &d
+				}
+			}
+			return nil
+		}
+		if got := anniversary("202502"); got == nil || !got.System || got.Date != "20250214" || got.Editable {
+			t.Fatalf("anniversary = %+v", got)
+		}
+
+		// moving the date moves the anniversary instead of adding another one
+		expect(t, alice.do(http.MethodPut, "/api/user/metadata", gin.H{"startedDating": "03/01/2024"}), http.StatusOK, nil)
+		if anniversary("202502") != nil || anniversary("202503") == nil {
+			t.Error("anniversary was not moved")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		var deleted struct {
+			PurgeAt time.Time `json:"purgeAt"`
+		}
+		expect(t, alice.do(http.MethodDelete, "/api/user", nil), http.StatusOK, &deleted)
+		user, err := s.st.Users().Get(context.Background(), aliceID)
+		if err != nil || user.DeletedAt.IsZero() || !deleted.PurgeAt.Equal(user.DeletedAt.Add(accounts.GracePeriod)) {
+			t.Fatalf("user after delete: %+v, %v, purge at %v", user, err, deleted.PurgeAt)
+		}
+
+		// signed out, and signing in again only allows a restore
+		expect(t, alice.do(http.MethodGet, "/api/user/metadata", nil), http.StatusUnauthorized, nil)
+		alice = s.as(aliceID)
+		expect(t, alice.do(http.MethodGet, "/api/user/metadata", nil), http.StatusForbidden, nil)
+
+		// the partner no longer sees the connection during the grace period
+		var conn struct {
+			Connected bool `json:"connected"`
+		}
+		expect(t, bob.do(http.MethodGet, "/api/connection", nil), http.StatusOK, &conn)
+		if conn.Connected {
+			t.Error("partner still connected to deleted user")
+		}
+
+		expect(t, alice.do(http.MethodPost, "/api/user/restore", nil), http.StatusOK, nil)
+		expect(t, alice.do(http.MethodPost, "/api/user/restore", nil), http.StatusConflict, nil)
+		expect(t, bob.do(http.MethodGet, "/api/connection", nil), http.StatusOK, &conn)
+		if !conn.Connected {
+			t.Error("restore did not bring the connection back")
+		}
+
+		// after the grace period the account is purged with the partner's side of the connection
+		expect(t, alice.do(http.MethodDelete, "/api/user", nil), http.StatusOK, nil)
+		purger := NewPurger(&Config{}, s.st)
+		if n, err := purger.PurgeDue(context.Background(), time.Now().Add(accounts.GracePeriod+time.Minute)); n != 1 || err != nil {
+			t.Fatalf("purged %d accounts: %v", n, err)
+		}
+		if _, err := s.st.Users().Get(context.Background(), aliceID); err != store.ErrNotFound {
+			t.Fatalf("user after purge: %v", err)
+		}
+		if conns, _ := s.st.Connections().List(context.Background(), bobID); len(conns) != 0 {
+			t.Errorf("partner connections after purge: %+v", conns)
+		}
+	})
+}
+
+func TestMilestones(t *testing.T) {
+	s := newSeededServer(t, true)
+	alice, bob := s.as(aliceID), s.as(bobID)
+	ctx := context.Background()
+
+	milestones := func(c *client, view string) map[string]string {
+		t.Helper()
+		out := map[string]string{}
+		for _, d := range c.listDDays(t, view) {
+			if d.System {
+				out[d.Milestone] = d.Date
+			}
+		}
+		return out
+	}
+
+	if got := milestones(alice, "202504"); len(got) != 0 {
+		t.Fatalf("milestones before startedDating: %v", got)
+	}
+	expect(t, alice.do(http.MethodPut, "/api/user/metadata", gin.H{"startedDating": "01/01/2025"}), http.StatusOK, nil)
+
+	// both partners get them, counting the first day as day 1
+	for _, c := range []*client{alice, bob} {
+		if got := milestones(c, "202504"); len(got) != 1 || got["100d"] != "20250410" {
+			t.Errorf("april milestones = %v", got)
+		}
+	}
+	if got := milestones(alice, "202601"); got["1y"] != "20260101" {
+		t.Errorf("january milestones = %v", got)
+	}
+	// the generated events are not stored
+	if ddays, _ := s.st.DDays().ListByCreator(ctx, aliceID); len(ddays) != 0 {
+		t.Errorf("stored events: %+v", ddays)
+	}
+
+	t.Run("hide", func(t *testing.T) {
+		expect(t, alice.do(http.MethodPut, "/api/ddays/milestones/150d/hidden", nil), http.StatusNotFound, nil)
+		expect(t, alice.do(http.MethodPut, "/api/ddays/milestones/100d/hidden", nil), http.StatusOK, nil)
+		if got := milestones(alice, "202504"); len(got) != 0 {
+			t.Errorf("hidden milestone still listed: %v", got)
+		}
+		if got := milestones(bob, "202504"); got["100d"] == "" {
+			t.Error("hiding removed the partner's milestone")
+		}
+
+		var hidden struct {
+			Hidden []string `json:"hidden"`
+		}
+		expect(t, alice.do(http.MethodGet, "/api/ddays/milestones/hidden", nil), http.StatusOK, &hidden)
+		if !slices.Equal(hidden.Hidden, []string{"100d"}) {
+			t.Errorf("hidden = %v", hidden.Hidden)
+		}
+
+		expect(t, alice.do(http.MethodDelete, "/api/ddays/milestones/100d/hidden", nil), http.StatusOK, nil)
+		if got := milestones(alice, "202504"); got["100d"] == "" {
+			t.Error("shown milestone not listed")
+		}
+	})
+
+	t.Run("stored anniversary", func(t *testing.T) {
+		// bob still has the event older versions created, it stands in for the generated anniversaries
+		now := time.Now()
+		legacy := store.DDay{Title: "Anniversary", Group: "important", Date: "20250101", IsAnnual: true, RRule: recurrence.Annual,
+			CreatorID: bobID, CreatedBy: bobEmail, CreatedAt: now, UpdatedAt: now}
+		if err := s.st.DDays().Create(ctx, &legacy); err != nil {
+			t.Fatal(err)
+		}
+		events := bob.listDDays(t, "202601")
+		if !titles(events)["Anniversary"] || titles(events)["1st anniversary"] {
+			t.Errorf("bob's january: %v", titles(events))
+		}
+
+		// a new date from either partner moves every milestone and the stored event
+		expect(t, alice.do(http.MethodPut, "/api/user/metadata", gin.H{"startedDating": "02/01/2025"}), http.StatusOK, nil)
+		if got := milestones(bob, "202505"); got["100d"] != "20250511" {
+			t.Errorf("bob's may milestones = %v", got)
+		}
+		if d, _ := s.st.DDays().Get(ctx, legacy.ID); d.Date != "20250201" {
+			t.Errorf("stored anniversary on %s", d.Date)
+		}
+	})
+}
+
+func TestCalendar(t *testing.T) {
+	s := newSeededServer(t, true)
+	alice, bob, carol := s.as(aliceID), s.as(bobID), s.as(carolID)
+
+	alice.createDDay(t, gin.H{"title": "Trip; Busan", "date": "20250710", "endDate": "20250712", "group": "travel",
+		"description": "ferry, then train", "imageUrl": "https://images.calple.test/trip.jpg", "connectedUsers": []string{bobEmail}})
+	alice.createDDay(t, gin.H{"title": "Anniversary", "date": "20200301", "isAnnual": true, "exdates": []string{"20240301"}})
+	alice.createDDay(t, gin.H{"title": "Someday", "group": "ideas"})
+	carol.createDDay(t, gin.H{"title": "Carol's party", "date": "20250801"})
+
+	unfold := func(w *httptest.ResponseRecorder) string {
+		t.Helper()
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+			t.Fatalf("content type %q", ct)
+		}
+		return strings.ReplaceAll(w.Body.String(), "\r\n ", "")
+	}
+
+	w := alice.do(http.MethodGet, "/api/ddays.ics", nil)
+	expect(t, w, http.StatusOK, nil)
+	body := unfold(w)
+	for _, line := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"SUMMARY:Trip\\; Busan\r\n",
+		"DTSTART;VALUE=DATE:20250710\r\nDTEND;VALUE=DATE:20250713\r\n",
+		"DESCRIPTION:ferry\\, then train\r\n",
+		"CATEGORIES:travel\r\n",
+		"ATTACH:https://images.calple.test/trip.jpg\r\n",
+		"RRULE:FREQ=YEARLY\r\nEXDATE;VALUE=DATE:20240301\r\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("calendar is missing %q:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "Someday") || strings.Contains(body, "Carol") {
+		t.Errorf("undated or other people's events in the calendar:\n%s", body)
+	}
+
+	t.Run("feed", func(t *testing.T) {
+		var none struct {
+			Feed *store.Feed `json:"feed"`
+		}
+		expect(t, bob.do(http.MethodGet, "/api/feed", nil), http.StatusOK, &none)
+		if none.Feed != nil {
+			t.Fatalf("feed before creating one: %+v", none.Feed)
+		}
+
+		var created struct {
+			URL  string     `json:"url"`
+			Feed store.Feed `json:"feed"`
+		}
+		expect(t, bob.do(http.MethodPost, "/api/feed", nil), http.StatusOK, &created)
+		path := created.URL[strings.Index(created.URL, "/feeds/"):]
+		if !strings.HasPrefix(path, "/feeds/cplf_") || !strings.HasPrefix(path[len("/feeds/"):], created.Feed.Prefix) {
+			t.Fatalf("feed url %q, prefix %q", created.URL, created.Feed.Prefix)
+		}
+
+		// calendar apps have no session, the events alice shared are in bob's feed
+		w := s.anon().do(http.MethodGet, path, nil)
+		expect(t, w, http.StatusOK, nil)
+		if body := unfold(w); !strings.Contains(body, "SUMMARY:Trip") || !strings.Contains(body, "SUMMARY:Anniversary") || strings.Contains(body, "Carol") {
+			t.Errorf("bob's feed:\n%s", body)
+		}
+		expect(t, s.anon().do(http.MethodGet, "/feeds/cplf_guess.ics", nil), http.StatusNotFound, nil)
+		expect(t, s.anon().do(http.MethodGet, strings.TrimSuffix(path, ".ics"), nil), http.StatusNotFound, nil)
+
+		// rotating retires the old url
+		var rotated struct {
+			URL string `json:"url"`
+		}
+		expect(t, bob.do(http.MethodPost, "/api/feed", nil), http.StatusOK, &rotated)
+		if rotated.URL == created.URL {
+			t.Fatal("rotation kept the url")
+		}
+		expect(t, s.anon().do(http.MethodGet, path, nil), http.StatusNotFound, nil)
+		newPath := rotated.URL[strings.Index(rotated.URL, "/feeds/"):]
+		expect(t, s.anon().do(http.MethodGet, newPath, nil), http.StatusOK, nil)
+
+		// a leaked api token cannot mint feeds
+		var token struct{ Token string }
+		expect(t, bob.do(http.MethodPost, "/api/tokens", gin.H{"name": "cli", "scopes": []string{"ddays:write"}}), http.StatusCreated, &token)
+		expect(t, s.bearer(token.Token).do(http.MethodPost, "/api/feed", nil), http.StatusForbidden, nil)
+		expect(t, s.bearer(token.Token).do(http.MethodGet, "/api/ddays.ics", nil), http.StatusOK, nil)
+
+		// deleted accounts and deleted feeds serve nothing
+		expect(t, bob.do(http.MethodDelete, "/api/user", nil), http.StatusOK, nil)
+		expect(t, s.anon().do(http.MethodGet, newPath, nil), http.StatusNotFound, nil)
+		bob = s.as(bobID)
+		expect(t, bob.do(http.MethodPost, "/api/user/restore", nil), http.StatusOK, nil)
+		expect(t, s.anon().do(http.MethodGet, newPath, nil), http.StatusOK, nil)
+		expect(t, bob.do(http.MethodDelete, "/api/feed", nil), http.StatusOK, nil)
+		expect(t, s.anon().do(http.MethodGet, newPath, nil), http.StatusNotFound, nil)
+	})
+
+	t.Run("import", func(t *testing.T) {
+		type report struct {
+			Report handlers.ICSImportReport `json:"report"`
+		}
+		actions := func(r report) map[string]string {
+			out := map[string]string{}
+			for _, e := range r.Report.Events {
+				out[e.UID] = e.Action + " " + e.Reason
+			}
+			return out
+		}
+
+		// the calendar calple wrote comes back without copies
+		var own report
+		expect(t, alice.do(http.MethodPost, "/api/ddays/import", w.Body.Bytes()), http.StatusOK, &own)
+		if own.Report.Created != 0 || own.Report.Updated != 0 || own.Report.Skipped != 2 {
+			t.Fatalf("importing alice's own calendar: %+v", own.Report)
+		}
+		expect(t, bob.do(http.MethodPost, "/api/ddays/import", w.Body.Bytes()), http.StatusOK, &own)
+		for uid, action := range actions(own) {
+			if action != "skipped Shared with you by someone else" {
+				t.Errorf("bob importing %s: %s", uid, action)
+			}
+		}
+
+		file := func(summary string) []byte {
+			return []byte(strings.Join([]string{
+				"BEGIN:VCALENDAR",
+				"BEGIN:VEVENT",
+				"UID:trip@example.com",
+				"DTSTART;VALUE=DATE:20250901",
+				"DTEND;VALUE=DATE:20250904",
+				"SUMMARY:" + summary,
+				"CATEGORIES:Holidays",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:yoga@example.com",
+				"DTSTART;TZID=Asia/Seoul:20250902T073000",
+				"DTEND;TZID=Asia/Seoul:20250902T083000",
+				"RRULE:FREQ=WEEKLY;BYDAY=TU;UNTIL=20251231T000000Z",
+				"SUMMARY:Yoga",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:yoga@example.com",
+				"RECURRENCE-ID;TZID=Asia/Seoul:20250909T073000",
+				"DTSTART;TZID=Asia/Seoul:20250910T073000",
+				"SUMMARY:Yoga",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:yoga@example.com",
+				"DTSTART;VALUE=DATE:20250903",
+				"SUMMARY:Yoga again",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:off@example.com",
+				"DTSTART;VALUE=DATE:20250905",
+				"SUMMARY:Called off",
+				"STATUS:CANCELLED",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:hourly@example.com",
+				"DTSTART:20250905T100000Z",
+				"RRULE:FREQ=HOURLY",
+				"SUMMARY:Water",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			}, "\r\n"))
+		}
+
+		var dry report
+		expect(t, alice.do(http.MethodPost, "/api/ddays/import?dryRun=true", file("Jeju")), http.StatusOK, &dry)
+		if !dry.Report.DryRun || dry.Report.Created != 2 || dry.Report.Skipped != 4 {
+			t.Fatalf("dry run: %+v", dry.Report)
+		}
+		if got := titles(alice.listDDays(t, "202509")); got["Jeju"] {
+			t.Fatalf("dry run created events: %v", got)
+		}
+
+		var first report
+		expect(t, alice.do(http.MethodPost, "/api/ddays/import", file("Jeju")), http.StatusOK, &first)
+		got := actions(first)
+		if first.Report.Created != 2 || got["trip@example.com"] != "created " || !strings.HasPrefix(got["hourly@example.com"], "skipped Invalid recurrence rule") ||
+			got["off@example.com"] != "skipped Cancelled" {
+			t.Fatalf("import: %+v", first.Report)
+		}
+
+		var jeju, yoga *store.DDay
+		ddays := bob.listDDays(t, "202509")
+		for i := range ddays {
+			switch ddays[i].Title {
+			case "Jeju":
+				jeju = &ddays[i]
+			case "Yoga":
+				yoga = &ddays[i]
+			}
+		}
+		// imported events are shared with the partner like the ones created in the app
+		if jeju == nil || yoga == nil {
+			t.Fatalf("bob's events: %v", titles(ddays))
+		}
+		if jeju.Date != "20250901" || jeju.EndDate != "20250903" || jeju.Group != "Holidays" || jeju.ICalUID != "trip@example.com" {
+			t.Errorf("jeju = %+v", jeju)
+		}
+		if yoga.Date != "20250902" || yoga.EndDate != "20250902" || yoga.RRule != "FREQ=WEEKLY;UNTIL=20251231;BYDAY=TU" ||
+			!slices.Equal(yoga.Occurrences, []string{"20250902", "20250909", "20250916", "20250923", "20250930"}) {
+			t.Errorf("yoga = %+v", yoga)
+		}
+
+		// importing again updates by UID, and the chosen group wins over the categories
+		var again report
+		expect(t, alice.do(http.MethodPost, "/api/ddays/import?group=travel", file("Jeju island")), http.StatusOK, &again)
+		if again.Report.Created != 0 || again.Report.Updated != 2 {
+			t.Fatalf("second import: %+v", again.Report)
+		}
+		expect(t, alice.do(http.MethodPost, "/api/ddays/import?group=travel", file("Jeju island")), http.StatusOK, &again)
+		if again.Report.Updated != 0 || actions(again)["trip@example.com"] != "skipped Unchanged" {
+			t.Fatalf("third import: %+v", again.Report)
+		}
+		got = map[string]string{}
+		for _, d := range alice.listDDays(t, "202509") {
+			got[d.Title] += "x"
+		}
+		if got["Jeju"] != "" || got["Jeju island"] != "x" || got["Yoga"] != "x" {
+			t.Errorf("events after importing again: %v", got)
+		}
+
+		expect(t, alice.do(http.MethodPost, "/api/ddays/import", []byte("BEGIN:VCARD\r\nEND:VCARD\r\n")), http.StatusBadRequest, nil)
+	})
+}
+
+func TestCalDAV(t *testing.T) {
+	s := newSeededServer(t, true)
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	trip := alice.createDDay(t, gin.H{"title": "Trip", "date": "20250710", "endDate": "20250712", "group": "travel"})
+	alice.createDDay(t, gin.H{"title": "Someday"})
+	concert := bob.createDDay(t, gin.H{"title": "Bob's concert", "date": "20250901"})
+
+	newToken := func(scope string) string {
+		var token struct{ Token string }
+		expect(t, alice.do(http.MethodPost, "/api/tokens", gin.H{"name": "phone", "scopes": []string{scope}}), http.StatusCreated, &token)
+		return token.Token
+	}
+	write, read := newToken("ddays:write"), newToken("ddays:read")
+
+	// calendar apps send Basic auth with the token as the password
+	dav := func(token, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.SetBasicAuth(aliceEmail, token)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	contains := func(w *httptest.ResponseRecorder, status int, parts ...string) {
+		t.Helper()
+		if w.Code != status {
+			t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body.String())
+		}
+		body := strings.ReplaceAll(w.Body.String(), "&#xD;&#xA; ", "")
+		for _, part := range parts {
+			if !strings.Contains(body, part) {
+				t.Errorf("response is missing %q:\n%s", part, body)
+			}
+		}
+	}
+	propfind := `<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+		<D:prop><D:resourcetype/><D:current-user-principal/><C:calendar-home-set/><D:getetag/><CS:getctag/></D:prop></D:propfind>`
+	ctag := func() string {
+		t.Helper()
+		w := dav(write, "PROPFIND", "/caldav/ddays/", propfind, "Depth", "0")
+		m := regexp.MustCompile(`<CS:getctag>(\w+)</CS:getctag>`).FindStringSubmatch(w.Body.String())
+		if m == nil {
+			t.Fatalf("no ctag: %s", w.Body.String())
+		}
+		return m[1]
+	}
+	tripPath := "/caldav/ddays/" + trip.ID + ".ics"
+
+	t.Run("discovery", func(t *testing.T) {
+		w := dav("", "PROPFIND", "/caldav/", propfind)
+		if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic") {
+			t.Fatalf("no credentials: %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+		expect(t, alice.do("PROPFIND", "/caldav/", nil), http.StatusUnauthorized, nil)
+		expect(t, dav("cpl_guess", "PROPFIND", "/caldav/", propfind), http.StatusUnauthorized, nil)
+
+		w = dav("", "PROPFIND", "/.well-known/caldav", "")
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/caldav/" {
+			t.Fatalf("well-known: %d %q", w.Code, w.Header().Get("Location"))
+		}
+		w = dav(write, http.MethodOptions, "/caldav/ddays/", "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("DAV"), "calendar-access") {
+			t.Fatalf("options: %d %q", w.Code, w.Header().Get("DAV"))
+		}
+
+		contains(dav(write, "PROPFIND", "/caldav/", propfind, "Depth", "0"), http.StatusMultiStatus,
+			"<D:current-user-principal><D:href>/caldav/</D:href></D:current-user-principal>",
+			"<C:calendar-home-set><D:href>/caldav/</D:href></C:calendar-home-set>")
+		contains(dav(write, "PROPFIND", "/caldav/", propfind, "Depth", "1"), http.StatusMultiStatus,
+			"<D:href>/caldav/ddays/</D:href><D:propstat><D:prop><D:resourcetype><D:collection/><C:calendar/></D:resourcetype>")
+
+		// alice's events and the ones shared with her, undated ones have no place in a calendar
+		w = dav(write, "PROPFIND", "/caldav/ddays/", propfind, "Depth", "1")
+		contains(w, http.StatusMultiStatus, "<D:href>"+tripPath+"</D:href>", "<D:href>/caldav/ddays/"+concert.ID+".ics</D:href>", "<D:getetag>")
+		if strings.Contains(w.Body.String(), "Someday") || strings.Count(w.Body.String(), "<D:response>") != 3 {
+			t.Errorf("calendar listing:\n%s", w.Body.String())
+		}
+	})
+
+	t.Run("report", func(t *testing.T) {
+		query := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+			<D:prop><D:getetag/><C:calendar-data/></D:prop>
+			<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+				<C:time-range start="20250701T000000Z" end="20250801T000000Z"/>
+			</C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`
+		w := dav(read, "REPORT", "/caldav/ddays/", query, "Depth", "1")
+		contains(w, http.StatusMultiStatus, "SUMMARY:Trip", "DTSTART;VALUE=DATE:20250710")
+		if strings.Contains(w.Body.String(), "concert") {
+			t.Errorf("event outside the time range:\n%s", w.Body.String())
+		}
+
+		multiget := `<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+			<D:prop><D:getetag/><C:calendar-data/></D:prop>
+			<D:href>` + tripPath + `</D:href><D:href>/caldav/ddays/gone.ics</D:href></C:calendar-multiget>`
+		contains(dav(read, "REPORT", "/caldav/ddays/", multiget), http.StatusMultiStatus, "SUMMARY:Trip",
+			"<D:href>/caldav/ddays/gone.ics</D:href><D:status>HTTP/1.1 404 Not Found</D:status>")
+
+		w = dav(read, http.MethodGet, tripPath, "")
+		contains(w, http.StatusOK, "UID:"+trip.ID+"@calple", "CATEGORIES:travel")
+		if w.Header().Get("ETag") == "" {
+			t.Error("GET without an etag")
+		}
+		expect(t, dav(read, http.MethodGet, "/caldav/ddays/gone.ics", ""), http.StatusNotFound, nil)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		event := func(uid, summary, date string) string {
+			return strings.Join([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "BEGIN:VEVENT", "UID:" + uid,
+				"DTSTART;VALUE=DATE:" + date, "SUMMARY:" + summary, "END:VEVENT", "END:VCALENDAR", ""}, "\r\n")
+		}
+		before := ctag()
+
+		// a new event from the phone keeps its name and is shared with the partner
+		expect(t, dav(read, http.MethodPut, "/caldav/ddays/phone-1.ics", event("phone-1", "Dinner", "20250715")), http.StatusForbidden, nil)
+		w := dav(write, http.MethodPut, "/caldav/ddays/phone-1.ics", event("phone-1", "Dinner", "20250715"), "If-None-Match", "*")
+		expect(t, w, http.StatusCreated, nil)
+		// the stored event is not what was sent, so there is no etag to cache it with
+		if etag := w.Header().Get("ETag"); etag != "" {
+			t.Errorf("etag on create %q", etag)
+		}
+		expect(t, dav(write, http.MethodPut, "/caldav/ddays/phone-1.ics", event("phone-1", "Dinner", "20250715"), "If-None-Match", "*"), http.StatusPreconditionFailed, nil)
+		contains(dav(write, http.MethodGet, "/caldav/ddays/phone-1.ics", ""), http.StatusOK, "SUMMARY:Dinner")
+		// apps that pick their own names find the event under it again
+		expect(t, dav(write, http.MethodPut, "/caldav/ddays/A1B2-lunch.ics", event("phone-2", "Lunch", "20250716")), http.StatusCreated, nil)
+		contains(dav(write, http.MethodGet, "/caldav/ddays/A1B2-lunch.ics", ""), http.StatusOK, "UID:phone-2", "SUMMARY:Lunch")
+		w = dav(write, http.MethodPut, "/caldav/ddays/A1B2-lunch.ics", event("phone-2", "Long lunch", "20250716"))
+		expect(t, w, http.StatusNoContent, nil)
+		if etag := w.Header().Get("ETag"); etag != "" {
+			t.Errorf("etag on update %q", etag)
+		}
+		expect(t, dav(write, http.MethodGet, "/caldav/ddays/phone-2.ics", ""), http.StatusNotFound, nil)
+		expect(t, dav(write, http.MethodDelete, "/caldav/ddays/A1B2-lunch.ics", ""), http.StatusNoContent, nil)
+		if !titles(bob.listDDays(t, "202507"))["Dinner"] {
+			t.Error("the event from the phone is not shared with bob")
+		}
+		if ctag() == before {
+			t.Error("ctag stayed the same after adding an event")
+		}
+
+		// updates need the current etag when one is given
+		etag := dav(write, http.MethodGet, tripPath, "").Header().Get("ETag")
+		updated := strings.Replace(dav(write, http.MethodGet, tripPath, "").Body.String(), "SUMMARY:Trip", "SUMMARY:Trip to Busan", 1)
+		expect(t, dav(write, http.MethodPut, tripPath, updated, "If-Match", `"0"`), http.StatusPreconditionFailed, nil)
+		expect(t, dav(write, http.MethodPut, tripPath, updated, "If-Match", etag), http.StatusNoContent, nil)
+		var got *store.DDay
+		for _, d := range alice.listDDays(t, "202507") {
+			if d.ID == trip.ID {
+				got = &d
+			}
+		}
+		if got == nil || got.Title != "Trip to Busan" || got.Group != "travel" || got.EndDate != "20250712" || got.ICalUID != "" {
+			t.Fatalf("trip after the update: %+v", got)
+		}
+		expect(t, dav(write, http.MethodPut, "/caldav/ddays/copy.ics", updated), http.StatusConflict, nil)
+		expect(t, dav(write, http.MethodPut, tripPath, "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"), http.StatusBadRequest, nil)
+
+		// only the creator changes an event
+		concertPath := "/caldav/ddays/" + concert.ID + ".ics"
+		expect(t, dav(write, http.MethodPut, concertPath, event(concert.ID+"@calple", "Alice's concert", "20250901")), http.StatusForbidden, nil)
+		expect(t, dav(write, http.MethodDelete, concertPath, ""), http.StatusForbidden, nil)
+
+		expect(t, dav(read, http.MethodDelete, "/caldav/ddays/phone-1.ics", ""), http.StatusForbidden, nil)
+		expect(t, dav(write, http.MethodDelete, "/caldav/ddays/phone-1.ics", "", "If-Match", `"0"`), http.StatusPreconditionFailed, nil)
+		expect(t, dav(write, http.MethodDelete, "/caldav/ddays/phone-1.ics", ""), http.StatusNoContent, nil)
+		expect(t, dav(write, http.MethodGet, "/caldav/ddays/phone-1.ics", ""), http.StatusNotFound, nil)
+		if titles(alice.listDDays(t, "202507"))["Dinner"] {
+			t.Error("deleted event is still listed")
+		}
+	})
+}
+
+func TestCheckin(t *testing.T) {
+	s := newSeededServer(t, false)
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	expect(t, alice.do(http.MethodPost, "/api/checkin", gin.H{"date": "2025-07-01", "energy": "high"}), http.StatusBadRequest, nil)
+	expect(t, alice.do(http.MethodPost, "/api/checkin", gin.H{"date": "07/01/2025", "mood": "happy", "energy": "high"}), http.StatusBadRequest, nil)
+	expect(t, alice.do(http.MethodGet, "/api/checkin/2025-07-01", nil), http.StatusNotFound, nil)
+	expect(t, alice.do(http.MethodGet, "/api/checkin/20250701", nil), http.StatusBadRequest, nil)
+	expect(t, bob.do(http.MethodGet, "/api/checkin/partner/2025-07-01", nil), http.StatusNotFound, nil)
+
+	var res struct {
+		Checkin store.Checkin `json:"checkin"`
+	}
+	expect(t, alice.do(http.MethodPost, "/api/checkin", gin.H{"date": "2025-07-01", "mood": "happy", "energy": "high"}), http.StatusOK, &res)
+	first := res.Checkin
+	expect(t, alice.do(http.MethodPost, "/api/checkin", gin.H{"date": "2025-07-01", "mood": "tired", "energy": "low"}), http.StatusOK, &res)
+	if res.Checkin.ID != first.ID || !res.Checkin.CreatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("second checkin %+v did not update %+v", res.Checkin, first)
+	}
+
+	expect(t, alice.do(http.MethodGet, "/api/checkin/2025-07-01", nil), http.StatusOK, &res)
+	if res.Checkin.Mood != "tired" {
+		t.Fatalf("checkin = %+v", res.Checkin)
+	}
+
+	t.Run("partner", func(t *testing.T) {
+		s.connect()
+		var partner struct {
+			PartnerCheckin struct {
+				UserName string `json:"userName"`
+				Mood     string `json:"mood"`
+			} `json:"partnerCheckin"`
+		}
+		expect(t, bob.do(http.MethodGet, "/api/checkin/partner/2025-07-01", nil), http.StatusOK, &partner)
+		if partner.PartnerCheckin.UserName != "Alice" || partner.PartnerCheckin.Mood != "tired" {
+			t.Fatalf("partner checkin = %+v", partner.PartnerCheckin)
+		}
+		expect(t, bob.do(http.MethodGet, "/api/checkin/partner/2025-07-02", nil), http.StatusNotFound, nil)
+	})
+
+	expect(t, alice.do(http.MethodDelete, "/api/checkin/2025-07-01", nil), http.StatusOK, nil)
+	expect(t, alice.do(http.MethodDelete, "/api/checkin/2025-07-01", nil), http.StatusNotFound, nil)
+}
+
+func TestFeedback(t *testing.T) {
+	s := newSeededServer(t, false)
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	expect(t, alice.do(http.MethodPost, "/api/feedback", gin.H{"feedbackText": "no category"}), http.StatusBadRequest, nil)
+	expect(t, alice.do(http.MethodPost, "/api/feedback", gin.H{"feedbackText": "first", "category": "bug"}), http.StatusCreated, nil)
+	time.Sleep(time.Millisecond)
+	expect(t, alice.do(http.MethodPost, "/api/feedback", gin.H{"feedbackText": "second", "category": "idea"}), http.StatusCreated, nil)
+
+	var list []store.Feedback
+	expect(t, alice.do(http.MethodGet, "/api/feedback", nil), http.StatusOK, &list)
+	if len(list) != 2 || list[0].FeedbackText != "first" || list[1].FeedbackText != "second" {
+		t.Fatalf("feedback = %+v", list)
+	}
+
+	// feedback is private to its author
+	expect(t, bob.do(http.MethodGet, "/api/feedback", nil), http.StatusOK, &list)
+	if len(list) != 0 {
+		t.Fatalf("bob sees feedback %+v", list)
+	}
+}
+
+func TestPins(t *testing.T) {
+	s := newSeededServer(t, true)
+	alice, bob, carol := s.as(aliceID), s.as(bobID), s.as(carolID)
+
+	expect(t, alice.do(http.MethodPost, "/api/pins", gin.H{"lat": 37.5, "lng": 127}), http.StatusBadRequest, nil)
+
+	pin := gin.H{"lat": 37.5, "lng": 127.0, "title": "First date", "date": "2024-02-14"}
+	var created struct {
+		ID string `json:"id"`
+	}
+	expect(t, alice.do(http.MethodPost, "/api/pins", pin), http.StatusCreated, &created)
+
+	type pinsResponse struct {
+		Pins        []store.Pin `json:"pins"`
+		PartnerPins []store.Pin `json:"partnerPins"`
+	}
+	var res pinsResponse
+	expect(t, bob.do(http.MethodGet, "/api/pins", nil), http.StatusOK, &res)
+	if len(res.Pins) != 0 || len(res.PartnerPins) != 1 || res.PartnerPins[0].Title != "First date" {
+		t.Fatalf("bob's pins = %+v", res)
+	}
+	expect(t, carol.do(http.MethodGet, "/api/pins", nil), http.StatusOK, &res)
+	if len(res.PartnerPins) != 0 {
+		t.Fatalf("carol sees partner pins %+v", res.PartnerPins)
+	}
+
+	pin["title"] = "Our first date"
+	expect(t, alice.do(http.MethodPut, "/api/pins/missing", pin), http.StatusNotFound, nil)
+	// pins are stored per user, the partner cannot edit them
+	expect(t, bob.do(http.MethodPut, "/api/pins/"+created.ID, pin), http.StatusNotFound, nil)
+	expect(t, alice.do(http.MethodPut, "/api/pins/"+created.ID, pin), http.StatusNoContent, nil)
+
+	expect(t, alice.do(http.MethodGet, "/api/pins", nil), http.StatusOK, &res)
+	if len(res.Pins) != 1 || res.Pins[0].Title != "Our first date" {
+		t.Fatalf("alice's pins = %+v", res.Pins)
+	}
+
+	expect(t, alice.do(http.MethodDelete, "/api/pins/"+created.ID, nil), http.StatusNoContent, nil)
+	expect(t, alice.do(http.MethodGet, "/api/pins", nil), http.StatusOK, &res)
+	if len(res.Pins) != 0 {
+		t.Fatalf("pins after delete = %+v", res.Pins)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	s := newSeededServer(t, false)
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	t.Run("validation", func(t *testing.T) {
+		expect(t, alice.do(http.MethodPost, "/api/tokens", gin.H{"scopes": []string{"ddays:read"}}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/tokens", gin.H{"name": "x", "scopes": []string{}}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/tokens", gin.H{"name": "x", "scopes": []string{"ddays:admin"}}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/tokens", gin.H{"name": "x", "scopes": []string{"tokens:write"}}), http.StatusBadRequest, nil)
+		expect(t, alice.do(http.MethodPost, "/api/tokens", gin.H{"name": "x", "scopes": []string{"pins:read"}, "expiresInDays": 1000}), http.StatusBadRequest, nil)
+	})
+
+	var created struct {
+		Token    string         `json:"token"`
+		APIToken store.APIToken `json:"apiToken"`
+	}
+	expect(t, alice.do(http.MethodPost, "/api/tokens", gin.H{
+		"name":   "import script",
+		"scopes": []string{"ddays:read", "periods:write"},
+	}), http.StatusCreated, &created)
+	if created.Token == "" || created.APIToken.ID == "" || created.APIToken.Prefix == "" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	// the secret is only stored hashed
+	stored, err := s.st.Tokens().ListByUser(context.Background(), aliceID)
+	if err != nil || len(stored) != 1 || stored[0].Hash == created.Token || stored[0].Hash == "" {
+		t.Fatalf("stored tokens = %+v, %v", stored, err)
+	}
+
+	script := s.bearer(created.Token)
+
+	t.Run("scopes", func(t *testing.T) {
+		alice.createDDay(t, gin.H{"title": "Trip", "date": "20250710"})
+		if got := titles(script.listDDays(t, "202507")); !got["Trip"] {
+			t.Errorf("token sees %v", got)
+		}
+		expect(t, script.do(http.MethodPost, "/api/ddays", gin.H{"title": "x"}), http.StatusForbidden, nil)
+
+		// write implies read
+		expect(t, script.do(http.MethodPost, "/api/periods/days", gin.H{"date": "2025-07-01"}), http.StatusCreated, nil)
+		expect(t, script.do(http.MethodGet, "/api/periods/days", nil), http.StatusOK, nil)
+
+		expect(t, script.do(http.MethodGet, "/api/pins", nil), http.StatusForbidden, nil)
+	})
+
+	t.Run("session only routes", func(t *testing.T) {
+		expect(t, script.do(http.MethodGet, "/api/tokens", nil), http.StatusForbidden, nil)
+		expect(t, script.do(http.MethodPost, "/api/tokens", gin.H{"name": "x", "scopes": []string{"pins:read"}}), http.StatusForbidden, nil)
+		expect(t, script.do(http.MethodDelete, "/api/user", nil), http.StatusForbidden, nil)
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		expect(t, s.bearer("cpl_nope").do(http.MethodGet, "/api/ddays?view=202507", nil), http.StatusUnauthorized, nil)
+		expect(t, s.bearer(created.Token+"x").do(http.MethodGet, "/api/ddays?view=202507", nil), http.StatusUnauthorized, nil)
+
+		hash := sha256.Sum256([]byte("cpl_expired"))
+		expired := store.APIToken{
+			UserID:    aliceID,
+			Name:      "old",
+			Hash:      hex.EncodeToString(hash[:]),
+			Scopes:    []string{"ddays:read"},
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(-time.Hour),
+		}
+		if err := s.st.Tokens().Create(context.Background(), &expired); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, s.bearer("cpl_expired").do(http.MethodGet, "/api/ddays?view=202507", nil), http.StatusUnauthorized, nil)
+
+		var list struct {
+			Tokens []store.APIToken `json:"tokens"`
+		}
+		expect(t, alice.do(http.MethodGet, "/api/tokens", nil), http.StatusOK, &list)
+		if len(list.Tokens) != 2 || list.Tokens[0].LastUsedAt.IsZero() || list.Tokens[1].Name != "old" {
+			t.Fatalf("tokens = %+v", list.Tokens)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		expect(t, bob.do(http.MethodDelete, "/api/tokens/"+created.APIToken.ID, nil), http.StatusNotFound, nil)
+		expect(t, alice.do(http.MethodDelete, "/api/tokens/"+created.APIToken.ID, nil), http.StatusOK, nil)
+		expect(t, script.do(http.MethodGet, "/api/ddays?view=202507", nil), http.StatusUnauthorized, nil)
+		expect(t, alice.do(http.MethodDelete, "/api/tokens/"+created.APIToken.ID, nil), http.StatusNotFound, nil)
+	})
+}
+
+func TestOAuthTokensNotExposed(t *testing.T) {
+	s := newSeededServer(t, true)
+	ctx := context.Background()
+
+	// tokens as a login would leave them, bob reads alice's data as her partner
+	alice, err := s.st.Users().Get(ctx, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.Tokens = &store.OAuthTokens{AccessToken: "secret-access", RefreshToken: "secret-refresh", Expiry: time.Now()}
+	if err := s.st.Users().Save(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []struct {
+		c    *client
+		path string
+	}{
+		{s.as(aliceID), "/api/user/metadata"},
+		{s.as(aliceID), "/api/auth/status"},
+		{s.as(bobID), "/api/user/partner/metadata"},
+		{s.as(bobID), "/api/connection"},
+	} {
+		w := r.c.do(http.MethodGet, r.path, nil)
+		expect(t, w, http.StatusOK, nil)
+		body := w.Body.String()
+		if strings.Contains(body, "secret-") || strings.Contains(body, "token") {
+			t.Errorf("%s exposes tokens: %s", r.path, body)
+		}
+	}
+
+	// the partner only sees the allowlisted fields
+	var partner struct {
+		PartnerMetadata map[string]any `json:"partnerMetadata"`
+	}
+	expect(t, s.as(bobID).do(http.MethodGet, "/api/user/partner/metadata", nil), http.StatusOK, &partner)
+	for field := range partner.PartnerMetadata {
+		switch field {
+		case "id", "email", "name", "sex", "startedDating":
+		default:
+			t.Errorf("partner metadata exposes %q", field)
+		}
+	}
+}
+
+// mockOIDC is an openid connect provider where each code signs in as the given claims
+func mockOIDC(t *testing.T, claims map[string]map[string]any) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": r.Form.Get("code"), "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(claims[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")])
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// oauthLogin runs the login redirect and the callback for code
+// and returns the client with the resulting session and the callback response
+func (c *client) oauthLogin(provider, code, query string) (*client, *httptest.ResponseRecorder) {
+	t := c.srv.t
+	t.Helper()
+
+	w := c.do(http.MethodGet, "/oauth/"+provider+"/login"+query, nil)
+	expect(t, w, http.StatusFound, nil)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := location.Query().Get("state")
+	if state == "" {
+		t.Fatalf("no state in %s", location)
+	}
+
+	flow := &client{srv: c.srv, cookie: w.Header().Get("Set-Cookie")}
+	w = flow.do(http.MethodGet, "/oauth/"+provider+"/callback?state="+state+"&code="+code, nil)
+	if cookie := w.Header().Get("Set-Cookie"); cookie != "" {
+		flow.cookie = cookie
+	}
+	return flow, w
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := mockOIDC(t, map[string]map[string]any{
+		"dana":        {"sub": "dana-sub", "email": "dana@example.com", "email_verified": true, "name": "Dana"},
+		"alice":       {"sub": "alice-sub", "email": aliceEmail, "email_verified": true, "name": "Alice"},
+		"fake-alice":  {"sub": "mallory-sub", "email": aliceEmail, "email_verified": false},
+		"carol-other": {"sub": "carol-sub", "email": "carol@elsewhere.example.com", "email_verified": false},
+	})
+	s := newTestServerWith(t, &Config{
+		Providers: map[string]ProviderConfig{"test": {Issuer: issuer.URL, ClientID: "client"}},
+	})
+	s.seedUsers()
+
+	var providers struct{ Providers []string }
+	expect(t, s.anon().do(http.MethodGet, "/oauth/providers", nil), http.StatusOK, &providers)
+	if strings.Join(providers.Providers, ",") != "google,test" {
+		t.Fatalf("providers = %v", providers.Providers)
+	}
+	expect(t, s.anon().do(http.MethodGet, "/oauth/nope/login", nil), http.StatusNotFound, nil)
+
+	// a new verified email gets a new account
+	dana, w := s.anon().oauthLogin("test", "dana", "")
+	expect(t, w, http.StatusFound, nil)
+	var meta struct {
+		User struct{ ID, Email, Name string } `json:"userMetadata"`
+	}
+	expect(t, dana.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+	if meta.User.Email != "dana@example.com" || meta.User.Name != "Dana" || meta.User.ID == "dana-sub" {
+		t.Fatalf("new user = %+v", meta.User)
+	}
+	danaID := meta.User.ID
+
+	// signing in again finds the same account
+	again, _ := s.anon().oauthLogin("test", "dana", "")
+	expect(t, again.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+	if meta.User.ID != danaID {
+		t.Fatalf("second login user = %s, want %s", meta.User.ID, danaID)
+	}
+
+	// a verified email links to the existing account, an unverified one is refused
+	alice, _ := s.anon().oauthLogin("test", "alice", "")
+	expect(t, alice.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+	if meta.User.ID != aliceID {
+		t.Fatalf("alice signed in as %s", meta.User.ID)
+	}
+	_, w = s.anon().oauthLogin("test", "fake-alice", "")
+	expect(t, w, http.StatusConflict, nil)
+
+	// carol links an account with a different email to hers
+	carol, w := s.as(carolID).oauthLogin("test", "carol-other", "?link=true")
+	expect(t, w, http.StatusFound, nil)
+	expect(t, carol.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+	if meta.User.ID != carolID || meta.User.Email != carolEmail {
+		t.Fatalf("after linking = %+v", meta.User)
+	}
+	var identities struct{ Identities []store.Identity }
+	expect(t, s.as(carolID).do(http.MethodGet, "/api/user/identities", nil), http.StatusOK, &identities)
+	if len(identities.Identities) != 1 || identities.Identities[0].Subject != "carol-sub" {
+		t.Fatalf("carol identities = %+v", identities.Identities)
+	}
+
+	// an identity linked to someone else cannot be linked again
+	_, w = s.as(carolID).oauthLogin("test", "dana", "?link=true")
+	expect(t, w, http.StatusConflict, nil)
+
+	// the only identity cannot be unlinked, a second one can
+	expect(t, s.as(carolID).do(http.MethodDelete, "/api/user/identities/test/carol-sub", nil), http.StatusConflict, nil)
+	ctx := context.Background()
+	if err := s.st.Identities().Link(ctx, &store.Identity{Provider: "google", Subject: carolID, UserID: carolID, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, s.as(carolID).do(http.MethodDelete, "/api/user/identities/test/dana-sub", nil), http.StatusNotFound, nil)
+	expect(t, s.as(carolID).do(http.MethodDelete, "/api/user/identities/test/carol-sub", nil), http.StatusOK, nil)
+
+	// the state is bound to the provider it was issued for
+	w = s.anon().do(http.MethodGet, "/oauth/test/login", nil)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	flow := &client{srv: s, cookie: w.Header().Get("Set-Cookie")}
+	expect(t, flow.do(http.MethodGet, "/google/oauth/callback?code=dana&state="+location.Query().Get("state"), nil), http.StatusBadRequest, nil)
+}
+
+// emails without an account are kept pending like the others and get the event when they sign up
+func TestPendingShares(t *testing.T) {
+	issuer := mockOIDC(t, map[string]map[string]any{
+		"dana": {"sub": "dana-sub", "email": "dana@example.com", "email_verified": true, "name": "Dana"},
+	})
+	s := newTestServerWith(t, &Config{
+		Providers: map[string]ProviderConfig{"test": {Issuer: issuer.URL, ClientID: "client"}},
+	})
+	s.seedUsers()
+	carol := s.as(carolID)
+
+	// the answer is the same whether the email has an account or not
+	var registered, pending struct{ DDay store.DDay }
+	expect(t, carol.do(http.MethodPost, "/api/ddays", gin.H{"title": "Brunch", "date": "20250720", "connectedUsers": []string{aliceEmail}}), http.StatusCreated, &registered)
+	expect(t, carol.do(http.MethodPost, "/api/ddays", gin.H{"title": "Picnic", "date": "20250721", "connectedUsers": []string{"Dana@Example.com"}}), http.StatusCreated, &pending)
+	if strings.Join(registered.DDay.ConnectedUsers, ",") != aliceEmail || strings.Join(pending.DDay.ConnectedUsers, ",") != "dana@example.com" {
+		t.Fatalf("connected users = %v and %v", registered.DDay.ConnectedUsers, pending.DDay.ConnectedUsers)
+	}
+	for _, d := range carol.listDDays(t, "202507") {
+		if d.Title == "Picnic" && strings.Join(d.ConnectedUsers, ",") != "dana@example.com" {
+			t.Errorf("listed picnic = %+v", d)
+		}
+	}
+	// the pending email stays when other fields change
+	expect(t, carol.do(http.MethodPut, "/api/ddays/"+pending.DDay.ID, gin.H{"title": "Picnic in the park"}), http.StatusOK, nil)
+
+	dana, w := s.anon().oauthLogin("test", "dana", "")
+	expect(t, w, http.StatusFound, nil)
+	if !titles(dana.listDDays(t, "202507"))["Picnic in the park"] {
+		t.Error("the picnic is not shared with dana after signing up")
+	}
+	d, err := s.st.DDays().Get(context.Background(), pending.DDay.ID)
+	if err != nil || len(d.PendingUsers) != 0 || strings.Join(d.ConnectedUsers, ",") != "dana@example.com" || len(d.SharedWith) != 1 {
+		t.Errorf("picnic after dana signed up = %+v, %v", d, err)
+	}
+}
+
+// popMail returns the only mail the file mailer wrote to dir and removes it
+func popMail(t *testing.T, dir string) string {
+	t.Helper()
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("want one mail in %s, got %d (%v)", dir, len(files), err)
+	}
+	path := filepath.Join(dir, files[0].Name())
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	return string(b)
+}
+
+var mailTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func mailToken(t *testing.T, mail string) string {
+	t.Helper()
+	m := mailTokenPattern.FindStringSubmatch(mail)
+	if m == nil {
+		t.Fatalf("no token in mail:\n%s", mail)
+	}
+	return m[1]
+}
+
+func TestEmailAuth(t *testing.T) {
+	mailDir := t.TempDir()
+	s := newTestServerWith(t, &Config{Mail: MailConfig{Driver: "file", Dir: mailDir, From: "Calple <no-reply@calple.date>"}})
+	s.seedUsers()
+
+	// sign in from a fresh client and return it with the session cookie
+	login := func(path string, body any, status int) *client {
+		t.Helper()
+		w := s.anon().do(http.MethodPost, path, body)
+		expect(t, w, status, nil)
+		return &client{srv: s, cookie: w.Header().Get("Set-Cookie")}
+	}
+	var meta struct {
+		User struct{ ID, Email, Name string } `json:"userMetadata"`
+	}
+
+	expect(t, s.anon().do(http.MethodPost, "/auth/signup", gin.H{"email": "erin@example.com", "password": "short"}), http.StatusBadRequest, nil)
+	expect(t, s.anon().do(http.MethodPost, "/auth/signup", gin.H{"email": "Erin@Example.com", "password": "correct horse", "name": "Erin"}), http.StatusAccepted, nil)
+	verifyMail := popMail(t, mailDir)
+	if !strings.Contains(verifyMail, "To: erin@example.com") || !strings.Contains(verifyMail, "http://localhost:3000/auth/verify?token=") {
+		t.Fatalf("verify mail:\n%s", verifyMail)
+	}
+
+	// no account until the email is verified
+	login("/auth/login", gin.H{"email": "erin@example.com", "password": "correct horse"}, http.StatusUnauthorized)
+
+	token := mailToken(t, verifyMail)
+	erin := login("/auth/verify", gin.H{"token": token}, http.StatusOK)
+	expect(t, erin.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+	if meta.User.Email != "erin@example.com" || meta.User.Name != "Erin" {
+		t.Fatalf("verified user = %+v", meta.User)
+	}
+	erinID := meta.User.ID
+	login("/auth/verify", gin.H{"token": token}, http.StatusBadRequest)
+
+	login("/auth/login", gin.H{"email": "erin@example.com", "password": "wrong password"}, http.StatusUnauthorized)
+	erin = login("/auth/login", gin.H{"email": "ERIN@example.com", "password": "correct horse"}, http.StatusOK)
+	expect(t, erin.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+	if meta.User.ID != erinID {
+		t.Fatalf("password login as %s, want %s", meta.User.ID, erinID)
+	}
+
+	// signing up again only notifies the owner
+	expect(t, s.anon().do(http.MethodPost, "/auth/signup", gin.H{"email": "erin@example.com", "password": "another password"}), http.StatusAccepted, nil)
+	if mail := popMail(t, mailDir); !strings.Contains(mail, "already has an account") || mailTokenPattern.MatchString(mail) {
+		t.Fatalf("existing account mail:\n%s", mail)
+	}
+
+	// unknown emails get the same answer and no mail
+	expect(t, s.anon().do(http.MethodPost, "/auth/password/forgot", gin.H{"email": "nobody@example.com"}), http.StatusAccepted, nil)
+	expect(t, s.anon().do(http.MethodPost, "/auth/password/forgot", gin.H{"email": "erin@example.com"}), http.StatusAccepted, nil)
+	token = mailToken(t, popMail(t, mailDir))
+	expect(t, s.anon().do(http.MethodPost, "/auth/password/reset", gin.H{"token": token, "password": "short"}), http.StatusBadRequest, nil)
+	login("/auth/password/reset", gin.H{"token": token, "password": "battery staple"}, http.StatusOK)
+	login("/auth/login", gin.H{"email": "erin@example.com", "password": "correct horse"}, http.StatusUnauthorized)
+	login("/auth/login", gin.H{"email": "erin@example.com", "password": "battery staple"}, http.StatusOK)
+
+	// a magic link signs in to the existing google account with that email
+	expect(t, s.anon().do(http.MethodPost, "/auth/magic", gin.H{"email": aliceEmail}), http.StatusAccepted, nil)
+	token = mailToken(t, popMail(t, mailDir))
+	expect(t, s.anon().do(http.MethodPost, "/auth/verify", gin.H{"token": token}), http.StatusBadRequest, nil)
+	alice := login("/auth/magic/verify", gin.H{"token": token}, http.StatusOK)
+	expect(t, alice.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, &meta)
+	if meta.User.ID != aliceID {
+		t.Fatalf("magic link signed in as %s", meta.User.ID)
+	}
+	// without a password for it
+	login("/auth/login", gin.H{"email": aliceEmail, "password": ""}, http.StatusBadRequest)
+	login("/auth/login", gin.H{"email": aliceEmail, "password": "anything at all"}, http.StatusUnauthorized)
+
+	var identities struct{ Identities []store.Identity }
+	expect(t, s.as(aliceID).do(http.MethodGet, "/api/user/identities", nil), http.StatusOK, &identities)
+	if len(identities.Identities) != 1 || identities.Identities[0].Provider != "email" {
+		t.Fatalf("alice identities = %+v", identities.Identities)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	mailDir := t.TempDir()
+	s := newTestServerWith(t, &Config{Mail: MailConfig{Driver: "file", Dir: mailDir, From: "Calple <no-reply@calple.date>"}})
+	s.seedUsers()
+	s.connect()
+	const newEmail = "alice@new.example.com"
+
+	// alice adds a password to her google account
+	expect(t, s.anon().do(http.MethodPost, "/auth/password/forgot", gin.H{"email": aliceEmail}), http.StatusAccepted, nil)
+	token := mailToken(t, popMail(t, mailDir))
+	expect(t, s.anon().do(http.MethodPost, "/auth/password/reset", gin.H{"token": token, "password": "correct horse"}), http.StatusOK, nil)
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	trip := alice.createDDay(t, gin.H{"title": "Trip", "date": "20250710"})
+	concert := bob.createDDay(t, gin.H{"title": "Concert", "date": "20250712"})
+
+	expect(t, alice.do(http.MethodPost, "/api/user/email", gin.H{"email": aliceEmail}), http.StatusBadRequest, nil)
+	expect(t, alice.do(http.MethodPost, "/api/user/email", gin.H{"email": "not an email"}), http.StatusBadRequest, nil)
+
+	// a taken email only gets a notice
+	expect(t, alice.do(http.MethodPost, "/api/user/email", gin.H{"email": carolEmail}), http.StatusAccepted, nil)
+	if mail := popMail(t, mailDir); !strings.Contains(mail, "To: "+carolEmail) || mailTokenPattern.MatchString(mail) {
+		t.Fatalf("taken email mail:\n%s", mail)
+	}
+
+	expect(t, alice.do(http.MethodPost, "/api/user/email", gin.H{"email": "Alice@New.Example.com"}), http.StatusAccepted, nil)
+	mail := popMail(t, mailDir)
+	if !strings.Contains(mail, "To: "+newEmail) || !strings.Contains(mail, "/auth/change-email?token=") {
+		t.Fatalf("confirm mail:\n%s", mail)
+	}
+	token = mailToken(t, mail)
+	expect(t, s.anon().do(http.MethodPost, "/auth/email/confirm", gin.H{"token": token}), http.StatusOK, nil)
+	expect(t, s.anon().do(http.MethodPost, "/auth/email/confirm", gin.H{"token": token}), http.StatusBadRequest, nil)
+	if mail := popMail(t, mailDir); !strings.Contains(mail, "To: "+aliceEmail) || !strings.Contains(mail, newEmail) {
+		t.Fatalf("old email notice:\n%s", mail)
+	}
+
+	// the password moved with the account
+	expect(t, s.anon().do(http.MethodPost, "/auth/login", gin.H{"email": aliceEmail, "password": "correct horse"}), http.StatusUnauthorized, nil)
+	expect(t, s.anon().do(http.MethodPost, "/auth/login", gin.H{"email": newEmail, "password": "correct horse"}), http.StatusOK, nil)
+
+	// sharing is by ID, only the emails shown change
+	ddays := bob.listDDays(t, "202507")
+	byTitle := map[string]store.DDay{}
+	for _, d := range ddays {
+		byTitle[d.Title] = d
+	}
+	if d, ok := byTitle["Trip"]; !ok || d.CreatedBy != newEmail || d.UpdatedAt.After(trip.UpdatedAt.Add(time.Second)) {
+		t.Errorf("partner's view of trip = %+v", d)
+	}
+	if d := byTitle["Concert"]; len(d.ConnectedUsers) != 1 || d.ConnectedUsers[0] != newEmail {
+		t.Errorf("concert shared with %v", d.ConnectedUsers)
+	}
+	if !titles(alice.listDDays(t, "202507"))["Concert"] {
+		t.Error("alice lost access to the partner's event")
+	}
+	expect(t, alice.do(http.MethodPut, "/api/ddays/"+trip.ID, gin.H{"title": "Road trip"}), http.StatusOK, nil)
+
+	var conn struct {
+		Connected bool `json:"connected"`
+	}
+	expect(t, bob.do(http.MethodGet, "/api/connection", nil), http.StatusOK, &conn)
+	if !conn.Connected {
+		t.Error("partner lost the connection")
+	}
+	if conns, _ := s.st.Connections().List(context.Background(), bobID); len(conns) != 1 || conns[0].PartnerEmail != newEmail {
+		t.Errorf("partner's connection = %+v", conns)
+	}
+
+	// the old email is free again, sharing with it gives no access until it has an account
+	expect(t, bob.do(http.MethodPut, "/api/ddays/"+concert.ID, gin.H{"connectedUsers": []string{aliceEmail}}), http.StatusOK, nil)
+	if d, _ := s.st.DDays().Get(context.Background(), concert.ID); len(d.SharedWith) != 0 || strings.Join(d.PendingUsers, ",") != aliceEmail {
+		t.Errorf("concert shared with the old email = %+v", d)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestServer(t)
+	s.seedUsers()
+
+	phone := s.asDevice(aliceID, "phone")
+	laptop := s.asDevice(aliceID, "laptop")
+	tablet := s.asDevice(aliceID, "tablet")
+	bob := s.as(bobID)
+
+	type device struct {
+		ID, UserAgent string
+		Current       bool
+	}
+	var list struct{ Sessions []device }
+	expect(t, laptop.do(http.MethodGet, "/api/sessions", nil), http.StatusOK, &list)
+	if len(list.Sessions) != 3 {
+		t.Fatalf("sessions = %+v", list.Sessions)
+	}
+	ids := map[string]string{}
+	for _, d := range list.Sessions {
+		ids[d.UserAgent] = d.ID
+		if d.Current != (d.UserAgent == "laptop") {
+			t.Fatalf("current flag wrong: %+v", d)
+		}
+	}
+
+	// revoking a session signs that device out, other users' sessions are not found
+	expect(t, bob.do(http.MethodDelete, "/api/sessions/"+ids["phone"], nil), http.StatusNotFound, nil)
+	expect(t, laptop.do(http.MethodDelete, "/api/sessions/"+ids["phone"], nil), http.StatusOK, nil)
+	expect(t, phone.do(http.MethodGet, "/api/user/metadata", nil), http.StatusUnauthorized, nil)
+	expect(t, tablet.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, nil)
+
+	// revoking everything else keeps the current session
+	expect(t, laptop.do(http.MethodDelete, "/api/sessions", nil), http.StatusOK, nil)
+	expect(t, tablet.do(http.MethodGet, "/api/user/metadata", nil), http.StatusUnauthorized, nil)
+	expect(t, laptop.do(http.MethodGet, "/api/sessions", nil), http.StatusOK, &list)
+	if len(list.Sessions) != 1 || !list.Sessions[0].Current {
+		t.Fatalf("after revoking others = %+v", list.Sessions)
+	}
+	expect(t, bob.do(http.MethodGet, "/api/user/metadata", nil), http.StatusOK, nil)
+
+	// logout ends the session on the server, not only the cookie
+	expect(t, laptop.do(http.MethodGet, "/google/oauth/logout", nil), http.StatusFound, nil)
+	expect(t, laptop.do(http.MethodGet, "/api/user/metadata", nil), http.StatusUnauthorized, nil)
+
+	// api tokens cannot see or revoke sessions
+	var created struct{ Token string }
+	expect(t, bob.do(http.MethodPost, "/api/tokens", gin.H{"name": "cli", "scopes": []string{"user:write"}}), http.StatusCreated, &created)
+	expect(t, s.bearer(created.Token).do(http.MethodGet, "/api/sessions", nil), http.StatusForbidden, nil)
+}
+
+func TestCSRF(t *testing.T) {
+	s := newTestServer(t)
+	s.seedUsers()
+	dday := gin.H{"title": "Anniversary", "date": "20250101", "group": "couple"}
+
+	// the session cookie alone is not enough
+	alice := s.as(aliceID)
+	alice.noCSRF = true
+	expect(t, alice.do(http.MethodPost, "/api/ddays", dday), http.StatusForbidden, nil)
+	expect(t, alice.do(http.MethodDelete, "/api/user", nil), http.StatusForbidden, nil)
+
+	// another session's token does not work
+	bob := s.as(bobID)
+	bob.fetchCSRF()
+	alice.fetchCSRF()
+	alice.noCSRF = false
+	forged := &client{srv: s, cookie: alice.cookie, csrf: bob.csrf}
+	expect(t, forged.do(http.MethodPost, "/api/ddays", dday), http.StatusForbidden, nil)
+	expect(t, alice.do(http.MethodPost, "/api/ddays", dday), http.StatusCreated, nil)
+
+	// reads and api tokens need no csrf token
+	get := s.as(aliceID)
+	get.noCSRF = true
+	expect(t, get.do(http.MethodGet, "/api/ddays?view=202501", nil), http.StatusOK, nil)
+	var created struct{ Token string }
+	expect(t, s.as(aliceID).do(http.MethodPost, "/api/tokens", gin.H{"name": "cli", "scopes": []string{"ddays:write"}}), http.StatusCreated, &created)
+	expect(t, s.bearer(created.Token).do(http.MethodPost, "/api/ddays", dday), http.StatusCreated, nil)
+
+	// the token fetched before signing in keeps working after it
+	visitor := s.anon()
+	visitor.fetchCSRF()
+	req := httptest.NewRequest(http.MethodGet, "/test/login/"+carolID, nil)
+	req.Header.Set("Cookie", visitor.cookie)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	carol := &client{srv: s, cookie: w.Header().Get("Set-Cookie"), csrf: visitor.csrf}
+	if carol.cookie == visitor.cookie {
+		t.Fatal("session was not rotated on sign in")
+	}
+	expect(t, carol.do(http.MethodPost, "/api/ddays", dday), http.StatusCreated, nil)
+}
+
+func TestOAuthState(t *testing.T) {
+	issuer := mockOIDC(t, nil)
+	s := newTestServerWith(t, &Config{
+		Providers: map[string]ProviderConfig{"test": {Issuer: issuer.URL, ClientID: "client"}},
+	})
+
+	states := map[string]bool{}
+	for range 3 {
+		w := s.anon().do(http.MethodGet, "/oauth/test/login", nil)
+		expect(t, w, http.StatusFound, nil)
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := location.Query().Get("state")
+		if len(state) < 40 || states[state] {
+			t.Fatalf("weak or repeated state %q", state)
+		}
+		states[state] = true
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	// httptest requests come from 192.0.2.1, here it is the proxy
+	s := newTestServerWith(t, &Config{TrustedProxies: []string{"192.0.2.1"}, RateLimits: map[string]RateLimitConfig{
+		"feedback": {Requests: 2, Per: "1h"},
+		"auth":     {Requests: 1, Per: "1m"},
+	}})
+	s.seedUsers()
+	alice, bob := s.as(aliceID), s.as(bobID)
+
+	body := gin.H{"feedbackText": "slow down", "category": "bug"}
+	expect(t, alice.do(http.MethodPost, "/api/feedback", body), http.StatusCreated, nil)
+	expect(t, alice.do(http.MethodPost, "/api/feedback", body), http.StatusCreated, nil)
+	w := alice.do(http.MethodPost, "/api/feedback", body)
+	expect(t, w, http.StatusTooManyRequests, nil)
+	if retry := w.Header().Get("Retry-After"); retry != "1800" {
+		t.Fatalf("Retry-After = %q, want 1800", retry)
+	}
+
+	// counted per user, and only on the limited route
+	expect(t, bob.do(http.MethodPost, "/api/feedback", body), http.StatusCreated, nil)
+	expect(t, alice.do(http.MethodGet, "/api/feedback", nil), http.StatusOK, nil)
+
+	// signed out requests are counted per client ip
+	anon := s.anon()
+	anon.fetchCSRF()
+	login := func(ip string) int {
+		b, _ := json.Marshal(gin.H{"email": "alice@example.com", "password": "wrong password"})
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Cookie", anon.cookie)
+		req.Header.Set("X-CSRF-Token", anon.csrf)
+		req.Header.Set("X-Forwarded-For", ip)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := login("203.0.113.1"); code != http.StatusUnauthorized {
+		t.Fatalf("first login = %d", code)
+	}
+	if code := login("203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("second login from the same ip = %d", code)
+	}
+	if code := login("203.0.113.2"); code != http.StatusUnauthorized {
+		t.Fatalf("login from another ip = %d", code)
+	}
+}
+
+// without trusted proxies X-Forwarded-For is ignored, a new address per request does not get a new limit
+func TestRateLimitSpoofedForwardedFor(t *testing.T) {
+	s := newTestServerWith(t, &Config{RateLimits: map[string]RateLimitConfig{"auth": {Requests: 1, Per: "1m"}}})
+	s.seedUsers()
+	anon := s.anon()
+	anon.fetchCSRF()
+	login := func(ip string) int {
+		b, _ := json.Marshal(gin.H{"email": "alice@example.com", "password": "wrong password"})
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Cookie", anon.cookie)
+		req.Header.Set("X-CSRF-Token", anon.csrf)
+		req.Header.Set("X-Forwarded-For", ip)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := login("203.0.113.1"); code != http.StatusUnauthorized {
+		t.Fatalf("first login = %d", code)
+	}
+	if code := login("203.0.113.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("login with a spoofed ip = %d", code)
+	}
+}
+
+func TestExport(t *testing.T) {
+	s := newSeededServer(t, true)
+	alice, bob := s.as(aliceID), s.as(bobID)
+	alice.createDDay(t, gin.H{"title": "Trip", "date": "20250101", "group": "personal"})
+
+	w := alice.do(http.MethodGet, "/api/user/export", nil)
+	expect(t, w, http.StatusOK, nil)
+	if w.Header().Get("Content-Type") != "application/zip" || !strings.Contains(w.Header().Get("Content-Disposition"), "calple-export-") {
+		t.Fatalf("export headers = %v", w.Header())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if !slices.Contains(names, "ddays.csv") || !slices.Contains(names, "manifest.json") {
+		t.Errorf("export files = %v", names)
+	}
+
+	// the job can be polled and downloaded again, only by its owner
+	job, err := s.exports.Start(aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.exports.Wait(context.Background(), aliceID, job.ID)
+	var status struct {
+		Job struct {
+			Status string `json:"status"`
+		} `json:"job"`
+		DownloadURL string `json:"downloadUrl"`
+	}
+	expect(t, alice.do(http.MethodGet, "/api/user/export/"+job.ID, nil), http.StatusOK, &status)
+	if status.Job.Status != "done" {
+		t.Fatalf("status = %+v", status)
+	}
+	expect(t, alice.do(http.MethodGet, status.DownloadURL, nil), http.StatusOK, nil)
+	expect(t, bob.do(http.MethodGet, "/api/user/export/"+job.ID, nil), http.StatusNotFound, nil)
+	expect(t, bob.do(http.MethodGet, status.DownloadURL, nil), http.StatusNotFound, nil)
+}
+
+func TestImport(t *testing.T) {
+	s := newSeededServer(t, false)
+	alice := s.as(aliceID)
+	alice.do(http.MethodPost, "/api/checkin", gin.H{"date": "2025-01-01", "mood": "happy", "energy": "high"})
+	alice.createDDay(t, gin.H{"title": "Trip", "date": "20250101"})
+
+	w := alice.do(http.MethodGet, "/api/user/export", nil)
+	expect(t, w, http.StatusOK, nil)
+	archive := w.Body.Bytes()
+
+	// bob takes over alice's data, a dry run first
+	bob := s.as(bobID)
+	type report struct {
+		Report struct {
+			DryRun   bool
+			Sections map[string]struct{ Created, Updated, Skipped int }
+		}
+	}
+	var out report
+	expect(t, bob.do(http.MethodPost, "/api/user/import?dryRun=true", archive), http.StatusOK, &out)
+	if !out.Report.DryRun || out.Report.Sections["ddays"].Created != 1 || out.Report.Sections["checkins"].Created != 1 {
+		t.Fatalf("dry run = %+v", out.Report)
+	}
+	if ddays := bob.listDDays(t, "202501"); len(ddays) != 0 {
+		t.Fatalf("dry run wrote %d events", len(ddays))
+	}
+
+	out = report{}
+	expect(t, bob.do(http.MethodPost, "/api/user/import?sections=ddays", archive), http.StatusOK, &out)
+	if _, ok := out.Report.Sections["checkins"]; ok || out.Report.Sections["ddays"].Created != 1 {
+		t.Fatalf("import = %+v", out.Report)
+	}
+	if ddays := bob.listDDays(t, "202501"); len(ddays) != 1 || ddays[0].CreatedBy != bobEmail {
+		t.Fatalf("imported events = %+v", ddays)
+	}
+	out = report{}
+	expect(t, bob.do(http.MethodPost, "/api/user/import?sections=ddays", archive), http.StatusOK, &out)
+	if out.Report.Sections["ddays"].Skipped != 1 {
+		t.Errorf("second import = %+v", out.Report)
+	}
+
+	expect(t, bob.do(http.MethodPost, "/api/user/import?conflict=merge", archive), http.StatusBadRequest, nil)
+	expect(t, bob.do(http.MethodPost, "/api/user/import?sections=ideas", archive), http.StatusBadRequest, nil)
+	expect(t, bob.do(http.MethodPost, "/api/user/import", []byte("not a zip")), http.StatusBadRequest, nil)
+}
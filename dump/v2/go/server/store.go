@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"calple/accounts"
+	"calple/firebase"
+	"calple/store"
+	"calple/store/fsstore"
+	"calple/store/memstore"
+	"calple/store/sqlstore"
+)
+
+// OpenStore opens the storage backend picked in the config
+// firestore is the default, memory and sqlite run without any credentials
+func OpenStore(ctx context.Context, cfg *Config) (store.Store, error) {
+	switch cfg.Storage {
+	case "firestore":
+		fsClient, err := firebase.InitFirebase(ctx, cfg.Firebase.CredentialsJSON, cfg.Firebase.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		// documents written by older versions are brought up to date with cmd/migrate
+		return fsstore.New(fsClient), nil
+	case "memory":
+		fmt.Printf("DEBUG: Using in-memory storage, data is lost on restart\n")
+		return memstore.New(), nil
+	case "sqlite":
+		fmt.Printf("DEBUG: Using sqlite storage at %s\n", cfg.SQLitePath)
+		return sqlstore.OpenSQLite(ctx, cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("unknown storage %q, use firestore, memory or sqlite", cfg.Storage)
+	}
+}
+
+// NewPurger purges the accounts whose deletion grace period is over
+// the images of their ddays are deleted from the r2 bucket
+func NewPurger(cfg *Config, st store.Store) *accounts.Purger {
+	return &accounts.Purger{Store: st, Images: cfg.bucket()}
+}
@@ -0,0 +1,221 @@
+// Package sessionstore keeps sessions on the server so they can be listed and revoked
+// it plugs into gin-contrib/sessions, handlers keep using sessions.Default
+// and the sessions are saved through store.SessionRepo of whichever backend is configured
+package sessionstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	ginsessions "github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	"calple/store"
+	"calple/util"
+)
+
+// the session values that have a meaning for the store
+const (
+	userIDKey   = "user_id"
+	rememberKey = "remember" // "true" keeps the session for RememberFor instead of IdleTimeout
+)
+
+// browsers cap cookies at 400 days, the server side expiry is what ends a remembered session
+const rememberCookieMaxAge = 400 * 24 * 60 * 60
+
+// last seen is only for display, a minute of precision saves a write per request
+const touchInterval = time.Minute
+
+// Store implements gin-contrib's sessions.Store
+type Store struct {
+	repo    store.SessionRepo
+	options sessions.Options
+
+	// sessions expire after this long without a request
+	IdleTimeout time.Duration
+	// same for sessions signed in with remember me
+	RememberFor time.Duration
+}
+
+func New(repo store.SessionRepo) *Store {
+	return &Store{
+		repo:        repo,
+		options:     sessions.Options{Path: "/", HttpOnly: true},
+		IdleTimeout: 12 * time.Hour,
+		RememberFor: 30 * 24 * time.Hour,
+	}
+}
+
+// PublicID is the stored ID of the session with the given cookie secret
+// handlers compare it with the listed sessions to find the current one
+func PublicID(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) Options(options ginsessions.Options) {
+	s.options = *options.ToGorillaOptions()
+}
+
+// Get returns the session cached for the request, loading it on first use
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of the cookie or starts an empty one
+// a missing, revoked or expired session is not an error, it is just empty
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := s.options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return session, nil
+	}
+
+	ctx := r.Context()
+	sess, err := s.repo.Get(ctx, PublicID(cookie.Value))
+	if errors.Is(err, store.ErrNotFound) {
+		return session, nil
+	}
+	if err != nil {
+		return session, fmt.Errorf("load session: %w", err)
+	}
+
+	now := time.Now()
+	if now.After(sess.ExpiresAt) {
+		s.repo.Delete(ctx, sess.ID)
+		return session, nil
+	}
+
+	session.ID = cookie.Value
+	session.IsNew = false
+	for k, v := range sess.Values {
+		session.Values[k] = v
+	}
+
+	// slide the expiry, the cookie itself does not change
+	if now.Sub(sess.LastSeenAt) > touchInterval {
+		sess.LastSeenAt = now
+		sess.ExpiresAt = now.Add(s.ttl(sess.Remember))
+		if err := s.repo.Save(ctx, sess); err != nil {
+			fmt.Printf("ERROR: failed to update session last seen: %v\n", err)
+		}
+	}
+	return session, nil
+}
+
+// Save writes the session and its cookie
+// an empty session, like after Clear on logout, is deleted
+// a change of user gets a new session ID so an ID planted before sign in is worthless
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx := r.Context()
+
+	values := make(map[string]string, len(session.Values))
+	for k, v := range session.Values {
+		key, ok := k.(string)
+		value, ok2 := v.(string)
+		if !ok || !ok2 {
+			return fmt.Errorf("sessionstore: only string keys and values are supported, got %T: %T", k, v)
+		}
+		values[key] = value
+	}
+
+	if session.Options.MaxAge < 0 || len(values) == 0 {
+		if session.ID != "" {
+			if err := s.repo.Delete(ctx, PublicID(session.ID)); err != nil {
+				return err
+			}
+		}
+		session.ID = ""
+		options := *session.Options
+		options.MaxAge = -1
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", &options))
+		return nil
+	}
+
+	now := time.Now()
+	var sess *store.Session
+	if session.ID != "" {
+		var err error
+		sess, err = s.repo.Get(ctx, PublicID(session.ID))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	if sess == nil || sess.UserID != values[userIDKey] {
+		if sess != nil {
+			if err := s.repo.Delete(ctx, sess.ID); err != nil {
+				return err
+			}
+		}
+		secret, err := util.RandomToken(32)
+		if err != nil {
+			return err
+		}
+		session.ID = secret
+		sess = &store.Session{ID: PublicID(secret), CreatedAt: now}
+	}
+
+	sess.UserID = values[userIDKey]
+	sess.Values = values
+	sess.Remember = values[rememberKey] == "true"
+	sess.UserAgent = r.UserAgent()
+	sess.IP = clientIP(r)
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(s.ttl(sess.Remember))
+	if err := s.repo.Save(ctx, sess); err != nil {
+		return err
+	}
+
+	// without remember me the cookie ends with the browser session
+	options := *session.Options
+	options.MaxAge = 0
+	if sess.Remember {
+		options.MaxAge = rememberCookieMaxAge
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, &options))
+	session.IsNew = false
+	return nil
+}
+
+func (s *Store) ttl(remember bool) time.Duration {
+	if remember {
+		return s.RememberFor
+	}
+	return s.IdleTimeout
+}
+
+type clientIPKey struct{}
+
+// ClientIP passes the address gin resolved for the request on to the store
+// gin only reads X-Forwarded-For from the trusted proxies, so a client cannot pick what the device list shows
+// it has to run before the sessions middleware, which keeps the request it was given
+func ClientIP(c *gin.Context) {
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), clientIPKey{}, c.ClientIP()))
+	c.Next()
+}
+
+// the address shown in the device list, without the ClientIP middleware it is the connection's
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok && ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
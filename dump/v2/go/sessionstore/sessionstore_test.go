@@ -0,0 +1,134 @@
+package sessionstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"calple/store"
+	"calple/store/memstore"
+)
+
+// roundTrip loads the session for cookie, lets edit change it and saves it
+// it returns the cookie the browser would get back
+func roundTrip(t *testing.T, s *Store, cookie *http.Cookie, edit func(values map[any]any)) *http.Cookie {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	session, err := s.New(r, "calple_session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(session.Values)
+
+	w := httptest.NewRecorder()
+	if err := s.Save(r, w, session); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("want one cookie, got %v", cookies)
+	}
+	return cookies[0]
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	st := memstore.New()
+	s := New(st.Sessions())
+	ctx := context.Background()
+
+	// the oauth state is kept before sign in
+	anon := roundTrip(t, s, nil, func(v map[any]any) { v["state"] = "123" })
+	if _, err := st.Sessions().Get(ctx, PublicID(anon.Value)); err != nil {
+		t.Fatalf("anonymous session not stored: %v", err)
+	}
+
+	// signing in moves to a new ID and keeps the values
+	signedIn := roundTrip(t, s, anon, func(v map[any]any) {
+		if v["state"] != "123" {
+			t.Fatalf("values not loaded: %v", v)
+		}
+		v["user_id"] = "alice"
+		v["remember"] = "true"
+	})
+	if signedIn.Value == anon.Value {
+		t.Fatal("session ID was not rotated on sign in")
+	}
+	if _, err := st.Sessions().Get(ctx, PublicID(anon.Value)); err != store.ErrNotFound {
+		t.Fatalf("old session still stored: %v", err)
+	}
+	if signedIn.MaxAge != rememberCookieMaxAge {
+		t.Fatalf("remember me cookie max age = %d", signedIn.MaxAge)
+	}
+	sess, err := st.Sessions().Get(ctx, PublicID(signedIn.Value))
+	if err != nil || sess.UserID != "alice" || !sess.Remember || sess.ExpiresAt.Before(time.Now().Add(29*24*time.Hour)) {
+		t.Fatalf("stored session = %+v, %v", sess, err)
+	}
+
+	// an expired session loads empty
+	sess.ExpiresAt = time.Now().Add(-time.Minute)
+	st.Sessions().Save(ctx, sess)
+	roundTrip(t, s, signedIn, func(v map[any]any) {
+		if len(v) != 0 {
+			t.Fatalf("expired session has values: %v", v)
+		}
+		v["user_id"] = "alice"
+	})
+
+	// clearing the session deletes it
+	current := roundTrip(t, s, nil, func(v map[any]any) { v["user_id"] = "bob" })
+	if current.MaxAge != 0 {
+		t.Fatalf("session cookie max age = %d", current.MaxAge)
+	}
+	cleared := roundTrip(t, s, current, func(v map[any]any) { delete(v, "user_id") })
+	if cleared.MaxAge >= 0 {
+		t.Fatalf("cleared cookie max age = %d", cleared.MaxAge)
+	}
+	if list, _ := st.Sessions().ListByUser(ctx, "bob"); len(list) != 0 {
+		t.Fatalf("bob sessions after clear = %+v", list)
+	}
+
+	// sessions nobody comes back to are swept
+	roundTrip(t, s, nil, func(v map[any]any) { v["csrf_token"] = "abc" })
+	if n, err := st.Sessions().DeleteExpired(ctx, time.Now()); err != nil || n != 0 {
+		t.Fatalf("DeleteExpired now = %d, %v", n, err)
+	}
+	if n, err := st.Sessions().DeleteExpired(ctx, time.Now().Add(s.IdleTimeout+time.Minute)); err != nil || n != 2 {
+		t.Fatalf("DeleteExpired later = %d, %v", n, err)
+	}
+}
+
+// the address comes from gin, which only believes X-Forwarded-For from trusted proxies
+func TestClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		trusted []string
+		want    string
+	}{
+		{nil, "192.0.2.1"},
+		{[]string{"192.0.2.1"}, "203.0.113.9"},
+	} {
+		c, engine := gin.CreateTestContext(httptest.NewRecorder())
+		if err := engine.SetTrustedProxies(tc.trusted); err != nil {
+			t.Fatal(err)
+		}
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.RemoteAddr = "192.0.2.1:4321"
+		c.Request.Header.Set("X-Forwarded-For", "203.0.113.9")
+		ClientIP(c)
+		if got := clientIP(c.Request); got != tc.want {
+			t.Errorf("trusting %v: client ip = %s, want %s", tc.trusted, got, tc.want)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	if got := clientIP(r); got != "192.0.2.1" {
+		t.Errorf("without the middleware client ip = %s", got)
+	}
+}
@@ -0,0 +1,71 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type checkinRepo struct {
+	client *firestore.Client
+}
+
+func (r checkinRepo) List(ctx context.Context, uid string) ([]store.Checkin, error) {
+	docs, err := userSub(r.client, uid, "checkins").OrderBy("date", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.Checkin, 0, len(docs))
+	for _, doc := range docs {
+		var ci store.Checkin
+		if err := doc.DataTo(&ci); err != nil {
+			return nil, err
+		}
+		ci.ID = doc.Ref.ID
+		ci.UserID = uid
+		out = append(out, ci)
+	}
+	return out, nil
+}
+
+func (r checkinRepo) GetByDate(ctx context.Context, uid, date string) (*store.Checkin, error) {
+	docs, err := userSub(r.client, uid, "checkins").Where("date", "==", date).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, store.ErrNotFound
+	}
+
+	var ci store.Checkin
+	if err := docs[0].DataTo(&ci); err != nil {
+		return nil, err
+	}
+	ci.ID = docs[0].Ref.ID
+	ci.UserID = uid
+	return &ci, nil
+}
+
+func (r checkinRepo) Save(ctx context.Context, uid string, ci *store.Checkin) error {
+	col := userSub(r.client, uid, "checkins")
+	var ref *firestore.DocumentRef
+	if ci.ID == "" {
+		ref = col.NewDoc()
+	} else {
+		ref = col.Doc(ci.ID)
+	}
+
+	ci.UserID = uid
+	if _, err := ref.Set(ctx, ci); err != nil {
+		return err
+	}
+	ci.ID = ref.ID
+	return nil
+}
+
+func (r checkinRepo) Delete(ctx context.Context, uid, id string) error {
+	_, err := userSub(r.client, uid, "checkins").Doc(id).Delete(ctx)
+	return err
+}
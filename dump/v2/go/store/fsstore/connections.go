@@ -0,0 +1,183 @@
+package fsstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type connectionRepo struct {
+	client *firestore.Client
+}
+
+func (r connectionRepo) Get(ctx context.Context, uid, id string) (*store.Connection, error) {
+	doc, err := userSub(r.client, uid, "connections").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return decodeConnection(doc)
+}
+
+func (r connectionRepo) List(ctx context.Context, uid string) ([]store.Connection, error) {
+	docs, err := userSub(r.client, uid, "connections").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return decodeConnections(docs)
+}
+
+func (r connectionRepo) ListByStatus(ctx context.Context, uid, status string) ([]store.Connection, error) {
+	docs, err := userSub(r.client, uid, "connections").Where("status", "==", status).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return decodeConnections(docs)
+}
+
+func (r connectionRepo) Active(ctx context.Context, uid string) (*store.Connection, error) {
+	docs, err := userSub(r.client, uid, "connections").Where("status", "==", store.StatusActive).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return decodeConnection(docs[0])
+}
+
+func (r connectionRepo) FindByPartner(ctx context.Context, uid, partnerUID string) (*store.Connection, error) {
+	docs, err := userSub(r.client, uid, "connections").Where("partnerUID", "==", partnerUID).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return decodeConnection(docs[0])
+}
+
+func (r connectionRepo) Invite(ctx context.Context, fromUID, fromEmail, toUID, toEmail string) (string, error) {
+	now := time.Now()
+	initiatorConnRef := userSub(r.client, fromUID, "connections").NewDoc()
+
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// document for initiator
+		if err := tx.Set(initiatorConnRef, map[string]interface{}{
+			"partnerEmail": toEmail,
+			"partnerUID":   toUID,
+			"role":         store.RoleInitiator,
+			"status":       store.StatusPending,
+			"createdAt":    now,
+			"updatedAt":    now,
+		}); err != nil {
+			return err
+		}
+
+		// document for target
+		targetConnRef := userSub(r.client, toUID, "connections").Doc(initiatorConnRef.ID)
+		return tx.Set(targetConnRef, map[string]interface{}{
+			"partnerEmail": fromEmail,
+			"partnerUID":   fromUID,
+			"role":         store.RoleReceiver,
+			"status":       store.StatusPending,
+			"createdAt":    now,
+			"updatedAt":    now,
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return initiatorConnRef.ID, nil
+}
+
+func (r connectionRepo) Accept(ctx context.Context, uid, partnerUID, id string) error {
+	now := time.Now()
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// update the current user's connection document
+		if err := tx.Update(userSub(r.client, uid, "connections").Doc(id), []firestore.Update{
+			{Path: "status", Value: store.StatusActive},
+			{Path: "updatedAt", Value: now},
+			{Path: "partnerUID", Value: partnerUID},
+		}); err != nil {
+			return err
+		}
+
+		// update the partner's connection document
+		return tx.Update(userSub(r.client, partnerUID, "connections").Doc(id), []firestore.Update{
+			{Path: "status", Value: store.StatusActive},
+			{Path: "updatedAt", Value: now},
+			{Path: "partnerUID", Value: uid},
+		})
+	})
+	// updating a missing side fails the whole transaction with NotFound
+	return wrapErr(err)
+}
+
+func (r connectionRepo) Remove(ctx context.Context, uid, partnerUID, id string) error {
+	connRef := userSub(r.client, uid, "connections").Doc(id)
+	if partnerUID == "" {
+		_, err := connRef.Delete(ctx)
+		return err
+	}
+
+	return r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Delete(connRef); err != nil {
+			return err
+		}
+		return tx.Delete(userSub(r.client, partnerUID, "connections").Doc(id))
+	})
+}
+
+// the collection group finds connection documents under user documents that no longer exist
+func (r connectionRepo) Owners(ctx context.Context) ([]string, error) {
+	docs, err := r.client.CollectionGroup("connections").Select().Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return parentIDs(docs, "users"), nil
+}
+
+// the partner's side of each connection lives in the partner's subcollection under the same ID
+func (r connectionRepo) SetPartnerEmail(ctx context.Context, uid, email string) error {
+	conns, err := r.List(ctx, uid)
+	if err != nil {
+		return err
+	}
+	for _, conn := range conns {
+		if conn.PartnerUID == "" {
+			continue
+		}
+		_, err := userSub(r.client, conn.PartnerUID, "connections").Doc(conn.ID).Update(ctx, []firestore.Update{
+			{Path: "partnerEmail", Value: email},
+		})
+		if err != nil && !errors.Is(wrapErr(err), store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeConnection(doc *firestore.DocumentSnapshot) (*store.Connection, error) {
+	var conn store.Connection
+	if err := doc.DataTo(&conn); err != nil {
+		return nil, err
+	}
+	conn.ID = doc.Ref.ID
+	return &conn, nil
+}
+
+func decodeConnections(docs []*firestore.DocumentSnapshot) ([]store.Connection, error) {
+	out := make([]store.Connection, 0, len(docs))
+	for _, doc := range docs {
+		conn, err := decodeConnection(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *conn)
+	}
+	return out, nil
+}
@@ -0,0 +1,179 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type ddayRepo struct {
+	client *firestore.Client
+}
+
+func (r ddayRepo) Get(ctx context.Context, id string) (*store.DDay, error) {
+	doc, err := r.client.Collection("ddays").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return decodeDDay(doc)
+}
+
+// firestore allows one range filter per query and no OR across fields,
+// so visible events are the merge of three queries
+func (r ddayRepo) ListVisible(ctx context.Context, uid, until string) ([]store.DDay, error) {
+	col := r.client.Collection("ddays")
+	queries := []firestore.Query{
+		// Q1: events created by the user that start before until
+		col.Where("creatorId", "==", uid).Where("date", "<=", until),
+		// Q2: events shared with the user that start before until
+		col.Where("sharedWith", "array-contains", uid).Where("date", "<=", until),
+		// Q3: annual events created by the user
+		col.Where("creatorId", "==", uid).Where("isAnnual", "==", true),
+	}
+
+	out := []store.DDay{}
+	seen := make(map[string]bool)
+	for _, q := range queries {
+		docs, err := q.Documents(ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			if seen[doc.Ref.ID] {
+				continue
+			}
+			seen[doc.Ref.ID] = true
+
+			d, err := decodeDDay(doc)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, *d)
+		}
+	}
+	return out, nil
+}
+
+func (r ddayRepo) ListByCreator(ctx context.Context, uid string) ([]store.DDay, error) {
+	docs, err := r.client.Collection("ddays").Where("creatorId", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.DDay, 0, len(docs))
+	for _, doc := range docs {
+		d, err := decodeDDay(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, nil
+}
+
+func (r ddayRepo) ListPending(ctx context.Context, email string) ([]store.DDay, error) {
+	docs, err := r.client.Collection("ddays").Where("pendingUsers", "array-contains", email).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.DDay, 0, len(docs))
+	for _, doc := range docs {
+		d, err := decodeDDay(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, nil
+}
+
+func (r ddayRepo) List(ctx context.Context, after string, limit int) ([]store.DDay, error) {
+	q := r.client.Collection("ddays").OrderBy(firestore.DocumentID, firestore.Asc).Limit(limit)
+	if after != "" {
+		q = q.StartAfter(after)
+	}
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.DDay, 0, len(docs))
+	for _, doc := range docs {
+		d, err := decodeDDay(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, nil
+}
+
+func (r ddayRepo) Create(ctx context.Context, d *store.DDay) error {
+	setEmptyShares(d)
+	ref, _, err := r.client.Collection("ddays").Add(ctx, d)
+	if err != nil {
+		return err
+	}
+	d.ID = ref.ID
+	return nil
+}
+
+func (r ddayRepo) Update(ctx context.Context, d *store.DDay) error {
+	setEmptyShares(d)
+	_, err := r.client.Collection("ddays").Doc(d.ID).Set(ctx, d)
+	return err
+}
+
+func (r ddayRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.client.Collection("ddays").Doc(id).Delete(ctx)
+	return err
+}
+
+func (r ddayRepo) HideMilestone(ctx context.Context, uid, key string) error {
+	_, err := userSub(r.client, uid, "hiddenMilestones").Doc(key).Set(ctx, map[string]interface{}{
+		"key": key,
+	})
+	return err
+}
+
+func (r ddayRepo) ShowMilestone(ctx context.Context, uid, key string) error {
+	_, err := userSub(r.client, uid, "hiddenMilestones").Doc(key).Delete(ctx)
+	return err
+}
+
+func (r ddayRepo) ListHiddenMilestones(ctx context.Context, uid string) ([]string, error) {
+	docs, err := userSub(r.client, uid, "hiddenMilestones").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		out = append(out, doc.Ref.ID)
+	}
+	return out, nil
+}
+
+func decodeDDay(doc *firestore.DocumentSnapshot) (*store.DDay, error) {
+	var d store.DDay
+	if err := doc.DataTo(&d); err != nil {
+		return nil, err
+	}
+	d.ID = doc.Ref.ID
+
+	// events created before the editable flag existed are editable
+	if _, ok := doc.Data()["editable"]; !ok {
+		d.Editable = true
+	}
+	setEmptyShares(&d)
+	return &d, nil
+}
+
+// the lists are always written so the array-contains query sees every event
+func setEmptyShares(d *store.DDay) {
+	if d.ConnectedUsers == nil {
+		d.ConnectedUsers = []string{}
+	}
+	if d.SharedWith == nil {
+		d.SharedWith = []string{}
+	}
+}
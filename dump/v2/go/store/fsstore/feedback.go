@@ -0,0 +1,73 @@
+package fsstore
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type feedbackRepo struct {
+	client *firestore.Client
+}
+
+func (r feedbackRepo) Create(ctx context.Context, uid string, f *store.Feedback) error {
+	ref, _, err := userSub(r.client, uid, "feedback").Add(ctx, f)
+	if err != nil {
+		return err
+	}
+	f.ID = ref.ID
+	return nil
+}
+
+func (r feedbackRepo) ListByUser(ctx context.Context, uid string) ([]store.Feedback, error) {
+	docs, err := userSub(r.client, uid, "feedback").OrderBy("submittedAt", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return decodeFeedback(docs)
+}
+
+// ordered here, ordering the collection group would need its own index
+func (r feedbackRepo) List(ctx context.Context) ([]store.Feedback, error) {
+	docs, err := r.client.CollectionGroup("feedback").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out, err := decodeFeedback(docs)
+	if err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		out[i].UserID = doc.Ref.Parent.Parent.ID
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].SubmittedAt.Equal(out[j].SubmittedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].SubmittedAt.Before(out[j].SubmittedAt)
+	})
+	return out, nil
+}
+
+func (r feedbackRepo) SetAdminComment(ctx context.Context, uid, id, comment string) error {
+	_, err := userSub(r.client, uid, "feedback").Doc(id).Update(ctx, []firestore.Update{
+		{Path: "adminComment", Value: comment},
+	})
+	return wrapErr(err)
+}
+
+func decodeFeedback(docs []*firestore.DocumentSnapshot) ([]store.Feedback, error) {
+	out := make([]store.Feedback, 0, len(docs))
+	for _, doc := range docs {
+		var f store.Feedback
+		if err := doc.DataTo(&f); err != nil {
+			return nil, err
+		}
+		f.ID = doc.Ref.ID
+		out = append(out, f)
+	}
+	return out, nil
+}
@@ -0,0 +1,52 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+// the documents are keyed by user ID, the secret is found by a query on its hash
+type feedRepo struct {
+	client *firestore.Client
+}
+
+func (r feedRepo) Get(ctx context.Context, uid string) (*store.Feed, error) {
+	doc, err := r.client.Collection("feeds").Doc(uid).Get(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return decodeFeed(doc)
+}
+
+func (r feedRepo) GetByHash(ctx context.Context, hash string) (*store.Feed, error) {
+	docs, err := r.client.Collection("feeds").Where("hash", "==", hash).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return decodeFeed(docs[0])
+}
+
+func (r feedRepo) Save(ctx context.Context, f *store.Feed) error {
+	_, err := r.client.Collection("feeds").Doc(f.UserID).Set(ctx, f)
+	return err
+}
+
+func (r feedRepo) Delete(ctx context.Context, uid string) error {
+	_, err := r.client.Collection("feeds").Doc(uid).Delete(ctx)
+	return err
+}
+
+func decodeFeed(doc *firestore.DocumentSnapshot) (*store.Feed, error) {
+	var f store.Feed
+	if err := doc.DataTo(&f); err != nil {
+		return nil, err
+	}
+	f.UserID = doc.Ref.ID
+	return &f, nil
+}
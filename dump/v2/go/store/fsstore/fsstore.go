@@ -0,0 +1,112 @@
+// Package fsstore implements store.Store on top of Cloud Firestore
+package fsstore
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"calple/store"
+)
+
+type Store struct {
+	client *firestore.Client
+}
+
+func New(client *firestore.Client) *Store {
+	return &Store{client: client}
+}
+
+func (s *Store) Users() store.UserRepo             { return userRepo{s.client} }
+func (s *Store) Connections() store.ConnectionRepo { return connectionRepo{s.client} }
+func (s *Store) DDays() store.DDayRepo             { return ddayRepo{s.client} }
+func (s *Store) Periods() store.PeriodRepo         { return periodRepo{s.client} }
+func (s *Store) Checkins() store.CheckinRepo       { return checkinRepo{s.client} }
+func (s *Store) Pins() store.PinRepo               { return pinRepo{s.client} }
+func (s *Store) Ideas() store.IdeaRepo             { return ideaRepo{s.client} }
+func (s *Store) Roulette() store.RouletteRepo      { return rouletteRepo{s.client} }
+func (s *Store) Feedback() store.FeedbackRepo      { return feedbackRepo{s.client} }
+func (s *Store) Tokens() store.TokenRepo           { return tokenRepo{s.client} }
+func (s *Store) Feeds() store.FeedRepo             { return feedRepo{s.client} }
+func (s *Store) Identities() store.IdentityRepo    { return identityRepo{s.client} }
+func (s *Store) LoginTokens() store.LoginTokenRepo { return loginTokenRepo{s.client} }
+func (s *Store) Sessions() store.SessionRepo       { return sessionRepo{s.client} }
+func (s *Store) Migrations() store.MigrationRepo   { return migrationRepo{s.client} }
+
+// Ping reads a document that is not expected to exist
+// a NotFound answer still means firestore is reachable
+func (s *Store) Ping(ctx context.Context) error {
+	_, err := s.client.Collection("_health_check").Doc("test").Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) Close() error {
+	return s.client.Close()
+}
+
+// translate firestore NotFound errors to store.ErrNotFound
+func wrapErr(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// helper to access a subcollection of a user document
+func userSub(client *firestore.Client, uid, name string) *firestore.CollectionRef {
+	return client.Collection("users").Doc(uid).Collection(name)
+}
+
+// parentIDs returns the sorted, distinct IDs of the documents in the parent collection
+// that hold the given subcollection documents, like the users of users/{uid}/connections
+func parentIDs(docs []*firestore.DocumentSnapshot, parent string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, doc := range docs {
+		owner := doc.Ref.Parent.Parent
+		if owner == nil || owner.Parent.ID != parent || seen[owner.ID] {
+			continue
+		}
+		seen[owner.ID] = true
+		out = append(out, owner.ID)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// deleteDocument deletes the document with all of its subcollections, depth first
+// firestore leaves subcollections behind when only the parent document is deleted
+func deleteDocument(ctx context.Context, ref *firestore.DocumentRef) error {
+	collections, err := ref.Collections(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, col := range collections {
+		if err := deleteCollection(ctx, col); err != nil {
+			return err
+		}
+	}
+	_, err = ref.Delete(ctx)
+	return err
+}
+
+// deleteCollection deletes every document in the collection with its subcollections
+// the refs include documents that were deleted while their subcollections were not
+func deleteCollection(ctx context.Context, col *firestore.CollectionRef) error {
+	refs, err := col.DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := deleteDocument(ctx, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
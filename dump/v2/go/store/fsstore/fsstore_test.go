@@ -0,0 +1,598 @@
+package fsstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+// these tests run against the firestore emulator and are skipped without it
+//
+//	gcloud emulators firestore start --host-port=localhost:8080
+//	FIRESTORE_EMULATOR_HOST=localhost:8080 go test ./store/fsstore/
+
+const (
+	aliceID = "alice-uid"
+	bobID   = "bob-uid"
+	carolID = "carol-uid"
+
+	aliceEmail = "alice@example.com"
+	bobEmail   = "bob@example.com"
+	carolEmail = "carol@example.com"
+)
+
+func emulatorProject() string {
+	if project := os.Getenv("FIRESTORE_PROJECT_ID"); project != "" {
+		return project
+	}
+	return "calple-test"
+}
+
+// newTestStore connects to the emulator, wipes it and seeds the three users
+func newTestStore(t *testing.T) (*Store, *firestore.Client) {
+	t.Helper()
+	host := os.Getenv("FIRESTORE_EMULATOR_HOST")
+	if host == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set")
+	}
+
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, emulatorProject())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	// the emulator exposes an endpoint that deletes every document
+	url := fmt.Sprintf("http://%s/emulator/v1/projects/%s/databases/(default)/documents", host, emulatorProject())
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("reset emulator: %v", err)
+	}
+	res.Body.Close()
+
+	st := New(client)
+	for _, u := range []store.User{
+		{ID: aliceID, Email: aliceEmail, Name: "Alice", Sex: "female"},
+		{ID: bobID, Email: bobEmail, Name: "Bob", Sex: "male"},
+		{ID: carolID, Email: carolEmail, Name: "Carol", Sex: "female"},
+	} {
+		if err := st.Users().Save(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st, client
+}
+
+// connect makes alice and bob partners and returns the connection ID
+func connect(t *testing.T, st *Store) string {
+	t.Helper()
+	ctx := context.Background()
+	id, err := st.Connections().Invite(ctx, aliceID, aliceEmail, bobID, bobEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Connections().Accept(ctx, bobID, aliceID, id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestUsers(t *testing.T) {
+	st, client := newTestStore(t)
+	ctx := context.Background()
+
+	u, err := st.Users().GetByEmail(ctx, bobEmail)
+	if err != nil || u.ID != bobID || u.Name != "Bob" {
+		t.Fatalf("GetByEmail = %+v, %v", u, err)
+	}
+	if _, err := st.Users().GetByEmail(ctx, "ghost@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetByEmail missing: %v", err)
+	}
+	if _, err := st.Users().Get(ctx, "ghost"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get missing: %v", err)
+	}
+
+	// Save merges, unknown fields survive while tokens are removed by a save without them
+	if _, err := client.Collection("users").Doc(aliceID).Set(ctx, map[string]interface{}{"legacy": "kept"}, firestore.MergeAll); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ := st.Users().Get(ctx, aliceID)
+	alice.Tokens = &store.OAuthTokens{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now()}
+	if err := st.Users().Save(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	alice.Tokens = nil
+	alice.StartedDating = "02/14/2024"
+	if err := st.Users().Save(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := st.Users().Get(ctx, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tokens != nil || got.StartedDating != "02/14/2024" {
+		t.Fatalf("after merge = %+v", got)
+	}
+	doc, _ := client.Collection("users").Doc(aliceID).Get(ctx)
+	if doc.Data()["legacy"] != "kept" {
+		t.Error("Save dropped a field it does not know about")
+	}
+}
+
+func TestConnectionTransactions(t *testing.T) {
+	st, _ := newTestStore(t)
+	ctx := context.Background()
+	conns := st.Connections()
+
+	// InviteConnection: both sides pending with opposite roles
+	id, err := conns.Invite(ctx, aliceID, aliceEmail, bobID, bobEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine, err := conns.Get(ctx, aliceID, id)
+	if err != nil || mine.Role != store.RoleInitiator || mine.Status != store.StatusPending || mine.PartnerEmail != bobEmail {
+		t.Fatalf("initiator side = %+v, %v", mine, err)
+	}
+	theirs, err := conns.Get(ctx, bobID, id)
+	if err != nil || theirs.Role != store.RoleReceiver || theirs.Status != store.StatusPending || theirs.PartnerEmail != aliceEmail {
+		t.Fatalf("receiver side = %+v, %v", theirs, err)
+	}
+
+	pending, err := conns.ListByStatus(ctx, bobID, store.StatusPending)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending = %+v, %v", pending, err)
+	}
+	if _, err := conns.Active(ctx, bobID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Active before accept: %v", err)
+	}
+	if found, err := conns.FindByPartner(ctx, aliceID, bobID); err != nil || found.ID != id {
+		t.Fatalf("FindByPartner = %+v, %v", found, err)
+	}
+
+	// AcceptInvitation: a missing side aborts the transaction and changes nothing
+	if err := conns.Accept(ctx, bobID, carolID, id); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Accept with missing partner side: %v", err)
+	}
+	if theirs, _ := conns.Get(ctx, bobID, id); theirs.Status != store.StatusPending {
+		t.Fatalf("failed accept left receiver side %+v", theirs)
+	}
+
+	if err := conns.Accept(ctx, bobID, aliceID, id); err != nil {
+		t.Fatal(err)
+	}
+	for uid, partnerUID := range map[string]string{aliceID: bobID, bobID: aliceID} {
+		active, err := conns.Active(ctx, uid)
+		if err != nil || active.ID != id || active.PartnerUID != partnerUID {
+			t.Fatalf("active for %s = %+v, %v", uid, active, err)
+		}
+	}
+
+	// RejectInvitation: both sides are deleted together
+	if err := conns.Remove(ctx, bobID, aliceID, id); err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range []string{aliceID, bobID} {
+		if _, err := conns.Get(ctx, uid, id); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("connection of %s after remove: %v", uid, err)
+		}
+	}
+
+	// without a partner only the caller's side goes
+	id = connect(t, st)
+	if err := conns.Remove(ctx, aliceID, "", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns.Get(ctx, aliceID, id); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("caller side after remove: %v", err)
+	}
+	if _, err := conns.Get(ctx, bobID, id); err != nil {
+		t.Fatalf("partner side after one-sided remove: %v", err)
+	}
+}
+
+func TestDDayQueries(t *testing.T) {
+	st, client := newTestStore(t)
+	ctx := context.Background()
+	ddays := st.DDays()
+
+	create := func(d store.DDay) string {
+		t.Helper()
+		if err := ddays.Create(ctx, &d); err != nil {
+			t.Fatal(err)
+		}
+		return d.ID
+	}
+
+	ids := map[string]string{
+		// range filter on date
+		"own past":   create(store.DDay{Title: "own past", Date: "20250701", CreatorID: aliceID}),
+		"own future": create(store.DDay{Title: "own future", Date: "20250801", CreatorID: aliceID}),
+		// array-contains on sharedWith
+		"shared":        create(store.DDay{Title: "shared", Date: "20250705", CreatorID: bobID, SharedWith: []string{aliceID}}),
+		"shared future": create(store.DDay{Title: "shared future", Date: "20250805", CreatorID: bobID, SharedWith: []string{aliceID}}),
+		"not shared":    create(store.DDay{Title: "not shared", Date: "20250705", CreatorID: carolID, SharedWith: []string{bobID}}),
+		// annual events of the creator are returned whatever their date
+		"own annual":     create(store.DDay{Title: "own annual", Date: "20300101", IsAnnual: true, CreatorID: aliceID}),
+		"partner annual": create(store.DDay{Title: "partner annual", Date: "20300101", IsAnnual: true, CreatorID: bobID, SharedWith: []string{aliceID}}),
+		// matched by two of the queries, returned once
+		"own and shared": create(store.DDay{Title: "own and shared", Date: "20250702", CreatorID: aliceID, SharedWith: []string{aliceID}}),
+	}
+
+	visible, err := ddays.ListVisible(ctx, aliceID, "20250731")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, d := range visible {
+		got[d.Title]++
+	}
+	want := map[string]int{"own past": 1, "shared": 1, "own annual": 1, "own and shared": 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ListVisible = %v, want %v", got, want)
+	}
+
+	byCreator, err := ddays.ListByCreator(ctx, bobID)
+	if err != nil || len(byCreator) != 3 {
+		t.Fatalf("ListByCreator = %d events, %v", len(byCreator), err)
+	}
+
+	// documents written before the editable flag existed are editable
+	if _, err := client.Collection("ddays").Doc("legacy").Set(ctx, map[string]interface{}{
+		"title":     "legacy",
+		"date":      "20250703",
+		"createdBy": aliceEmail,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := ddays.Get(ctx, "legacy")
+	if err != nil || !legacy.Editable || legacy.ConnectedUsers == nil {
+		t.Fatalf("legacy event = %+v, %v", legacy, err)
+	}
+
+	if err := ddays.Delete(ctx, ids["own past"]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ddays.Get(ctx, ids["own past"]); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after delete: %v", err)
+	}
+}
+
+func TestIdeaCounters(t *testing.T) {
+	st, client := newTestStore(t)
+	ctx := context.Background()
+	ideas := st.Ideas()
+
+	post := store.Idea{Title: "Picnic", Author: "Alice", Tags: []string{}, Comments: []store.Comment{}}
+	if err := ideas.Create(ctx, aliceID, &post); err != nil {
+		t.Fatal(err)
+	}
+
+	// likes from the author and from someone without a mirror of the post
+	for _, like := range []struct {
+		uid   string
+		delta int
+	}{{aliceID, 1}, {bobID, 1}, {carolID, 1}, {bobID, -1}} {
+		if err := ideas.AddLikes(ctx, like.uid, post.ID, like.delta); err != nil {
+			t.Fatalf("AddLikes(%s, %d): %v", like.uid, like.delta, err)
+		}
+	}
+	if err := ideas.AddLikes(ctx, aliceID, "missing", 1); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("AddLikes on missing post: %v", err)
+	}
+
+	all, err := ideas.List(ctx)
+	if err != nil || len(all) != 1 || all[0].Likes != 2 {
+		t.Fatalf("List = %+v, %v", all, err)
+	}
+	// only the author's own likes reach the mirror
+	mine, err := ideas.ListByAuthor(ctx, aliceID)
+	if err != nil || len(mine) != 1 || mine[0].Likes != 1 {
+		t.Fatalf("ListByAuthor = %+v, %v", mine, err)
+	}
+
+	commentsCount := func() int64 {
+		t.Helper()
+		doc, err := client.Collection("ideas").Doc(post.ID).Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := doc.Data()["comments_count"].(int64)
+		return n
+	}
+
+	first := store.Comment{Author: bobID, Content: "count me in"}
+	second := store.Comment{Author: carolID, Content: "me too"}
+	if err := ideas.AddComment(ctx, bobID, post.ID, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := ideas.AddComment(ctx, carolID, post.ID, &second); err != nil {
+		t.Fatal(err)
+	}
+	if n := commentsCount(); n != 2 {
+		t.Fatalf("comments_count = %d, want 2", n)
+	}
+
+	first.Content = "edited"
+	if err := ideas.UpdateComment(ctx, post.ID, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := ideas.DeleteComment(ctx, carolID, post.ID, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := commentsCount(); n != 1 {
+		t.Fatalf("comments_count after delete = %d, want 1", n)
+	}
+	comments, err := ideas.ListComments(ctx, post.ID)
+	if err != nil || len(comments) != 1 || comments[0].Content != "edited" {
+		t.Fatalf("ListComments = %+v, %v", comments, err)
+	}
+
+	// posts written before the counters used the go field name
+	if _, err := client.Collection("ideas").Doc("legacy").Set(ctx, map[string]interface{}{
+		"Title": "Old post",
+		"Likes": 5,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	all, _ = ideas.List(ctx)
+	for _, idea := range all {
+		if idea.ID == "legacy" && idea.Likes != 5 {
+			t.Fatalf("legacy post likes = %d, want 5", idea.Likes)
+		}
+	}
+}
+
+func TestPerUserOrdering(t *testing.T) {
+	st, _ := newTestStore(t)
+	ctx := context.Background()
+	base := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, title := range []string{"first", "second", "third"} {
+		at := base.Add(time.Duration(i) * time.Hour)
+		if err := st.Pins().Create(ctx, aliceID, &store.Pin{Title: title, CreatedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Feedback().Create(ctx, aliceID, &store.Feedback{FeedbackText: title, SubmittedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pins, err := st.Pins().List(ctx, aliceID)
+	if err != nil || len(pins) != 3 || pins[0].Title != "third" {
+		t.Fatalf("pins = %+v, %v", pins, err)
+	}
+	if err := st.Pins().Update(ctx, aliceID, &store.Pin{ID: "missing"}); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Update missing pin: %v", err)
+	}
+
+	feedback, err := st.Feedback().ListByUser(ctx, aliceID)
+	if err != nil || len(feedback) != 3 || feedback[0].FeedbackText != "first" {
+		t.Fatalf("feedback = %+v, %v", feedback, err)
+	}
+
+	if err := st.Checkins().Save(ctx, aliceID, &store.Checkin{Date: "2025-07-01", Mood: "happy"}); err != nil {
+		t.Fatal(err)
+	}
+	ci, err := st.Checkins().GetByDate(ctx, aliceID, "2025-07-01")
+	if err != nil || ci.Mood != "happy" || ci.UserID != aliceID {
+		t.Fatalf("checkin = %+v, %v", ci, err)
+	}
+	if _, err := st.Checkins().GetByDate(ctx, bobID, "2025-07-01"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("partner checkin leaked: %v", err)
+	}
+}
+
+func TestUserPurge(t *testing.T) {
+	st, client := newTestStore(t)
+	ctx := context.Background()
+
+	alice, _ := st.Users().Get(ctx, aliceID)
+	alice.DeletedAt = time.Now()
+	if err := st.Users().Save(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := st.Users().ListDeleted(ctx, time.Now())
+	if err != nil || len(deleted) != 1 || deleted[0].ID != aliceID {
+		t.Fatalf("ListDeleted = %+v, %v", deleted, err)
+	}
+
+	// a subcollection the repos do not know about, under a document that only has children
+	legacy := client.Collection("users").Doc(aliceID).Collection("legacy").Doc("parent").Collection("nested").Doc("child")
+	if _, err := legacy.Set(ctx, map[string]interface{}{"kept": false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Pins().Create(ctx, aliceID, &store.Pin{Title: "Cafe"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Users().Purge(ctx, aliceID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Users().Get(ctx, aliceID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("user after purge: %v", err)
+	}
+	collections, err := client.Collection("users").Doc(aliceID).Collections(ctx).GetAll()
+	if err != nil || len(collections) != 0 {
+		t.Fatalf("subcollections left after purge: %d, %v", len(collections), err)
+	}
+	if err := st.Users().Purge(ctx, aliceID); err != nil {
+		t.Fatalf("second purge: %v", err)
+	}
+}
+
+func TestBackfillPartnerUIDs(t *testing.T) {
+	st, client := newTestStore(t)
+	ctx := context.Background()
+
+	// documents as the email based versions wrote them
+	if _, err := client.Collection("users").Doc(aliceID).Collection("connections").Doc("c1").Set(ctx, map[string]interface{}{
+		"partnerEmail": bobEmail, "role": store.RoleInitiator, "status": store.StatusActive,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Collection("ddays").Doc("old").Set(ctx, map[string]interface{}{
+		"title": "old", "date": "20250701", "createdBy": bobEmail,
+		"connectedUsers": []string{"nobody@example.com", strings.ToUpper(aliceEmail)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second run finds nothing left to change
+	for _, want := range []int{2, 0} {
+		changed := 0
+		for _, id := range []string{aliceID, bobID} {
+			user, err := st.Users().Get(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := st.BackfillPartnerUIDs(ctx, user, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changed += n
+		}
+		if changed != want {
+			t.Fatalf("changed %d documents, want %d", changed, want)
+		}
+	}
+	conn, err := st.Connections().FindByPartner(ctx, aliceID, bobID)
+	if err != nil || conn.ID != "c1" {
+		t.Fatalf("migrated connection = %+v, %v", conn, err)
+	}
+	d, err := st.DDays().Get(ctx, "old")
+	if err != nil || d.CreatorID != bobID || fmt.Sprint(d.SharedWith) != "["+aliceID+"]" || fmt.Sprint(d.PendingUsers) != "[nobody@example.com]" {
+		t.Fatalf("migrated event = %+v, %v", d, err)
+	}
+}
+
+func TestUserPagesAndMigrationRuns(t *testing.T) {
+	st, _ := newTestStore(t)
+	ctx := context.Background()
+
+	// pages follow the document IDs
+	var ids []string
+	after := ""
+	for {
+		page, err := st.Users().List(ctx, after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range page {
+			ids = append(ids, u.ID)
+		}
+		if len(page) < 2 {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	if len(ids) != 3 || !slices.IsSorted(ids) {
+		t.Fatalf("listed users %v", ids)
+	}
+
+	if _, err := st.Migrations().Get(ctx, "0001_test"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get missing run: %v", err)
+	}
+	run := &store.MigrationRun{Name: "0001_test", Cursor: ids[0], Users: 1, StartedAt: time.Now()}
+	if err := st.Migrations().Save(ctx, run); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := st.Migrations().List(ctx)
+	if err != nil || len(runs) != 1 || runs[0].Name != "0001_test" || runs[0].Cursor != ids[0] || !runs[0].FinishedAt.IsZero() {
+		t.Fatalf("runs = %+v, %v", runs, err)
+	}
+}
+
+// the admin queries read across users with collection groups
+func TestAdminQueries(t *testing.T) {
+	st, client := newTestStore(t)
+	ctx := context.Background()
+	connect(t, st)
+
+	// connections left under a user document that is gone still have an owner
+	if _, err := userSub(client, "gone-uid", "connections").Doc("stale").Set(ctx, map[string]interface{}{"status": store.StatusActive}); err != nil {
+		t.Fatal(err)
+	}
+	owners, err := st.Connections().Owners(ctx)
+	if err != nil || !slices.Equal(owners, []string{aliceID, bobID, "gone-uid"}) {
+		t.Fatalf("owners = %v, %v", owners, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	later := store.Feedback{FeedbackText: "later", Category: "bug", SubmittedAt: now}
+	first := store.Feedback{FeedbackText: "first", Category: "idea", SubmittedAt: now.Add(-time.Hour)}
+	if err := st.Feedback().Create(ctx, bobID, &later); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Feedback().Create(ctx, aliceID, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Feedback().SetAdminComment(ctx, aliceID, first.ID, "thanks"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Feedback().SetAdminComment(ctx, aliceID, "missing", "thanks"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("reply to missing feedback: %v", err)
+	}
+	all, err := st.Feedback().List(ctx)
+	if err != nil || len(all) != 2 || all[0].UserID != aliceID || all[0].AdminComment != "thanks" || all[1].UserID != bobID {
+		t.Fatalf("feedback = %+v, %v", all, err)
+	}
+
+	post := store.Idea{Title: "Picnic", Author: "Bob"}
+	if err := st.Ideas().Create(ctx, bobID, &post); err != nil {
+		t.Fatal(err)
+	}
+	cm := store.Comment{Author: "Carol", Content: "nice"}
+	if err := st.Ideas().AddComment(ctx, carolID, post.ID, &cm); err != nil {
+		t.Fatal(err)
+	}
+	if uid, err := st.Ideas().Author(ctx, post.ID); err != nil || uid != bobID {
+		t.Fatalf("author = %q, %v", uid, err)
+	}
+	if uid, err := st.Ideas().CommentAuthor(ctx, post.ID, cm.ID); err != nil || uid != carolID {
+		t.Fatalf("comment author = %q, %v", uid, err)
+	}
+	if _, err := st.Ideas().CommentAuthor(ctx, post.ID, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("missing comment author: %v", err)
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	st, _ := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if err := st.Feeds().Save(ctx, &store.Feed{UserID: aliceID, Prefix: "cplf_old", Hash: "old", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	// saving again replaces the secret
+	if err := st.Feeds().Save(ctx, &store.Feed{UserID: aliceID, Prefix: "cplf_new", Hash: "new", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Feeds().GetByHash(ctx, "old"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("old secret: %v", err)
+	}
+	feed, err := st.Feeds().GetByHash(ctx, "new")
+	if err != nil || feed.UserID != aliceID || feed.Prefix != "cplf_new" {
+		t.Fatalf("feed = %+v, %v", feed, err)
+	}
+
+	if err := st.Feeds().Delete(ctx, aliceID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Feeds().Get(ctx, aliceID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("deleted feed: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type ideaRepo struct {
+	client *firestore.Client
+}
+
+// ideaDoc mirrors how posts were first written (go field names as keys)
+// the counters were later incremented under lowercase keys, which win when present
+type ideaDoc struct {
+	Title       string          `firestore:"Title"`
+	Description string          `firestore:"Description"`
+	Author      string          `firestore:"Author"`
+	CreatedAt   string          `firestore:"CreatedAt"`
+	UpdatedAt   string          `firestore:"UpdatedAt"`
+	Likes       int             `firestore:"Likes"`
+	Tags        []string        `firestore:"Tags"`
+	Comments    []store.Comment `firestore:"Comments"`
+	LikeCount   *int            `firestore:"likes,omitempty"`
+}
+
+func (r ideaRepo) List(ctx context.Context) ([]store.Idea, error) {
+	docs, err := r.client.Collection("ideas").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return decodeIdeas(docs)
+}
+
+func (r ideaRepo) ListByAuthor(ctx context.Context, uid string) ([]store.Idea, error) {
+	docs, err := userSub(r.client, uid, "posts").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return decodeIdeas(docs)
+}
+
+func (r ideaRepo) Create(ctx context.Context, uid string, idea *store.Idea) error {
+	ref, _, err := r.client.Collection("ideas").Add(ctx, encodeIdea(idea))
+	if err != nil {
+		return err
+	}
+	idea.ID = ref.ID
+
+	// mirror the post in the user's posts collection
+	_, err = userSub(r.client, uid, "posts").Doc(ref.ID).Set(ctx, encodeIdea(idea))
+	return err
+}
+
+func (r ideaRepo) Update(ctx context.Context, idea *store.Idea) error {
+	_, err := r.client.Collection("ideas").Doc(idea.ID).Set(ctx, map[string]interface{}{
+		"Title":       idea.Title,
+		"Description": idea.Description,
+		"Tags":        idea.Tags,
+	}, firestore.MergeAll)
+	return err
+}
+
+func (r ideaRepo) Delete(ctx context.Context, uid, id string) error {
+	// the comments subcollection goes with the post
+	if err := deleteDocument(ctx, r.client.Collection("ideas").Doc(id)); err != nil {
+		return err
+	}
+	_, err := userSub(r.client, uid, "posts").Doc(id).Delete(ctx)
+	return err
+}
+
+func (r ideaRepo) ListComments(ctx context.Context, postID string) ([]store.Comment, error) {
+	return listComments(ctx, r.client.Collection("ideas").Doc(postID).Collection("comments"))
+}
+
+// the user's comments mirror holds a copy of every comment they wrote
+func (r ideaRepo) ListCommentsByUser(ctx context.Context, uid string) ([]store.Comment, error) {
+	return listComments(ctx, userSub(r.client, uid, "comments"))
+}
+
+func listComments(ctx context.Context, col *firestore.CollectionRef) ([]store.Comment, error) {
+	docs, err := col.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.Comment, 0, len(docs))
+	for _, doc := range docs {
+		var cm store.Comment
+		if err := doc.DataTo(&cm); err != nil {
+			return nil, err
+		}
+		cm.ID = doc.Ref.ID
+		out = append(out, cm)
+	}
+	return out, nil
+}
+
+func (r ideaRepo) AddComment(ctx context.Context, uid, postID string, cm *store.Comment) error {
+	postRef := r.client.Collection("ideas").Doc(postID)
+	ref, _, err := postRef.Collection("comments").Add(ctx, cm)
+	if err != nil {
+		return err
+	}
+	cm.ID = ref.ID
+
+	// also add comment to user's comments collection
+	if _, err := userSub(r.client, uid, "comments").Doc(ref.ID).Set(ctx, cm); err != nil {
+		return err
+	}
+	return r.addCommentsCount(ctx, uid, postID, 1)
+}
+
+func (r ideaRepo) UpdateComment(ctx context.Context, postID string, cm *store.Comment) error {
+	_, err := r.client.Collection("ideas").Doc(postID).Collection("comments").Doc(cm.ID).Set(ctx, map[string]interface{}{
+		"Content": cm.Content,
+	}, firestore.MergeAll)
+	return err
+}
+
+func (r ideaRepo) DeleteComment(ctx context.Context, uid, postID, commentID string) error {
+	if _, err := r.client.Collection("ideas").Doc(postID).Collection("comments").Doc(commentID).Delete(ctx); err != nil {
+		return err
+	}
+	if _, err := userSub(r.client, uid, "comments").Doc(commentID).Delete(ctx); err != nil {
+		return err
+	}
+	return r.addCommentsCount(ctx, uid, postID, -1)
+}
+
+// the user's comments mirror does not record the post
+// so every post is checked for the mirrored comment IDs, one batched read per post
+func (r ideaRepo) DeleteCommentsByUser(ctx context.Context, uid string) error {
+	mirror, err := userSub(r.client, uid, "comments").DocumentRefs(ctx).GetAll()
+	if err != nil || len(mirror) == 0 {
+		return err
+	}
+	posts, err := r.client.Collection("ideas").DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		refs := make([]*firestore.DocumentRef, len(mirror))
+		for i, ref := range mirror {
+			refs[i] = post.Collection("comments").Doc(ref.ID)
+		}
+		docs, err := r.client.GetAll(ctx, refs)
+		if err != nil {
+			return err
+		}
+
+		deleted := 0
+		for _, doc := range docs {
+			if !doc.Exists() {
+				continue
+			}
+			if _, err := doc.Ref.Delete(ctx); err != nil {
+				return err
+			}
+			deleted++
+		}
+		if deleted > 0 {
+			inc := []firestore.Update{{Path: "comments_count", Value: firestore.Increment(-deleted)}}
+			if err := updateMirror(ctx, post, inc); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, ref := range mirror {
+		if _, err := ref.Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the posts mirror is the only link from a post to its author's ID
+// so every mirror is scanned, which is fine for the admin tools that need it
+func (r ideaRepo) Author(ctx context.Context, postID string) (string, error) {
+	return mirrorOwner(ctx, r.client, "posts", postID)
+}
+
+func (r ideaRepo) CommentAuthor(ctx context.Context, postID, commentID string) (string, error) {
+	if _, err := r.client.Collection("ideas").Doc(postID).Collection("comments").Doc(commentID).Get(ctx); err != nil {
+		return "", wrapErr(err)
+	}
+	return mirrorOwner(ctx, r.client, "comments", commentID)
+}
+
+// mirrorOwner returns the user whose named subcollection holds the document with the given ID
+// the ideas' comments subcollections share the name and are skipped
+func mirrorOwner(ctx context.Context, client *firestore.Client, name, id string) (string, error) {
+	docs, err := client.CollectionGroup(name).Select().Documents(ctx).GetAll()
+	if err != nil {
+		return "", err
+	}
+	for _, doc := range docs {
+		if doc.Ref.ID != id {
+			continue
+		}
+		if owners := parentIDs([]*firestore.DocumentSnapshot{doc}, "users"); len(owners) > 0 {
+			return owners[0], nil
+		}
+	}
+	return "", store.ErrNotFound
+}
+
+// counters are kept on the post and on the user's mirror
+func (r ideaRepo) addCommentsCount(ctx context.Context, uid, postID string, delta int) error {
+	inc := []firestore.Update{{Path: "comments_count", Value: firestore.Increment(delta)}}
+	if _, err := r.client.Collection("ideas").Doc(postID).Update(ctx, inc); err != nil {
+		return wrapErr(err)
+	}
+	return updateMirror(ctx, userSub(r.client, uid, "posts").Doc(postID), inc)
+}
+
+func (r ideaRepo) AddLikes(ctx context.Context, uid, postID string, delta int) error {
+	inc := []firestore.Update{{Path: "likes", Value: firestore.Increment(delta)}}
+	if _, err := r.client.Collection("ideas").Doc(postID).Update(ctx, inc); err != nil {
+		return wrapErr(err)
+	}
+	return updateMirror(ctx, userSub(r.client, uid, "posts").Doc(postID), inc)
+}
+
+// the user's mirror only exists when they wrote the post
+func updateMirror(ctx context.Context, ref *firestore.DocumentRef, updates []firestore.Update) error {
+	_, err := ref.Update(ctx, updates)
+	if err != nil && wrapErr(err) != store.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func (r ideaRepo) Bookmark(ctx context.Context, uid, postID string) error {
+	_, err := userSub(r.client, uid, "bookmarks").Doc(postID).Set(ctx, map[string]interface{}{
+		"post_id": postID,
+	})
+	return err
+}
+
+func (r ideaRepo) Unbookmark(ctx context.Context, uid, postID string) error {
+	_, err := userSub(r.client, uid, "bookmarks").Doc(postID).Delete(ctx)
+	return err
+}
+
+func (r ideaRepo) ListBookmarks(ctx context.Context, uid string) ([]string, error) {
+	docs, err := userSub(r.client, uid, "bookmarks").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		out = append(out, doc.Ref.ID)
+	}
+	return out, nil
+}
+
+func encodeIdea(idea *store.Idea) ideaDoc {
+	return ideaDoc{
+		Title:       idea.Title,
+		Description: idea.Description,
+		Author:      idea.Author,
+		CreatedAt:   idea.CreatedAt,
+		UpdatedAt:   idea.UpdatedAt,
+		Likes:       idea.Likes,
+		Tags:        idea.Tags,
+		Comments:    idea.Comments,
+	}
+}
+
+func decodeIdeas(docs []*firestore.DocumentSnapshot) ([]store.Idea, error) {
+	out := make([]store.Idea, 0, len(docs))
+	for _, doc := range docs {
+		var d ideaDoc
+		if err := doc.DataTo(&d); err != nil {
+			return nil, err
+		}
+		likes := d.Likes
+		if d.LikeCount != nil {
+			likes = *d.LikeCount
+		}
+		out = append(out, store.Idea{
+			ID:          doc.Ref.ID,
+			Title:       d.Title,
+			Description: d.Description,
+			Author:      d.Author,
+			CreatedAt:   d.CreatedAt,
+			UpdatedAt:   d.UpdatedAt,
+			Likes:       likes,
+			Tags:        d.Tags,
+			Comments:    d.Comments,
+		})
+	}
+	return out, nil
+}
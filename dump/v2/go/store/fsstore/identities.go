@@ -0,0 +1,71 @@
+package fsstore
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type identityRepo struct {
+	client *firestore.Client
+}
+
+// keyed by provider and subject so a sign in is a single document read
+func (r identityRepo) doc(provider, subject string) *firestore.DocumentRef {
+	return r.client.Collection("identities").Doc(provider + ":" + subject)
+}
+
+func (r identityRepo) Get(ctx context.Context, provider, subject string) (*store.Identity, error) {
+	doc, err := r.doc(provider, subject).Get(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	var id store.Identity
+	if err := doc.DataTo(&id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// sorted here instead of with OrderBy so no composite index is needed
+func (r identityRepo) ListByUser(ctx context.Context, uid string) ([]store.Identity, error) {
+	docs, err := r.client.Collection("identities").Where("userId", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := []store.Identity{}
+	for _, doc := range docs {
+		var id store.Identity
+		if err := doc.DataTo(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (r identityRepo) Link(ctx context.Context, id *store.Identity) error {
+	_, err := r.doc(id.Provider, id.Subject).Set(ctx, id)
+	return err
+}
+
+func (r identityRepo) Unlink(ctx context.Context, uid, provider, subject string) error {
+	ref := r.doc(provider, subject)
+	return r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return wrapErr(err)
+		}
+		// another user's identity is reported as missing
+		if owner, _ := doc.DataAt("userId"); owner != uid {
+			return store.ErrNotFound
+		}
+		return tx.Delete(ref)
+	})
+}
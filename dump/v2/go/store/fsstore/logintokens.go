@@ -0,0 +1,43 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+// expired tokens are left behind, a ttl policy on expiresAt cleans them up
+type loginTokenRepo struct {
+	client *firestore.Client
+}
+
+func (r loginTokenRepo) Create(ctx context.Context, t *store.LoginToken) error {
+	_, err := r.client.Collection("loginTokens").Doc(t.Hash).Create(ctx, t)
+	return err
+}
+
+// read and delete in one transaction so two requests cannot both use the token
+func (r loginTokenRepo) Consume(ctx context.Context, purpose, hash string) (*store.LoginToken, error) {
+	ref := r.client.Collection("loginTokens").Doc(hash)
+	var t store.LoginToken
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return wrapErr(err)
+		}
+		if err := doc.DataTo(&t); err != nil {
+			return err
+		}
+		if t.Purpose != purpose {
+			return store.ErrNotFound
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.Hash = hash
+	return &t, nil
+}
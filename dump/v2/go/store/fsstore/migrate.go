@@ -0,0 +1,111 @@
+package fsstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+// BackfillPartnerUIDs gives the connections and events of one user the user IDs next to the partner emails
+// connections and ddays referenced partners by email before, the migrate package runs it for every user
+// emails in connectedUsers without an account never gave anyone access, they move to pendingUsers
+// documents that already have the IDs are skipped, it returns how many documents it changed
+func (s *Store) BackfillPartnerUIDs(ctx context.Context, user *store.User, dryRun bool) (int, error) {
+	users := userRepo{s.client}
+	// older versions stored emails as they were typed, newer ones lowercase them
+	uid := func(email string) (string, error) {
+		if email == "" {
+			return "", nil
+		}
+		u, err := users.GetByEmail(ctx, email)
+		if errors.Is(err, store.ErrNotFound) && email != strings.ToLower(email) {
+			u, err = users.GetByEmail(ctx, strings.ToLower(email))
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return u.ID, nil
+	}
+
+	changed := 0
+	conns, err := userSub(s.client, user.ID, "connections").Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, conn := range conns {
+		if partnerUID, _ := conn.Data()["partnerUID"].(string); partnerUID != "" {
+			continue
+		}
+		email, _ := conn.Data()["partnerEmail"].(string)
+		partnerUID, err := uid(email)
+		if err != nil {
+			return changed, err
+		}
+		if partnerUID == "" {
+			continue
+		}
+		changed++
+		if dryRun {
+			continue
+		}
+		if _, err := conn.Ref.Update(ctx, []firestore.Update{{Path: "partnerUID", Value: partnerUID}}); err != nil {
+			return changed, err
+		}
+	}
+
+	// events whose creator has no account are never visited, the admin check lists them
+	if user.Email == "" {
+		return changed, nil
+	}
+	createdBy := []string{user.Email}
+	if lower := strings.ToLower(user.Email); lower != user.Email {
+		createdBy = append(createdBy, lower)
+	}
+	ddays, err := s.client.Collection("ddays").Where("createdBy", "in", createdBy).Documents(ctx).GetAll()
+	if err != nil {
+		return changed, err
+	}
+	for _, doc := range ddays {
+		data := doc.Data()
+		if _, ok := data["creatorId"]; ok {
+			continue
+		}
+		emails, _ := data["connectedUsers"].([]interface{})
+
+		connected, shared, pending := []string{}, []string{}, []string{}
+		for _, v := range emails {
+			email, _ := v.(string)
+			partnerUID, err := uid(email)
+			if err != nil {
+				return changed, err
+			}
+			if partnerUID != "" {
+				connected = append(connected, email)
+				shared = append(shared, partnerUID)
+			} else if email != "" {
+				pending = append(pending, email)
+			}
+		}
+		changed++
+		if dryRun {
+			continue
+		}
+		_, err := doc.Ref.Update(ctx, []firestore.Update{
+			{Path: "creatorId", Value: user.ID},
+			{Path: "connectedUsers", Value: connected},
+			{Path: "sharedWith", Value: shared},
+			{Path: "pendingUsers", Value: pending},
+		})
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
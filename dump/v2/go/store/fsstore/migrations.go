@@ -0,0 +1,52 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+// the runs of the data migrations of the migrate package
+type migrationRepo struct {
+	client *firestore.Client
+}
+
+func (r migrationRepo) Get(ctx context.Context, name string) (*store.MigrationRun, error) {
+	doc, err := r.client.Collection("migrationRuns").Doc(name).Get(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return decodeMigrationRun(doc)
+}
+
+func (r migrationRepo) List(ctx context.Context) ([]store.MigrationRun, error) {
+	docs, err := r.client.Collection("migrationRuns").OrderBy(firestore.DocumentID, firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.MigrationRun, 0, len(docs))
+	for _, doc := range docs {
+		run, err := decodeMigrationRun(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *run)
+	}
+	return out, nil
+}
+
+func (r migrationRepo) Save(ctx context.Context, run *store.MigrationRun) error {
+	_, err := r.client.Collection("migrationRuns").Doc(run.Name).Set(ctx, run)
+	return err
+}
+
+func decodeMigrationRun(doc *firestore.DocumentSnapshot) (*store.MigrationRun, error) {
+	var run store.MigrationRun
+	if err := doc.DataTo(&run); err != nil {
+		return nil, err
+	}
+	run.Name = doc.Ref.ID
+	return &run, nil
+}
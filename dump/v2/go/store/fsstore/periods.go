@@ -0,0 +1,103 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type periodRepo struct {
+	client *firestore.Client
+}
+
+func (r periodRepo) ListDays(ctx context.Context, uid string) ([]store.PeriodDay, error) {
+	docs, err := userSub(r.client, uid, "periodDays").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.PeriodDay, 0, len(docs))
+	for _, doc := range docs {
+		d, err := decodePeriodDay(doc, uid)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, nil
+}
+
+func (r periodRepo) GetDay(ctx context.Context, uid, date string) (*store.PeriodDay, error) {
+	docs, err := userSub(r.client, uid, "periodDays").Where("date", "==", date).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return decodePeriodDay(docs[0], uid)
+}
+
+func (r periodRepo) SaveDay(ctx context.Context, uid string, d *store.PeriodDay) error {
+	col := userSub(r.client, uid, "periodDays")
+	if d.ID == "" {
+		ref, _, err := col.Add(ctx, d)
+		if err != nil {
+			return err
+		}
+		d.ID = ref.ID
+	} else if _, err := col.Doc(d.ID).Set(ctx, d); err != nil {
+		return err
+	}
+	d.UserID = uid
+	return nil
+}
+
+func (r periodRepo) DeleteDay(ctx context.Context, uid, id string) error {
+	_, err := userSub(r.client, uid, "periodDays").Doc(id).Delete(ctx)
+	return err
+}
+
+func (r periodRepo) GetSettings(ctx context.Context, uid string) (*store.CycleSettings, error) {
+	docs, err := userSub(r.client, uid, "cycleSettings").Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, store.ErrNotFound
+	}
+
+	var s store.CycleSettings
+	if err := docs[0].DataTo(&s); err != nil {
+		return nil, err
+	}
+	s.ID = docs[0].Ref.ID
+	s.UserID = uid
+	return &s, nil
+}
+
+func (r periodRepo) SaveSettings(ctx context.Context, uid string, s *store.CycleSettings) error {
+	col := userSub(r.client, uid, "cycleSettings")
+	if s.ID == "" {
+		ref, _, err := col.Add(ctx, s)
+		if err != nil {
+			return err
+		}
+		s.ID = ref.ID
+	} else if _, err := col.Doc(s.ID).Set(ctx, s); err != nil {
+		return err
+	}
+	s.UserID = uid
+	return nil
+}
+
+func decodePeriodDay(doc *firestore.DocumentSnapshot, uid string) (*store.PeriodDay, error) {
+	var d store.PeriodDay
+	if err := doc.DataTo(&d); err != nil {
+		return nil, err
+	}
+	d.ID = doc.Ref.ID
+	d.UserID = uid
+	return &d, nil
+}
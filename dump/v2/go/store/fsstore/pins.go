@@ -0,0 +1,65 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"calple/store"
+)
+
+type pinRepo struct {
+	client *firestore.Client
+}
+
+func (r pinRepo) List(ctx context.Context, uid string) ([]store.Pin, error) {
+	snapIter := userSub(r.client, uid, "pins").OrderBy("createdAt", firestore.Desc).Documents(ctx)
+	defer snapIter.Stop()
+
+	out := []store.Pin{}
+	for {
+		doc, err := snapIter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var p store.Pin
+		if err := doc.DataTo(&p); err != nil {
+			return nil, err
+		}
+		p.ID = doc.Ref.ID
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (r pinRepo) Create(ctx context.Context, uid string, p *store.Pin) error {
+	ref, _, err := userSub(r.client, uid, "pins").Add(ctx, p)
+	if err != nil {
+		return err
+	}
+	p.ID = ref.ID
+	return nil
+}
+
+// Update fails with store.ErrNotFound if the pin does not exist
+func (r pinRepo) Update(ctx context.Context, uid string, p *store.Pin) error {
+	_, err := userSub(r.client, uid, "pins").Doc(p.ID).Update(ctx, []firestore.Update{
+		{Path: "lat", Value: p.Lat},
+		{Path: "lng", Value: p.Lng},
+		{Path: "title", Value: p.Title},
+		{Path: "description", Value: p.Description},
+		{Path: "location", Value: p.Location},
+		{Path: "date", Value: p.Date},
+		{Path: "updatedAt", Value: p.UpdatedAt},
+	})
+	return wrapErr(err)
+}
+
+func (r pinRepo) Delete(ctx context.Context, uid, id string) error {
+	_, err := userSub(r.client, uid, "pins").Doc(id).Delete(ctx)
+	return err
+}
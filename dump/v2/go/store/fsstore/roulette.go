@@ -0,0 +1,49 @@
+package fsstore
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type rouletteRepo struct {
+	client *firestore.Client
+}
+
+func (r rouletteRepo) List(ctx context.Context) ([]store.Roulette, error) {
+	docs, err := r.client.Collection("roulette").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.Roulette, 0, len(docs))
+	for _, doc := range docs {
+		var item store.Roulette
+		if err := doc.DataTo(&item); err != nil {
+			return nil, err
+		}
+		item.ID = doc.Ref.ID
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (r rouletteRepo) Create(ctx context.Context, item *store.Roulette) error {
+	ref, _, err := r.client.Collection("roulette").Add(ctx, item)
+	if err != nil {
+		return err
+	}
+	item.ID = ref.ID
+	return nil
+}
+
+func (r rouletteRepo) Update(ctx context.Context, item *store.Roulette) error {
+	_, err := r.client.Collection("roulette").Doc(item.ID).Set(ctx, item)
+	return err
+}
+
+func (r rouletteRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.client.Collection("roulette").Doc(id).Delete(ctx)
+	return err
+}
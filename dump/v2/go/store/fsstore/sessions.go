@@ -0,0 +1,90 @@
+package fsstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+// expired sessions are removed by DeleteExpired, which the purger runs
+type sessionRepo struct {
+	client *firestore.Client
+}
+
+func (r sessionRepo) Get(ctx context.Context, id string) (*store.Session, error) {
+	doc, err := r.client.Collection("sessions").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	var sess store.Session
+	if err := doc.DataTo(&sess); err != nil {
+		return nil, err
+	}
+	sess.ID = doc.Ref.ID
+	return &sess, nil
+}
+
+// sorted here instead of with OrderBy so no composite index is needed
+func (r sessionRepo) ListByUser(ctx context.Context, uid string) ([]store.Session, error) {
+	docs, err := r.client.Collection("sessions").Where("userId", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := []store.Session{}
+	for _, doc := range docs {
+		var sess store.Session
+		if err := doc.DataTo(&sess); err != nil {
+			return nil, err
+		}
+		sess.ID = doc.Ref.ID
+		out = append(out, sess)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].LastSeenAt.After(out[j].LastSeenAt)
+	})
+	return out, nil
+}
+
+func (r sessionRepo) Save(ctx context.Context, sess *store.Session) error {
+	_, err := r.client.Collection("sessions").Doc(sess.ID).Set(ctx, sess)
+	return err
+}
+
+// deleting a missing document is not an error in firestore
+func (r sessionRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.client.Collection("sessions").Doc(id).Delete(ctx)
+	return err
+}
+
+func (r sessionRepo) DeleteByUser(ctx context.Context, uid, keepID string) error {
+	docs, err := r.client.Collection("sessions").Where("userId", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if doc.Ref.ID == keepID {
+			continue
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r sessionRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	docs, err := r.client.Collection("sessions").Where("expiresAt", "<", now).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	for i, doc := range docs {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return i, err
+		}
+	}
+	return len(docs), nil
+}
@@ -0,0 +1,83 @@
+package fsstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type tokenRepo struct {
+	client *firestore.Client
+}
+
+func (r tokenRepo) GetByHash(ctx context.Context, hash string) (*store.APIToken, error) {
+	docs, err := r.client.Collection("apiTokens").Where("hash", "==", hash).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, store.ErrNotFound
+	}
+	var t store.APIToken
+	if err := docs[0].DataTo(&t); err != nil {
+		return nil, err
+	}
+	t.ID = docs[0].Ref.ID
+	return &t, nil
+}
+
+// sorted here instead of with OrderBy so no composite index is needed
+func (r tokenRepo) ListByUser(ctx context.Context, uid string) ([]store.APIToken, error) {
+	docs, err := r.client.Collection("apiTokens").Where("userId", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := []store.APIToken{}
+	for _, doc := range docs {
+		var t store.APIToken
+		if err := doc.DataTo(&t); err != nil {
+			return nil, err
+		}
+		t.ID = doc.Ref.ID
+		out = append(out, t)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (r tokenRepo) Create(ctx context.Context, t *store.APIToken) error {
+	ref, _, err := r.client.Collection("apiTokens").Add(ctx, t)
+	if err != nil {
+		return err
+	}
+	t.ID = ref.ID
+	return nil
+}
+
+func (r tokenRepo) Delete(ctx context.Context, uid, id string) error {
+	ref := r.client.Collection("apiTokens").Doc(id)
+	return r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return wrapErr(err)
+		}
+		// another user's token is reported as missing
+		if owner, _ := doc.DataAt("userId"); owner != uid {
+			return store.ErrNotFound
+		}
+		return tx.Delete(ref)
+	})
+}
+
+func (r tokenRepo) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	_, err := r.client.Collection("apiTokens").Doc(id).Update(ctx, []firestore.Update{
+		{Path: "lastUsedAt", Value: at},
+	})
+	return wrapErr(err)
+}
@@ -0,0 +1,133 @@
+package fsstore
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"calple/store"
+)
+
+type userRepo struct {
+	client *firestore.Client
+}
+
+func (r userRepo) Get(ctx context.Context, id string) (*store.User, error) {
+	doc, err := r.client.Collection("users").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return decodeUser(doc)
+}
+
+func (r userRepo) GetByEmail(ctx context.Context, email string) (*store.User, error) {
+	docs, err := r.client.Collection("users").Where("email", "==", email).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return decodeUser(docs[0])
+}
+
+// Save merges the model fields into the document
+// so fields written by older versions of the app are kept
+func (r userRepo) Save(ctx context.Context, u *store.User) error {
+	data := map[string]interface{}{
+		"email":          u.Email,
+		"name":           u.Name,
+		"sex":            u.Sex,
+		"returning_user": u.ReturningUser,
+		"last_login_at":  u.LastLoginAt,
+		"created_at":     u.CreatedAt,
+		"updatedAt":      u.UpdatedAt,
+	}
+
+	// startedDating is stored as null until the couple sets it
+	if u.StartedDating != "" {
+		data["startedDating"] = u.StartedDating
+	} else {
+		data["startedDating"] = nil
+	}
+
+	// the field only exists while the account waits to be purged
+	if !u.DeletedAt.IsZero() {
+		data["deletedAt"] = u.DeletedAt
+	} else {
+		data["deletedAt"] = firestore.Delete
+	}
+
+	if u.Tokens != nil {
+		data["tokens"] = map[string]interface{}{
+			"access_token":  u.Tokens.AccessToken,
+			"refresh_token": u.Tokens.RefreshToken,
+			"expiry":        u.Tokens.Expiry,
+		}
+	} else {
+		data["tokens"] = firestore.Delete
+	}
+
+	_, err := r.client.Collection("users").Doc(u.ID).Set(ctx, data, firestore.MergeAll)
+	return err
+}
+
+func (r userRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.client.Collection("users").Doc(id).Delete(ctx)
+	return err
+}
+
+func (r userRepo) List(ctx context.Context, after string, limit int) ([]store.User, error) {
+	q := r.client.Collection("users").OrderBy(firestore.DocumentID, firestore.Asc).Limit(limit)
+	if after != "" {
+		q = q.StartAfter(after)
+	}
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.User, 0, len(docs))
+	for _, doc := range docs {
+		u, err := decodeUser(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *u)
+	}
+	return out, nil
+}
+
+func (r userRepo) ListDeleted(ctx context.Context, before time.Time) ([]store.User, error) {
+	docs, err := r.client.Collection("users").
+		Where("deletedAt", "<=", before).
+		OrderBy("deletedAt", firestore.Asc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.User, 0, len(docs))
+	for _, doc := range docs {
+		u, err := decodeUser(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *u)
+	}
+	return out, nil
+}
+
+// Purge lists the subcollections instead of naming them
+// so collections written by older versions of the app go too
+func (r userRepo) Purge(ctx context.Context, id string) error {
+	return deleteDocument(ctx, r.client.Collection("users").Doc(id))
+}
+
+func decodeUser(doc *firestore.DocumentSnapshot) (*store.User, error) {
+	var u store.User
+	if err := doc.DataTo(&u); err != nil {
+		return nil, err
+	}
+	u.ID = doc.Ref.ID
+	return &u, nil
+}
@@ -0,0 +1,58 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"calple/store"
+)
+
+type checkinRepo struct {
+	s *Store
+}
+
+func (r checkinRepo) List(ctx context.Context, uid string) ([]store.Checkin, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Checkin{}
+	checkins := r.s.checkins[uid]
+	for _, id := range sortedKeys(checkins) {
+		out = append(out, checkins[id])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out, nil
+}
+
+func (r checkinRepo) GetByDate(ctx context.Context, uid, date string) (*store.Checkin, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	checkins := r.s.checkins[uid]
+	for _, id := range sortedKeys(checkins) {
+		if ci := checkins[id]; ci.Date == date {
+			return &ci, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (r checkinRepo) Save(ctx context.Context, uid string, ci *store.Checkin) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if ci.ID == "" {
+		ci.ID = newID()
+	}
+	ci.UserID = uid
+	sub(r.s.checkins, uid)[ci.ID] = *ci
+	return nil
+}
+
+func (r checkinRepo) Delete(ctx context.Context, uid, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.checkins[uid], id)
+	return nil
+}
@@ -0,0 +1,148 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"calple/store"
+)
+
+type connectionRepo struct {
+	s *Store
+}
+
+func (r connectionRepo) Get(ctx context.Context, uid, id string) (*store.Connection, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	conn, ok := r.s.connections[uid][id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &conn, nil
+}
+
+func (r connectionRepo) List(ctx context.Context, uid string) ([]store.Connection, error) {
+	return r.filter(uid, func(store.Connection) bool { return true }), nil
+}
+
+func (r connectionRepo) ListByStatus(ctx context.Context, uid, status string) ([]store.Connection, error) {
+	return r.filter(uid, func(conn store.Connection) bool { return conn.Status == status }), nil
+}
+
+func (r connectionRepo) Active(ctx context.Context, uid string) (*store.Connection, error) {
+	conns := r.filter(uid, func(conn store.Connection) bool { return conn.Status == store.StatusActive })
+	if len(conns) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &conns[0], nil
+}
+
+func (r connectionRepo) FindByPartner(ctx context.Context, uid, partnerUID string) (*store.Connection, error) {
+	conns := r.filter(uid, func(conn store.Connection) bool { return conn.PartnerUID == partnerUID })
+	if len(conns) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &conns[0], nil
+}
+
+func (r connectionRepo) Invite(ctx context.Context, fromUID, fromEmail, toUID, toEmail string) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	id := newID()
+	now := time.Now()
+	sub(r.s.connections, fromUID)[id] = store.Connection{
+		ID:           id,
+		PartnerEmail: toEmail,
+		PartnerUID:   toUID,
+		Role:         store.RoleInitiator,
+		Status:       store.StatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	sub(r.s.connections, toUID)[id] = store.Connection{
+		ID:           id,
+		PartnerEmail: fromEmail,
+		PartnerUID:   fromUID,
+		Role:         store.RoleReceiver,
+		Status:       store.StatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	return id, nil
+}
+
+func (r connectionRepo) Accept(ctx context.Context, uid, partnerUID, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	mine, ok := r.s.connections[uid][id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	theirs, ok := r.s.connections[partnerUID][id]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	now := time.Now()
+	mine.Status, mine.PartnerUID, mine.UpdatedAt = store.StatusActive, partnerUID, now
+	theirs.Status, theirs.PartnerUID, theirs.UpdatedAt = store.StatusActive, uid, now
+	r.s.connections[uid][id] = mine
+	r.s.connections[partnerUID][id] = theirs
+	return nil
+}
+
+func (r connectionRepo) Remove(ctx context.Context, uid, partnerUID, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.connections[uid], id)
+	if partnerUID != "" {
+		delete(r.s.connections[partnerUID], id)
+	}
+	return nil
+}
+
+func (r connectionRepo) SetPartnerEmail(ctx context.Context, uid, email string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for partnerUID, conns := range r.s.connections {
+		for id, conn := range conns {
+			if conn.PartnerUID == uid {
+				conn.PartnerEmail = email
+				r.s.connections[partnerUID][id] = conn
+			}
+		}
+	}
+	return nil
+}
+
+func (r connectionRepo) Owners(ctx context.Context) ([]string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []string{}
+	for _, uid := range sortedKeys(r.s.connections) {
+		if len(r.s.connections[uid]) > 0 {
+			out = append(out, uid)
+		}
+	}
+	return out, nil
+}
+
+func (r connectionRepo) filter(uid string, keep func(store.Connection) bool) []store.Connection {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Connection{}
+	conns := r.s.connections[uid]
+	for _, id := range sortedKeys(conns) {
+		if keep(conns[id]) {
+			out = append(out, conns[id])
+		}
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package memstore
+
+import (
+	"context"
+
+	"calple/store"
+	"calple/util"
+)
+
+type ddayRepo struct {
+	s *Store
+}
+
+func (r ddayRepo) Get(ctx context.Context, id string) (*store.DDay, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	d, ok := r.s.ddays[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return cloneDDay(d), nil
+}
+
+// same rules as the three firestore queries, undated events ("") sort before any date
+func (r ddayRepo) ListVisible(ctx context.Context, uid, until string) ([]store.DDay, error) {
+	return r.filter(func(d store.DDay) bool {
+		if d.CreatorID == uid && d.IsAnnual {
+			return true
+		}
+		if d.Date > until {
+			return false
+		}
+		return d.CreatorID == uid || util.Contains(d.SharedWith, uid)
+	}), nil
+}
+
+func (r ddayRepo) ListByCreator(ctx context.Context, uid string) ([]store.DDay, error) {
+	return r.filter(func(d store.DDay) bool { return d.CreatorID == uid }), nil
+}
+
+func (r ddayRepo) ListPending(ctx context.Context, email string) ([]store.DDay, error) {
+	return r.filter(func(d store.DDay) bool { return util.Contains(d.PendingUsers, email) }), nil
+}
+
+func (r ddayRepo) List(ctx context.Context, after string, limit int) ([]store.DDay, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.DDay{}
+	for _, id := range sortedKeys(r.s.ddays) {
+		if id <= after {
+			continue
+		}
+		if len(out) == limit {
+			break
+		}
+		out = append(out, *cloneDDay(r.s.ddays[id]))
+	}
+	return out, nil
+}
+
+func (r ddayRepo) Create(ctx context.Context, d *store.DDay) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	d.ID = newID()
+	setEmptyShares(d)
+	r.s.ddays[d.ID] = *cloneDDay(*d)
+	return nil
+}
+
+func (r ddayRepo) Update(ctx context.Context, d *store.DDay) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	setEmptyShares(d)
+	r.s.ddays[d.ID] = *cloneDDay(*d)
+	return nil
+}
+
+func (r ddayRepo) Delete(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.ddays, id)
+	return nil
+}
+
+func (r ddayRepo) HideMilestone(ctx context.Context, uid, key string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	sub(r.s.hiddenMilestones, uid)[key] = true
+	return nil
+}
+
+func (r ddayRepo) ShowMilestone(ctx context.Context, uid, key string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.hiddenMilestones[uid], key)
+	return nil
+}
+
+func (r ddayRepo) ListHiddenMilestones(ctx context.Context, uid string) ([]string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return sortedKeys(r.s.hiddenMilestones[uid]), nil
+}
+
+func (r ddayRepo) filter(keep func(store.DDay) bool) []store.DDay {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.DDay{}
+	for _, id := range sortedKeys(r.s.ddays) {
+		if d := r.s.ddays[id]; keep(d) {
+			out = append(out, *cloneDDay(d))
+		}
+	}
+	return out
+}
+
+func cloneDDay(d store.DDay) *store.DDay {
+	d.ConnectedUsers = cloneStrings(d.ConnectedUsers)
+	d.SharedWith = cloneStrings(d.SharedWith)
+	d.PendingUsers = cloneStrings(d.PendingUsers)
+	d.ExDates = cloneStrings(d.ExDates)
+	return &d
+}
+
+// events are stored with empty lists like firestore does
+func setEmptyShares(d *store.DDay) {
+	if d.ConnectedUsers == nil {
+		d.ConnectedUsers = []string{}
+	}
+	if d.SharedWith == nil {
+		d.SharedWith = []string{}
+	}
+}
@@ -0,0 +1,71 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"calple/store"
+)
+
+type feedbackRepo struct {
+	s *Store
+}
+
+func (r feedbackRepo) Create(ctx context.Context, uid string, f *store.Feedback) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	f.ID = newID()
+	sub(r.s.feedback, uid)[f.ID] = *f
+	return nil
+}
+
+func (r feedbackRepo) ListByUser(ctx context.Context, uid string) ([]store.Feedback, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Feedback{}
+	for _, f := range r.s.feedback[uid] {
+		out = append(out, f)
+	}
+	sortFeedback(out)
+	return out, nil
+}
+
+func (r feedbackRepo) List(ctx context.Context) ([]store.Feedback, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Feedback{}
+	for uid, feedback := range r.s.feedback {
+		for _, f := range feedback {
+			f.UserID = uid
+			out = append(out, f)
+		}
+	}
+	sortFeedback(out)
+	return out, nil
+}
+
+func (r feedbackRepo) SetAdminComment(ctx context.Context, uid, id, comment string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	f, ok := r.s.feedback[uid][id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	f.AdminComment = comment
+	r.s.feedback[uid][id] = f
+	return nil
+}
+
+// oldest first, the ID breaks ties so the order is stable
+func sortFeedback(out []store.Feedback) {
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].SubmittedAt.Equal(out[j].SubmittedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].SubmittedAt.Before(out[j].SubmittedAt)
+	})
+}
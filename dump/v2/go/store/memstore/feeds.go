@@ -0,0 +1,50 @@
+package memstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type feedRepo struct {
+	s *Store
+}
+
+func (r feedRepo) Get(ctx context.Context, uid string) (*store.Feed, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	f, ok := r.s.feeds[uid]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &f, nil
+}
+
+func (r feedRepo) GetByHash(ctx context.Context, hash string) (*store.Feed, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, f := range r.s.feeds {
+		if f.Hash == hash {
+			return &f, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (r feedRepo) Save(ctx context.Context, f *store.Feed) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.feeds[f.UserID] = *f
+	return nil
+}
+
+func (r feedRepo) Delete(ctx context.Context, uid string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.feeds, uid)
+	return nil
+}
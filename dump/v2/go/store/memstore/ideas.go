@@ -0,0 +1,218 @@
+package memstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type ideaRepo struct {
+	s *Store
+}
+
+func (r ideaRepo) List(ctx context.Context) ([]store.Idea, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Idea{}
+	for _, id := range sortedKeys(r.s.ideas) {
+		out = append(out, *cloneIdea(r.s.ideas[id]))
+	}
+	return out, nil
+}
+
+func (r ideaRepo) ListByAuthor(ctx context.Context, uid string) ([]store.Idea, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Idea{}
+	posts := r.s.posts[uid]
+	for _, id := range sortedKeys(posts) {
+		out = append(out, *cloneIdea(posts[id]))
+	}
+	return out, nil
+}
+
+func (r ideaRepo) Create(ctx context.Context, uid string, idea *store.Idea) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	idea.ID = newID()
+	r.s.ideas[idea.ID] = *cloneIdea(*idea)
+	sub(r.s.posts, uid)[idea.ID] = *cloneIdea(*idea)
+	return nil
+}
+
+func (r ideaRepo) Update(ctx context.Context, idea *store.Idea) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	prev, ok := r.s.ideas[idea.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	prev.Title = idea.Title
+	prev.Description = idea.Description
+	prev.Tags = cloneStrings(idea.Tags)
+	r.s.ideas[idea.ID] = prev
+	return nil
+}
+
+func (r ideaRepo) Delete(ctx context.Context, uid, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.ideas, id)
+	delete(r.s.posts[uid], id)
+	delete(r.s.comments, id)
+	return nil
+}
+
+func (r ideaRepo) ListComments(ctx context.Context, postID string) ([]store.Comment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Comment{}
+	comments := r.s.comments[postID]
+	for _, id := range sortedKeys(comments) {
+		out = append(out, comments[id])
+	}
+	return out, nil
+}
+
+func (r ideaRepo) AddComment(ctx context.Context, uid, postID string, cm *store.Comment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.ideas[postID]; !ok {
+		return store.ErrNotFound
+	}
+	cm.ID = newID()
+	sub(r.s.comments, postID)[cm.ID] = *cm
+	sub(r.s.userComments, uid)[cm.ID] = *cm
+	return nil
+}
+
+func (r ideaRepo) UpdateComment(ctx context.Context, postID string, cm *store.Comment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	prev, ok := r.s.comments[postID][cm.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	prev.Content = cm.Content
+	r.s.comments[postID][cm.ID] = prev
+	return nil
+}
+
+func (r ideaRepo) DeleteComment(ctx context.Context, uid, postID, commentID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.comments[postID], commentID)
+	delete(r.s.userComments[uid], commentID)
+	return nil
+}
+
+func (r ideaRepo) ListCommentsByUser(ctx context.Context, uid string) ([]store.Comment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Comment{}
+	comments := r.s.userComments[uid]
+	for _, id := range sortedKeys(comments) {
+		out = append(out, comments[id])
+	}
+	return out, nil
+}
+
+func (r ideaRepo) DeleteCommentsByUser(ctx context.Context, uid string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for commentID := range r.s.userComments[uid] {
+		for _, comments := range r.s.comments {
+			delete(comments, commentID)
+		}
+	}
+	delete(r.s.userComments, uid)
+	return nil
+}
+
+func (r ideaRepo) Author(ctx context.Context, postID string) (string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, uid := range sortedKeys(r.s.posts) {
+		if _, ok := r.s.posts[uid][postID]; ok {
+			return uid, nil
+		}
+	}
+	return "", store.ErrNotFound
+}
+
+func (r ideaRepo) CommentAuthor(ctx context.Context, postID, commentID string) (string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if _, ok := r.s.comments[postID][commentID]; !ok {
+		return "", store.ErrNotFound
+	}
+	for _, uid := range sortedKeys(r.s.userComments) {
+		if _, ok := r.s.userComments[uid][commentID]; ok {
+			return uid, nil
+		}
+	}
+	return "", store.ErrNotFound
+}
+
+func (r ideaRepo) AddLikes(ctx context.Context, uid, postID string, delta int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	idea, ok := r.s.ideas[postID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	idea.Likes += delta
+	r.s.ideas[postID] = idea
+
+	// the user's mirror only exists when they wrote the post
+	if post, ok := r.s.posts[uid][postID]; ok {
+		post.Likes += delta
+		r.s.posts[uid][postID] = post
+	}
+	return nil
+}
+
+func (r ideaRepo) Bookmark(ctx context.Context, uid, postID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	sub(r.s.bookmarks, uid)[postID] = true
+	return nil
+}
+
+func (r ideaRepo) Unbookmark(ctx context.Context, uid, postID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.bookmarks[uid], postID)
+	return nil
+}
+
+func (r ideaRepo) ListBookmarks(ctx context.Context, uid string) ([]string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return sortedKeys(r.s.bookmarks[uid]), nil
+}
+
+func cloneIdea(idea store.Idea) *store.Idea {
+	idea.Tags = cloneStrings(idea.Tags)
+	if idea.Comments != nil {
+		idea.Comments = append([]store.Comment{}, idea.Comments...)
+	}
+	return &idea
+}
@@ -0,0 +1,75 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"calple/store"
+)
+
+type identityRepo struct {
+	s *Store
+}
+
+func identityKey(provider, subject string) string {
+	return provider + ":" + subject
+}
+
+func cloneIdentity(id store.Identity) *store.Identity {
+	if id.Tokens != nil {
+		tokens := *id.Tokens
+		id.Tokens = &tokens
+	}
+	return &id
+}
+
+func (r identityRepo) Get(ctx context.Context, provider, subject string) (*store.Identity, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	id, ok := r.s.identities[identityKey(provider, subject)]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return cloneIdentity(id), nil
+}
+
+func (r identityRepo) ListByUser(ctx context.Context, uid string) ([]store.Identity, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Identity{}
+	for _, id := range r.s.identities {
+		if id.UserID == uid {
+			out = append(out, *cloneIdentity(id))
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return identityKey(out[i].Provider, out[i].Subject) < identityKey(out[j].Provider, out[j].Subject)
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (r identityRepo) Link(ctx context.Context, id *store.Identity) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.identities[identityKey(id.Provider, id.Subject)] = *cloneIdentity(*id)
+	return nil
+}
+
+func (r identityRepo) Unlink(ctx context.Context, uid, provider, subject string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	key := identityKey(provider, subject)
+	id, ok := r.s.identities[key]
+	if !ok || id.UserID != uid {
+		return store.ErrNotFound
+	}
+	delete(r.s.identities, key)
+	return nil
+}
@@ -0,0 +1,31 @@
+package memstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type loginTokenRepo struct {
+	s *Store
+}
+
+func (r loginTokenRepo) Create(ctx context.Context, t *store.LoginToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.loginTokens[t.Hash] = *t
+	return nil
+}
+
+func (r loginTokenRepo) Consume(ctx context.Context, purpose, hash string) (*store.LoginToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.loginTokens[hash]
+	if !ok || t.Purpose != purpose {
+		return nil, store.ErrNotFound
+	}
+	delete(r.s.loginTokens, hash)
+	return &t, nil
+}
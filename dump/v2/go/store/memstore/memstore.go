@@ -0,0 +1,118 @@
+// Package memstore implements store.Store in process memory
+// it is meant for local development and tests, everything is lost on restart
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"calple/store"
+)
+
+// Store keeps every collection in maps guarded by a single lock
+// so operations that touch several documents are atomic like firestore transactions
+type Store struct {
+	mu sync.RWMutex
+
+	users            map[string]store.User
+	connections      map[string]map[string]store.Connection // uid -> connection id
+	ddays            map[string]store.DDay
+	hiddenMilestones map[string]map[string]bool            // uid -> milestone key
+	periodDays       map[string]map[string]store.PeriodDay // uid -> day id
+	cycleSettings    map[string]store.CycleSettings        // uid
+	checkins         map[string]map[string]store.Checkin   // uid -> checkin id
+	pins             map[string]map[string]store.Pin       // uid -> pin id
+	ideas            map[string]store.Idea
+	posts            map[string]map[string]store.Idea    // uid -> post id, the user's mirror of ideas
+	comments         map[string]map[string]store.Comment // post id -> comment id
+	userComments     map[string]map[string]store.Comment // uid -> comment id
+	bookmarks        map[string]map[string]bool          // uid -> post id
+	roulette         map[string]store.Roulette
+	feedback         map[string]map[string]store.Feedback // uid -> feedback id
+	tokens           map[string]store.APIToken
+	feeds            map[string]store.Feed       // uid
+	identities       map[string]store.Identity   // provider:subject
+	loginTokens      map[string]store.LoginToken // hash
+	sessions         map[string]store.Session
+	migrations       map[string]store.MigrationRun
+}
+
+func New() *Store {
+	return &Store{
+		users:            map[string]store.User{},
+		connections:      map[string]map[string]store.Connection{},
+		ddays:            map[string]store.DDay{},
+		hiddenMilestones: map[string]map[string]bool{},
+		periodDays:       map[string]map[string]store.PeriodDay{},
+		cycleSettings:    map[string]store.CycleSettings{},
+		checkins:         map[string]map[string]store.Checkin{},
+		pins:             map[string]map[string]store.Pin{},
+		ideas:            map[string]store.Idea{},
+		posts:            map[string]map[string]store.Idea{},
+		comments:         map[string]map[string]store.Comment{},
+		userComments:     map[string]map[string]store.Comment{},
+		bookmarks:        map[string]map[string]bool{},
+		roulette:         map[string]store.Roulette{},
+		feedback:         map[string]map[string]store.Feedback{},
+		tokens:           map[string]store.APIToken{},
+		feeds:            map[string]store.Feed{},
+		identities:       map[string]store.Identity{},
+		loginTokens:      map[string]store.LoginToken{},
+		sessions:         map[string]store.Session{},
+		migrations:       map[string]store.MigrationRun{},
+	}
+}
+
+func (s *Store) Users() store.UserRepo             { return userRepo{s} }
+func (s *Store) Connections() store.ConnectionRepo { return connectionRepo{s} }
+func (s *Store) DDays() store.DDayRepo             { return ddayRepo{s} }
+func (s *Store) Periods() store.PeriodRepo         { return periodRepo{s} }
+func (s *Store) Checkins() store.CheckinRepo       { return checkinRepo{s} }
+func (s *Store) Pins() store.PinRepo               { return pinRepo{s} }
+func (s *Store) Ideas() store.IdeaRepo             { return ideaRepo{s} }
+func (s *Store) Roulette() store.RouletteRepo      { return rouletteRepo{s} }
+func (s *Store) Feedback() store.FeedbackRepo      { return feedbackRepo{s} }
+func (s *Store) Tokens() store.TokenRepo           { return tokenRepo{s} }
+func (s *Store) Feeds() store.FeedRepo             { return feedRepo{s} }
+func (s *Store) Identities() store.IdentityRepo    { return identityRepo{s} }
+func (s *Store) LoginTokens() store.LoginTokenRepo { return loginTokenRepo{s} }
+func (s *Store) Sessions() store.SessionRepo       { return sessionRepo{s} }
+func (s *Store) Migrations() store.MigrationRepo   { return migrationRepo{s} }
+
+func (s *Store) Ping(ctx context.Context) error { return nil }
+func (s *Store) Close() error                   { return nil }
+
+func newID() string {
+	return uuid.NewString()
+}
+
+// sub returns the nested map for key, creating it on first write
+func sub[T any](m map[string]map[string]T, key string) map[string]T {
+	inner, ok := m[key]
+	if !ok {
+		inner = map[string]T{}
+		m[key] = inner
+	}
+	return inner
+}
+
+// sortedKeys gives map iteration a stable order, firestore returns documents ordered by ID
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copy of a string slice so callers never share memory with the store
+func cloneStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	return append([]string{}, in...)
+}
@@ -0,0 +1,41 @@
+package memstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type migrationRepo struct {
+	s *Store
+}
+
+func (r migrationRepo) Get(ctx context.Context, name string) (*store.MigrationRun, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	run, ok := r.s.migrations[name]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &run, nil
+}
+
+func (r migrationRepo) List(ctx context.Context) ([]store.MigrationRun, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.MigrationRun{}
+	for _, name := range sortedKeys(r.s.migrations) {
+		out = append(out, r.s.migrations[name])
+	}
+	return out, nil
+}
+
+func (r migrationRepo) Save(ctx context.Context, run *store.MigrationRun) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.migrations[run.Name] = *run
+	return nil
+}
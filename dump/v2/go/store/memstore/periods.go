@@ -0,0 +1,87 @@
+package memstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type periodRepo struct {
+	s *Store
+}
+
+func (r periodRepo) ListDays(ctx context.Context, uid string) ([]store.PeriodDay, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.PeriodDay{}
+	days := r.s.periodDays[uid]
+	for _, id := range sortedKeys(days) {
+		out = append(out, *clonePeriodDay(days[id]))
+	}
+	return out, nil
+}
+
+func (r periodRepo) GetDay(ctx context.Context, uid, date string) (*store.PeriodDay, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	days := r.s.periodDays[uid]
+	for _, id := range sortedKeys(days) {
+		if days[id].Date == date {
+			return clonePeriodDay(days[id]), nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (r periodRepo) SaveDay(ctx context.Context, uid string, d *store.PeriodDay) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if d.ID == "" {
+		d.ID = newID()
+	}
+	d.UserID = uid
+	sub(r.s.periodDays, uid)[d.ID] = *clonePeriodDay(*d)
+	return nil
+}
+
+func (r periodRepo) DeleteDay(ctx context.Context, uid, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.periodDays[uid], id)
+	return nil
+}
+
+func (r periodRepo) GetSettings(ctx context.Context, uid string) (*store.CycleSettings, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	settings, ok := r.s.cycleSettings[uid]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &settings, nil
+}
+
+func (r periodRepo) SaveSettings(ctx context.Context, uid string, settings *store.CycleSettings) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if settings.ID == "" {
+		settings.ID = newID()
+	}
+	settings.UserID = uid
+	r.s.cycleSettings[uid] = *settings
+	return nil
+}
+
+func clonePeriodDay(d store.PeriodDay) *store.PeriodDay {
+	d.Symptoms = cloneStrings(d.Symptoms)
+	d.Mood = cloneStrings(d.Mood)
+	d.Activities = cloneStrings(d.Activities)
+	d.SexActivity = cloneStrings(d.SexActivity)
+	return &d
+}
@@ -0,0 +1,60 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"calple/store"
+)
+
+type pinRepo struct {
+	s *Store
+}
+
+func (r pinRepo) List(ctx context.Context, uid string) ([]store.Pin, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Pin{}
+	for _, p := range r.s.pins[uid] {
+		out = append(out, p)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (r pinRepo) Create(ctx context.Context, uid string, p *store.Pin) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	p.ID = newID()
+	sub(r.s.pins, uid)[p.ID] = *p
+	return nil
+}
+
+func (r pinRepo) Update(ctx context.Context, uid string, p *store.Pin) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	prev, ok := r.s.pins[uid][p.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	// createdAt is not part of an update
+	p.CreatedAt = prev.CreatedAt
+	r.s.pins[uid][p.ID] = *p
+	return nil
+}
+
+func (r pinRepo) Delete(ctx context.Context, uid, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.pins[uid], id)
+	return nil
+}
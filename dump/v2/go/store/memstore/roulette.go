@@ -0,0 +1,47 @@
+package memstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type rouletteRepo struct {
+	s *Store
+}
+
+func (r rouletteRepo) List(ctx context.Context) ([]store.Roulette, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Roulette{}
+	for _, id := range sortedKeys(r.s.roulette) {
+		out = append(out, r.s.roulette[id])
+	}
+	return out, nil
+}
+
+func (r rouletteRepo) Create(ctx context.Context, item *store.Roulette) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	item.ID = newID()
+	r.s.roulette[item.ID] = *item
+	return nil
+}
+
+func (r rouletteRepo) Update(ctx context.Context, item *store.Roulette) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.roulette[item.ID] = *item
+	return nil
+}
+
+func (r rouletteRepo) Delete(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.roulette, id)
+	return nil
+}
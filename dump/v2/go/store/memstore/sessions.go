@@ -0,0 +1,94 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"calple/store"
+)
+
+type sessionRepo struct {
+	s *Store
+}
+
+func cloneSession(sess store.Session) *store.Session {
+	values := make(map[string]string, len(sess.Values))
+	for k, v := range sess.Values {
+		values[k] = v
+	}
+	sess.Values = values
+	return &sess
+}
+
+func (r sessionRepo) Get(ctx context.Context, id string) (*store.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	sess, ok := r.s.sessions[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return cloneSession(sess), nil
+}
+
+func (r sessionRepo) ListByUser(ctx context.Context, uid string) ([]store.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.Session{}
+	for _, sess := range r.s.sessions {
+		if sess.UserID == uid {
+			out = append(out, *cloneSession(sess))
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].LastSeenAt.Equal(out[j].LastSeenAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].LastSeenAt.After(out[j].LastSeenAt)
+	})
+	return out, nil
+}
+
+func (r sessionRepo) Save(ctx context.Context, sess *store.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.sessions[sess.ID] = *cloneSession(*sess)
+	return nil
+}
+
+func (r sessionRepo) Delete(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.sessions, id)
+	return nil
+}
+
+func (r sessionRepo) DeleteByUser(ctx context.Context, uid, keepID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, sess := range r.s.sessions {
+		if sess.UserID == uid && id != keepID {
+			delete(r.s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r sessionRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	deleted := 0
+	for id, sess := range r.s.sessions {
+		if sess.ExpiresAt.Before(now) {
+			delete(r.s.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,82 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"calple/store"
+)
+
+type tokenRepo struct {
+	s *Store
+}
+
+func (r tokenRepo) GetByHash(ctx context.Context, hash string) (*store.APIToken, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, t := range r.s.tokens {
+		if t.Hash == hash {
+			t.Scopes = append([]string{}, t.Scopes...)
+			return &t, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (r tokenRepo) ListByUser(ctx context.Context, uid string) ([]store.APIToken, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.APIToken{}
+	for _, t := range r.s.tokens {
+		if t.UserID == uid {
+			t.Scopes = append([]string{}, t.Scopes...)
+			out = append(out, t)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (r tokenRepo) Create(ctx context.Context, t *store.APIToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t.ID = newID()
+	stored := *t
+	stored.Scopes = append([]string{}, t.Scopes...)
+	r.s.tokens[t.ID] = stored
+	return nil
+}
+
+func (r tokenRepo) Delete(ctx context.Context, uid, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.tokens[id]
+	if !ok || t.UserID != uid {
+		return store.ErrNotFound
+	}
+	delete(r.s.tokens, id)
+	return nil
+}
+
+func (r tokenRepo) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.tokens[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	t.LastUsedAt = at
+	r.s.tokens[id] = t
+	return nil
+}
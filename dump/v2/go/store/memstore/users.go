@@ -0,0 +1,109 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"calple/store"
+)
+
+type userRepo struct {
+	s *Store
+}
+
+func (r userRepo) Get(ctx context.Context, id string) (*store.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return cloneUser(u), nil
+}
+
+func (r userRepo) GetByEmail(ctx context.Context, email string) (*store.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, id := range sortedKeys(r.s.users) {
+		if u := r.s.users[id]; u.Email == email {
+			return cloneUser(u), nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (r userRepo) Save(ctx context.Context, u *store.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.users[u.ID] = *cloneUser(*u)
+	return nil
+}
+
+func (r userRepo) Delete(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.users, id)
+	return nil
+}
+
+func (r userRepo) List(ctx context.Context, after string, limit int) ([]store.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.User{}
+	for _, id := range sortedKeys(r.s.users) {
+		if id <= after {
+			continue
+		}
+		if len(out) == limit {
+			break
+		}
+		out = append(out, *cloneUser(r.s.users[id]))
+	}
+	return out, nil
+}
+
+func (r userRepo) ListDeleted(ctx context.Context, before time.Time) ([]store.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	out := []store.User{}
+	for _, id := range sortedKeys(r.s.users) {
+		if u := r.s.users[id]; !u.DeletedAt.IsZero() && !u.DeletedAt.After(before) {
+			out = append(out, *cloneUser(u))
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].DeletedAt.Before(out[j].DeletedAt) })
+	return out, nil
+}
+
+func (r userRepo) Purge(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.connections, id)
+	delete(r.s.periodDays, id)
+	delete(r.s.cycleSettings, id)
+	delete(r.s.checkins, id)
+	delete(r.s.pins, id)
+	delete(r.s.posts, id)
+	delete(r.s.userComments, id)
+	delete(r.s.bookmarks, id)
+	delete(r.s.hiddenMilestones, id)
+	delete(r.s.feedback, id)
+	delete(r.s.users, id)
+	return nil
+}
+
+func cloneUser(u store.User) *store.User {
+	if u.Tokens != nil {
+		tokens := *u.Tokens
+		u.Tokens = &tokens
+	}
+	return &u
+}
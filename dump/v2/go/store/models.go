@@ -0,0 +1,248 @@
+package store
+
+import "time"
+
+// connection status and role values stored on connection documents
+const (
+	StatusPending = "pending"
+	StatusActive  = "active"
+
+	RoleInitiator = "initiator" // user1, the one who sent the invitation
+	RoleReceiver  = "receiver"  // user2
+)
+
+type User struct {
+	ID            string       `json:"id" firestore:"-"`
+	Email         string       `json:"email" firestore:"email"`
+	Name          string       `json:"name" firestore:"name"`
+	Sex           string       `json:"sex" firestore:"sex"`
+	StartedDating string       `json:"startedDating" firestore:"startedDating"` // MM/DD/YYYY
+	Tokens        *OAuthTokens `json:"-" firestore:"tokens,omitempty"`          // encrypted, never sent to clients
+	ReturningUser bool         `json:"returning_user" firestore:"returning_user"`
+	LastLoginAt   time.Time    `json:"last_login_at" firestore:"last_login_at"`
+	CreatedAt     time.Time    `json:"created_at" firestore:"created_at"`
+	UpdatedAt     time.Time    `json:"updatedAt" firestore:"updatedAt"`
+	// set while a deleted account waits out the grace period before it is purged
+	DeletedAt time.Time `json:"-" firestore:"deletedAt,omitempty"`
+}
+
+// google oauth tokens saved after login
+type OAuthTokens struct {
+	AccessToken  string    `json:"access_token" firestore:"access_token"`
+	RefreshToken string    `json:"refresh_token" firestore:"refresh_token"`
+	Expiry       time.Time `json:"expiry" firestore:"expiry"`
+}
+
+// the partner is referenced by PartnerUID, PartnerEmail is only shown and follows email changes
+type Connection struct {
+	ID           string    `json:"id" firestore:"-"`
+	PartnerEmail string    `json:"partnerEmail" firestore:"partnerEmail"`
+	PartnerUID   string    `json:"partnerUID,omitempty" firestore:"partnerUID,omitempty"`
+	Role         string    `json:"role" firestore:"role"`
+	Status       string    `json:"status" firestore:"status"`
+	CreatedAt    time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// events belong to CreatorID and are shared with the users in SharedWith
+// CreatedBy and ConnectedUsers are their emails for display, ConnectedUsers[i] is the email of SharedWith[i]
+// PendingUsers are emails it is shared with that have no account yet, they give no access until they sign up
+// CalDAVName is the resource name a calendar app gave the event when it created it, empty for the others
+type DDay struct {
+	ID             string    `json:"id" firestore:"-"`
+	Title          string    `json:"title" firestore:"title"`
+	Group          string    `json:"group" firestore:"group"`
+	Description    string    `json:"description" firestore:"description"`
+	Date           string    `json:"date,omitempty" firestore:"date"`       // YYYYMMDD
+	EndDate        string    `json:"endDate,omitempty" firestore:"endDate"` // YYYYMMDD
+	ImageURL       string    `json:"imageUrl,omitempty" firestore:"imageUrl"`
+	IsAnnual       bool      `json:"isAnnual" firestore:"isAnnual"`                   // kept in step with RRule being the yearly rule
+	RRule          string    `json:"rrule,omitempty" firestore:"rrule,omitempty"`     // RFC 5545 recurrence rule, Date is the first occurrence
+	ExDates        []string  `json:"exdates,omitempty" firestore:"exdates,omitempty"` // YYYYMMDD, occurrences left out
+	ICalUID        string    `json:"icalUid,omitempty" firestore:"icalUid,omitempty"` // UID of the calendar event it was imported from
+	CalDAVName     string    `json:"caldavName,omitempty" firestore:"caldavName,omitempty"`
+	CreatedBy      string    `json:"createdBy" firestore:"createdBy"`
+	CreatorID      string    `json:"creatorId" firestore:"creatorId"`
+	ConnectedUsers []string  `json:"connectedUsers" firestore:"connectedUsers"`
+	SharedWith     []string  `json:"sharedWith" firestore:"sharedWith"`
+	PendingUsers   []string  `json:"-" firestore:"pendingUsers,omitempty"`
+	CreatedAt      time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt" firestore:"updatedAt"`
+	Editable       bool      `json:"editable,omitempty" firestore:"editable"` // if the event can be edited by the user
+	// start dates (YYYYMMDD) of the occurrences in the requested month, never stored
+	Occurrences []string `json:"occurrences,omitempty" firestore:"-"`
+	// set on the milestones generated from startedDating, which are never stored
+	// Milestone is the key to hide them with
+	System    bool   `json:"system,omitempty" firestore:"-"`
+	Milestone string `json:"milestone,omitempty" firestore:"-"`
+}
+
+type PeriodDay struct {
+	ID             string    `json:"id" firestore:"-"`
+	UserID         string    `json:"userId" firestore:"-"`
+	Date           string    `json:"date" firestore:"date"` // YYYY-MM-DD
+	IsPeriod       bool      `json:"isPeriod" firestore:"isPeriod"`
+	Symptoms       []string  `json:"symptoms" firestore:"symptoms"`
+	CrampIntensity int64     `json:"crampIntensity" firestore:"crampIntensity"`
+	Mood           []string  `json:"mood" firestore:"mood"`
+	Activities     []string  `json:"activities" firestore:"activities"`
+	SexActivity    []string  `json:"sexActivity" firestore:"sexActivity"`
+	Notes          string    `json:"notes" firestore:"notes"`
+	CreatedAt      time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type CycleSettings struct {
+	ID           string    `json:"id" firestore:"-"`
+	UserID       string    `json:"userId" firestore:"-"`
+	CycleLength  int64     `json:"cycleLength" firestore:"cycleLength"`
+	PeriodLength int64     `json:"periodLength" firestore:"periodLength"`
+	CreatedAt    time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// daily checkin entry
+type Checkin struct {
+	ID           string    `json:"id" firestore:"-"`
+	UserID       string    `json:"userId" firestore:"userId"`
+	Date         string    `json:"date" firestore:"date"` // YYYY-MM-DD
+	Mood         string    `json:"mood" firestore:"mood"`
+	Energy       string    `json:"energy" firestore:"energy"`
+	PeriodStatus string    `json:"periodStatus" firestore:"periodStatus,omitempty"`
+	SexualMood   string    `json:"sexualMood" firestore:"sexualMood,omitempty"`
+	Note         string    `json:"note" firestore:"note,omitempty"`
+	CreatedAt    time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type Pin struct {
+	ID          string    `json:"id" firestore:"-"`
+	Lat         float64   `json:"lat" firestore:"lat"`
+	Lng         float64   `json:"lng" firestore:"lng"`
+	Title       string    `json:"title" firestore:"title"`
+	Description string    `json:"description" firestore:"description"`
+	Location    string    `json:"location" firestore:"location"`
+	Date        string    `json:"date" firestore:"date"` // ISO yyyy-MM-dd
+	CreatedAt   time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// ideas were first written with the go field names as firestore keys
+// so Idea, Comment and Roulette carry no firestore tags
+type Idea struct {
+	ID          string    `json:"id" firestore:"-"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Author      string    `json:"author"`
+	CreatedAt   string    `json:"created_at"`
+	UpdatedAt   string    `json:"updated_at"`
+	Likes       int       `json:"likes"`
+	Tags        []string  `json:"tags"`
+	Comments    []Comment `json:"comments"`
+}
+
+type Comment struct {
+	ID        string `json:"id" firestore:"-"`
+	Author    string `json:"author"`
+	CreatedAt string `json:"created_at"`
+	Content   string `json:"content"`
+}
+
+type Roulette struct {
+	ID          string `json:"id" firestore:"-"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type Feedback struct {
+	ID           string    `json:"id" firestore:"-"`
+	UserID       string    `json:"-" firestore:"-"` // only set by List
+	FeedbackText string    `json:"feedbackText" firestore:"feedbackText"`
+	Category     string    `json:"category" firestore:"category"`
+	AdminComment string    `json:"adminComment" firestore:"adminComment"`
+	SubmittedAt  time.Time `json:"submittedAt" firestore:"submittedAt"`
+}
+
+// personal access token for scripts and native clients
+// only the sha256 hash of the secret is stored, the secret itself is shown once on creation
+type APIToken struct {
+	ID         string    `json:"id" firestore:"-"`
+	UserID     string    `json:"-" firestore:"userId"`
+	Name       string    `json:"name" firestore:"name"`
+	Prefix     string    `json:"prefix" firestore:"prefix"` // start of the secret so users can tell tokens apart
+	Hash       string    `json:"-" firestore:"hash"`
+	Scopes     []string  `json:"scopes" firestore:"scopes"`
+	CreatedAt  time.Time `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt" firestore:"expiresAt"` // zero if the token does not expire
+	LastUsedAt time.Time `json:"lastUsedAt" firestore:"lastUsedAt"`
+}
+
+// secret calendar feed of a user, the url carries the secret and only its hash is stored
+type Feed struct {
+	UserID    string    `json:"-" firestore:"-"`
+	Prefix    string    `json:"prefix" firestore:"prefix"` // start of the secret so users can tell feeds apart
+	Hash      string    `json:"-" firestore:"hash"`
+	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// external account linked to a user, the provider's subject is stable while the email can change
+type Identity struct {
+	Provider    string       `json:"provider" firestore:"provider"`
+	Subject     string       `json:"subject" firestore:"subject"`
+	UserID      string       `json:"-" firestore:"userId"`
+	Email       string       `json:"email" firestore:"email"`
+	Tokens      *OAuthTokens `json:"-" firestore:"tokens,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt" firestore:"createdAt"`
+	LastLoginAt time.Time    `json:"lastLoginAt" firestore:"lastLoginAt"`
+
+	// bcrypt hash, only for the "email" provider and empty for magic link only accounts
+	PasswordHash string `json:"-" firestore:"passwordHash,omitempty"`
+}
+
+// login token purposes
+const (
+	LoginTokenVerify = "verify" // confirms the email of a signup
+	LoginTokenReset  = "reset"  // sets a new password
+	LoginTokenMagic  = "magic"  // signs in without a password
+	LoginTokenEmail  = "email"  // confirms a new email for an account
+)
+
+// single use secret sent by email, only the sha256 hash of the secret is stored
+type LoginToken struct {
+	Hash    string `json:"-" firestore:"-"`
+	Purpose string `json:"purpose" firestore:"purpose"`
+	Email   string `json:"email" firestore:"email"`
+	// the account a reset or email change is for, empty for signups and magic links
+	UserID string `json:"-" firestore:"userId"`
+	// the signup details, kept until the email is verified
+	Name         string    `json:"-" firestore:"name,omitempty"`
+	PasswordHash string    `json:"-" firestore:"passwordHash,omitempty"`
+	CreatedAt    time.Time `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt" firestore:"expiresAt"`
+}
+
+// progress of a data migration, recorded after every batch so an interrupted run resumes
+type MigrationRun struct {
+	Name      string    `json:"name" firestore:"-"`
+	Cursor    string    `json:"cursor" firestore:"cursor"` // ID of the last user the migration finished
+	Users     int       `json:"users" firestore:"users"`
+	Changed   int       `json:"changed" firestore:"changed"`
+	StartedAt time.Time `json:"startedAt" firestore:"startedAt"`
+	// zero until every user is done
+	FinishedAt time.Time `json:"finishedAt" firestore:"finishedAt"`
+}
+
+// server side session, the cookie holds a random secret and the ID is its sha256
+// so the stored sessions cannot be used to sign in
+type Session struct {
+	ID     string `json:"id" firestore:"-"`
+	UserID string `json:"-" firestore:"userId"` // empty before sign in
+	// the values handlers set on the session, like user_id and the oauth state
+	Values     map[string]string `json:"-" firestore:"values"`
+	UserAgent  string            `json:"userAgent" firestore:"userAgent"`
+	IP         string            `json:"ip" firestore:"ip"`
+	Remember   bool              `json:"remember" firestore:"remember"`
+	CreatedAt  time.Time         `json:"createdAt" firestore:"createdAt"`
+	LastSeenAt time.Time         `json:"lastSeenAt" firestore:"lastSeenAt"`
+	ExpiresAt  time.Time         `json:"expiresAt" firestore:"expiresAt"`
+}
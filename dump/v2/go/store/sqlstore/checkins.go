@@ -0,0 +1,78 @@
+package sqlstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type checkinRepo struct {
+	s *Store
+}
+
+func (r checkinRepo) List(ctx context.Context, uid string) ([]store.Checkin, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT id, user_id, date, mood, energy, period_status, sexual_mood, note,
+			created_at, updated_at
+		FROM checkins WHERE user_id = ? ORDER BY date, id`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Checkin{}
+	for rows.Next() {
+		ci, err := scanCheckin(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *ci)
+	}
+	return out, rows.Err()
+}
+
+func (r checkinRepo) GetByDate(ctx context.Context, uid, date string) (*store.Checkin, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT id, user_id, date, mood, energy, period_status, sexual_mood, note,
+			created_at, updated_at
+		FROM checkins WHERE user_id = ? AND date = ? ORDER BY id LIMIT 1`, uid, date)
+	return scanCheckin(row)
+}
+
+func (r checkinRepo) Save(ctx context.Context, uid string, ci *store.Checkin) error {
+	if ci.ID == "" {
+		ci.ID = newID()
+	}
+	ci.UserID = uid
+	_, err := r.s.conn().exec(ctx, `INSERT INTO checkins (id, user_id, date, mood, energy, period_status, sexual_mood, note,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			date = excluded.date,
+			mood = excluded.mood,
+			energy = excluded.energy,
+			period_status = excluded.period_status,
+			sexual_mood = excluded.sexual_mood,
+			note = excluded.note,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at`,
+		ci.ID, uid, ci.Date, ci.Mood, ci.Energy, ci.PeriodStatus, ci.SexualMood, ci.Note,
+		formatTime(ci.CreatedAt), formatTime(ci.UpdatedAt))
+	return err
+}
+
+func (r checkinRepo) Delete(ctx context.Context, uid, id string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM checkins WHERE user_id = ? AND id = ?`, uid, id)
+	return err
+}
+
+func scanCheckin(row scanner) (*store.Checkin, error) {
+	var ci store.Checkin
+	var createdAt, updatedAt string
+	err := row.Scan(&ci.ID, &ci.UserID, &ci.Date, &ci.Mood, &ci.Energy, &ci.PeriodStatus, &ci.SexualMood, &ci.Note,
+		&createdAt, &updatedAt)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	ci.CreatedAt = parseTime(createdAt)
+	ci.UpdatedAt = parseTime(updatedAt)
+	return &ci, nil
+}
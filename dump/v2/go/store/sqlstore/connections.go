@@ -0,0 +1,147 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"calple/store"
+)
+
+type connectionRepo struct {
+	s *Store
+}
+
+const connectionColumns = `id, partner_email, partner_uid, role, status, created_at, updated_at`
+
+func (r connectionRepo) Get(ctx context.Context, uid, id string) (*store.Connection, error) {
+	conns, err := r.list(ctx, `WHERE user_id = ? AND id = ?`, uid, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(conns) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &conns[0], nil
+}
+
+func (r connectionRepo) List(ctx context.Context, uid string) ([]store.Connection, error) {
+	return r.list(ctx, `WHERE user_id = ?`, uid)
+}
+
+func (r connectionRepo) ListByStatus(ctx context.Context, uid, status string) ([]store.Connection, error) {
+	return r.list(ctx, `WHERE user_id = ? AND status = ?`, uid, status)
+}
+
+func (r connectionRepo) Active(ctx context.Context, uid string) (*store.Connection, error) {
+	conns, err := r.list(ctx, `WHERE user_id = ? AND status = ?`, uid, store.StatusActive)
+	if err != nil {
+		return nil, err
+	}
+	if len(conns) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &conns[0], nil
+}
+
+func (r connectionRepo) FindByPartner(ctx context.Context, uid, partnerUID string) (*store.Connection, error) {
+	conns, err := r.list(ctx, `WHERE user_id = ? AND partner_uid = ?`, uid, partnerUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(conns) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &conns[0], nil
+}
+
+func (r connectionRepo) Invite(ctx context.Context, fromUID, fromEmail, toUID, toEmail string) (string, error) {
+	id := newID()
+	now := formatTime(time.Now())
+	err := r.s.inTx(ctx, func(q boundQuerier) error {
+		insert := `INSERT INTO connections (user_id, id, partner_email, partner_uid, role, status, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		if _, err := q.exec(ctx, insert, fromUID, id, toEmail, toUID, store.RoleInitiator, store.StatusPending, now, now); err != nil {
+			return err
+		}
+		_, err := q.exec(ctx, insert, toUID, id, fromEmail, fromUID, store.RoleReceiver, store.StatusPending, now, now)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (r connectionRepo) Accept(ctx context.Context, uid, partnerUID, id string) error {
+	now := formatTime(time.Now())
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		update := `UPDATE connections SET status = ?, partner_uid = ?, updated_at = ? WHERE user_id = ? AND id = ?`
+		if err := mustAffect(q.exec(ctx, update, store.StatusActive, partnerUID, now, uid, id)); err != nil {
+			return err
+		}
+		return mustAffect(q.exec(ctx, update, store.StatusActive, uid, now, partnerUID, id))
+	})
+}
+
+func (r connectionRepo) Remove(ctx context.Context, uid, partnerUID, id string) error {
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		if _, err := q.exec(ctx, `DELETE FROM connections WHERE user_id = ? AND id = ?`, uid, id); err != nil {
+			return err
+		}
+		if partnerUID == "" {
+			return nil
+		}
+		_, err := q.exec(ctx, `DELETE FROM connections WHERE user_id = ? AND id = ?`, partnerUID, id)
+		return err
+	})
+}
+
+func (r connectionRepo) SetPartnerEmail(ctx context.Context, uid, email string) error {
+	_, err := r.s.conn().exec(ctx, `UPDATE connections SET partner_email = ? WHERE partner_uid = ?`, email, uid)
+	return err
+}
+
+func (r connectionRepo) Owners(ctx context.Context) ([]string, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT DISTINCT user_id FROM connections ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		out = append(out, uid)
+	}
+	return out, rows.Err()
+}
+
+func (r connectionRepo) list(ctx context.Context, where string, args ...any) ([]store.Connection, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT `+connectionColumns+` FROM connections `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Connection{}
+	for rows.Next() {
+		conn, err := scanConnection(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, conn)
+	}
+	return out, rows.Err()
+}
+
+func scanConnection(rows scanner) (store.Connection, error) {
+	var conn store.Connection
+	var createdAt, updatedAt string
+	err := rows.Scan(&conn.ID, &conn.PartnerEmail, &conn.PartnerUID, &conn.Role, &conn.Status, &createdAt, &updatedAt)
+	conn.CreatedAt = parseTime(createdAt)
+	conn.UpdatedAt = parseTime(updatedAt)
+	return conn, err
+}
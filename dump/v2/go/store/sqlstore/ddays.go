@@ -0,0 +1,211 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"calple/store"
+)
+
+type ddayRepo struct {
+	s *Store
+}
+
+func (r ddayRepo) Get(ctx context.Context, id string) (*store.DDay, error) {
+	ddays, err := r.query(ctx, `d.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ddays) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &ddays[0], nil
+}
+
+// one query instead of firestore's three, the creator_id and connected user indexes cover both branches
+func (r ddayRepo) ListVisible(ctx context.Context, uid, until string) ([]store.DDay, error) {
+	return r.query(ctx, `(d.creator_id = ? AND (d.is_annual OR d.date <= ?))
+		OR (d.date <= ? AND EXISTS (
+			SELECT 1 FROM dday_connected_users v WHERE v.dday_id = d.id AND v.user_id = ?))`,
+		uid, until, until, uid)
+}
+
+func (r ddayRepo) ListByCreator(ctx context.Context, uid string) ([]store.DDay, error) {
+	return r.query(ctx, `d.creator_id = ?`, uid)
+}
+
+// pending emails are the connected users without a user id
+func (r ddayRepo) ListPending(ctx context.Context, email string) ([]store.DDay, error) {
+	return r.query(ctx, `d.id IN (SELECT dday_id FROM dday_connected_users WHERE email = ? AND user_id = '')`, email)
+}
+
+// the page is picked in a subquery, the join gives one row per connected user
+func (r ddayRepo) List(ctx context.Context, after string, limit int) ([]store.DDay, error) {
+	return r.query(ctx, `d.id IN (SELECT id FROM ddays WHERE id > ? ORDER BY id LIMIT ?)`, after, limit)
+}
+
+func (r ddayRepo) Create(ctx context.Context, d *store.DDay) error {
+	d.ID = newID()
+	setEmptyShares(d)
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		_, err := q.exec(ctx, `INSERT INTO ddays (id, title, group_name, description, date, end_date, image_url,
+				is_annual, rrule, exdates, ical_uid, caldav_name, created_by, creator_id, editable, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.ID, d.Title, d.Group, d.Description, d.Date, d.EndDate, d.ImageURL,
+			d.IsAnnual, d.RRule, encodeList(d.ExDates), d.ICalUID, d.CalDAVName, d.CreatedBy, d.CreatorID, d.Editable, formatTime(d.CreatedAt), formatTime(d.UpdatedAt))
+		if err != nil {
+			return err
+		}
+		return setConnectedUsers(ctx, q, d)
+	})
+}
+
+// Update overwrites the whole event like a firestore Set
+func (r ddayRepo) Update(ctx context.Context, d *store.DDay) error {
+	setEmptyShares(d)
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		_, err := q.exec(ctx, `UPDATE ddays SET title = ?, group_name = ?, description = ?, date = ?, end_date = ?,
+				image_url = ?, is_annual = ?, rrule = ?, exdates = ?, ical_uid = ?, caldav_name = ?, created_by = ?, creator_id = ?, editable = ?,
+				created_at = ?, updated_at = ?
+			WHERE id = ?`,
+			d.Title, d.Group, d.Description, d.Date, d.EndDate,
+			d.ImageURL, d.IsAnnual, d.RRule, encodeList(d.ExDates), d.ICalUID, d.CalDAVName, d.CreatedBy, d.CreatorID, d.Editable, formatTime(d.CreatedAt), formatTime(d.UpdatedAt),
+			d.ID)
+		if err != nil {
+			return err
+		}
+		return setConnectedUsers(ctx, q, d)
+	})
+}
+
+func (r ddayRepo) Delete(ctx context.Context, id string) error {
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		if _, err := q.exec(ctx, `DELETE FROM dday_connected_users WHERE dday_id = ?`, id); err != nil {
+			return err
+		}
+		_, err := q.exec(ctx, `DELETE FROM ddays WHERE id = ?`, id)
+		return err
+	})
+}
+
+func (r ddayRepo) HideMilestone(ctx context.Context, uid, key string) error {
+	_, err := r.s.conn().exec(ctx, `INSERT INTO hidden_milestones (user_id, key) VALUES (?, ?)
+		ON CONFLICT (user_id, key) DO NOTHING`, uid, key)
+	return err
+}
+
+func (r ddayRepo) ShowMilestone(ctx context.Context, uid, key string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM hidden_milestones WHERE user_id = ? AND key = ?`, uid, key)
+	return err
+}
+
+func (r ddayRepo) ListHiddenMilestones(ctx context.Context, uid string) ([]string, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT key FROM hidden_milestones WHERE user_id = ? ORDER BY key`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		out = append(out, key)
+	}
+	return out, rows.Err()
+}
+
+// replaces the connected user rows of the event, one per email with the user it belongs to
+// the pending emails follow with an empty user
+func setConnectedUsers(ctx context.Context, q boundQuerier, d *store.DDay) error {
+	if _, err := q.exec(ctx, `DELETE FROM dday_connected_users WHERE dday_id = ?`, d.ID); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for i, email := range d.ConnectedUsers {
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		uid := ""
+		if i < len(d.SharedWith) {
+			uid = d.SharedWith[i]
+		}
+		if _, err := q.exec(ctx, `INSERT INTO dday_connected_users (dday_id, email, user_id, position) VALUES (?, ?, ?, ?)`,
+			d.ID, email, uid, i); err != nil {
+			return err
+		}
+	}
+	for i, email := range d.PendingUsers {
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		if _, err := q.exec(ctx, `INSERT INTO dday_connected_users (dday_id, email, user_id, position) VALUES (?, ?, '', ?)`,
+			d.ID, email, len(d.ConnectedUsers)+i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query loads the events matching where together with their connected users
+// the left join gives one row per connected user, folded back into one event per id
+func (r ddayRepo) query(ctx context.Context, where string, args ...any) ([]store.DDay, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT d.id, d.title, d.group_name, d.description, d.date, d.end_date,
+			d.image_url, d.is_annual, d.rrule, d.exdates, d.ical_uid, d.caldav_name, d.created_by, d.creator_id, d.editable, d.created_at, d.updated_at,
+			cu.email, cu.user_id
+		FROM ddays d
+		LEFT JOIN dday_connected_users cu ON cu.dday_id = d.id
+		WHERE `+where+`
+		ORDER BY d.id, cu.position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.DDay{}
+	for rows.Next() {
+		var d store.DDay
+		var exdates, createdAt, updatedAt string
+		var email, uid sql.NullString
+		err := rows.Scan(&d.ID, &d.Title, &d.Group, &d.Description, &d.Date, &d.EndDate,
+			&d.ImageURL, &d.IsAnnual, &d.RRule, &exdates, &d.ICalUID, &d.CalDAVName, &d.CreatedBy, &d.CreatorID, &d.Editable, &createdAt, &updatedAt, &email, &uid)
+		if err != nil {
+			return nil, err
+		}
+
+		if n := len(out); n == 0 || out[n-1].ID != d.ID {
+			d.CreatedAt = parseTime(createdAt)
+			d.UpdatedAt = parseTime(updatedAt)
+			if list := decodeList(exdates); len(list) > 0 {
+				d.ExDates = list
+			}
+			d.ConnectedUsers = []string{}
+			d.SharedWith = []string{}
+			out = append(out, d)
+		}
+		last := &out[len(out)-1]
+		switch {
+		case !email.Valid:
+		case uid.String == "":
+			last.PendingUsers = append(last.PendingUsers, email.String)
+		default:
+			last.ConnectedUsers = append(last.ConnectedUsers, email.String)
+			last.SharedWith = append(last.SharedWith, uid.String)
+		}
+	}
+	return out, rows.Err()
+}
+
+// events are returned with empty lists like firestore does
+func setEmptyShares(d *store.DDay) {
+	if d.ConnectedUsers == nil {
+		d.ConnectedUsers = []string{}
+	}
+	if d.SharedWith == nil {
+		d.SharedWith = []string{}
+	}
+}
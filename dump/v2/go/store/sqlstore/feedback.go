@@ -0,0 +1,53 @@
+package sqlstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type feedbackRepo struct {
+	s *Store
+}
+
+func (r feedbackRepo) Create(ctx context.Context, uid string, f *store.Feedback) error {
+	f.ID = newID()
+	_, err := r.s.conn().exec(ctx, `INSERT INTO feedback (id, user_id, feedback_text, category, admin_comment, submitted_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		f.ID, uid, f.FeedbackText, f.Category, f.AdminComment, formatTime(f.SubmittedAt))
+	return err
+}
+
+func (r feedbackRepo) ListByUser(ctx context.Context, uid string) ([]store.Feedback, error) {
+	return r.list(ctx, `WHERE user_id = ? ORDER BY submitted_at, id`, uid)
+}
+
+func (r feedbackRepo) List(ctx context.Context) ([]store.Feedback, error) {
+	return r.list(ctx, `ORDER BY submitted_at, id`)
+}
+
+func (r feedbackRepo) SetAdminComment(ctx context.Context, uid, id, comment string) error {
+	return mustAffect(r.s.conn().exec(ctx, `UPDATE feedback SET admin_comment = ? WHERE user_id = ? AND id = ?`,
+		comment, uid, id))
+}
+
+func (r feedbackRepo) list(ctx context.Context, where string, args ...any) ([]store.Feedback, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT id, user_id, feedback_text, category, admin_comment, submitted_at
+		FROM feedback `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Feedback{}
+	for rows.Next() {
+		var f store.Feedback
+		var submittedAt string
+		if err := rows.Scan(&f.ID, &f.UserID, &f.FeedbackText, &f.Category, &f.AdminComment, &submittedAt); err != nil {
+			return nil, err
+		}
+		f.SubmittedAt = parseTime(submittedAt)
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
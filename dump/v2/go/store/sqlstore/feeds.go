@@ -0,0 +1,48 @@
+package sqlstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type feedRepo struct {
+	s *Store
+}
+
+const feedColumns = `user_id, prefix, hash, created_at`
+
+func (r feedRepo) Get(ctx context.Context, uid string) (*store.Feed, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+feedColumns+` FROM feeds WHERE user_id = ?`, uid)
+	return scanFeed(row)
+}
+
+func (r feedRepo) GetByHash(ctx context.Context, hash string) (*store.Feed, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+feedColumns+` FROM feeds WHERE hash = ?`, hash)
+	return scanFeed(row)
+}
+
+func (r feedRepo) Save(ctx context.Context, f *store.Feed) error {
+	_, err := r.s.conn().exec(ctx, `INSERT INTO feeds (`+feedColumns+`) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			prefix = excluded.prefix,
+			hash = excluded.hash,
+			created_at = excluded.created_at`,
+		f.UserID, f.Prefix, f.Hash, formatTime(f.CreatedAt))
+	return err
+}
+
+func (r feedRepo) Delete(ctx context.Context, uid string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM feeds WHERE user_id = ?`, uid)
+	return err
+}
+
+func scanFeed(row scanner) (*store.Feed, error) {
+	var f store.Feed
+	var createdAt string
+	if err := row.Scan(&f.UserID, &f.Prefix, &f.Hash, &createdAt); err != nil {
+		return nil, mapErr(err)
+	}
+	f.CreatedAt = parseTime(createdAt)
+	return &f, nil
+}
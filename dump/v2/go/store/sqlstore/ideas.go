@@ -0,0 +1,188 @@
+package sqlstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type ideaRepo struct {
+	s *Store
+}
+
+func (r ideaRepo) List(ctx context.Context) ([]store.Idea, error) {
+	return r.list(ctx, ``)
+}
+
+func (r ideaRepo) ListByAuthor(ctx context.Context, uid string) ([]store.Idea, error) {
+	return r.list(ctx, `WHERE author_uid = ?`, uid)
+}
+
+func (r ideaRepo) Create(ctx context.Context, uid string, idea *store.Idea) error {
+	idea.ID = newID()
+	_, err := r.s.conn().exec(ctx, `INSERT INTO ideas (id, author_uid, title, description, author, created_at, updated_at,
+			likes, tags)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		idea.ID, uid, idea.Title, idea.Description, idea.Author, idea.CreatedAt, idea.UpdatedAt,
+		idea.Likes, encodeList(idea.Tags))
+	return err
+}
+
+func (r ideaRepo) Update(ctx context.Context, idea *store.Idea) error {
+	return mustAffect(r.s.conn().exec(ctx, `UPDATE ideas SET title = ?, description = ?, tags = ? WHERE id = ?`,
+		idea.Title, idea.Description, encodeList(idea.Tags), idea.ID))
+}
+
+// the comments go with the post, firestore left them orphaned in the subcollection
+func (r ideaRepo) Delete(ctx context.Context, uid, id string) error {
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		if _, err := q.exec(ctx, `DELETE FROM comments WHERE post_id = ?`, id); err != nil {
+			return err
+		}
+		_, err := q.exec(ctx, `DELETE FROM ideas WHERE id = ?`, id)
+		return err
+	})
+}
+
+func (r ideaRepo) ListComments(ctx context.Context, postID string) ([]store.Comment, error) {
+	return r.listComments(ctx, `post_id = ?`, postID)
+}
+
+func (r ideaRepo) ListCommentsByUser(ctx context.Context, uid string) ([]store.Comment, error) {
+	return r.listComments(ctx, `user_id = ?`, uid)
+}
+
+func (r ideaRepo) listComments(ctx context.Context, where, arg string) ([]store.Comment, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT id, author, created_at, content FROM comments
+		WHERE `+where+` ORDER BY id`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Comment{}
+	for rows.Next() {
+		var cm store.Comment
+		if err := rows.Scan(&cm.ID, &cm.Author, &cm.CreatedAt, &cm.Content); err != nil {
+			return nil, err
+		}
+		out = append(out, cm)
+	}
+	return out, rows.Err()
+}
+
+func (r ideaRepo) AddComment(ctx context.Context, uid, postID string, cm *store.Comment) error {
+	cm.ID = newID()
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		if err := mustAffect(q.exec(ctx, `UPDATE ideas SET comments_count = comments_count + 1 WHERE id = ?`, postID)); err != nil {
+			return err
+		}
+		_, err := q.exec(ctx, `INSERT INTO comments (id, post_id, user_id, author, created_at, content)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			cm.ID, postID, uid, cm.Author, cm.CreatedAt, cm.Content)
+		return err
+	})
+}
+
+func (r ideaRepo) UpdateComment(ctx context.Context, postID string, cm *store.Comment) error {
+	return mustAffect(r.s.conn().exec(ctx, `UPDATE comments SET content = ? WHERE post_id = ? AND id = ?`,
+		cm.Content, postID, cm.ID))
+}
+
+func (r ideaRepo) DeleteComment(ctx context.Context, uid, postID, commentID string) error {
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		res, err := q.exec(ctx, `DELETE FROM comments WHERE post_id = ? AND id = ?`, postID, commentID)
+		if err != nil {
+			return err
+		}
+		// nothing deleted, leave the counter alone
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		_, err = q.exec(ctx, `UPDATE ideas SET comments_count = comments_count - 1 WHERE id = ?`, postID)
+		return err
+	})
+}
+
+func (r ideaRepo) DeleteCommentsByUser(ctx context.Context, uid string) error {
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		_, err := q.exec(ctx, `UPDATE ideas SET comments_count = comments_count -
+			(SELECT COUNT(*) FROM comments WHERE comments.post_id = ideas.id AND comments.user_id = ?)
+			WHERE id IN (SELECT post_id FROM comments WHERE user_id = ?)`, uid, uid)
+		if err != nil {
+			return err
+		}
+		_, err = q.exec(ctx, `DELETE FROM comments WHERE user_id = ?`, uid)
+		return err
+	})
+}
+
+func (r ideaRepo) Author(ctx context.Context, postID string) (string, error) {
+	var uid string
+	err := r.s.conn().queryRow(ctx, `SELECT author_uid FROM ideas WHERE id = ?`, postID).Scan(&uid)
+	return uid, mapErr(err)
+}
+
+func (r ideaRepo) CommentAuthor(ctx context.Context, postID, commentID string) (string, error) {
+	var uid string
+	err := r.s.conn().queryRow(ctx, `SELECT user_id FROM comments WHERE post_id = ? AND id = ?`, postID, commentID).Scan(&uid)
+	return uid, mapErr(err)
+}
+
+func (r ideaRepo) AddLikes(ctx context.Context, uid, postID string, delta int) error {
+	return mustAffect(r.s.conn().exec(ctx, `UPDATE ideas SET likes = likes + ? WHERE id = ?`, delta, postID))
+}
+
+func (r ideaRepo) Bookmark(ctx context.Context, uid, postID string) error {
+	_, err := r.s.conn().exec(ctx, `INSERT INTO bookmarks (user_id, post_id) VALUES (?, ?)
+		ON CONFLICT (user_id, post_id) DO NOTHING`, uid, postID)
+	return err
+}
+
+func (r ideaRepo) Unbookmark(ctx context.Context, uid, postID string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM bookmarks WHERE user_id = ? AND post_id = ?`, uid, postID)
+	return err
+}
+
+func (r ideaRepo) ListBookmarks(ctx context.Context, uid string) ([]string, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT post_id FROM bookmarks WHERE user_id = ? ORDER BY post_id`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var postID string
+		if err := rows.Scan(&postID); err != nil {
+			return nil, err
+		}
+		out = append(out, postID)
+	}
+	return out, rows.Err()
+}
+
+func (r ideaRepo) list(ctx context.Context, where string, args ...any) ([]store.Idea, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT id, title, description, author, created_at, updated_at, likes, tags
+		FROM ideas `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Idea{}
+	for rows.Next() {
+		var idea store.Idea
+		var tags string
+		err := rows.Scan(&idea.ID, &idea.Title, &idea.Description, &idea.Author, &idea.CreatedAt, &idea.UpdatedAt,
+			&idea.Likes, &tags)
+		if err != nil {
+			return nil, err
+		}
+		idea.Tags = decodeList(tags)
+		// comments live in their own table, the embedded list is always empty
+		idea.Comments = []store.Comment{}
+		out = append(out, idea)
+	}
+	return out, rows.Err()
+}
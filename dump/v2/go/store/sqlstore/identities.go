@@ -0,0 +1,86 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"calple/store"
+)
+
+type identityRepo struct {
+	s *Store
+}
+
+const identityColumns = `provider, subject, user_id, email, access_token, refresh_token, token_expiry, created_at, last_login_at, password_hash`
+
+func (r identityRepo) Get(ctx context.Context, provider, subject string) (*store.Identity, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+identityColumns+` FROM identities WHERE provider = ? AND subject = ?`, provider, subject)
+	return scanIdentity(row)
+}
+
+func (r identityRepo) ListByUser(ctx context.Context, uid string) ([]store.Identity, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT `+identityColumns+` FROM identities WHERE user_id = ? ORDER BY created_at, provider, subject`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Identity{}
+	for rows.Next() {
+		id, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *id)
+	}
+	return out, rows.Err()
+}
+
+func (r identityRepo) Link(ctx context.Context, id *store.Identity) error {
+	var accessToken, refreshToken, tokenExpiry sql.NullString
+	if id.Tokens != nil {
+		accessToken = sql.NullString{String: id.Tokens.AccessToken, Valid: true}
+		refreshToken = sql.NullString{String: id.Tokens.RefreshToken, Valid: true}
+		tokenExpiry = sql.NullString{String: formatTime(id.Tokens.Expiry), Valid: true}
+	}
+	_, err := r.s.conn().exec(ctx, `INSERT INTO identities (`+identityColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (provider, subject) DO UPDATE SET
+			user_id = excluded.user_id,
+			email = excluded.email,
+			access_token = excluded.access_token,
+			refresh_token = excluded.refresh_token,
+			token_expiry = excluded.token_expiry,
+			created_at = excluded.created_at,
+			last_login_at = excluded.last_login_at,
+			password_hash = excluded.password_hash`,
+		id.Provider, id.Subject, id.UserID, id.Email, accessToken, refreshToken, tokenExpiry,
+		formatTime(id.CreatedAt), formatTime(id.LastLoginAt), id.PasswordHash)
+	return err
+}
+
+func (r identityRepo) Unlink(ctx context.Context, uid, provider, subject string) error {
+	return mustAffect(r.s.conn().exec(ctx, `DELETE FROM identities WHERE user_id = ? AND provider = ? AND subject = ?`, uid, provider, subject))
+}
+
+func scanIdentity(row scanner) (*store.Identity, error) {
+	var id store.Identity
+	var accessToken, refreshToken, tokenExpiry sql.NullString
+	var createdAt, lastLoginAt string
+	err := row.Scan(&id.Provider, &id.Subject, &id.UserID, &id.Email, &accessToken, &refreshToken, &tokenExpiry,
+		&createdAt, &lastLoginAt, &id.PasswordHash)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+
+	if accessToken.Valid {
+		id.Tokens = &store.OAuthTokens{
+			AccessToken:  accessToken.String,
+			RefreshToken: refreshToken.String,
+			Expiry:       parseTime(tokenExpiry.String),
+		}
+	}
+	id.CreatedAt = parseTime(createdAt)
+	id.LastLoginAt = parseTime(lastLoginAt)
+	return &id, nil
+}
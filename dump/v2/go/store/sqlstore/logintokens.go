@@ -0,0 +1,54 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"calple/store"
+)
+
+type loginTokenRepo struct {
+	s *Store
+}
+
+const loginTokenColumns = `hash, purpose, email, user_id, name, password_hash, created_at, expires_at`
+
+func (r loginTokenRepo) Create(ctx context.Context, t *store.LoginToken) error {
+	_, err := r.s.conn().exec(ctx, `INSERT INTO login_tokens (`+loginTokenColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Hash, t.Purpose, t.Email, t.UserID, t.Name, t.PasswordHash, formatTime(t.CreatedAt), formatTime(t.ExpiresAt))
+	return err
+}
+
+// expired tokens are removed whenever one is used
+func (r loginTokenRepo) Consume(ctx context.Context, purpose, hash string) (*store.LoginToken, error) {
+	var t *store.LoginToken
+	err := r.s.inTx(ctx, func(q boundQuerier) error {
+		var err error
+		t, err = scanLoginToken(q.queryRow(ctx, `SELECT `+loginTokenColumns+` FROM login_tokens WHERE hash = ? AND purpose = ?`, hash, purpose))
+		if err != nil {
+			return err
+		}
+		if _, err := q.exec(ctx, `DELETE FROM login_tokens WHERE hash = ?`, hash); err != nil {
+			return err
+		}
+		_, err = q.exec(ctx, `DELETE FROM login_tokens WHERE expires_at < ?`, formatTime(time.Now()))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func scanLoginToken(row scanner) (*store.LoginToken, error) {
+	var t store.LoginToken
+	var createdAt, expiresAt string
+	err := row.Scan(&t.Hash, &t.Purpose, &t.Email, &t.UserID, &t.Name, &t.PasswordHash, &createdAt, &expiresAt)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	t.CreatedAt = parseTime(createdAt)
+	t.ExpiresAt = parseTime(expiresAt)
+	return &t, nil
+}
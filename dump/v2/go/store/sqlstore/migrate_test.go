@@ -0,0 +1,114 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "calple.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rows written by the email based versions get the user ids, emails without an account stay pending
+func TestMigratePartnerUIDs(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	must(t, s.Rollback(ctx, 6))
+
+	now := formatTime(time.Now())
+	exec := func(query string, args ...any) {
+		t.Helper()
+		_, err := s.db.ExecContext(ctx, query, args...)
+		must(t, err)
+	}
+	for _, u := range [][]string{{"alice", "Alice@Example.com"}, {"bob", "bob@example.com"}} {
+		exec(`INSERT INTO users (id, email, last_login_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, u[0], u[1], now, now, now)
+	}
+	exec(`INSERT INTO connections (user_id, id, partner_email, role, status, created_at, updated_at)
+		VALUES ('bob', 'c1', 'alice@example.com', 'receiver', 'active', ?, ?)`, now, now)
+	exec(`INSERT INTO ddays (id, title, created_by, created_at, updated_at) VALUES ('trip', 'Trip', 'BOB@example.com', ?, ?)`, now, now)
+	exec(`INSERT INTO ddays (id, title, created_by, created_at, updated_at) VALUES ('ghost', 'Ghost', 'ghost@example.com', ?, ?)`, now, now)
+	exec(`INSERT INTO dday_connected_users (dday_id, email, position) VALUES ('trip', 'nobody@example.com', 0), ('trip', 'alice@example.com', 1)`)
+	must(t, s.Migrate(ctx))
+
+	conn, err := s.Connections().Get(ctx, "bob", "c1")
+	if err != nil || conn.PartnerUID != "alice" {
+		t.Fatalf("connection = %+v, %v", conn, err)
+	}
+	trip, err := s.DDays().Get(ctx, "trip")
+	if err != nil || trip.CreatorID != "bob" || fmt.Sprint(trip.SharedWith) != "[alice]" || fmt.Sprint(trip.PendingUsers) != "[nobody@example.com]" {
+		t.Fatalf("trip = %+v, %v", trip, err)
+	}
+	if ghost, err := s.DDays().Get(ctx, "ghost"); err != nil || ghost.CreatorID != "" {
+		t.Fatalf("ghost = %+v, %v", ghost, err)
+	}
+
+	if pending, err := s.DDays().ListPending(ctx, "nobody@example.com"); err != nil || len(pending) != 1 || pending[0].ID != "trip" {
+		t.Fatalf("ListPending = %+v, %v", pending, err)
+	}
+
+	// pending emails survive an update of the event
+	trip.Title = "Busan"
+	must(t, s.DDays().Update(ctx, trip))
+	trip, err = s.DDays().Get(ctx, "trip")
+	if err != nil || fmt.Sprint(trip.ConnectedUsers) != "[alice@example.com]" || fmt.Sprint(trip.PendingUsers) != "[nobody@example.com]" {
+		t.Fatalf("updated trip = %+v, %v", trip, err)
+	}
+}
+
+// every down migration undoes its up migration, so the schema can go back to nothing and up again
+func TestMigrateRollbackRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	migrations, err := loadMigrations()
+	must(t, err)
+	latest := migrations[len(migrations)-1].version
+
+	tables := func() []string {
+		t.Helper()
+		rows, err := s.db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+		must(t, err)
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			must(t, rows.Scan(&name))
+			names = append(names, name)
+		}
+		return names
+	}
+	migrated := tables()
+
+	must(t, s.Rollback(ctx, 0))
+	if v, err := s.Version(ctx); err != nil || v != 0 {
+		t.Fatalf("version after rollback = %d, %v", v, err)
+	}
+	if left := tables(); fmt.Sprint(left) != "[schema_migrations]" {
+		t.Fatalf("left after rollback: %v", left)
+	}
+
+	must(t, s.Migrate(ctx))
+	if v, err := s.Version(ctx); err != nil || v != latest {
+		t.Fatalf("version after migrate = %d, %v", v, err)
+	}
+	if again := tables(); fmt.Sprint(again) != fmt.Sprint(migrated) {
+		t.Fatalf("schema after the round trip\n got %v\nwant %v", again, migrated)
+	}
+	seed(t, s)
+}
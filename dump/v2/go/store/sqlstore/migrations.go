@@ -0,0 +1,61 @@
+package sqlstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type migrationRepo struct {
+	s *Store
+}
+
+const migrationRunColumns = `name, cursor, users, changed, started_at, finished_at`
+
+func (r migrationRepo) Get(ctx context.Context, name string) (*store.MigrationRun, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+migrationRunColumns+` FROM migration_runs WHERE name = ?`, name)
+	return scanMigrationRun(row)
+}
+
+func (r migrationRepo) List(ctx context.Context) ([]store.MigrationRun, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT `+migrationRunColumns+` FROM migration_runs ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.MigrationRun{}
+	for rows.Next() {
+		run, err := scanMigrationRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *run)
+	}
+	return out, rows.Err()
+}
+
+func (r migrationRepo) Save(ctx context.Context, run *store.MigrationRun) error {
+	_, err := r.s.conn().exec(ctx, `INSERT INTO migration_runs (`+migrationRunColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			cursor = excluded.cursor,
+			users = excluded.users,
+			changed = excluded.changed,
+			started_at = excluded.started_at,
+			finished_at = excluded.finished_at`,
+		run.Name, run.Cursor, run.Users, run.Changed, formatTime(run.StartedAt), formatTime(run.FinishedAt))
+	return err
+}
+
+func scanMigrationRun(row scanner) (*store.MigrationRun, error) {
+	var run store.MigrationRun
+	var startedAt, finishedAt string
+	err := row.Scan(&run.Name, &run.Cursor, &run.Users, &run.Changed, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	run.StartedAt = parseTime(startedAt)
+	run.FinishedAt = parseTime(finishedAt)
+	return &run, nil
+}
@@ -0,0 +1,13 @@
+DROP TABLE feedback;
+DROP TABLE roulette;
+DROP TABLE bookmarks;
+DROP TABLE comments;
+DROP TABLE ideas;
+DROP TABLE pins;
+DROP TABLE checkins;
+DROP TABLE cycle_settings;
+DROP TABLE period_days;
+DROP TABLE dday_connected_users;
+DROP TABLE ddays;
+DROP TABLE connections;
+DROP TABLE users;
@@ -0,0 +1,161 @@
+-- one table per firestore collection, per-user subcollections carry a user_id column
+-- timestamps are utc text (see timeLayout), plain string lists are json text
+
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	email TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	sex TEXT NOT NULL DEFAULT '',
+	started_dating TEXT NOT NULL DEFAULT '',
+	access_token TEXT,
+	refresh_token TEXT,
+	token_expiry TEXT,
+	returning_user BOOLEAN NOT NULL DEFAULT FALSE,
+	last_login_at TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE INDEX users_email_idx ON users (email);
+
+-- both users of a couple get a row with the same id
+CREATE TABLE connections (
+	user_id TEXT NOT NULL,
+	id TEXT NOT NULL,
+	partner_email TEXT NOT NULL,
+	partner_uid TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL,
+	status TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	PRIMARY KEY (user_id, id)
+);
+CREATE INDEX connections_status_idx ON connections (user_id, status);
+CREATE INDEX connections_partner_idx ON connections (user_id, partner_email);
+
+CREATE TABLE ddays (
+	id TEXT PRIMARY KEY,
+	title TEXT NOT NULL,
+	group_name TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	date TEXT NOT NULL DEFAULT '',
+	end_date TEXT NOT NULL DEFAULT '',
+	image_url TEXT NOT NULL DEFAULT '',
+	is_annual BOOLEAN NOT NULL DEFAULT FALSE,
+	created_by TEXT NOT NULL,
+	editable BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE INDEX ddays_creator_idx ON ddays (created_by, date);
+CREATE INDEX ddays_date_idx ON ddays (date);
+
+-- connectedUsers array, position keeps the original order
+CREATE TABLE dday_connected_users (
+	dday_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (dday_id, email)
+);
+CREATE INDEX dday_connected_users_email_idx ON dday_connected_users (email, dday_id);
+
+CREATE TABLE period_days (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	date TEXT NOT NULL,
+	is_period BOOLEAN NOT NULL DEFAULT FALSE,
+	symptoms TEXT NOT NULL DEFAULT '[]',
+	cramp_intensity INTEGER NOT NULL DEFAULT 0,
+	mood TEXT NOT NULL DEFAULT '[]',
+	activities TEXT NOT NULL DEFAULT '[]',
+	sex_activity TEXT NOT NULL DEFAULT '[]',
+	notes TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE INDEX period_days_user_date_idx ON period_days (user_id, date);
+
+CREATE TABLE cycle_settings (
+	user_id TEXT PRIMARY KEY,
+	id TEXT NOT NULL,
+	cycle_length INTEGER NOT NULL,
+	period_length INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE TABLE checkins (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	date TEXT NOT NULL,
+	mood TEXT NOT NULL DEFAULT '',
+	energy TEXT NOT NULL DEFAULT '',
+	period_status TEXT NOT NULL DEFAULT '',
+	sexual_mood TEXT NOT NULL DEFAULT '',
+	note TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE INDEX checkins_user_date_idx ON checkins (user_id, date);
+
+CREATE TABLE pins (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	lat DOUBLE PRECISION NOT NULL,
+	lng DOUBLE PRECISION NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	location TEXT NOT NULL DEFAULT '',
+	date TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE INDEX pins_user_created_idx ON pins (user_id, created_at);
+
+-- author_uid replaces the users/{uid}/posts mirror
+CREATE TABLE ideas (
+	id TEXT PRIMARY KEY,
+	author_uid TEXT NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	author TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT '',
+	updated_at TEXT NOT NULL DEFAULT '',
+	likes INTEGER NOT NULL DEFAULT 0,
+	comments_count INTEGER NOT NULL DEFAULT 0,
+	tags TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX ideas_author_idx ON ideas (author_uid);
+
+-- user_id replaces the users/{uid}/comments mirror
+CREATE TABLE comments (
+	id TEXT PRIMARY KEY,
+	post_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	author TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT '',
+	content TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX comments_post_idx ON comments (post_id);
+CREATE INDEX comments_user_idx ON comments (user_id);
+
+CREATE TABLE bookmarks (
+	user_id TEXT NOT NULL,
+	post_id TEXT NOT NULL,
+	PRIMARY KEY (user_id, post_id)
+);
+
+CREATE TABLE roulette (
+	id TEXT PRIMARY KEY,
+	title TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE feedback (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	feedback_text TEXT NOT NULL,
+	category TEXT NOT NULL DEFAULT '',
+	admin_comment TEXT NOT NULL DEFAULT '',
+	submitted_at TEXT NOT NULL
+);
+CREATE INDEX feedback_user_idx ON feedback (user_id, submitted_at);
@@ -0,0 +1,12 @@
+CREATE TABLE api_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	prefix TEXT NOT NULL DEFAULT '',
+	hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '[]',
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL DEFAULT '',
+	last_used_at TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX api_tokens_user_idx ON api_tokens (user_id, created_at);
@@ -0,0 +1,13 @@
+CREATE TABLE identities (
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	access_token TEXT,
+	refresh_token TEXT,
+	token_expiry TEXT,
+	created_at TEXT NOT NULL,
+	last_login_at TEXT NOT NULL,
+	PRIMARY KEY (provider, subject)
+);
+CREATE INDEX identities_user_idx ON identities (user_id, created_at);
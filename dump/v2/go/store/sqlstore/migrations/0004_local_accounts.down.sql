@@ -0,0 +1,2 @@
+DROP TABLE login_tokens;
+ALTER TABLE identities DROP COLUMN password_hash;
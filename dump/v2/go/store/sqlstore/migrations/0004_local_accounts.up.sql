@@ -0,0 +1,13 @@
+ALTER TABLE identities ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE login_tokens (
+	hash TEXT PRIMARY KEY,
+	purpose TEXT NOT NULL,
+	email TEXT NOT NULL,
+	user_id TEXT NOT NULL DEFAULT '',
+	name TEXT NOT NULL DEFAULT '',
+	password_hash TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
+CREATE INDEX login_tokens_expires_idx ON login_tokens (expires_at);
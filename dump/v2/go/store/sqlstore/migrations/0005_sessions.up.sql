@@ -0,0 +1,13 @@
+CREATE TABLE sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL DEFAULT '',
+	session_values TEXT NOT NULL DEFAULT '{}',
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	remember BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TEXT NOT NULL,
+	last_seen_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
+CREATE INDEX sessions_user_idx ON sessions (user_id);
+CREATE INDEX sessions_expires_idx ON sessions (expires_at);
@@ -0,0 +1,3 @@
+-- empty until the account is deleted, then the time the grace period started
+ALTER TABLE users ADD COLUMN deleted_at TEXT NOT NULL DEFAULT '';
+CREATE INDEX users_deleted_idx ON users (deleted_at);
@@ -0,0 +1,7 @@
+DROP INDEX dday_connected_users_user_idx;
+ALTER TABLE dday_connected_users DROP COLUMN user_id;
+
+DROP INDEX ddays_creator_id_idx;
+ALTER TABLE ddays DROP COLUMN creator_id;
+
+DROP INDEX connections_partner_uid_idx;
@@ -0,0 +1,16 @@
+-- partners and shared events are referenced by user id, the emails stay for display
+-- emails are matched without case, older versions stored them as they were typed
+
+UPDATE connections SET partner_uid = COALESCE((SELECT MIN(u.id) FROM users u WHERE lower(u.email) = lower(connections.partner_email)), '')
+	WHERE partner_uid = '';
+CREATE INDEX connections_partner_uid_idx ON connections (user_id, partner_uid);
+
+-- an event whose creator has no account keeps an empty creator_id, the admin check lists it
+ALTER TABLE ddays ADD COLUMN creator_id TEXT NOT NULL DEFAULT '';
+UPDATE ddays SET creator_id = COALESCE((SELECT MIN(u.id) FROM users u WHERE lower(u.email) = lower(ddays.created_by)), '');
+CREATE INDEX ddays_creator_id_idx ON ddays (creator_id, date);
+
+-- an email without an account never gave anyone access, it stays pending with an empty user_id
+ALTER TABLE dday_connected_users ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
+UPDATE dday_connected_users SET user_id = COALESCE((SELECT MIN(u.id) FROM users u WHERE lower(u.email) = lower(dday_connected_users.email)), '');
+CREATE INDEX dday_connected_users_user_idx ON dday_connected_users (user_id, dday_id);
@@ -0,0 +1,9 @@
+-- progress of the data migrations run by cmd/migrate
+CREATE TABLE migration_runs (
+	name TEXT PRIMARY KEY,
+	cursor TEXT NOT NULL DEFAULT '',
+	users INTEGER NOT NULL DEFAULT 0,
+	changed INTEGER NOT NULL DEFAULT 0,
+	started_at TEXT NOT NULL,
+	finished_at TEXT NOT NULL
+);
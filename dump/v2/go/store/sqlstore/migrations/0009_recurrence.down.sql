@@ -0,0 +1,2 @@
+ALTER TABLE ddays DROP COLUMN exdates;
+ALTER TABLE ddays DROP COLUMN rrule;
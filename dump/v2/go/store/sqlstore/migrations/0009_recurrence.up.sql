@@ -0,0 +1,5 @@
+-- RFC 5545 recurrence rule and the excluded dates (json list of YYYYMMDD)
+-- annual events get the yearly rule isAnnual stood for
+ALTER TABLE ddays ADD COLUMN rrule TEXT NOT NULL DEFAULT '';
+ALTER TABLE ddays ADD COLUMN exdates TEXT NOT NULL DEFAULT '[]';
+UPDATE ddays SET rrule = 'FREQ=YEARLY' WHERE is_annual;
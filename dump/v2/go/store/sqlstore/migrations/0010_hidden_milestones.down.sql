@@ -0,0 +1 @@
+DROP TABLE hidden_milestones;
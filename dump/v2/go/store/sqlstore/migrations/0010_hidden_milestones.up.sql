@@ -0,0 +1,6 @@
+-- the generated milestones each user hid, the users/{uid}/hiddenMilestones subcollection
+CREATE TABLE hidden_milestones (
+	user_id TEXT NOT NULL,
+	key TEXT NOT NULL,
+	PRIMARY KEY (user_id, key)
+);
@@ -0,0 +1,7 @@
+-- the secret calendar feed of each user, only the hash of the secret is stored
+CREATE TABLE feeds (
+	user_id TEXT PRIMARY KEY,
+	prefix TEXT NOT NULL DEFAULT '',
+	hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL
+);
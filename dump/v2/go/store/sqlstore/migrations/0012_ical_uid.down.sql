@@ -0,0 +1 @@
+ALTER TABLE ddays DROP COLUMN ical_uid;
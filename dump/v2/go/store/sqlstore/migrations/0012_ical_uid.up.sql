@@ -0,0 +1,2 @@
+-- UID of the VEVENT an event was imported from, so importing the same file again updates it
+ALTER TABLE ddays ADD COLUMN ical_uid TEXT NOT NULL DEFAULT '';
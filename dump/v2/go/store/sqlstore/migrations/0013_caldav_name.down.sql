@@ -0,0 +1 @@
+ALTER TABLE ddays DROP COLUMN caldav_name;
@@ -0,0 +1,2 @@
+-- resource name a calendar app created the event under, it finds the event by it again
+ALTER TABLE ddays ADD COLUMN caldav_name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,117 @@
+package sqlstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type periodRepo struct {
+	s *Store
+}
+
+const periodDayColumns = `id, user_id, date, is_period, symptoms, cramp_intensity, mood, activities, sex_activity,
+	notes, created_at, updated_at`
+
+func (r periodRepo) ListDays(ctx context.Context, uid string) ([]store.PeriodDay, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT `+periodDayColumns+` FROM period_days WHERE user_id = ? ORDER BY id`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.PeriodDay{}
+	for rows.Next() {
+		d, err := scanPeriodDay(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func (r periodRepo) GetDay(ctx context.Context, uid, date string) (*store.PeriodDay, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+periodDayColumns+` FROM period_days
+		WHERE user_id = ? AND date = ? ORDER BY id LIMIT 1`, uid, date)
+	d, err := scanPeriodDay(row)
+	return d, mapErr(err)
+}
+
+func (r periodRepo) SaveDay(ctx context.Context, uid string, d *store.PeriodDay) error {
+	if d.ID == "" {
+		d.ID = newID()
+	}
+	d.UserID = uid
+	_, err := r.s.conn().exec(ctx, `INSERT INTO period_days (`+periodDayColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			date = excluded.date,
+			is_period = excluded.is_period,
+			symptoms = excluded.symptoms,
+			cramp_intensity = excluded.cramp_intensity,
+			mood = excluded.mood,
+			activities = excluded.activities,
+			sex_activity = excluded.sex_activity,
+			notes = excluded.notes,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at`,
+		d.ID, uid, d.Date, d.IsPeriod, encodeList(d.Symptoms), d.CrampIntensity, encodeList(d.Mood),
+		encodeList(d.Activities), encodeList(d.SexActivity), d.Notes, formatTime(d.CreatedAt), formatTime(d.UpdatedAt))
+	return err
+}
+
+func (r periodRepo) DeleteDay(ctx context.Context, uid, id string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM period_days WHERE user_id = ? AND id = ?`, uid, id)
+	return err
+}
+
+func (r periodRepo) GetSettings(ctx context.Context, uid string) (*store.CycleSettings, error) {
+	var settings store.CycleSettings
+	var createdAt, updatedAt string
+	err := r.s.conn().queryRow(ctx, `SELECT id, user_id, cycle_length, period_length, created_at, updated_at
+		FROM cycle_settings WHERE user_id = ?`, uid).
+		Scan(&settings.ID, &settings.UserID, &settings.CycleLength, &settings.PeriodLength, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	settings.CreatedAt = parseTime(createdAt)
+	settings.UpdatedAt = parseTime(updatedAt)
+	return &settings, nil
+}
+
+// a user has at most one settings row
+func (r periodRepo) SaveSettings(ctx context.Context, uid string, settings *store.CycleSettings) error {
+	if settings.ID == "" {
+		settings.ID = newID()
+	}
+	settings.UserID = uid
+	_, err := r.s.conn().exec(ctx, `INSERT INTO cycle_settings (user_id, id, cycle_length, period_length, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			id = excluded.id,
+			cycle_length = excluded.cycle_length,
+			period_length = excluded.period_length,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at`,
+		uid, settings.ID, settings.CycleLength, settings.PeriodLength,
+		formatTime(settings.CreatedAt), formatTime(settings.UpdatedAt))
+	return err
+}
+
+func scanPeriodDay(row scanner) (*store.PeriodDay, error) {
+	var d store.PeriodDay
+	var symptoms, mood, activities, sexActivity, createdAt, updatedAt string
+	err := row.Scan(&d.ID, &d.UserID, &d.Date, &d.IsPeriod, &symptoms, &d.CrampIntensity, &mood, &activities,
+		&sexActivity, &d.Notes, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.Symptoms = decodeList(symptoms)
+	d.Mood = decodeList(mood)
+	d.Activities = decodeList(activities)
+	d.SexActivity = decodeList(sexActivity)
+	d.CreatedAt = parseTime(createdAt)
+	d.UpdatedAt = parseTime(updatedAt)
+	return &d, nil
+}
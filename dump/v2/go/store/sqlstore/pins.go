@@ -0,0 +1,57 @@
+package sqlstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type pinRepo struct {
+	s *Store
+}
+
+func (r pinRepo) List(ctx context.Context, uid string) ([]store.Pin, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT id, lat, lng, title, description, location, date, created_at, updated_at
+		FROM pins WHERE user_id = ? ORDER BY created_at DESC`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Pin{}
+	for rows.Next() {
+		var p store.Pin
+		var createdAt, updatedAt string
+		err := rows.Scan(&p.ID, &p.Lat, &p.Lng, &p.Title, &p.Description, &p.Location, &p.Date, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		p.CreatedAt = parseTime(createdAt)
+		p.UpdatedAt = parseTime(updatedAt)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r pinRepo) Create(ctx context.Context, uid string, p *store.Pin) error {
+	p.ID = newID()
+	_, err := r.s.conn().exec(ctx, `INSERT INTO pins (id, user_id, lat, lng, title, description, location, date,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, uid, p.Lat, p.Lng, p.Title, p.Description, p.Location, p.Date,
+		formatTime(p.CreatedAt), formatTime(p.UpdatedAt))
+	return err
+}
+
+// Update fails with store.ErrNotFound if the pin does not exist
+func (r pinRepo) Update(ctx context.Context, uid string, p *store.Pin) error {
+	return mustAffect(r.s.conn().exec(ctx, `UPDATE pins SET lat = ?, lng = ?, title = ?, description = ?, location = ?,
+			date = ?, updated_at = ?
+		WHERE user_id = ? AND id = ?`,
+		p.Lat, p.Lng, p.Title, p.Description, p.Location, p.Date, formatTime(p.UpdatedAt), uid, p.ID))
+}
+
+func (r pinRepo) Delete(ctx context.Context, uid, id string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM pins WHERE user_id = ? AND id = ?`, uid, id)
+	return err
+}
@@ -0,0 +1,49 @@
+package sqlstore
+
+import (
+	"context"
+
+	"calple/store"
+)
+
+type rouletteRepo struct {
+	s *Store
+}
+
+func (r rouletteRepo) List(ctx context.Context) ([]store.Roulette, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT id, title, description FROM roulette ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Roulette{}
+	for rows.Next() {
+		var item store.Roulette
+		if err := rows.Scan(&item.ID, &item.Title, &item.Description); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+func (r rouletteRepo) Create(ctx context.Context, item *store.Roulette) error {
+	item.ID = newID()
+	_, err := r.s.conn().exec(ctx, `INSERT INTO roulette (id, title, description) VALUES (?, ?, ?)`,
+		item.ID, item.Title, item.Description)
+	return err
+}
+
+// Update overwrites the item like a firestore Set, creating it if needed
+func (r rouletteRepo) Update(ctx context.Context, item *store.Roulette) error {
+	_, err := r.s.conn().exec(ctx, `INSERT INTO roulette (id, title, description) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title, description = excluded.description`,
+		item.ID, item.Title, item.Description)
+	return err
+}
+
+func (r rouletteRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM roulette WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,101 @@
+package sqlstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"calple/store"
+)
+
+type sessionRepo struct {
+	s *Store
+}
+
+const sessionColumns = `id, user_id, session_values, user_agent, ip, remember, created_at, last_seen_at, expires_at`
+
+func (r sessionRepo) Get(ctx context.Context, id string) (*store.Session, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id)
+	return scanSession(row)
+}
+
+func (r sessionRepo) ListByUser(ctx context.Context, uid string) ([]store.Session, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? ORDER BY last_seen_at DESC, id`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.Session{}
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *sess)
+	}
+	return out, rows.Err()
+}
+
+// expired sessions are removed whenever a session is written
+func (r sessionRepo) Save(ctx context.Context, sess *store.Session) error {
+	values, err := json.Marshal(sess.Values)
+	if err != nil {
+		return err
+	}
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		_, err := q.exec(ctx, `INSERT INTO sessions (`+sessionColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				user_id = excluded.user_id,
+				session_values = excluded.session_values,
+				user_agent = excluded.user_agent,
+				ip = excluded.ip,
+				remember = excluded.remember,
+				created_at = excluded.created_at,
+				last_seen_at = excluded.last_seen_at,
+				expires_at = excluded.expires_at`,
+			sess.ID, sess.UserID, string(values), sess.UserAgent, sess.IP, sess.Remember,
+			formatTime(sess.CreatedAt), formatTime(sess.LastSeenAt), formatTime(sess.ExpiresAt))
+		if err != nil {
+			return err
+		}
+		_, err = q.exec(ctx, `DELETE FROM sessions WHERE expires_at < ?`, formatTime(sess.LastSeenAt))
+		return err
+	})
+}
+
+func (r sessionRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+func (r sessionRepo) DeleteByUser(ctx context.Context, uid, keepID string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM sessions WHERE user_id = ? AND id <> ?`, uid, keepID)
+	return err
+}
+
+func (r sessionRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := r.s.conn().exec(ctx, `DELETE FROM sessions WHERE expires_at < ?`, formatTime(now))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func scanSession(row scanner) (*store.Session, error) {
+	var sess store.Session
+	var values, createdAt, lastSeenAt, expiresAt string
+	err := row.Scan(&sess.ID, &sess.UserID, &values, &sess.UserAgent, &sess.IP, &sess.Remember,
+		&createdAt, &lastSeenAt, &expiresAt)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	sess.Values = map[string]string{}
+	json.Unmarshal([]byte(values), &sess.Values)
+	sess.CreatedAt = parseTime(createdAt)
+	sess.LastSeenAt = parseTime(lastSeenAt)
+	sess.ExpiresAt = parseTime(expiresAt)
+	return &sess, nil
+}
@@ -0,0 +1,17 @@
+package sqlstore
+
+import (
+	"context"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite opens (or creates) the sqlite database file at path
+// the driver is pure go so the binary still builds with CGO_ENABLED=0
+func OpenSQLite(ctx context.Context, path string) (*Store, error) {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	return Open(ctx, "sqlite", "file:"+path+"?"+params.Encode())
+}
@@ -0,0 +1,196 @@
+// Package sqlstore implements store.Store on a SQL database
+// the queries stick to the syntax sqlite and postgres share,
+// placeholders are written as ? and rebound to $n for postgres
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"calple/store"
+)
+
+// Store runs every repo on a single *sql.DB
+type Store struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// Open connects with an already registered database/sql driver
+// and applies the pending migrations before returning
+func Open(ctx context.Context, driver, dsn string) (*Store, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{db: db, postgres: driver == "postgres" || driver == "pgx"}
+	if !s.postgres {
+		// sqlite allows a single writer, sharing one connection avoids SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) Users() store.UserRepo             { return userRepo{s} }
+func (s *Store) Connections() store.ConnectionRepo { return connectionRepo{s} }
+func (s *Store) DDays() store.DDayRepo             { return ddayRepo{s} }
+func (s *Store) Periods() store.PeriodRepo         { return periodRepo{s} }
+func (s *Store) Checkins() store.CheckinRepo       { return checkinRepo{s} }
+func (s *Store) Pins() store.PinRepo               { return pinRepo{s} }
+func (s *Store) Ideas() store.IdeaRepo             { return ideaRepo{s} }
+func (s *Store) Roulette() store.RouletteRepo      { return rouletteRepo{s} }
+func (s *Store) Feedback() store.FeedbackRepo      { return feedbackRepo{s} }
+func (s *Store) Tokens() store.TokenRepo           { return tokenRepo{s} }
+func (s *Store) Feeds() store.FeedRepo             { return feedRepo{s} }
+func (s *Store) Identities() store.IdentityRepo    { return identityRepo{s} }
+func (s *Store) LoginTokens() store.LoginTokenRepo { return loginTokenRepo{s} }
+func (s *Store) Sessions() store.SessionRepo       { return sessionRepo{s} }
+func (s *Store) Migrations() store.MigrationRepo   { return migrationRepo{s} }
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// boundQuerier rewrites the ? placeholders before handing the query to q
+type boundQuerier struct {
+	s *Store
+	q querier
+}
+
+func (b boundQuerier) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return b.q.ExecContext(ctx, b.s.rebind(query), args...)
+}
+
+func (b boundQuerier) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return b.q.QueryContext(ctx, b.s.rebind(query), args...)
+}
+
+func (b boundQuerier) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return b.q.QueryRowContext(ctx, b.s.rebind(query), args...)
+}
+
+func (s *Store) conn() boundQuerier {
+	return boundQuerier{s, s.db}
+}
+
+// inTx runs fn in a transaction, committing only if it returns nil
+func (s *Store) inTx(ctx context.Context, fn func(q boundQuerier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(boundQuerier{s, tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebind turns ? placeholders into $1, $2... for postgres
+// none of the queries contain a literal ?
+func (s *Store) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func newID() string {
+	return uuid.NewString()
+}
+
+// timestamps are stored as fixed width utc text so they sort correctly as strings
+const timeLayout = "2006-01-02T15:04:05.000000000Z"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(timeLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// string lists that are never queried are stored as json text
+func encodeList(list []string) string {
+	if list == nil {
+		list = []string{}
+	}
+	b, _ := json.Marshal(list)
+	return string(b)
+}
+
+func decodeList(s string) []string {
+	list := []string{}
+	json.Unmarshal([]byte(s), &list)
+	return list
+}
+
+// mapErr turns sql.ErrNoRows into store.ErrNotFound
+func mapErr(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// mustAffect returns store.ErrNotFound when an update or delete matched no row
+func mustAffect(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,689 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"calple/store"
+)
+
+const (
+	aliceID = "alice-uid"
+	bobID   = "bob-uid"
+	carolID = "carol-uid"
+
+	aliceEmail = "alice@example.com"
+	bobEmail   = "bob@example.com"
+	carolEmail = "carol@example.com"
+)
+
+// seed saves the three users the repo tests share
+func seed(t *testing.T, s *Store) {
+	t.Helper()
+	for _, u := range []store.User{
+		{ID: aliceID, Email: aliceEmail, Name: "Alice", Sex: "female"},
+		{ID: bobID, Email: bobEmail, Name: "Bob", Sex: "male"},
+		{ID: carolID, Email: carolEmail, Name: "Carol", Sex: "female"},
+	} {
+		must(t, s.Users().Save(context.Background(), &u))
+	}
+}
+
+// connect makes alice and bob partners and returns the connection ID
+func connect(t *testing.T, s *Store) string {
+	t.Helper()
+	ctx := context.Background()
+	id, err := s.Connections().Invite(ctx, aliceID, aliceEmail, bobID, bobEmail)
+	must(t, err)
+	must(t, s.Connections().Accept(ctx, bobID, aliceID, id))
+	return id
+}
+
+func TestUsers(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	users := s.Users()
+
+	u, err := users.GetByEmail(ctx, bobEmail)
+	if err != nil || u.ID != bobID || u.Name != "Bob" {
+		t.Fatalf("GetByEmail = %+v, %v", u, err)
+	}
+	if _, err := users.GetByEmail(ctx, "ghost@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetByEmail missing: %v", err)
+	}
+	if _, err := users.Get(ctx, "ghost"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get missing: %v", err)
+	}
+
+	// Save updates in place, tokens are removed by a save without them
+	alice, err := users.Get(ctx, aliceID)
+	must(t, err)
+	alice.Tokens = &store.OAuthTokens{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now()}
+	must(t, users.Save(ctx, alice))
+	if got, _ := users.Get(ctx, aliceID); got.Tokens == nil || got.Tokens.RefreshToken != "refresh" {
+		t.Fatalf("tokens after save = %+v", got.Tokens)
+	}
+	alice.Tokens = nil
+	alice.StartedDating = "02/14/2024"
+	must(t, users.Save(ctx, alice))
+	if got, _ := users.Get(ctx, aliceID); got.Tokens != nil || got.StartedDating != "02/14/2024" {
+		t.Fatalf("after second save = %+v", got)
+	}
+
+	// pages follow the IDs
+	var ids []string
+	after := ""
+	for {
+		page, err := users.List(ctx, after, 2)
+		must(t, err)
+		for _, u := range page {
+			ids = append(ids, u.ID)
+		}
+		if len(page) < 2 {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	if !slices.Equal(ids, []string{aliceID, bobID, carolID}) {
+		t.Fatalf("listed users %v", ids)
+	}
+
+	alice.DeletedAt = time.Now().Add(-time.Hour)
+	must(t, users.Save(ctx, alice))
+	deleted, err := users.ListDeleted(ctx, time.Now())
+	if err != nil || len(deleted) != 1 || deleted[0].ID != aliceID {
+		t.Fatalf("ListDeleted = %+v, %v", deleted, err)
+	}
+	if deleted, _ := users.ListDeleted(ctx, time.Now().Add(-2*time.Hour)); len(deleted) != 0 {
+		t.Fatalf("ListDeleted before the deletion = %+v", deleted)
+	}
+
+	must(t, s.Pins().Create(ctx, bobID, &store.Pin{Title: "Cafe"}))
+	must(t, users.Purge(ctx, bobID))
+	if _, err := users.Get(ctx, bobID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after purge: %v", err)
+	}
+	if pins, _ := s.Pins().List(ctx, bobID); len(pins) != 0 {
+		t.Fatalf("pins after purge = %+v", pins)
+	}
+	must(t, users.Purge(ctx, bobID))
+
+	must(t, users.Delete(ctx, carolID))
+	if _, err := users.Get(ctx, carolID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after delete: %v", err)
+	}
+}
+
+func TestConnections(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	conns := s.Connections()
+
+	// both sides pending with opposite roles
+	id, err := conns.Invite(ctx, aliceID, aliceEmail, bobID, bobEmail)
+	must(t, err)
+	mine, err := conns.Get(ctx, aliceID, id)
+	if err != nil || mine.Role != store.RoleInitiator || mine.Status != store.StatusPending || mine.PartnerUID != bobID {
+		t.Fatalf("initiator side = %+v, %v", mine, err)
+	}
+	theirs, err := conns.Get(ctx, bobID, id)
+	if err != nil || theirs.Role != store.RoleReceiver || theirs.Status != store.StatusPending || theirs.PartnerEmail != aliceEmail {
+		t.Fatalf("receiver side = %+v, %v", theirs, err)
+	}
+
+	if pending, err := conns.ListByStatus(ctx, bobID, store.StatusPending); err != nil || len(pending) != 1 {
+		t.Fatalf("pending = %+v, %v", pending, err)
+	}
+	if _, err := conns.Active(ctx, bobID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Active before accept: %v", err)
+	}
+	if found, err := conns.FindByPartner(ctx, aliceID, bobID); err != nil || found.ID != id {
+		t.Fatalf("FindByPartner = %+v, %v", found, err)
+	}
+
+	// a missing side aborts the transaction and changes nothing
+	if err := conns.Accept(ctx, bobID, carolID, id); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Accept with missing partner side: %v", err)
+	}
+	if theirs, _ := conns.Get(ctx, bobID, id); theirs.Status != store.StatusPending {
+		t.Fatalf("failed accept left receiver side %+v", theirs)
+	}
+	must(t, conns.Accept(ctx, bobID, aliceID, id))
+	for uid, partnerUID := range map[string]string{aliceID: bobID, bobID: aliceID} {
+		active, err := conns.Active(ctx, uid)
+		if err != nil || active.ID != id || active.PartnerUID != partnerUID {
+			t.Fatalf("active for %s = %+v, %v", uid, active, err)
+		}
+	}
+
+	must(t, conns.SetPartnerEmail(ctx, aliceID, "alice@new.example.com"))
+	if theirs, _ := conns.Get(ctx, bobID, id); theirs.PartnerEmail != "alice@new.example.com" {
+		t.Fatalf("partner email after change = %q", theirs.PartnerEmail)
+	}
+	if list, err := conns.List(ctx, aliceID); err != nil || len(list) != 1 {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+	if owners, err := conns.Owners(ctx); err != nil || !slices.Equal(owners, []string{aliceID, bobID}) {
+		t.Fatalf("Owners = %v, %v", owners, err)
+	}
+
+	// both sides are removed together
+	must(t, conns.Remove(ctx, bobID, aliceID, id))
+	for _, uid := range []string{aliceID, bobID} {
+		if _, err := conns.Get(ctx, uid, id); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("connection of %s after remove: %v", uid, err)
+		}
+	}
+
+	// without a partner only the caller's side goes
+	id = connect(t, s)
+	must(t, conns.Remove(ctx, aliceID, "", id))
+	if _, err := conns.Get(ctx, aliceID, id); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("caller side after remove: %v", err)
+	}
+	if _, err := conns.Get(ctx, bobID, id); err != nil {
+		t.Fatalf("partner side after one-sided remove: %v", err)
+	}
+}
+
+func TestDDays(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	ddays := s.DDays()
+
+	create := func(d store.DDay) string {
+		t.Helper()
+		must(t, ddays.Create(ctx, &d))
+		return d.ID
+	}
+	ids := map[string]string{
+		"own past":       create(store.DDay{Title: "own past", Date: "20250701", CreatorID: aliceID}),
+		"own future":     create(store.DDay{Title: "own future", Date: "20250801", CreatorID: aliceID}),
+		"shared":         create(store.DDay{Title: "shared", Date: "20250705", CreatorID: bobID, SharedWith: []string{aliceID}, ConnectedUsers: []string{aliceEmail}}),
+		"shared future":  create(store.DDay{Title: "shared future", Date: "20250805", CreatorID: bobID, SharedWith: []string{aliceID}, ConnectedUsers: []string{aliceEmail}}),
+		"not shared":     create(store.DDay{Title: "not shared", Date: "20250705", CreatorID: carolID, SharedWith: []string{bobID}, ConnectedUsers: []string{bobEmail}}),
+		"own annual":     create(store.DDay{Title: "own annual", Date: "20300101", IsAnnual: true, CreatorID: aliceID}),
+		"partner annual": create(store.DDay{Title: "partner annual", Date: "20300101", IsAnnual: true, CreatorID: bobID, SharedWith: []string{aliceID}, ConnectedUsers: []string{aliceEmail}}),
+	}
+
+	visible, err := ddays.ListVisible(ctx, aliceID, "20250731")
+	must(t, err)
+	got := map[string]int{}
+	for _, d := range visible {
+		got[d.Title]++
+	}
+	want := map[string]int{"own past": 1, "shared": 1, "own annual": 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ListVisible = %v, want %v", got, want)
+	}
+	if byCreator, err := ddays.ListByCreator(ctx, bobID); err != nil || len(byCreator) != 3 {
+		t.Fatalf("ListByCreator = %d events, %v", len(byCreator), err)
+	}
+
+	// every event once, in ID order, however many users it is shared with
+	var listed []string
+	after := ""
+	for {
+		page, err := ddays.List(ctx, after, 3)
+		must(t, err)
+		for _, d := range page {
+			listed = append(listed, d.ID)
+		}
+		if len(page) < 3 {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	if len(listed) != len(ids) || !slices.IsSorted(listed) {
+		t.Fatalf("listed events %v", listed)
+	}
+
+	// Update overwrites the event with its shares
+	d, err := ddays.Get(ctx, ids["shared"])
+	must(t, err)
+	if !slices.Equal(d.ConnectedUsers, []string{aliceEmail}) || d.ExDates != nil {
+		t.Fatalf("Get = %+v", d)
+	}
+	d.Title, d.RRule, d.ExDates, d.CalDAVName = "moved", "FREQ=YEARLY", []string{"20260705"}, "A1B2.ics"
+	d.SharedWith, d.ConnectedUsers = []string{}, []string{}
+	must(t, ddays.Update(ctx, d))
+	d, err = ddays.Get(ctx, ids["shared"])
+	if err != nil || d.Title != "moved" || d.RRule != "FREQ=YEARLY" || !slices.Equal(d.ExDates, []string{"20260705"}) || d.CalDAVName != "A1B2.ics" || len(d.SharedWith) != 0 {
+		t.Fatalf("after update = %+v, %v", d, err)
+	}
+
+	must(t, ddays.Delete(ctx, ids["own past"]))
+	if _, err := ddays.Get(ctx, ids["own past"]); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after delete: %v", err)
+	}
+
+	must(t, ddays.HideMilestone(ctx, aliceID, "100d"))
+	must(t, ddays.HideMilestone(ctx, aliceID, "1y"))
+	must(t, ddays.HideMilestone(ctx, aliceID, "1y"))
+	must(t, ddays.ShowMilestone(ctx, aliceID, "100d"))
+	if hidden, err := ddays.ListHiddenMilestones(ctx, aliceID); err != nil || !slices.Equal(hidden, []string{"1y"}) {
+		t.Fatalf("hidden milestones = %v, %v", hidden, err)
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	periods := s.Periods()
+
+	day := store.PeriodDay{Date: "2025-07-01", IsPeriod: true, Symptoms: []string{"cramps"}}
+	must(t, periods.SaveDay(ctx, aliceID, &day))
+	if day.ID == "" {
+		t.Fatal("SaveDay did not set the ID")
+	}
+	day.Notes = "rest"
+	must(t, periods.SaveDay(ctx, aliceID, &day))
+	got, err := periods.GetDay(ctx, aliceID, "2025-07-01")
+	if err != nil || got.ID != day.ID || got.Notes != "rest" || !slices.Equal(got.Symptoms, []string{"cramps"}) {
+		t.Fatalf("GetDay = %+v, %v", got, err)
+	}
+	if days, err := periods.ListDays(ctx, aliceID); err != nil || len(days) != 1 {
+		t.Fatalf("ListDays = %+v, %v", days, err)
+	}
+	if _, err := periods.GetDay(ctx, bobID, "2025-07-01"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetDay of another user: %v", err)
+	}
+	must(t, periods.DeleteDay(ctx, aliceID, day.ID))
+	if days, _ := periods.ListDays(ctx, aliceID); len(days) != 0 {
+		t.Fatalf("days after delete = %+v", days)
+	}
+
+	if _, err := periods.GetSettings(ctx, aliceID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetSettings before save: %v", err)
+	}
+	settings := store.CycleSettings{CycleLength: 28, PeriodLength: 5}
+	must(t, periods.SaveSettings(ctx, aliceID, &settings))
+	settings.CycleLength = 30
+	must(t, periods.SaveSettings(ctx, aliceID, &settings))
+	if got, err := periods.GetSettings(ctx, aliceID); err != nil || got.CycleLength != 30 || got.PeriodLength != 5 {
+		t.Fatalf("GetSettings = %+v, %v", got, err)
+	}
+}
+
+func TestCheckins(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	checkins := s.Checkins()
+
+	for _, date := range []string{"2025-07-02", "2025-07-01"} {
+		must(t, checkins.Save(ctx, aliceID, &store.Checkin{Date: date, Mood: "happy"}))
+	}
+	list, err := checkins.List(ctx, aliceID)
+	if err != nil || len(list) != 2 || list[0].Date != "2025-07-01" {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+
+	ci, err := checkins.GetByDate(ctx, aliceID, "2025-07-01")
+	if err != nil || ci.Mood != "happy" || ci.UserID != aliceID {
+		t.Fatalf("GetByDate = %+v, %v", ci, err)
+	}
+	ci.Mood = "tired"
+	must(t, checkins.Save(ctx, aliceID, ci))
+	if ci, _ := checkins.GetByDate(ctx, aliceID, "2025-07-01"); ci.Mood != "tired" {
+		t.Fatalf("mood after save = %q", ci.Mood)
+	}
+	if _, err := checkins.GetByDate(ctx, bobID, "2025-07-01"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("partner checkin leaked: %v", err)
+	}
+
+	must(t, checkins.Delete(ctx, aliceID, ci.ID))
+	if list, _ := checkins.List(ctx, aliceID); len(list) != 1 {
+		t.Fatalf("checkins after delete = %+v", list)
+	}
+}
+
+func TestPins(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	pins := s.Pins()
+	base := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, title := range []string{"first", "second", "third"} {
+		must(t, pins.Create(ctx, aliceID, &store.Pin{Title: title, CreatedAt: base.Add(time.Duration(i) * time.Hour)}))
+	}
+	list, err := pins.List(ctx, aliceID)
+	if err != nil || len(list) != 3 || list[0].Title != "third" {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+
+	pin := list[0]
+	pin.Title = "Cafe"
+	must(t, pins.Update(ctx, aliceID, &pin))
+	if list, _ := pins.List(ctx, aliceID); list[0].Title != "Cafe" {
+		t.Fatalf("title after update = %q", list[0].Title)
+	}
+	if err := pins.Update(ctx, aliceID, &store.Pin{ID: "missing"}); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Update missing pin: %v", err)
+	}
+	if err := pins.Update(ctx, bobID, &pin); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Update another user's pin: %v", err)
+	}
+
+	must(t, pins.Delete(ctx, aliceID, pin.ID))
+	if list, _ := pins.List(ctx, aliceID); len(list) != 2 {
+		t.Fatalf("pins after delete = %+v", list)
+	}
+}
+
+func TestIdeas(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	ideas := s.Ideas()
+
+	post := store.Idea{Title: "Picnic", Author: "Alice", Tags: []string{"outside"}, Comments: []store.Comment{}}
+	must(t, ideas.Create(ctx, aliceID, &post))
+	if author, err := ideas.Author(ctx, post.ID); err != nil || author != aliceID {
+		t.Fatalf("Author = %q, %v", author, err)
+	}
+	if _, err := ideas.Author(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Author of a missing post: %v", err)
+	}
+
+	post.Title, post.Tags = "Picnic by the river", []string{"outside", "summer"}
+	must(t, ideas.Update(ctx, &post))
+	for _, delta := range []int{1, 1, -1} {
+		must(t, ideas.AddLikes(ctx, bobID, post.ID, delta))
+	}
+	if err := ideas.AddLikes(ctx, aliceID, "missing", 1); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("AddLikes on missing post: %v", err)
+	}
+	all, err := ideas.List(ctx)
+	if err != nil || len(all) != 1 || all[0].Likes != 1 || all[0].Title != "Picnic by the river" || len(all[0].Tags) != 2 {
+		t.Fatalf("List = %+v, %v", all, err)
+	}
+	if mine, err := ideas.ListByAuthor(ctx, aliceID); err != nil || len(mine) != 1 {
+		t.Fatalf("ListByAuthor = %+v, %v", mine, err)
+	}
+
+	first := store.Comment{Author: "Bob", Content: "count me in"}
+	second := store.Comment{Author: "Carol", Content: "me too"}
+	must(t, ideas.AddComment(ctx, bobID, post.ID, &first))
+	must(t, ideas.AddComment(ctx, carolID, post.ID, &second))
+	if err := ideas.AddComment(ctx, bobID, "missing", &store.Comment{}); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("AddComment on missing post: %v", err)
+	}
+	if author, err := ideas.CommentAuthor(ctx, post.ID, first.ID); err != nil || author != bobID {
+		t.Fatalf("CommentAuthor = %q, %v", author, err)
+	}
+
+	first.Content = "edited"
+	must(t, ideas.UpdateComment(ctx, post.ID, &first))
+	must(t, ideas.DeleteComment(ctx, carolID, post.ID, second.ID))
+	comments, err := ideas.ListComments(ctx, post.ID)
+	if err != nil || len(comments) != 1 || comments[0].Content != "edited" {
+		t.Fatalf("ListComments = %+v, %v", comments, err)
+	}
+	if mine, err := ideas.ListCommentsByUser(ctx, bobID); err != nil || len(mine) != 1 {
+		t.Fatalf("ListCommentsByUser = %+v, %v", mine, err)
+	}
+	must(t, ideas.DeleteCommentsByUser(ctx, bobID))
+	if comments, _ := ideas.ListComments(ctx, post.ID); len(comments) != 0 {
+		t.Fatalf("comments after DeleteCommentsByUser = %+v", comments)
+	}
+
+	must(t, ideas.Bookmark(ctx, carolID, post.ID))
+	must(t, ideas.Bookmark(ctx, carolID, post.ID))
+	if marks, err := ideas.ListBookmarks(ctx, carolID); err != nil || !slices.Equal(marks, []string{post.ID}) {
+		t.Fatalf("ListBookmarks = %v, %v", marks, err)
+	}
+	must(t, ideas.Unbookmark(ctx, carolID, post.ID))
+	if marks, _ := ideas.ListBookmarks(ctx, carolID); len(marks) != 0 {
+		t.Fatalf("bookmarks after unbookmark = %v", marks)
+	}
+
+	must(t, ideas.Delete(ctx, aliceID, post.ID))
+	if all, _ := ideas.List(ctx); len(all) != 0 {
+		t.Fatalf("posts after delete = %+v", all)
+	}
+}
+
+func TestRoulette(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	roulette := s.Roulette()
+
+	r := store.Roulette{Title: "Movie night"}
+	must(t, roulette.Create(ctx, &r))
+	r.Description = "pick a horror film"
+	must(t, roulette.Update(ctx, &r))
+	list, err := roulette.List(ctx)
+	if err != nil || len(list) != 1 || list[0].Description != "pick a horror film" {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+	must(t, roulette.Delete(ctx, r.ID))
+	if list, _ := roulette.List(ctx); len(list) != 0 {
+		t.Fatalf("roulette after delete = %+v", list)
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	feedback := s.Feedback()
+	base := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, text := range []string{"first", "second"} {
+		must(t, feedback.Create(ctx, aliceID, &store.Feedback{FeedbackText: text, SubmittedAt: base.Add(time.Duration(i) * time.Hour)}))
+	}
+	must(t, feedback.Create(ctx, bobID, &store.Feedback{FeedbackText: "bob's", SubmittedAt: base.Add(30 * time.Minute)}))
+
+	mine, err := feedback.ListByUser(ctx, aliceID)
+	if err != nil || len(mine) != 2 || mine[0].FeedbackText != "first" {
+		t.Fatalf("ListByUser = %+v, %v", mine, err)
+	}
+	all, err := feedback.List(ctx)
+	if err != nil || len(all) != 3 || all[1].UserID != bobID {
+		t.Fatalf("List = %+v, %v", all, err)
+	}
+
+	must(t, feedback.SetAdminComment(ctx, aliceID, mine[0].ID, "thanks"))
+	if mine, _ := feedback.ListByUser(ctx, aliceID); mine[0].AdminComment != "thanks" {
+		t.Fatalf("admin comment = %q", mine[0].AdminComment)
+	}
+	if err := feedback.SetAdminComment(ctx, bobID, mine[0].ID, "thanks"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("SetAdminComment on another user's feedback: %v", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	tokens := s.Tokens()
+	base := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	first := store.APIToken{UserID: aliceID, Name: "script", Hash: "hash1", Scopes: []string{"ddays"}, CreatedAt: base}
+	second := store.APIToken{UserID: aliceID, Name: "phone", Hash: "hash2", CreatedAt: base.Add(time.Hour)}
+	must(t, tokens.Create(ctx, &first))
+	must(t, tokens.Create(ctx, &second))
+
+	got, err := tokens.GetByHash(ctx, "hash1")
+	if err != nil || got.ID != first.ID || got.UserID != aliceID || !slices.Equal(got.Scopes, []string{"ddays"}) {
+		t.Fatalf("GetByHash = %+v, %v", got, err)
+	}
+	if _, err := tokens.GetByHash(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetByHash missing: %v", err)
+	}
+	list, err := tokens.ListByUser(ctx, aliceID)
+	if err != nil || len(list) != 2 || list[0].Name != "script" {
+		t.Fatalf("ListByUser = %+v, %v", list, err)
+	}
+
+	used := base.Add(2 * time.Hour)
+	must(t, tokens.MarkUsed(ctx, first.ID, used))
+	if got, _ := tokens.GetByHash(ctx, "hash1"); !got.LastUsedAt.Equal(used) {
+		t.Fatalf("LastUsedAt = %v", got.LastUsedAt)
+	}
+
+	if err := tokens.Delete(ctx, bobID, first.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Delete another user's token: %v", err)
+	}
+	must(t, tokens.Delete(ctx, aliceID, first.ID))
+	if _, err := tokens.GetByHash(ctx, "hash1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetByHash after delete: %v", err)
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	feeds := s.Feeds()
+
+	if _, err := feeds.Get(ctx, aliceID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get before save: %v", err)
+	}
+	must(t, feeds.Save(ctx, &store.Feed{UserID: aliceID, Prefix: "old", Hash: "old-hash", CreatedAt: time.Now()}))
+	// saving again replaces the secret
+	must(t, feeds.Save(ctx, &store.Feed{UserID: aliceID, Prefix: "new", Hash: "new-hash", CreatedAt: time.Now()}))
+	if _, err := feeds.GetByHash(ctx, "old-hash"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetByHash of the replaced secret: %v", err)
+	}
+	if feed, err := feeds.GetByHash(ctx, "new-hash"); err != nil || feed.UserID != aliceID {
+		t.Fatalf("GetByHash = %+v, %v", feed, err)
+	}
+	if feed, err := feeds.Get(ctx, aliceID); err != nil || feed.Prefix != "new" {
+		t.Fatalf("Get = %+v, %v", feed, err)
+	}
+
+	must(t, feeds.Delete(ctx, aliceID))
+	must(t, feeds.Delete(ctx, aliceID))
+	if _, err := feeds.Get(ctx, aliceID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after delete: %v", err)
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	s := newTestStore(t)
+	seed(t, s)
+	ctx := context.Background()
+	identities := s.Identities()
+	base := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	google := store.Identity{Provider: "google", Subject: "g-1", UserID: aliceID, Email: aliceEmail, CreatedAt: base,
+		Tokens: &store.OAuthTokens{AccessToken: "sealed-access", RefreshToken: "sealed-refresh"}}
+	email := store.Identity{Provider: "email", Subject: aliceEmail, UserID: aliceID, Email: aliceEmail, CreatedAt: base.Add(time.Hour), PasswordHash: "bcrypt"}
+	must(t, identities.Link(ctx, &google))
+	must(t, identities.Link(ctx, &email))
+
+	got, err := identities.Get(ctx, "google", "g-1")
+	if err != nil || got.UserID != aliceID || got.Tokens == nil || got.Tokens.RefreshToken != "sealed-refresh" {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+	// linking again replaces the identity
+	google.LastLoginAt = base.Add(2 * time.Hour)
+	must(t, identities.Link(ctx, &google))
+	list, err := identities.ListByUser(ctx, aliceID)
+	if err != nil || len(list) != 2 || list[0].Provider != "google" || !list[0].LastLoginAt.Equal(google.LastLoginAt) || list[1].PasswordHash != "bcrypt" {
+		t.Fatalf("ListByUser = %+v, %v", list, err)
+	}
+
+	if err := identities.Unlink(ctx, bobID, "google", "g-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Unlink from another user: %v", err)
+	}
+	must(t, identities.Unlink(ctx, aliceID, "google", "g-1"))
+	if _, err := identities.Get(ctx, "google", "g-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after unlink: %v", err)
+	}
+}
+
+func TestLoginTokens(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	tokens := s.LoginTokens()
+
+	must(t, tokens.Create(ctx, &store.LoginToken{Hash: "h", Purpose: store.LoginTokenMagic, Email: aliceEmail,
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}))
+	if _, err := tokens.Consume(ctx, store.LoginTokenReset, "h"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Consume for another purpose: %v", err)
+	}
+	got, err := tokens.Consume(ctx, store.LoginTokenMagic, "h")
+	if err != nil || got.Email != aliceEmail || got.Hash != "h" {
+		t.Fatalf("Consume = %+v, %v", got, err)
+	}
+	if _, err := tokens.Consume(ctx, store.LoginTokenMagic, "h"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second Consume: %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	sessions := s.Sessions()
+	base := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"s1", "s2", "s3"} {
+		must(t, sessions.Save(ctx, &store.Session{ID: id, UserID: aliceID, Values: map[string]string{"user_id": aliceID},
+			LastSeenAt: base.Add(time.Duration(i) * time.Hour), ExpiresAt: base.Add(24 * time.Hour)}))
+	}
+	must(t, sessions.Save(ctx, &store.Session{ID: "b1", UserID: bobID, LastSeenAt: base, ExpiresAt: base.Add(24 * time.Hour)}))
+
+	got, err := sessions.Get(ctx, "s1")
+	if err != nil || got.UserID != aliceID || got.Values["user_id"] != aliceID {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+	list, err := sessions.ListByUser(ctx, aliceID)
+	if err != nil || len(list) != 3 || list[0].ID != "s3" {
+		t.Fatalf("ListByUser = %+v, %v", list, err)
+	}
+
+	must(t, sessions.Delete(ctx, "s1"))
+	must(t, sessions.Delete(ctx, "s1"))
+	if _, err := sessions.Get(ctx, "s1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after delete: %v", err)
+	}
+	must(t, sessions.DeleteByUser(ctx, aliceID, "s2"))
+	if list, _ := sessions.ListByUser(ctx, aliceID); len(list) != 1 || list[0].ID != "s2" {
+		t.Fatalf("sessions after DeleteByUser = %+v", list)
+	}
+	if _, err := sessions.Get(ctx, "b1"); err != nil {
+		t.Fatalf("another user's session after DeleteByUser: %v", err)
+	}
+
+	if n, err := sessions.DeleteExpired(ctx, base.Add(time.Hour)); err != nil || n != 0 {
+		t.Fatalf("DeleteExpired before the expiry = %d, %v", n, err)
+	}
+	if n, err := sessions.DeleteExpired(ctx, base.Add(25*time.Hour)); err != nil || n != 2 {
+		t.Fatalf("DeleteExpired = %d, %v", n, err)
+	}
+	if _, err := sessions.Get(ctx, "b1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expired session after DeleteExpired: %v", err)
+	}
+}
+
+func TestMigrationRuns(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	runs := s.Migrations()
+
+	if _, err := runs.Get(ctx, "0001_test"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get missing run: %v", err)
+	}
+	run := &store.MigrationRun{Name: "0001_test", Cursor: aliceID, Users: 1, StartedAt: time.Now()}
+	must(t, runs.Save(ctx, run))
+	run.FinishedAt = time.Now()
+	must(t, runs.Save(ctx, run))
+	must(t, runs.Save(ctx, &store.MigrationRun{Name: "0000_first", StartedAt: time.Now()}))
+
+	list, err := runs.List(ctx)
+	if err != nil || len(list) != 2 || list[0].Name != "0000_first" || list[1].FinishedAt.IsZero() {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+}
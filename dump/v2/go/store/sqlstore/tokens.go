@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"calple/store"
+)
+
+type tokenRepo struct {
+	s *Store
+}
+
+const tokenColumns = `id, user_id, name, prefix, hash, scopes, created_at, expires_at, last_used_at`
+
+func (r tokenRepo) GetByHash(ctx context.Context, hash string) (*store.APIToken, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE hash = ?`, hash)
+	return scanToken(row)
+}
+
+func (r tokenRepo) ListByUser(ctx context.Context, uid string) ([]store.APIToken, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE user_id = ? ORDER BY created_at, id`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.APIToken{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+func (r tokenRepo) Create(ctx context.Context, t *store.APIToken) error {
+	t.ID = newID()
+	_, err := r.s.conn().exec(ctx, `INSERT INTO api_tokens (`+tokenColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.UserID, t.Name, t.Prefix, t.Hash, encodeList(t.Scopes),
+		formatTime(t.CreatedAt), formatTime(t.ExpiresAt), formatTime(t.LastUsedAt))
+	return err
+}
+
+func (r tokenRepo) Delete(ctx context.Context, uid, id string) error {
+	return mustAffect(r.s.conn().exec(ctx, `DELETE FROM api_tokens WHERE user_id = ? AND id = ?`, uid, id))
+}
+
+func (r tokenRepo) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	return mustAffect(r.s.conn().exec(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, formatTime(at), id))
+}
+
+func scanToken(row scanner) (*store.APIToken, error) {
+	var t store.APIToken
+	var scopes, createdAt, expiresAt, lastUsedAt string
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Hash, &scopes, &createdAt, &expiresAt, &lastUsedAt)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	t.Scopes = decodeList(scopes)
+	t.CreatedAt = parseTime(createdAt)
+	t.ExpiresAt = parseTime(expiresAt)
+	t.LastUsedAt = parseTime(lastUsedAt)
+	return &t, nil
+}
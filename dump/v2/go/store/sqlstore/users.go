@@ -0,0 +1,134 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"calple/store"
+)
+
+type userRepo struct {
+	s *Store
+}
+
+const userColumns = `id, email, name, sex, started_dating, access_token, refresh_token, token_expiry,
+	returning_user, last_login_at, created_at, updated_at, deleted_at`
+
+func (r userRepo) Get(ctx context.Context, id string) (*store.User, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+	return scanUser(row)
+}
+
+func (r userRepo) GetByEmail(ctx context.Context, email string) (*store.User, error) {
+	row := r.s.conn().queryRow(ctx, `SELECT `+userColumns+` FROM users WHERE email = ? ORDER BY id LIMIT 1`, email)
+	return scanUser(row)
+}
+
+func (r userRepo) Save(ctx context.Context, u *store.User) error {
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		_, err := q.exec(ctx, `INSERT INTO users (id, email, name, sex, started_dating, returning_user, last_login_at, created_at, updated_at, deleted_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				email = excluded.email,
+				name = excluded.name,
+				sex = excluded.sex,
+				started_dating = excluded.started_dating,
+				returning_user = excluded.returning_user,
+				last_login_at = excluded.last_login_at,
+				created_at = excluded.created_at,
+				updated_at = excluded.updated_at,
+				deleted_at = excluded.deleted_at`,
+			u.ID, u.Email, u.Name, u.Sex, u.StartedDating, u.ReturningUser,
+			formatTime(u.LastLoginAt), formatTime(u.CreatedAt), formatTime(u.UpdatedAt), formatDeletedAt(u.DeletedAt))
+		if err != nil {
+			return err
+		}
+
+		if u.Tokens == nil {
+			_, err = q.exec(ctx, `UPDATE users SET access_token = NULL, refresh_token = NULL, token_expiry = NULL WHERE id = ?`, u.ID)
+			return err
+		}
+		_, err = q.exec(ctx, `UPDATE users SET access_token = ?, refresh_token = ?, token_expiry = ? WHERE id = ?`,
+			u.Tokens.AccessToken, u.Tokens.RefreshToken, formatTime(u.Tokens.Expiry), u.ID)
+		return err
+	})
+}
+
+func (r userRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.s.conn().exec(ctx, `DELETE FROM users WHERE id = ?`, id)
+	return err
+}
+
+func (r userRepo) List(ctx context.Context, after string, limit int) ([]store.User, error) {
+	return r.list(ctx, `WHERE id > ? ORDER BY id LIMIT ?`, after, limit)
+}
+
+func (r userRepo) ListDeleted(ctx context.Context, before time.Time) ([]store.User, error) {
+	return r.list(ctx, `WHERE deleted_at <> '' AND deleted_at <= ? ORDER BY deleted_at, id`, formatTime(before))
+}
+
+func (r userRepo) list(ctx context.Context, where string, args ...any) ([]store.User, error) {
+	rows, err := r.s.conn().query(ctx, `SELECT `+userColumns+` FROM users `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *u)
+	}
+	return out, rows.Err()
+}
+
+// the tables that stand in for the per-user subcollections
+var userTables = []string{"connections", "period_days", "cycle_settings", "checkins", "pins", "bookmarks", "feedback", "hidden_milestones"}
+
+func (r userRepo) Purge(ctx context.Context, id string) error {
+	return r.s.inTx(ctx, func(q boundQuerier) error {
+		for _, table := range userTables {
+			if _, err := q.exec(ctx, `DELETE FROM `+table+` WHERE user_id = ?`, id); err != nil {
+				return err
+			}
+		}
+		_, err := q.exec(ctx, `DELETE FROM users WHERE id = ?`, id)
+		return err
+	})
+}
+
+// an account that is not deleted has an empty deleted_at
+func formatDeletedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return formatTime(t)
+}
+
+func scanUser(row scanner) (*store.User, error) {
+	var u store.User
+	var accessToken, refreshToken, tokenExpiry sql.NullString
+	var lastLoginAt, createdAt, updatedAt, deletedAt string
+	err := row.Scan(&u.ID, &u.Email, &u.Name, &u.Sex, &u.StartedDating, &accessToken, &refreshToken, &tokenExpiry,
+		&u.ReturningUser, &lastLoginAt, &createdAt, &updatedAt, &deletedAt)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+
+	if accessToken.Valid {
+		u.Tokens = &store.OAuthTokens{
+			AccessToken:  accessToken.String,
+			RefreshToken: refreshToken.String,
+			Expiry:       parseTime(tokenExpiry.String),
+		}
+	}
+	u.LastLoginAt = parseTime(lastLoginAt)
+	u.CreatedAt = parseTime(createdAt)
+	u.UpdatedAt = parseTime(updatedAt)
+	u.DeletedAt = parseTime(deletedAt)
+	return &u, nil
+}
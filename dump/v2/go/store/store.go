@@ -0,0 +1,254 @@
+// Package store defines the repositories the handlers use to read and write data
+// and the models they exchange, independent of the backing database
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by every repo when the requested document does not exist
+var ErrNotFound = errors.New("store: not found")
+
+// Store groups the repositories the handlers use
+// each backend (firestore, memory, sql) provides its own implementation
+type Store interface {
+	Users() UserRepo
+	Connections() ConnectionRepo
+	DDays() DDayRepo
+	Periods() PeriodRepo
+	Checkins() CheckinRepo
+	Pins() PinRepo
+	Ideas() IdeaRepo
+	Roulette() RouletteRepo
+	Feedback() FeedbackRepo
+	Tokens() TokenRepo
+	Feeds() FeedRepo
+	Identities() IdentityRepo
+	LoginTokens() LoginTokenRepo
+	Sessions() SessionRepo
+	Migrations() MigrationRepo
+
+	// Ping checks that the backend is reachable
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// users collection
+type UserRepo interface {
+	Get(ctx context.Context, id string) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// Save creates or updates the user keyed by u.ID
+	// fields that are not part of the model are left untouched, nil Tokens removes the stored ones
+	Save(ctx context.Context, u *User) error
+	Delete(ctx context.Context, id string) error
+	// List returns up to limit users with an ID after the given one, ordered by ID
+	// deleted accounts are included
+	List(ctx context.Context, after string, limit int) ([]User, error)
+	// ListDeleted returns the users deleted at or before the given time, oldest deletion first
+	ListDeleted(ctx context.Context, before time.Time) ([]User, error)
+	// Purge deletes the user with everything stored under them (the per-user subcollections)
+	// it does not fail when the user is already gone
+	Purge(ctx context.Context, id string) error
+}
+
+// per-user connections subcollection
+// every connection is mirrored in both users' subcollections under the same ID
+type ConnectionRepo interface {
+	Get(ctx context.Context, uid, id string) (*Connection, error)
+	List(ctx context.Context, uid string) ([]Connection, error)
+	ListByStatus(ctx context.Context, uid, status string) ([]Connection, error)
+	// Active returns the first active connection, ErrNotFound if there is none
+	Active(ctx context.Context, uid string) (*Connection, error)
+	// FindByPartner returns the connection with the given partner, ErrNotFound if there is none
+	FindByPartner(ctx context.Context, uid, partnerUID string) (*Connection, error)
+
+	// Invite creates the pending connection for both users atomically and returns its ID
+	Invite(ctx context.Context, fromUID, fromEmail, toUID, toEmail string) (string, error)
+	// Accept activates both sides of the connection atomically
+	Accept(ctx context.Context, uid, partnerUID, id string) error
+	// Remove deletes both sides of the connection atomically
+	// if partnerUID is empty only the caller's side is removed
+	Remove(ctx context.Context, uid, partnerUID, id string) error
+	// SetPartnerEmail sets the partnerEmail shown to everyone connected to uid after uid changed their email
+	SetPartnerEmail(ctx context.Context, uid, email string) error
+	// Owners returns the IDs of the users that have connection documents, ordered by ID
+	// it includes users whose own document is gone, for the integrity checks
+	Owners(ctx context.Context) ([]string, error)
+}
+
+// ddays collection
+type DDayRepo interface {
+	Get(ctx context.Context, id string) (*DDay, error)
+	// ListVisible returns the events created by or shared with the user that start
+	// on or before until (YYYYMMDD), plus every annual event the user created
+	ListVisible(ctx context.Context, uid, until string) ([]DDay, error)
+	ListByCreator(ctx context.Context, uid string) ([]DDay, error)
+	// ListPending returns the events with the email in their PendingUsers
+	ListPending(ctx context.Context, email string) ([]DDay, error)
+	// List returns up to limit events with an ID after the given one, ordered by ID
+	List(ctx context.Context, after string, limit int) ([]DDay, error)
+	// Create stores a new event and sets d.ID
+	Create(ctx context.Context, d *DDay) error
+	Update(ctx context.Context, d *DDay) error
+	Delete(ctx context.Context, id string) error
+
+	// the keys of the generated milestones (see package milestone) the user does not want to see
+	HideMilestone(ctx context.Context, uid, key string) error
+	ShowMilestone(ctx context.Context, uid, key string) error
+	ListHiddenMilestones(ctx context.Context, uid string) ([]string, error)
+}
+
+// periodDays and cycleSettings subcollections
+type PeriodRepo interface {
+	ListDays(ctx context.Context, uid string) ([]PeriodDay, error)
+	GetDay(ctx context.Context, uid, date string) (*PeriodDay, error)
+	// SaveDay creates the day when d.ID is empty and overwrites it otherwise
+	SaveDay(ctx context.Context, uid string, d *PeriodDay) error
+	DeleteDay(ctx context.Context, uid, id string) error
+
+	GetSettings(ctx context.Context, uid string) (*CycleSettings, error)
+	// SaveSettings creates the settings when s.ID is empty and overwrites them otherwise
+	SaveSettings(ctx context.Context, uid string, s *CycleSettings) error
+}
+
+// checkins subcollection
+type CheckinRepo interface {
+	// List returns the user's checkins ordered by date
+	List(ctx context.Context, uid string) ([]Checkin, error)
+	GetByDate(ctx context.Context, uid, date string) (*Checkin, error)
+	// Save creates the checkin when ci.ID is empty and overwrites it otherwise
+	Save(ctx context.Context, uid string, ci *Checkin) error
+	Delete(ctx context.Context, uid, id string) error
+}
+
+// pins subcollection
+type PinRepo interface {
+	// List returns the pins newest first
+	List(ctx context.Context, uid string) ([]Pin, error)
+	Create(ctx context.Context, uid string, p *Pin) error
+	Update(ctx context.Context, uid string, p *Pin) error
+	Delete(ctx context.Context, uid, id string) error
+}
+
+// ideas collection with the posts, comments and bookmarks mirrors on the user
+type IdeaRepo interface {
+	List(ctx context.Context) ([]Idea, error)
+	// ListByAuthor returns the posts in the user's posts subcollection
+	ListByAuthor(ctx context.Context, uid string) ([]Idea, error)
+	Create(ctx context.Context, uid string, idea *Idea) error
+	// Update overwrites the title, description and tags of the post
+	Update(ctx context.Context, idea *Idea) error
+	Delete(ctx context.Context, uid, id string) error
+
+	ListComments(ctx context.Context, postID string) ([]Comment, error)
+	AddComment(ctx context.Context, uid, postID string, cm *Comment) error
+	UpdateComment(ctx context.Context, postID string, cm *Comment) error
+	DeleteComment(ctx context.Context, uid, postID, commentID string) error
+	// ListCommentsByUser returns the comments the user wrote, on any post
+	ListCommentsByUser(ctx context.Context, uid string) ([]Comment, error)
+	// DeleteCommentsByUser removes every comment the user wrote, on any post
+	DeleteCommentsByUser(ctx context.Context, uid string) error
+	// Author returns the ID of the user who wrote the post, ErrNotFound if no user has it
+	Author(ctx context.Context, postID string) (string, error)
+	// CommentAuthor returns the ID of the user who wrote the comment, ErrNotFound if no user has it
+	CommentAuthor(ctx context.Context, postID, commentID string) (string, error)
+
+	// AddLikes increments (or decrements with a negative delta) the like counter
+	AddLikes(ctx context.Context, uid, postID string, delta int) error
+
+	Bookmark(ctx context.Context, uid, postID string) error
+	Unbookmark(ctx context.Context, uid, postID string) error
+	ListBookmarks(ctx context.Context, uid string) ([]string, error)
+}
+
+// roulette collection
+type RouletteRepo interface {
+	List(ctx context.Context) ([]Roulette, error)
+	Create(ctx context.Context, r *Roulette) error
+	Update(ctx context.Context, r *Roulette) error
+	Delete(ctx context.Context, id string) error
+}
+
+// feedback subcollection
+type FeedbackRepo interface {
+	Create(ctx context.Context, uid string, f *Feedback) error
+	// ListByUser returns the feedback oldest first
+	ListByUser(ctx context.Context, uid string) ([]Feedback, error)
+	// List returns the feedback of every user oldest first, with UserID set
+	List(ctx context.Context) ([]Feedback, error)
+	// SetAdminComment answers the feedback, ErrNotFound if the user has no feedback with that ID
+	SetAdminComment(ctx context.Context, uid, id, comment string) error
+}
+
+// apiTokens collection, kept top level so a token can be found by its hash alone
+type TokenRepo interface {
+	// GetByHash returns the token whose secret hashes to hash, ErrNotFound if there is none
+	GetByHash(ctx context.Context, hash string) (*APIToken, error)
+	// ListByUser returns the user's tokens oldest first
+	ListByUser(ctx context.Context, uid string) ([]APIToken, error)
+	// Create stores a new token and sets t.ID
+	Create(ctx context.Context, t *APIToken) error
+	// Delete fails with ErrNotFound if the user has no token with that ID
+	Delete(ctx context.Context, uid, id string) error
+	MarkUsed(ctx context.Context, id string, at time.Time) error
+}
+
+// feeds collection, keyed by user so every user has at most one calendar feed
+type FeedRepo interface {
+	// Get returns the user's feed, ErrNotFound if they have none
+	Get(ctx context.Context, uid string) (*Feed, error)
+	// GetByHash returns the feed whose secret hashes to hash, ErrNotFound if there is none
+	GetByHash(ctx context.Context, hash string) (*Feed, error)
+	// Save creates or replaces the feed keyed by f.UserID, replacing it retires the old secret
+	Save(ctx context.Context, f *Feed) error
+	// Delete does not fail when the user has no feed
+	Delete(ctx context.Context, uid string) error
+}
+
+// identities collection, the external accounts a user signs in with
+type IdentityRepo interface {
+	// Get returns the identity for a provider's subject, ErrNotFound if it is not linked
+	Get(ctx context.Context, provider, subject string) (*Identity, error)
+	// ListByUser returns the user's identities oldest first
+	ListByUser(ctx context.Context, uid string) ([]Identity, error)
+	// Link creates or replaces the identity keyed by provider and subject
+	Link(ctx context.Context, id *Identity) error
+	// Unlink fails with ErrNotFound if the identity is not linked to the user
+	Unlink(ctx context.Context, uid, provider, subject string) error
+}
+
+// loginTokens collection, single use links sent by email
+type LoginTokenRepo interface {
+	Create(ctx context.Context, t *LoginToken) error
+	// Consume deletes the token and returns it, ErrNotFound if there is no token
+	// with that hash for purpose, so every token works at most once
+	Consume(ctx context.Context, purpose, hash string) (*LoginToken, error)
+}
+
+// sessions collection, the server side of the session cookies
+type SessionRepo interface {
+	// Get returns the session even when it expired, ErrNotFound if there is none
+	Get(ctx context.Context, id string) (*Session, error)
+	// ListByUser returns the user's sessions, expired ones included, most recently seen first
+	ListByUser(ctx context.Context, uid string) ([]Session, error)
+	// Save creates or replaces the session keyed by s.ID
+	Save(ctx context.Context, s *Session) error
+	// Delete does not fail when the session is already gone
+	Delete(ctx context.Context, id string) error
+	// DeleteByUser removes every session of the user except keepID, which may be empty
+	DeleteByUser(ctx context.Context, uid, keepID string) error
+	// DeleteExpired removes the sessions that expired before now and returns how many there were
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// migrations collection, the data migrations that ran, see the migrate package
+type MigrationRepo interface {
+	// Get returns the recorded run, ErrNotFound if the migration never ran
+	Get(ctx context.Context, name string) (*MigrationRun, error)
+	// List returns every recorded run ordered by name
+	List(ctx context.Context) ([]MigrationRun, error)
+	// Save creates or replaces the run keyed by r.Name
+	Save(ctx context.Context, r *MigrationRun) error
+}
@@ -1,5 +1,10 @@
 package util
 
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
 type StringSlice []string
 
 func Contains(slice []string, s string) bool {
@@ -82,3 +87,12 @@ func GetMapKeys(data map[string]interface{}) []string {
 	}
 	return keys
 }
+
+// RandomToken returns n random bytes as unpadded base64url, for secrets and state values
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}